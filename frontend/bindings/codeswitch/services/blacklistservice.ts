@@ -89,10 +89,10 @@ export function ManualUnblockAndReset(platform: string, providerName: string): $
 }
 
 /**
- * RecordFailure 记录 provider 失败，连续失败次数达到阈值时自动拉黑（支持等级拉黑）
+ * RecordFailure 记录 provider 失败，连续失败次数达到阈值时自动拉黑（支持等级拉黑），reason 写入事件时间线
  */
-export function RecordFailure(platform: string, providerName: string): $CancellablePromise<void> {
-    return $Call.ByID(640211172, platform, providerName);
+export function RecordFailure(platform: string, providerName: string, reason: string): $CancellablePromise<void> {
+    return $Call.ByID(640211172, platform, providerName, reason);
 }
 
 /**
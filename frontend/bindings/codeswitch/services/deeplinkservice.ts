@@ -16,9 +16,10 @@ import * as $models from "./models.js";
 
 /**
  * ImportProviderFromDeepLink 从深度链接导入供应商
+ * 接收原始链接而非解析结果，以便按信任配置校验签名（开启强制签名时拒绝未签名链接）
  */
-export function ImportProviderFromDeepLink(request: $models.DeepLinkImportRequest | null): $CancellablePromise<string> {
-    return $Call.ByID(2087032230, request);
+export function ImportProviderFromDeepLink(urlStr: string): $CancellablePromise<string> {
+    return $Call.ByID(2087032230, urlStr);
 }
 
 /**
@@ -120,10 +120,13 @@ func main() {
 	blacklistService := services.NewBlacklistService(settingsService, notificationService)
 	geminiService := services.NewGeminiService("127.0.0.1:18100")
 	providerRelay := services.NewProviderRelayService(providerService, geminiService, blacklistService, notificationService, ":18100")
+	budgetService := services.NewBudgetService(notificationService) // 预算与消费上限
+	providerRelay.SetBudgetService(budgetService)
 	claudeSettings := services.NewClaudeSettingsService(providerRelay.Addr())
 	codexSettings := services.NewCodexSettingsService(providerRelay.Addr())
 	cliConfigService := services.NewCliConfigService(providerRelay.Addr())
 	logService := services.NewLogService(appSettings)
+	budgetService.SetLogService(logService)
 	updateService := services.NewUpdateService(AppVersion)
 	mcpService := services.NewMCPService()
 	skillService := services.NewSkillService()
@@ -134,6 +137,9 @@ func main() {
 	speedTestService := services.NewSpeedTestService()
 	connectivityTestService := services.NewConnectivityTestService(providerService, blacklistService, settingsService)
 	healthCheckService := services.NewHealthCheckService(providerService, blacklistService, settingsService)
+	blacklistService.SetCircuitProber(healthCheckService.ProbeProvider)
+	providerRelay.SetPassiveHealthRecorder(healthCheckService.RecordPassiveOutcome)
+	providerRelay.SetStatusPageSources(healthCheckService, appSettings)
 	// 初始化健康检查数据库表
 	if err := healthCheckService.Start(); err != nil {
 		log.Fatalf("初始化健康检查服务失败: %v", err)
@@ -142,7 +148,25 @@ func main() {
 	versionService := NewVersionService()
 	consoleService := services.NewConsoleService()
 	customCliService := services.NewCustomCliService(providerRelay.Addr())
+	healthCheckService.SetGeminiService(geminiService)
+	healthCheckService.SetCustomCliService(customCliService)
 	networkService := services.NewNetworkService(providerRelay.Addr(), claudeSettings, codexSettings, geminiService)
+	secretVaultService := services.NewSecretVaultService(providerService, geminiService, customCliService)
+	// 口令模式的密钥库启动时处于锁定状态，解锁后重新加载 Gemini 配置并启动中转服务
+	secretVaultService.OnUnlock(func() {
+		if err := geminiService.ReloadProviders(); err != nil {
+			log.Printf("重新加载 Gemini 供应商失败: %v", err)
+		}
+		if err := providerRelay.Start(); err != nil {
+			log.Printf("provider relay start error: %v", err)
+		}
+	})
+	providerRenameService := services.NewProviderRenameService(providerService, geminiService, blacklistService, healthCheckService, providerRelay, budgetService, logService)
+	workspaceService := services.NewWorkspaceService(providerService, geminiService, mcpService, promptService, skillService, customCliService, settingsService, appSettings)
+	deeplinkService.SetWorkspaceService(workspaceService)
+	configSyncService := services.NewConfigSyncService(workspaceService)
+	providerCatalogService := services.NewProviderCatalogService(providerService, geminiService, logService)
+	modelDiscoveryService := services.NewModelDiscoveryService(providerService, geminiService)
 
 	// 应用待处理的更新
 	go func() {
@@ -209,6 +233,15 @@ func main() {
 		}
 	}()
 
+	// 启动配置同步定时器（未启用同步时不做任何事）
+	go func() {
+		time.Sleep(5 * time.Second) // 延迟5秒，等待中转服务与密钥库就绪
+		configSyncService.StartAutoSync()
+	}()
+
+	// 供应商目录缓存过期时后台刷新
+	go providerCatalogService.RefreshIfStale()
+
 	//fmt.Println(clipboardService)
 	// Create a new Wails application by providing the necessary options.
 	// Variables 'Name' and 'Description' are for application metadata.
@@ -228,6 +261,7 @@ func main() {
 			application.NewService(codexSettings),
 			application.NewService(cliConfigService),
 			application.NewService(logService),
+			application.NewService(budgetService),
 			application.NewService(appSettings),
 			application.NewService(updateService),
 			application.NewService(mcpService),
@@ -245,6 +279,12 @@ func main() {
 			application.NewService(consoleService),
 			application.NewService(customCliService),
 			application.NewService(networkService),
+			application.NewService(secretVaultService),
+			application.NewService(providerRenameService),
+			application.NewService(workspaceService),
+			application.NewService(configSyncService),
+			application.NewService(providerCatalogService),
+			application.NewService(modelDiscoveryService),
 		},
 		Assets: application.AssetOptions{
 			Handler: application.AssetFileServerFS(assets),
@@ -266,6 +306,7 @@ func main() {
 		// 2. 停止健康检查轮询
 		healthCheckService.StopBackgroundPolling()
 		log.Println("✅ 健康检查服务已停止")
+		configSyncService.StopAutoSync()
 
 		// 3. 停止更新定时器
 		updateService.StopDailyCheck()
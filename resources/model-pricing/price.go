@@ -48,6 +48,8 @@ type UsageSnapshot struct {
 	CacheCreateTokens int
 	CacheReadTokens   int
 	CacheCreation     *CacheCreationDetail
+	// Requests 用量对应的请求数（汇总多次请求时使用），长上下文档位按单次平均输入判断
+	Requests int
 }
 
 // CacheCreationDetail 细分缓存创建 tokens。
@@ -135,9 +137,47 @@ func (s *Service) CalculateCost(model string, usage UsageSnapshot) CostBreakdown
 	if usage.ReasoningTokens > 0 && entry.OutputCostPerReasoningToken > 0 {
 		breakdown.ReasoningCost = float64(usage.ReasoningTokens) * entry.OutputCostPerReasoningToken
 	}
+	applyCacheCost(&breakdown, entry, usage, s.getEphemeral1hPricing(model))
+	return breakdown
+}
+
+// CalculateCostWithEntry 使用给定单价（美元/token）计算费用，用于自定义价格表与供应商价格覆盖。
+func CalculateCostWithEntry(entry PricingEntry, usage UsageSnapshot) CostBreakdown {
+	ensureCachePricing(&entry)
+	breakdown := CostBreakdown{HasPricing: true}
+	breakdown.InputCost = float64(usage.InputTokens) * entry.InputCostPerToken
+	breakdown.OutputCost = float64(usage.OutputTokens) * entry.OutputCostPerToken
+	if usage.ReasoningTokens > 0 && entry.OutputCostPerReasoningToken > 0 {
+		breakdown.ReasoningCost = float64(usage.ReasoningTokens) * entry.OutputCostPerReasoningToken
+	}
+	cache1hPrice := entry.CacheCreationInputTokenCostAbove1Hr
+	if cache1hPrice == 0 {
+		cache1hPrice = entry.CacheCreationInputTokenCost
+	}
+	applyCacheCost(&breakdown, &entry, usage, cache1hPrice)
+	return breakdown
+}
+
+// Scale 按倍率缩放所有费用字段（供应商倍率、汇率换算）。
+func (b CostBreakdown) Scale(factor float64) CostBreakdown {
+	if factor == 1 {
+		return b
+	}
+	b.InputCost *= factor
+	b.OutputCost *= factor
+	b.ReasoningCost *= factor
+	b.CacheCreateCost *= factor
+	b.CacheReadCost *= factor
+	b.Ephemeral5mCost *= factor
+	b.Ephemeral1hCost *= factor
+	b.TotalCost *= factor
+	return b
+}
+
+func applyCacheCost(breakdown *CostBreakdown, entry *PricingEntry, usage UsageSnapshot, cache1hPrice float64) {
 	cacheCreateTokens, cache1hTokens := resolveCacheTokens(usage)
 	cache5mCost := float64(cacheCreateTokens) * entry.CacheCreationInputTokenCost
-	cache1hCost := float64(cache1hTokens) * s.getEphemeral1hPricing(model)
+	cache1hCost := float64(cache1hTokens) * cache1hPrice
 	breakdown.Ephemeral5mCost = cache5mCost
 	breakdown.Ephemeral1hCost = cache1hCost
 	breakdown.CacheCreateCost = cache5mCost + cache1hCost
@@ -146,7 +186,6 @@ func (s *Service) CalculateCost(model string, usage UsageSnapshot) CostBreakdown
 	if breakdown.TotalCost > 0 {
 		breakdown.HasPricing = true
 	}
-	return breakdown
 }
 
 func (s *Service) getPricing(model string) (*PricingEntry, bool) {
@@ -184,6 +223,9 @@ func (s *Service) getPricing(model string) (*PricingEntry, bool) {
 
 func (s *Service) longContextTier(model string, usage UsageSnapshot) (LongContextPricing, bool) {
 	totalInput := usage.InputTokens + usage.CacheCreateTokens + usage.CacheReadTokens
+	if usage.Requests > 1 {
+		totalInput /= usage.Requests
+	}
 	if strings.Contains(strings.ToLower(model), "[1m]") && totalInput > 200000 && len(s.longContexts) > 0 {
 		if tier, ok := s.longContexts[model]; ok {
 			return tier, true
@@ -30,6 +30,9 @@ type AppSettings struct {
 	UserAgent            string `json:"user_agent"`           // 全局 User-Agent
 	LogRetentionEnabled  bool   `json:"log_retention_enabled"`
 	LogRetentionDays     int    `json:"log_retention_days"`
+	RollupRetentionDays  int    `json:"rollup_retention_days"` // 小时汇总保留天数，0 表示永久保留
+	StatusPageEnabled    bool   `json:"status_page_enabled"`   // 中转服务提供只读状态页 /status
+	StatusPageToken      string `json:"status_page_token"`     // 状态页访问令牌，为空时仅允许本机访问
 }
 
 type AppSettingsService struct {
@@ -238,6 +241,12 @@ func normalizeLogRetentionSettings(settings *AppSettings) {
 	if settings == nil {
 		return
 	}
+	if settings.RollupRetentionDays < 0 {
+		settings.RollupRetentionDays = 0
+	}
+	if settings.RollupRetentionDays > maxLogRetentionDays {
+		settings.RollupRetentionDays = maxLogRetentionDays
+	}
 	if settings.LogRetentionDays <= 0 {
 		settings.LogRetentionDays = defaultLogRetentionDays
 		return
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 熔断状态：closed（正常）→ open（拉黑中）→ half_open（到期后试探）→ closed / open
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+// halfOpenTrialRetrySeconds 半开试探名额已满时，提示调用方的重试间隔
+const halfOpenTrialRetrySeconds = 5
+
+// CircuitProber 合成探测函数（由 HealthCheckService 提供），返回探测是否成功
+type CircuitProber func(platform string, providerName string) (bool, error)
+
+// halfOpenTrial 半开 provider 的内存试探状态
+type halfOpenTrial struct {
+	InFlight  int
+	MaxTrials int
+}
+
+// SetCircuitProber 设置进入半开状态时使用的合成探测函数
+func (bs *BlacklistService) SetCircuitProber(prober CircuitProber) {
+	bs.circuitMu.Lock()
+	bs.circuitProber = prober
+	bs.circuitMu.Unlock()
+}
+
+// BeginTrial 转发请求前调用：若 provider（或该模型）处于半开状态则占用一个试探名额，返回释放函数。
+// 名额检查与占用在同一临界区内完成，名额已满时返回 false（调用方应跳过该 provider）
+func (bs *BlacklistService) BeginTrial(platform string, providerName string, model string) (func(), bool) {
+	if bs == nil {
+		return func() {}, true
+	}
+	keys := []string{circuitKey(platform, providerName, "")}
+	if model = strings.TrimSpace(model); model != "" {
+		keys = append(keys, circuitKey(platform, providerName, model))
+	}
+
+	bs.circuitMu.Lock()
+	trials := make([]*halfOpenTrial, 0, len(keys))
+	trialKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		trial := bs.halfOpenTrials[key]
+		if trial == nil {
+			continue
+		}
+		if trial.InFlight >= trial.MaxTrials {
+			bs.circuitMu.Unlock()
+			return nil, false
+		}
+		trials = append(trials, trial)
+		trialKeys = append(trialKeys, key)
+	}
+	for _, trial := range trials {
+		trial.InFlight++
+	}
+	bs.circuitMu.Unlock()
+
+	released := false
+	return func() {
+		bs.circuitMu.Lock()
+		defer bs.circuitMu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		for i, trial := range trials {
+			if current := bs.halfOpenTrials[trialKeys[i]]; current == trial && trial.InFlight > 0 {
+				trial.InFlight--
+			}
+		}
+	}, true
+}
+
+// allowHalfOpenTrial 半开 provider 的试探名额预检查（只登记名额上限，不占用；占用由 BeginTrial 完成）
+func (bs *BlacklistService) allowHalfOpenTrial(platform string, providerName string, model string, maxTrials int) bool {
+	key := circuitKey(platform, providerName, model)
+	bs.circuitMu.Lock()
+	defer bs.circuitMu.Unlock()
+	trial := bs.halfOpenTrials[key]
+	if trial == nil {
+		trial = &halfOpenTrial{}
+		bs.halfOpenTrials[key] = trial
+	}
+	trial.MaxTrials = maxTrials
+	return trial.InFlight < maxTrials
+}
+
+// forgetHalfOpenTrial 离开半开状态时清理内存试探状态
+func (bs *BlacklistService) forgetHalfOpenTrial(platform string, providerName string, model string) {
+	bs.circuitMu.Lock()
+	delete(bs.halfOpenTrials, circuitKey(platform, providerName, model))
+	bs.circuitMu.Unlock()
+}
+
+// loadCircuitState 读取 provider 的熔断状态（已过期但尚未被定时器处理的 open 视为 half_open）
+func (bs *BlacklistService) loadCircuitState(platform string, providerName string, model string, levelConfig *BlacklistLevelConfig) string {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return CircuitStateClosed
+	}
+	var state sql.NullString
+	var blacklistedUntil sql.NullTime
+	err = db.QueryRow(`
+		SELECT circuit_state, blacklisted_until
+		FROM provider_blacklist
+		WHERE platform = ? AND provider_name = ? AND model = ?
+	`, platform, providerName, model).Scan(&state, &blacklistedUntil)
+	if err != nil {
+		return CircuitStateClosed
+	}
+	return effectiveCircuitState(state.String, blacklistedUntil, time.Now(), levelConfig)
+}
+
+// effectiveCircuitState 结合拉黑到期时间计算当前生效的熔断状态
+func effectiveCircuitState(state string, blacklistedUntil sql.NullTime, now time.Time, levelConfig *BlacklistLevelConfig) string {
+	if blacklistedUntil.Valid && blacklistedUntil.Time.After(now) {
+		return CircuitStateOpen
+	}
+	if levelConfig != nil && levelConfig.HalfOpenDisabled {
+		return CircuitStateClosed
+	}
+	switch state {
+	case CircuitStateOpen, CircuitStateHalfOpen:
+		return CircuitStateHalfOpen
+	default:
+		return CircuitStateClosed
+	}
+}
+
+// recordHalfOpenSuccess 半开状态下记录一次成功，达到阈值后关闭熔断
+func (bs *BlacklistService) recordHalfOpenSuccess(id int, platform string, providerName string, model string, successes int, levelConfig *BlacklistLevelConfig) error {
+	subject := blacklistSubject(providerName, model)
+	successes++
+	threshold := halfOpenSuccessThreshold(levelConfig)
+	if successes < threshold {
+		if err := GlobalDBQueue.Exec(`
+			UPDATE provider_blacklist
+			SET half_open_successes = ?, circuit_state = ?
+			WHERE id = ?
+		`, successes, CircuitStateHalfOpen, id); err != nil {
+			return fmt.Errorf("更新半开成功次数失败: %w", err)
+		}
+		log.Printf("🟡 Provider %s/%s 半开试探成功 %d/%d", platform, subject, successes, threshold)
+		return nil
+	}
+
+	if err := GlobalDBQueue.Exec(`
+		UPDATE provider_blacklist
+		SET half_open_successes = 0, circuit_state = ?, circuit_changed_at = ?
+		WHERE id = ?
+	`, CircuitStateClosed, time.Now(), id); err != nil {
+		return fmt.Errorf("关闭熔断失败: %w", err)
+	}
+	bs.forgetHalfOpenTrial(platform, providerName, model)
+	log.Printf("🟢 Provider %s/%s 半开试探成功 %d 次，熔断关闭，恢复全量流量", platform, subject, successes)
+	recordProviderEvent(ProviderEvent{
+		Platform:     platform,
+		ProviderName: providerName,
+		Model:        model,
+		EventType:    ProviderEventCircuitClosed,
+		Reason:       fmt.Sprintf("半开试探连续成功 %d 次", successes),
+	})
+	bs.emitCircuitState(platform, providerName, model, CircuitStateHalfOpen, CircuitStateClosed)
+	return nil
+}
+
+// recordProviderHalfOpenSuccess 按模型拉黑时，模型请求成功同样计入 provider 级半开试探，
+// 否则由健康检查 / 合成探测产生的 provider 级熔断只能等探测成功才能关闭
+func (bs *BlacklistService) recordProviderHalfOpenSuccess(db *sql.DB, platform string, providerName string, levelConfig *BlacklistLevelConfig) error {
+	var id int
+	var blacklistedUntil sql.NullTime
+	var circuitState sql.NullString
+	var halfOpenSuccesses sql.NullInt64
+	err := db.QueryRow(`
+		SELECT id, blacklisted_until, circuit_state, half_open_successes
+		FROM provider_blacklist
+		WHERE platform = ? AND provider_name = ? AND model = ''
+	`, platform, providerName).Scan(&id, &blacklistedUntil, &circuitState, &halfOpenSuccesses)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("查询黑名单记录失败: %w", err)
+	}
+	if effectiveCircuitState(circuitState.String, blacklistedUntil, time.Now(), levelConfig) != CircuitStateHalfOpen {
+		return nil
+	}
+	return bs.recordHalfOpenSuccess(id, platform, providerName, "", int(halfOpenSuccesses.Int64), levelConfig)
+}
+
+// markCircuitOpened 拉黑生效后调用：清理半开状态并通知前端
+func (bs *BlacklistService) markCircuitOpened(platform string, providerName string, model string, fromState string) {
+	bs.forgetHalfOpenTrial(platform, providerName, model)
+	if fromState == CircuitStateHalfOpen {
+		log.Printf("🔴 Provider %s/%s 半开试探失败，重新熔断", platform, blacklistSubject(providerName, model))
+	}
+	bs.emitCircuitState(platform, providerName, model, fromState, CircuitStateOpen)
+}
+
+// startHalfOpenProbe 进入半开状态后异步发送一次合成探测请求，结果按普通成功/失败记录
+func (bs *BlacklistService) startHalfOpenProbe(platform string, providerName string, levelConfig *BlacklistLevelConfig) {
+	if levelConfig.HalfOpenProbeDisabled {
+		return
+	}
+	bs.circuitMu.Lock()
+	prober := bs.circuitProber
+	bs.circuitMu.Unlock()
+	if prober == nil {
+		return
+	}
+
+	go func() {
+		release, acquired := bs.BeginTrial(platform, providerName, "")
+		if !acquired {
+			return // 真实流量已占满试探名额，由其结果决定熔断状态
+		}
+		ok, err := prober(platform, providerName)
+		release()
+		if err != nil {
+			log.Printf("⚠️  Provider %s/%s 半开探测未执行: %v", platform, providerName, err)
+			return
+		}
+		if ok {
+			if err := bs.RecordSuccess(platform, providerName); err != nil {
+				log.Printf("⚠️  记录半开探测成功失败: %v", err)
+			}
+			return
+		}
+		if err := bs.RecordFailure(platform, providerName, "半开试探请求失败"); err != nil {
+			log.Printf("⚠️  记录半开探测失败失败: %v", err)
+		}
+	}()
+}
+
+func (bs *BlacklistService) emitCircuitState(platform string, providerName string, model string, from string, to string) {
+	if bs.notificationService != nil {
+		bs.notificationService.NotifyCircuitStateChanged(platform, providerName, model, from, to)
+	}
+}
+
+func halfOpenMaxTrials(levelConfig *BlacklistLevelConfig) int {
+	if levelConfig == nil || levelConfig.HalfOpenMaxTrials <= 0 {
+		return 1
+	}
+	return levelConfig.HalfOpenMaxTrials
+}
+
+func halfOpenSuccessThreshold(levelConfig *BlacklistLevelConfig) int {
+	if levelConfig == nil || levelConfig.HalfOpenSuccessThreshold <= 0 {
+		return 2
+	}
+	return levelConfig.HalfOpenSuccessThreshold
+}
+
+func circuitKey(platform string, providerName string, model string) string {
+	if model == "" {
+		return platform + ":" + providerName
+	}
+	return platform + ":" + providerName + ":" + model
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEffectiveCircuitState(t *testing.T) {
+	now := time.Now()
+	future := sql.NullTime{Time: now.Add(time.Minute), Valid: true}
+	past := sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+	cfg := DefaultBlacklistLevelConfig()
+
+	if got := effectiveCircuitState(CircuitStateClosed, future, now, cfg); got != CircuitStateOpen {
+		t.Fatalf("unexpired blacklist = %s, want open", got)
+	}
+	if got := effectiveCircuitState(CircuitStateOpen, past, now, cfg); got != CircuitStateHalfOpen {
+		t.Fatalf("expired open = %s, want half_open", got)
+	}
+	if got := effectiveCircuitState(CircuitStateClosed, past, now, cfg); got != CircuitStateClosed {
+		t.Fatalf("closed = %s, want closed", got)
+	}
+
+	cfg.HalfOpenDisabled = true
+	if got := effectiveCircuitState(CircuitStateHalfOpen, past, now, cfg); got != CircuitStateClosed {
+		t.Fatalf("half-open disabled = %s, want closed", got)
+	}
+}
+
+func TestHalfOpenTrialGating(t *testing.T) {
+	bs := NewBlacklistService(nil, nil)
+
+	// 未处于半开状态时不占用名额
+	release, ok := bs.BeginTrial("claude", "idle", "")
+	if !ok {
+		t.Fatalf("provider outside half-open should always be allowed")
+	}
+	release()
+
+	if !bs.allowHalfOpenTrial("claude", "a", "", 1) {
+		t.Fatalf("first trial should be allowed")
+	}
+	release, ok = bs.BeginTrial("claude", "a", "")
+	if !ok {
+		t.Fatalf("first trial should reserve a slot")
+	}
+	if _, ok := bs.BeginTrial("claude", "a", ""); ok {
+		t.Fatalf("second concurrent trial should be refused")
+	}
+	if bs.allowHalfOpenTrial("claude", "a", "", 1) {
+		t.Fatalf("pre-check should see the reserved slot")
+	}
+	release()
+	release()
+	if !bs.allowHalfOpenTrial("claude", "a", "", 1) {
+		t.Fatalf("trial slot should be released")
+	}
+
+	if halfOpenMaxTrials(&BlacklistLevelConfig{}) != 1 || halfOpenSuccessThreshold(&BlacklistLevelConfig{}) != 2 {
+		t.Fatalf("unexpected half-open defaults")
+	}
+}
+
+func TestHalfOpenTrialGating_Concurrent(t *testing.T) {
+	bs := NewBlacklistService(nil, nil)
+	const maxTrials = 2
+	bs.allowHalfOpenTrial("claude", "a", "", maxTrials)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	releases := make([]func(), 0)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			// 所有请求都通过了预检查后再占用名额
+			bs.allowHalfOpenTrial("claude", "a", "", maxTrials)
+			if release, ok := bs.BeginTrial("claude", "a", "opus"); ok {
+				mu.Lock()
+				releases = append(releases, release)
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if len(releases) != maxTrials {
+		t.Fatalf("reserved %d trials, want %d", len(releases), maxTrials)
+	}
+	for _, release := range releases {
+		release()
+	}
+	if _, ok := bs.BeginTrial("claude", "a", ""); !ok {
+		t.Fatalf("slots should be free after release")
+	}
+}
+
+func TestBlacklistModelScope(t *testing.T) {
+	cfg := DefaultBlacklistLevelConfig()
+	if got := blacklistModelScope(cfg, "opus"); got != "" {
+		t.Fatalf("per-model disabled should use provider scope, got %q", got)
+	}
+	cfg.PerModelBlacklist = true
+	if got := blacklistModelScope(cfg, " opus "); got != "opus" {
+		t.Fatalf("scope = %q, want opus", got)
+	}
+	if circuitKey("claude", "a", "") == circuitKey("claude", "a", "opus") {
+		t.Fatalf("model-scoped key should differ from provider key")
+	}
+	if got := blacklistSubject("a", "opus"); got != "a[opus]" {
+		t.Fatalf("subject = %q", got)
+	}
+}
+
+func TestModelSuccessClosesProviderHalfOpen(t *testing.T) {
+	db := useTestDatabase(t)
+	settings := NewSettingsService()
+	bs := NewBlacklistService(settings, nil)
+	cfg := DefaultBlacklistLevelConfig()
+	cfg.PerModelBlacklist = true
+	if err := settings.SaveBlacklistLevelConfig(cfg); err != nil {
+		t.Fatalf("save level config: %v", err)
+	}
+
+	// 健康检查产生的 provider 级熔断已到期，进入半开
+	if _, err := db.Exec(`
+		INSERT INTO provider_blacklist (platform, provider_name, model, failure_count, blacklisted_until, circuit_state)
+		VALUES ('claude', 'a', '', 3, ?, ?)
+	`, time.Now().Add(-time.Minute), CircuitStateOpen); err != nil {
+		t.Fatalf("insert blacklist row: %v", err)
+	}
+	for i := 0; i < halfOpenSuccessThreshold(cfg); i++ {
+		if err := bs.RecordModelSuccess("claude", "a", "opus"); err != nil {
+			t.Fatalf("record model success: %v", err)
+		}
+	}
+	var state string
+	if err := db.QueryRow(`SELECT circuit_state FROM provider_blacklist WHERE platform = 'claude' AND provider_name = 'a' AND model = ''`).Scan(&state); err != nil {
+		t.Fatalf("query circuit state: %v", err)
+	}
+	if state != CircuitStateClosed {
+		t.Fatalf("provider circuit = %s, want closed after model successes", state)
+	}
+}
+
+func TestBlacklistScopeSwitchClearsOldScopeRows(t *testing.T) {
+	db := useTestDatabase(t)
+	settings := NewSettingsService()
+	bs := NewBlacklistService(settings, nil)
+	until := time.Now().Add(time.Hour)
+	for _, model := range []string{"", "opus"} {
+		if _, err := db.Exec(`
+			INSERT INTO provider_blacklist (platform, provider_name, model, failure_count, blacklisted_until, circuit_state)
+			VALUES ('claude', 'a', ?, 3, ?, ?)
+		`, model, until, CircuitStateOpen); err != nil {
+			t.Fatalf("insert blacklist row: %v", err)
+		}
+	}
+	bs.allowHalfOpenTrial("claude", "a", "", 1)
+	blacklistRows := func(condition string) int {
+		t.Helper()
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM provider_blacklist WHERE ` + condition).Scan(&count); err != nil {
+			t.Fatalf("count rows: %v", err)
+		}
+		return count
+	}
+
+	// 切到按模型拉黑：provider 级记录不再拉黑整个 provider
+	cfg := DefaultBlacklistLevelConfig()
+	cfg.PerModelBlacklist = true
+	if err := settings.SaveBlacklistLevelConfig(cfg); err != nil {
+		t.Fatalf("save level config: %v", err)
+	}
+	if blacklistRows("model = ''") != 0 || blacklistRows("model = 'opus'") != 1 || len(bs.halfOpenTrials) != 0 {
+		t.Fatalf("switching to per-model should clear provider-level rows and trials")
+	}
+	if blacklisted, _ := bs.IsModelBlacklisted("claude", "a", "sonnet"); blacklisted {
+		t.Fatalf("other models should stay available after the switch")
+	}
+
+	// 未切换维度时保存配置不清理
+	if err := settings.SaveBlacklistLevelConfig(cfg); err != nil {
+		t.Fatalf("save level config: %v", err)
+	}
+	if blacklistRows("model = 'opus'") != 1 {
+		t.Fatalf("saving without a scope change should keep rows")
+	}
+
+	cfg.PerModelBlacklist = false
+	if err := settings.SaveBlacklistLevelConfig(cfg); err != nil {
+		t.Fatalf("save level config: %v", err)
+	}
+	if blacklistRows("1 = 1") != 0 {
+		t.Fatalf("switching back to provider scope should clear model-level rows")
+	}
+}
@@ -24,12 +24,47 @@ func GetBlacklistLevelConfigPath() (string, error) {
 }
 
 // GetBlacklistLevelConfig 获取等级拉黑配置
-// 【修复】开关状态从数据库读取，其他配置从 JSON 文件读取
+// 转发链路每个请求都会读取，结果缓存在内存中；通过 SettingsService 保存相关配置时失效
+// 返回副本，调用方修改不影响缓存
 func (ss *SettingsService) GetBlacklistLevelConfig() (*BlacklistLevelConfig, error) {
-	configPath, err := GetBlacklistLevelConfigPath()
+	ss.levelConfigMu.Lock()
+	cached, epoch := ss.levelConfig, ss.levelConfigEpoch
+	ss.levelConfigMu.Unlock()
+	if cached != nil {
+		copied := *cached
+		return &copied, nil
+	}
+
+	config, cacheable, err := ss.loadBlacklistLevelConfig()
 	if err != nil {
 		return nil, err
 	}
+	if cacheable {
+		copied := *config
+		ss.levelConfigMu.Lock()
+		if ss.levelConfigEpoch == epoch {
+			ss.levelConfig = &copied
+		}
+		ss.levelConfigMu.Unlock()
+	}
+	return config, nil
+}
+
+// invalidateBlacklistLevelConfig 等级拉黑配置（JSON 文件或数据库中的开关 / 阈值）变更后清除缓存
+func (ss *SettingsService) invalidateBlacklistLevelConfig() {
+	ss.levelConfigMu.Lock()
+	ss.levelConfig = nil
+	ss.levelConfigEpoch++
+	ss.levelConfigMu.Unlock()
+}
+
+// loadBlacklistLevelConfig 读取等级拉黑配置，数据库不可用时结果不缓存
+// 【修复】开关状态从数据库读取，其他配置从 JSON 文件读取
+func (ss *SettingsService) loadBlacklistLevelConfig() (*BlacklistLevelConfig, bool, error) {
+	configPath, err := GetBlacklistLevelConfigPath()
+	if err != nil {
+		return nil, false, err
+	}
 
 	var config *BlacklistLevelConfig
 
@@ -41,21 +76,24 @@ func (ss *SettingsService) GetBlacklistLevelConfig() (*BlacklistLevelConfig, err
 	if _, err := os.Stat(configPath); err == nil {
 		data, err := os.ReadFile(configPath)
 		if err != nil {
-			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+			return nil, false, fmt.Errorf("读取配置文件失败: %w", err)
 		}
 
 		// JSON Unmarshal 只会覆盖 JSON 中存在的字段，未出现的字段保持默认值
 		if err := json.Unmarshal(data, config); err != nil {
-			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+			return nil, false, fmt.Errorf("解析配置文件失败: %w", err)
 		}
 	}
 	// 如果文件不存在，直接使用默认配置（已在上面初始化）
 
 	// 【关键修复】从数据库读取开关状态，覆盖 JSON 文件中的值
 	// 因为 UI 开关是通过 SetLevelBlacklistEnabled() 写入数据库的
+	cacheable := true
 	dbEnabled, err := ss.GetLevelBlacklistEnabled()
 	if err == nil {
 		config.EnableLevelBlacklist = dbEnabled
+	} else {
+		cacheable = false
 	}
 	// 如果数据库读取失败，保留 JSON 文件中的值（向后兼容）
 
@@ -64,10 +102,12 @@ func (ss *SettingsService) GetBlacklistLevelConfig() (*BlacklistLevelConfig, err
 	dbThreshold, _, err := ss.GetBlacklistSettings()
 	if err == nil && dbThreshold > 0 {
 		config.FailureThreshold = dbThreshold
+	} else if err != nil {
+		cacheable = false
 	}
 	// 如果数据库读取失败，保留 JSON 文件中的值（向后兼容）
 
-	return config, nil
+	return config, cacheable, nil
 }
 
 // SaveBlacklistLevelConfig 保存等级拉黑配置
@@ -76,6 +116,7 @@ func (ss *SettingsService) SaveBlacklistLevelConfig(config *BlacklistLevelConfig
 	if err != nil {
 		return err
 	}
+	previous, previousErr := ss.GetBlacklistLevelConfig()
 
 	// 序列化配置
 	data, err := json.MarshalIndent(config, "", "  ")
@@ -92,10 +133,30 @@ func (ss *SettingsService) SaveBlacklistLevelConfig(config *BlacklistLevelConfig
 	if err := os.Rename(tmpPath, configPath); err != nil {
 		return fmt.Errorf("重命名配置文件失败: %w", err)
 	}
+	ss.invalidateBlacklistLevelConfig()
 
+	if previousErr == nil && previous.PerModelBlacklist != config.PerModelBlacklist {
+		ss.notifyBlacklistScopeChanged(config.PerModelBlacklist)
+	}
 	return nil
 }
 
+// onBlacklistScopeChanged 注册按模型拉黑开关切换后的回调
+func (ss *SettingsService) onBlacklistScopeChanged(hook func(perModel bool)) {
+	ss.scopeMu.Lock()
+	ss.scopeHooks = append(ss.scopeHooks, hook)
+	ss.scopeMu.Unlock()
+}
+
+func (ss *SettingsService) notifyBlacklistScopeChanged(perModel bool) {
+	ss.scopeMu.Lock()
+	hooks := append([]func(perModel bool){}, ss.scopeHooks...)
+	ss.scopeMu.Unlock()
+	for _, hook := range hooks {
+		hook(perModel)
+	}
+}
+
 // UpdateBlacklistLevelConfig 更新等级拉黑配置
 func (ss *SettingsService) UpdateBlacklistLevelConfig(config *BlacklistLevelConfig) error {
 	// 验证配置
@@ -161,5 +222,34 @@ func validateBlacklistLevelConfig(config *BlacklistLevelConfig) error {
 		return fmt.Errorf("fallback 拉黑时长必须在 1-10080 分钟之间")
 	}
 
+	if config.HalfOpenMaxTrials < 0 || config.HalfOpenMaxTrials > 10 {
+		return fmt.Errorf("半开试探请求数必须在 0-10 之间（0 表示默认 1）")
+	}
+
+	if config.HalfOpenSuccessThreshold < 0 || config.HalfOpenSuccessThreshold > 10 {
+		return fmt.Errorf("半开恢复所需成功次数必须在 0-10 之间（0 表示默认 2）")
+	}
+
+	if config.RateWindowEnabled {
+		if config.RateWindowSeconds < 10 || config.RateWindowSeconds > 3600 {
+			return fmt.Errorf("滑动窗口长度必须在 10-3600 秒之间")
+		}
+		if config.RateMinSamples < 1 || config.RateMinSamples > 1000 {
+			return fmt.Errorf("滑动窗口最小样本数必须在 1-1000 之间")
+		}
+		if config.ErrorRateThreshold < 0 || config.ErrorRateThreshold > 100 {
+			return fmt.Errorf("错误率阈值必须在 0-100 之间")
+		}
+		if config.SlowRateThreshold < 0 || config.SlowRateThreshold > 100 {
+			return fmt.Errorf("慢请求率阈值必须在 0-100 之间")
+		}
+		if config.ErrorRateThreshold == 0 && config.SlowRateThreshold == 0 {
+			return fmt.Errorf("启用滑动窗口拉黑时，错误率阈值和慢请求率阈值至少设置一个")
+		}
+		if config.SlowRateThreshold > 0 && config.SlowRequestMs < 100 {
+			return fmt.Errorf("慢请求判定阈值不能小于 100 毫秒")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// rateSample 单次转发结果（仅保存在内存中）
+type rateSample struct {
+	At     time.Time
+	Failed bool
+	Slow   bool
+}
+
+// rateWindow 单个 provider 的滑动窗口
+type rateWindow struct {
+	Samples    []rateSample
+	TripReason string // 最近一次由滑动窗口触发拉黑的原因
+}
+
+// RateWindowStats 滑动窗口统计结果
+type RateWindowStats struct {
+	Samples   int     `json:"samples"`
+	Failures  int     `json:"failures"`
+	SlowCount int     `json:"slowCount"`
+	ErrorRate float64 `json:"errorRate"` // 百分比
+	SlowRate  float64 `json:"slowRate"`  // 百分比
+}
+
+// RecordOutcome 记录一次转发结果，用于滑动窗口错误率/慢请求率拉黑
+// latency 为上游响应头到达耗时；客户端中断不应调用本方法
+// model 为空或未开启按模型拉黑时统计整个 provider
+func (bs *BlacklistService) RecordOutcome(platform string, providerName string, model string, success bool, latency time.Duration) {
+	if bs == nil || bs.settingsService == nil {
+		return
+	}
+	levelConfig, err := bs.settingsService.GetBlacklistLevelConfig()
+	if err != nil || !levelConfig.RateWindowEnabled {
+		return
+	}
+	model = blacklistModelScope(levelConfig, model)
+
+	now := time.Now()
+	sample := rateSample{
+		At:     now,
+		Failed: !success,
+		Slow:   levelConfig.SlowRequestMs > 0 && latency >= time.Duration(levelConfig.SlowRequestMs)*time.Millisecond,
+	}
+
+	key := circuitKey(platform, providerName, model)
+	bs.rateMu.Lock()
+	window := bs.rateWindows[key]
+	if window == nil {
+		window = &rateWindow{}
+		bs.rateWindows[key] = window
+	}
+	window.Samples = append(pruneRateSamples(window.Samples, now, levelConfig), sample)
+	stats := summarizeRateSamples(window.Samples)
+	reason := rateTripReason(stats, levelConfig)
+	if reason != "" {
+		// 触发后清空窗口，避免恢复后被旧样本再次拉黑
+		window.Samples = nil
+		window.TripReason = reason
+	}
+	bs.rateMu.Unlock()
+
+	if reason == "" {
+		return
+	}
+	if bs.loadCircuitState(platform, providerName, model, levelConfig) == CircuitStateOpen {
+		return
+	}
+	log.Printf("📉 Provider %s/%s 滑动窗口触发拉黑: %s", platform, blacklistSubject(providerName, model), reason)
+	if err := bs.recordFailure(platform, providerName, model, "滑动窗口"+reason, true); err != nil {
+		log.Printf("⚠️  滑动窗口拉黑失败: %v", err)
+	}
+}
+
+// GetRateWindowStats 获取 provider（或某个模型）当前滑动窗口统计
+func (bs *BlacklistService) GetRateWindowStats(platform string, providerName string, model string) RateWindowStats {
+	levelConfig, err := bs.settingsService.GetBlacklistLevelConfig()
+	if err != nil {
+		levelConfig = DefaultBlacklistLevelConfig()
+	}
+	stats, _ := bs.rateWindowSnapshot(platform, providerName, blacklistModelScope(levelConfig, model), levelConfig, time.Now())
+	return stats
+}
+
+// rateWindowSnapshot 读取窗口统计和最近一次触发原因（会顺带清理过期样本）
+func (bs *BlacklistService) rateWindowSnapshot(platform string, providerName string, model string, levelConfig *BlacklistLevelConfig, now time.Time) (RateWindowStats, string) {
+	bs.rateMu.Lock()
+	defer bs.rateMu.Unlock()
+	window := bs.rateWindows[circuitKey(platform, providerName, model)]
+	if window == nil {
+		return RateWindowStats{}, ""
+	}
+	window.Samples = pruneRateSamples(window.Samples, now, levelConfig)
+	return summarizeRateSamples(window.Samples), window.TripReason
+}
+
+// resetRateWindow 手动解除拉黑时清空窗口
+func (bs *BlacklistService) resetRateWindow(platform string, providerName string, model string) {
+	bs.rateMu.Lock()
+	delete(bs.rateWindows, circuitKey(platform, providerName, model))
+	bs.rateMu.Unlock()
+}
+
+func pruneRateSamples(samples []rateSample, now time.Time, levelConfig *BlacklistLevelConfig) []rateSample {
+	windowSeconds := levelConfig.RateWindowSeconds
+	if windowSeconds <= 0 {
+		windowSeconds = DefaultBlacklistLevelConfig().RateWindowSeconds
+	}
+	cutoff := now.Add(-time.Duration(windowSeconds) * time.Second)
+	idx := 0
+	for idx < len(samples) && samples[idx].At.Before(cutoff) {
+		idx++
+	}
+	if idx == 0 {
+		return samples
+	}
+	return append(samples[:0], samples[idx:]...)
+}
+
+func summarizeRateSamples(samples []rateSample) RateWindowStats {
+	stats := RateWindowStats{Samples: len(samples)}
+	for _, sample := range samples {
+		if sample.Failed {
+			stats.Failures++
+		}
+		if sample.Slow {
+			stats.SlowCount++
+		}
+	}
+	if stats.Samples > 0 {
+		stats.ErrorRate = float64(stats.Failures) * 100 / float64(stats.Samples)
+		stats.SlowRate = float64(stats.SlowCount) * 100 / float64(stats.Samples)
+	}
+	return stats
+}
+
+// rateTripReason 判断窗口是否达到拉黑条件，返回触发原因（空字符串表示未触发）
+func rateTripReason(stats RateWindowStats, levelConfig *BlacklistLevelConfig) string {
+	if stats.Samples < levelConfig.RateMinSamples {
+		return ""
+	}
+	if levelConfig.ErrorRateThreshold > 0 && stats.ErrorRate >= levelConfig.ErrorRateThreshold {
+		return fmt.Sprintf("错误率 %.1f%% ≥ %.1f%%（%d/%d）", stats.ErrorRate, levelConfig.ErrorRateThreshold, stats.Failures, stats.Samples)
+	}
+	if levelConfig.SlowRateThreshold > 0 && stats.SlowRate >= levelConfig.SlowRateThreshold {
+		return fmt.Sprintf("慢请求率 %.1f%% ≥ %.1f%%（%d/%d）", stats.SlowRate, levelConfig.SlowRateThreshold, stats.SlowCount, stats.Samples)
+	}
+	return ""
+}
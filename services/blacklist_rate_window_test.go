@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateTripReason(t *testing.T) {
+	cfg := DefaultBlacklistLevelConfig()
+	cfg.RateMinSamples = 5
+	cfg.ErrorRateThreshold = 40
+	cfg.SlowRateThreshold = 50
+
+	// 交替失败：连续失败从未达到 3 次，但错误率 40%
+	samples := []rateSample{{Failed: true}, {}, {Failed: true}, {}, {}}
+	if reason := rateTripReason(summarizeRateSamples(samples[:4]), cfg); reason != "" {
+		t.Fatalf("below min samples should not trip, got %q", reason)
+	}
+	if reason := rateTripReason(summarizeRateSamples(samples), cfg); reason == "" {
+		t.Fatalf("40%% error rate should trip")
+	}
+
+	slow := []rateSample{{Slow: true}, {Slow: true}, {Slow: true}, {}, {}}
+	if reason := rateTripReason(summarizeRateSamples(slow), cfg); reason == "" {
+		t.Fatalf("60%% slow rate should trip")
+	}
+	cfg.SlowRateThreshold = 0
+	if reason := rateTripReason(summarizeRateSamples(slow), cfg); reason != "" {
+		t.Fatalf("slow rate check disabled, got %q", reason)
+	}
+}
+
+func TestPruneRateSamples(t *testing.T) {
+	cfg := DefaultBlacklistLevelConfig()
+	cfg.RateWindowSeconds = 60
+	now := time.Now()
+	samples := []rateSample{
+		{At: now.Add(-2 * time.Minute), Failed: true},
+		{At: now.Add(-30 * time.Second)},
+		{At: now},
+	}
+	pruned := pruneRateSamples(samples, now, cfg)
+	if len(pruned) != 2 || pruned[0].Failed {
+		t.Fatalf("pruned = %+v, want 2 samples inside window", pruned)
+	}
+}
+
+func TestBlacklistLevelConfigCacheInvalidation(t *testing.T) {
+	useTestDatabase(t)
+	settings := NewSettingsService()
+
+	cfg, err := settings.GetBlacklistLevelConfig()
+	if err != nil {
+		t.Fatalf("get level config: %v", err)
+	}
+	// 返回的是副本，修改不影响缓存
+	cfg.RateWindowEnabled = true
+	if cached, _ := settings.GetBlacklistLevelConfig(); cached.RateWindowEnabled {
+		t.Fatalf("mutating the returned config must not leak into the cache")
+	}
+
+	if err := settings.SaveBlacklistLevelConfig(cfg); err != nil {
+		t.Fatalf("save level config: %v", err)
+	}
+	if err := settings.SetLevelBlacklistEnabled(true); err != nil {
+		t.Fatalf("enable level blacklist: %v", err)
+	}
+	if err := settings.UpdateBlacklistSettings(7, 30); err != nil {
+		t.Fatalf("update blacklist settings: %v", err)
+	}
+	got, err := settings.GetBlacklistLevelConfig()
+	if err != nil {
+		t.Fatalf("get level config: %v", err)
+	}
+	if !got.RateWindowEnabled || !got.EnableLevelBlacklist || got.FailureThreshold != 7 {
+		t.Fatalf("config = %+v, want saved values after invalidation", got)
+	}
+}
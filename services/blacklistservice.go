@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/daodao97/xgo/xdb"
@@ -13,12 +15,20 @@ import (
 type BlacklistService struct {
 	settingsService     *SettingsService
 	notificationService *NotificationService
+
+	circuitMu      sync.Mutex
+	circuitProber  CircuitProber
+	halfOpenTrials map[string]*halfOpenTrial // key: platform:providerName
+
+	rateMu      sync.Mutex
+	rateWindows map[string]*rateWindow // key: platform:providerName
 }
 
 // BlacklistStatus 黑名单状态（用于前端展示）
 type BlacklistStatus struct {
 	Platform         string     `json:"platform"`
 	ProviderName     string     `json:"providerName"`
+	Model            string     `json:"model"` // 为空表示整个 provider，否则为按模型拉黑的记录
 	FailureCount     int        `json:"failureCount"`
 	BlacklistedAt    *time.Time `json:"blacklistedAt"`
 	BlacklistedUntil *time.Time `json:"blacklistedUntil"`
@@ -30,17 +40,41 @@ type BlacklistStatus struct {
 	BlacklistLevel       int        `json:"blacklistLevel"`       // 当前黑名单等级 (0-5)
 	LastRecoveredAt      *time.Time `json:"lastRecoveredAt"`      // 最后恢复时间
 	ForgivenessRemaining int        `json:"forgivenessRemaining"` // 距离宽恕还剩多少秒（3小时倒计时）
+
+	// 熔断状态：closed / open / half_open
+	CircuitState      string     `json:"circuitState"`
+	HalfOpenSuccesses int        `json:"halfOpenSuccesses"` // 半开期间已成功的试探次数
+	CircuitChangedAt  *time.Time `json:"circuitChangedAt"`  // 最近一次状态切换时间
+
+	// 滑动窗口统计（内存，重启后清零）
+	RateWindow     RateWindowStats `json:"rateWindow"`
+	RateTripReason string          `json:"rateTripReason"` // 最近一次由错误率/慢请求率触发拉黑的原因
 }
 
 func NewBlacklistService(settingsService *SettingsService, notificationService *NotificationService) *BlacklistService {
-	return &BlacklistService{
+	bs := &BlacklistService{
 		settingsService:     settingsService,
 		notificationService: notificationService,
+		halfOpenTrials:      make(map[string]*halfOpenTrial),
+		rateWindows:         make(map[string]*rateWindow),
+	}
+	if settingsService != nil {
+		settingsService.onBlacklistScopeChanged(bs.resetBlacklistScope)
 	}
+	return bs
 }
 
 // RecordSuccess 记录 provider 成功，清零连续失败计数，执行降级和宽恕逻辑
 func (bs *BlacklistService) RecordSuccess(platform string, providerName string) error {
+	return bs.recordSuccess(platform, providerName, "")
+}
+
+// RecordModelSuccess 记录 provider 某个模型的成功（未开启按模型拉黑时等同 RecordSuccess）
+func (bs *BlacklistService) RecordModelSuccess(platform string, providerName string, model string) error {
+	return bs.recordSuccess(platform, providerName, model)
+}
+
+func (bs *BlacklistService) recordSuccess(platform string, providerName string, model string) error {
 	db, err := xdb.DB("default")
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
@@ -52,6 +86,13 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 		log.Printf("⚠️  获取等级拉黑配置失败: %v", err)
 		levelConfig = DefaultBlacklistLevelConfig()
 	}
+	model = blacklistModelScope(levelConfig, model)
+	subject := blacklistSubject(providerName, model)
+	if model != "" {
+		if err := bs.recordProviderHalfOpenSuccess(db, platform, providerName, levelConfig); err != nil {
+			log.Printf("⚠️  记录 provider 级半开试探成功失败: %v", err)
+		}
+	}
 
 	// 查询现有记录
 	var id int
@@ -59,12 +100,14 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 	var lastRecoveredAt sql.NullTime
 	var lastDegradeHour int
 	var blacklistedUntil sql.NullTime
+	var circuitState sql.NullString
+	var halfOpenSuccesses sql.NullInt64
 
 	err = db.QueryRow(`
-		SELECT id, blacklist_level, last_recovered_at, last_degrade_hour, blacklisted_until
+		SELECT id, blacklist_level, last_recovered_at, last_degrade_hour, blacklisted_until, circuit_state, half_open_successes
 		FROM provider_blacklist
-		WHERE platform = ? AND provider_name = ?
-	`, platform, providerName).Scan(&id, &blacklistLevel, &lastRecoveredAt, &lastDegradeHour, &blacklistedUntil)
+		WHERE platform = ? AND provider_name = ? AND model = ?
+	`, platform, providerName, model).Scan(&id, &blacklistLevel, &lastRecoveredAt, &lastDegradeHour, &blacklistedUntil, &circuitState, &halfOpenSuccesses)
 
 	if err == sql.ErrNoRows {
 		// 没有失败记录，无需操作
@@ -75,12 +118,19 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 
 	now := time.Now()
 
+	// 半开状态：累计试探成功次数，达到阈值后关闭熔断
+	if effectiveCircuitState(circuitState.String, blacklistedUntil, now, levelConfig) == CircuitStateHalfOpen {
+		if err := bs.recordHalfOpenSuccess(id, platform, providerName, model, int(halfOpenSuccesses.Int64), levelConfig); err != nil {
+			return err
+		}
+	}
+
 	// 检查是否刚从拉黑中恢复（blacklisted_until 刚过期且 last_recovered_at 未设置）
 	justRecovered := false
 	if blacklistedUntil.Valid && blacklistedUntil.Time.Before(now) && !lastRecoveredAt.Valid {
 		justRecovered = true
 		lastRecoveredAt = sql.NullTime{Time: now, Valid: true}
-		log.Printf("🔓 Provider %s/%s 从黑名单恢复（L%d），开始降级计时", platform, providerName, blacklistLevel)
+		log.Printf("🔓 Provider %s/%s 从黑名单恢复（L%d），开始降级计时", platform, subject, blacklistLevel)
 	}
 
 	// 如果功能关闭，只清零失败计数
@@ -95,7 +145,7 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 			return fmt.Errorf("清零失败计数失败: %w", err)
 		}
 
-		log.Printf("✅ Provider %s/%s 成功，连续失败计数已清零（固定模式）", platform, providerName)
+		log.Printf("✅ Provider %s/%s 成功，连续失败计数已清零（固定模式）", platform, subject)
 		return nil
 	}
 
@@ -112,7 +162,16 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 			newLevel = 0
 			newLastDegradeHour = 0
 			log.Printf("🎉 Provider %s/%s 触发宽恕机制（稳定 %.1f 小时），等级清零（L%d → L0）",
-				platform, providerName, timeSinceRecovery.Hours(), blacklistLevel)
+				platform, subject, timeSinceRecovery.Hours(), blacklistLevel)
+			recordProviderEvent(ProviderEvent{
+				Platform:     platform,
+				ProviderName: providerName,
+				Model:        model,
+				EventType:    ProviderEventForgiven,
+				Reason:       fmt.Sprintf("恢复后稳定 %.1f 小时", timeSinceRecovery.Hours()),
+				FromLevel:    blacklistLevel,
+				ToLevel:      0,
+			})
 		} else if hoursSinceRecovery > lastDegradeHour {
 			// 正常降级：每小时 -1 等级（防止同一小时内重复降级）
 			hoursPassed := hoursSinceRecovery - lastDegradeHour
@@ -127,7 +186,16 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 
 			if degradeCount > 0 {
 				log.Printf("📉 Provider %s/%s 降级（L%d → L%d，经过 %d 小时）",
-					platform, providerName, blacklistLevel, newLevel, degradeCount)
+					platform, subject, blacklistLevel, newLevel, degradeCount)
+				recordProviderEvent(ProviderEvent{
+					Platform:     platform,
+					ProviderName: providerName,
+					Model:        model,
+					EventType:    ProviderEventLevelChanged,
+					Reason:       fmt.Sprintf("恢复后经过 %d 小时自然降级", hoursSinceRecovery),
+					FromLevel:    blacklistLevel,
+					ToLevel:      newLevel,
+				})
 			}
 		}
 	}
@@ -156,18 +224,32 @@ func (bs *BlacklistService) RecordSuccess(platform string, providerName string)
 	}
 
 	if justRecovered {
-		log.Printf("✅ Provider %s/%s 成功（刚恢复），失败计数已清零，当前等级: L%d", platform, providerName, newLevel)
+		log.Printf("✅ Provider %s/%s 成功（刚恢复），失败计数已清零，当前等级: L%d", platform, subject, newLevel)
 	} else if newLevel != blacklistLevel {
-		log.Printf("✅ Provider %s/%s 成功，失败计数已清零，等级: L%d → L%d", platform, providerName, blacklistLevel, newLevel)
+		log.Printf("✅ Provider %s/%s 成功，失败计数已清零，等级: L%d → L%d", platform, subject, blacklistLevel, newLevel)
 	} else {
-		log.Printf("✅ Provider %s/%s 成功，失败计数已清零，当前等级: L%d", platform, providerName, newLevel)
+		log.Printf("✅ Provider %s/%s 成功，失败计数已清零，当前等级: L%d", platform, subject, newLevel)
 	}
 
 	return nil
 }
 
-// RecordFailure 记录 provider 失败，连续失败次数达到阈值时自动拉黑（支持等级拉黑）
-func (bs *BlacklistService) RecordFailure(platform string, providerName string) error {
+// RecordFailure 记录 provider 失败，连续失败次数达到阈值时自动拉黑（支持等级拉黑），reason 写入事件时间线
+func (bs *BlacklistService) RecordFailure(platform string, providerName string, reason string) error {
+	return bs.recordFailure(platform, providerName, "", truncateEventReason(reason), false)
+}
+
+// RecordModelFailure 记录 provider 某个模型的失败（开启按模型拉黑时只拉黑该模型），cause 写入事件时间线
+func (bs *BlacklistService) RecordModelFailure(platform string, providerName string, model string, cause error) error {
+	reason := ""
+	if cause != nil {
+		reason = truncateEventReason(cause.Error())
+	}
+	return bs.recordFailure(platform, providerName, model, reason, false)
+}
+
+// recordFailure 记录失败；forceTrip=true 时跳过去重和阈值直接拉黑（滑动窗口触发，reason 为触发原因）
+func (bs *BlacklistService) recordFailure(platform string, providerName string, model string, reason string, forceTrip bool) error {
 	// 检查拉黑功能是否启用
 	if !bs.settingsService.IsBlacklistEnabled() {
 		log.Printf("🚫 拉黑功能已关闭，跳过 provider %s/%s 的失败记录", platform, providerName)
@@ -185,6 +267,40 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		log.Printf("⚠️  获取等级拉黑配置失败: %v", err)
 		levelConfig = DefaultBlacklistLevelConfig()
 	}
+	model = blacklistModelScope(levelConfig, model)
+	subject := blacklistSubject(providerName, model)
+
+	// 失败事件在去重之后才写入，强制拉黑不算一次失败
+	var failureEvent *ProviderEvent
+	if !forceTrip {
+		failureEvent = &ProviderEvent{
+			Platform:     platform,
+			ProviderName: providerName,
+			Model:        model,
+			EventType:    ProviderEventFailure,
+			Reason:       reason,
+		}
+	}
+
+	// 强制拉黑时确保记录存在，后续统一走“已有记录”分支
+	if forceTrip {
+		if err := GlobalDBQueue.Exec(`
+			INSERT OR IGNORE INTO provider_blacklist (platform, provider_name, model, failure_count, blacklist_level)
+			VALUES (?, ?, ?, 0, 0)
+		`, platform, providerName, model); err != nil {
+			return fmt.Errorf("插入失败记录失败: %w", err)
+		}
+	}
+
+	// 半开状态下任何失败、或滑动窗口触发时，都立即（重新）熔断
+	fromState := bs.loadCircuitState(platform, providerName, model, levelConfig)
+	tripNow := fromState == CircuitStateHalfOpen || forceTrip
+	tripReason := ""
+	if forceTrip {
+		tripReason = reason
+	} else if fromState == CircuitStateHalfOpen {
+		tripReason = "半开试探失败"
+	}
 
 	// 如果功能关闭，使用旧的固定拉黑模式
 	if !levelConfig.EnableLevelBlacklist {
@@ -195,7 +311,10 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 			threshold = levelConfig.FailureThreshold
 			duration = levelConfig.FallbackDurationMinutes
 		}
-		return bs.recordFailureFixedMode(platform, providerName, levelConfig.FallbackMode, duration, threshold)
+		if tripNow {
+			threshold = 1
+		}
+		return bs.recordFailureFixedMode(platform, providerName, model, levelConfig.FallbackMode, duration, threshold, fromState, tripReason, failureEvent)
 	}
 
 	now := time.Now()
@@ -211,22 +330,23 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 	err = db.QueryRow(`
 		SELECT id, failure_count, blacklisted_until, blacklist_level, last_recovered_at, last_failure_window_start
 		FROM provider_blacklist
-		WHERE platform = ? AND provider_name = ?
-	`, platform, providerName).Scan(&id, &failureCount, &blacklistedUntil, &blacklistLevel, &lastRecoveredAt, &lastFailureWindowStart)
+		WHERE platform = ? AND provider_name = ? AND model = ?
+	`, platform, providerName, model).Scan(&id, &failureCount, &blacklistedUntil, &blacklistLevel, &lastRecoveredAt, &lastFailureWindowStart)
 
 	if err == sql.ErrNoRows {
 		// 首次失败，插入新记录
 		err = GlobalDBQueue.Exec(`
 			INSERT INTO provider_blacklist
-				(platform, provider_name, failure_count, last_failure_at, last_failure_window_start, blacklist_level)
-			VALUES (?, ?, 1, ?, ?, 0)
-		`, platform, providerName, now, now)
+				(platform, provider_name, model, failure_count, last_failure_at, last_failure_window_start, blacklist_level)
+			VALUES (?, ?, ?, 1, ?, ?, 0)
+		`, platform, providerName, model, now, now)
 
 		if err != nil {
 			return fmt.Errorf("插入失败记录失败: %w", err)
 		}
 
-		log.Printf("📊 Provider %s/%s 失败计数: 1/%d（等级拉黑模式）", platform, providerName, levelConfig.FailureThreshold)
+		log.Printf("📊 Provider %s/%s 失败计数: 1/%d（等级拉黑模式）", platform, subject, levelConfig.FailureThreshold)
+		recordFailureEvent(failureEvent)
 		return nil
 	} else if err != nil {
 		return fmt.Errorf("查询黑名单记录失败: %w", err)
@@ -235,20 +355,24 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 	// 如果已经拉黑且未过期，不重复计数
 	if blacklistedUntil.Valid && blacklistedUntil.Time.After(now) {
 		log.Printf("⛔ Provider %s/%s 已在黑名单中（L%d），过期时间: %s",
-			platform, providerName, blacklistLevel, blacklistedUntil.Time.Format("15:04:05"))
+			platform, subject, blacklistLevel, blacklistedUntil.Time.Format("15:04:05"))
 		return nil
 	}
 
-	// 30秒去重窗口检测（防止客户端重试误判）
-	if lastFailureWindowStart.Valid {
+	// 30秒去重窗口检测（防止客户端重试误判，立即熔断时不去重）
+	if lastFailureWindowStart.Valid && !tripNow {
 		timeSinceLastFailure := now.Sub(lastFailureWindowStart.Time)
 		if timeSinceLastFailure < time.Duration(levelConfig.DedupeWindowSeconds)*time.Second {
-			log.Printf("🔄 Provider %s/%s 在30秒去重窗口内，忽略此次失败", platform, providerName)
+			log.Printf("🔄 Provider %s/%s 在30秒去重窗口内，忽略此次失败", platform, subject)
 			return nil
 		}
 	}
+	recordFailureEvent(failureEvent)
 
 	// 失败计数 +1，更新去重窗口起始时间
+	if tripNow && failureCount < levelConfig.FailureThreshold-1 {
+		failureCount = levelConfig.FailureThreshold - 1
+	}
 	failureCount++
 
 	// 检查是否达到拉黑阈值
@@ -265,12 +389,12 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 				// 跳级惩罚：恢复后短时间内再次失败
 				levelIncrease = 2
 				log.Printf("⚡ Provider %s/%s 触发跳级惩罚（恢复后 %.1f 小时内再次失败）",
-					platform, providerName, timeSinceRecovery.Hours())
+					platform, subject, timeSinceRecovery.Hours())
 			} else {
 				// 正常升级
 				levelIncrease = 1
 				log.Printf("📈 Provider %s/%s 正常升级（恢复后 %.1f 小时再次失败）",
-					platform, providerName, timeSinceRecovery.Hours())
+					platform, subject, timeSinceRecovery.Hours())
 			}
 		} else {
 			// 首次拉黑，默认 L1
@@ -295,21 +419,38 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 				blacklisted_until = ?,
 				blacklist_level = ?,
 				auto_recovered = 0,
-				last_failure_window_start = ?
+				last_failure_window_start = ?,
+				circuit_state = ?,
+				half_open_successes = 0,
+				circuit_changed_at = ?
 			WHERE id = ?
-		`, now, blacklistedAt, blacklistedUntil, newLevel, now, id)
+		`, now, blacklistedAt, blacklistedUntil, newLevel, now, CircuitStateOpen, now, id)
 
 		if err != nil {
 			return fmt.Errorf("更新拉黑状态失败: %w", err)
 		}
 
 		log.Printf("⛔ Provider %s/%s 已拉黑（L%d → L%d，%d 分钟），过期时间: %s",
-			platform, providerName, blacklistLevel, newLevel, duration, blacklistedUntil.Format("15:04:05"))
+			platform, subject, blacklistLevel, newLevel, duration, blacklistedUntil.Format("15:04:05"))
 
 		// 发送拉黑通知
 		if bs.notificationService != nil {
-			bs.notificationService.NotifyProviderBlacklisted(platform, providerName, newLevel, duration)
+			bs.notificationService.NotifyProviderBlacklisted(platform, subject, newLevel, duration)
+		}
+		if tripReason == "" {
+			tripReason = fmt.Sprintf("连续失败 %d 次", failureCount)
 		}
+		recordProviderEvent(ProviderEvent{
+			Platform:        platform,
+			ProviderName:    providerName,
+			Model:           model,
+			EventType:       ProviderEventBlacklisted,
+			Reason:          tripReason,
+			FromLevel:       blacklistLevel,
+			ToLevel:         newLevel,
+			DurationMinutes: duration,
+		})
+		bs.markCircuitOpened(platform, providerName, model, fromState)
 
 	} else {
 		// 未达到阈值，仅更新失败计数和窗口起始时间
@@ -324,16 +465,18 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		}
 
 		log.Printf("📊 Provider %s/%s 失败计数: %d/%d（当前等级: L%d）",
-			platform, providerName, failureCount, levelConfig.FailureThreshold, blacklistLevel)
+			platform, subject, failureCount, levelConfig.FailureThreshold, blacklistLevel)
 	}
 
 	return nil
 }
 
 // recordFailureFixedMode 固定拉黑模式（向后兼容）
-func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName string, fallbackMode string, fallbackDuration int, failureThreshold int) error {
+func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName string, model string, fallbackMode string, fallbackDuration int, failureThreshold int, fromState string, tripReason string, failureEvent *ProviderEvent) error {
+	subject := blacklistSubject(providerName, model)
 	if fallbackMode == "none" {
-		log.Printf("🚫 Provider %s/%s 失败，但等级拉黑已关闭且 fallbackMode=none，不拉黑", platform, providerName)
+		log.Printf("🚫 Provider %s/%s 失败，但等级拉黑已关闭且 fallbackMode=none，不拉黑", platform, subject)
+		recordFailureEvent(failureEvent)
 		return nil
 	}
 
@@ -353,22 +496,23 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 	err = db.QueryRow(`
 		SELECT id, failure_count, blacklisted_until
 		FROM provider_blacklist
-		WHERE platform = ? AND provider_name = ?
-	`, platform, providerName).Scan(&id, &failureCount, &blacklistedUntil)
+		WHERE platform = ? AND provider_name = ? AND model = ?
+	`, platform, providerName, model).Scan(&id, &failureCount, &blacklistedUntil)
 
 	if err == sql.ErrNoRows {
 		// 首次失败，插入新记录
 		err = GlobalDBQueue.Exec(`
 			INSERT INTO provider_blacklist
-				(platform, provider_name, failure_count, last_failure_at)
-			VALUES (?, ?, 1, ?)
-		`, platform, providerName, now)
+				(platform, provider_name, model, failure_count, last_failure_at)
+			VALUES (?, ?, ?, 1, ?)
+		`, platform, providerName, model, now)
 
 		if err != nil {
 			return fmt.Errorf("插入失败记录失败: %w", err)
 		}
 
-		log.Printf("📊 Provider %s/%s 失败计数: 1/%d（固定拉黑模式）", platform, providerName, failureThreshold)
+		log.Printf("📊 Provider %s/%s 失败计数: 1/%d（固定拉黑模式）", platform, subject, failureThreshold)
+		recordFailureEvent(failureEvent)
 		return nil
 	} else if err != nil {
 		return fmt.Errorf("查询黑名单记录失败: %w", err)
@@ -376,9 +520,10 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 
 	// 如果已经拉黑且未过期，不重复计数
 	if blacklistedUntil.Valid && blacklistedUntil.Time.After(now) {
-		log.Printf("⛔ Provider %s/%s 已在黑名单中（固定模式），过期时间: %s", platform, providerName, blacklistedUntil.Time.Format("15:04:05"))
+		log.Printf("⛔ Provider %s/%s 已在黑名单中（固定模式），过期时间: %s", platform, subject, blacklistedUntil.Time.Format("15:04:05"))
 		return nil
 	}
+	recordFailureEvent(failureEvent)
 
 	// 失败计数 +1
 	failureCount++
@@ -394,16 +539,31 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 				last_failure_at = ?,
 				blacklisted_at = ?,
 				blacklisted_until = ?,
-				auto_recovered = 0
+				auto_recovered = 0,
+				circuit_state = ?,
+				half_open_successes = 0,
+				circuit_changed_at = ?
 			WHERE id = ?
-		`, failureCount, now, blacklistedAt, blacklistedUntil, id)
+		`, failureCount, now, blacklistedAt, blacklistedUntil, CircuitStateOpen, now, id)
 
 		if err != nil {
 			return fmt.Errorf("更新拉黑状态失败: %w", err)
 		}
 
 		log.Printf("⛔ Provider %s/%s 已拉黑 %d 分钟（固定模式，失败 %d 次），过期时间: %s",
-			platform, providerName, fallbackDuration, failureCount, blacklistedUntil.Format("15:04:05"))
+			platform, subject, fallbackDuration, failureCount, blacklistedUntil.Format("15:04:05"))
+		if tripReason == "" {
+			tripReason = fmt.Sprintf("连续失败 %d 次", failureCount)
+		}
+		recordProviderEvent(ProviderEvent{
+			Platform:        platform,
+			ProviderName:    providerName,
+			Model:           model,
+			EventType:       ProviderEventBlacklisted,
+			Reason:          tripReason,
+			DurationMinutes: fallbackDuration,
+		})
+		bs.markCircuitOpened(platform, providerName, model, fromState)
 
 	} else {
 		// 更新失败计数
@@ -417,7 +577,7 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 			return fmt.Errorf("更新失败计数失败: %w", err)
 		}
 
-		log.Printf("📊 Provider %s/%s 失败计数: %d/%d（固定模式）", platform, providerName, failureCount, failureThreshold)
+		log.Printf("📊 Provider %s/%s 失败计数: %d/%d（固定模式）", platform, subject, failureCount, failureThreshold)
 	}
 
 	return nil
@@ -447,6 +607,28 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 	if !bs.settingsService.IsBlacklistEnabled() {
 		return false, nil
 	}
+	return bs.isBlacklisted(platform, providerName, "")
+}
+
+// IsModelBlacklisted 检查 provider 对指定模型是否不可用：整个 provider 被拉黑，或（开启按模型拉黑时）该模型被拉黑
+func (bs *BlacklistService) IsModelBlacklisted(platform string, providerName string, model string) (bool, *time.Time) {
+	if !bs.settingsService.IsBlacklistEnabled() {
+		return false, nil
+	}
+	if blacklisted, until := bs.isBlacklisted(platform, providerName, ""); blacklisted {
+		return true, until
+	}
+	if strings.TrimSpace(model) == "" {
+		return false, nil
+	}
+	levelConfig, err := bs.settingsService.GetBlacklistLevelConfig()
+	if err != nil || !levelConfig.PerModelBlacklist {
+		return false, nil
+	}
+	return bs.isBlacklisted(platform, providerName, blacklistModelScope(levelConfig, model))
+}
+
+func (bs *BlacklistService) isBlacklisted(platform string, providerName string, model string) (bool, *time.Time) {
 
 	db, err := xdb.DB("default")
 	if err != nil {
@@ -455,13 +637,14 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 	}
 
 	var blacklistedUntil sql.NullTime
+	var circuitState sql.NullString
 
 	// 移除 SQL 时间比较，改为 Go 代码判断（修复时区 bug）
 	err = db.QueryRow(`
-		SELECT blacklisted_until
+		SELECT blacklisted_until, circuit_state
 		FROM provider_blacklist
-		WHERE platform = ? AND provider_name = ? AND blacklisted_until IS NOT NULL
-	`, platform, providerName).Scan(&blacklistedUntil)
+		WHERE platform = ? AND provider_name = ? AND model = ?
+	`, platform, providerName, model).Scan(&blacklistedUntil, &circuitState)
 
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -470,18 +653,45 @@ func (bs *BlacklistService) IsBlacklisted(platform string, providerName string)
 		return false, nil
 	}
 
+	now := time.Now()
 	if blacklistedUntil.Valid {
 		// 使用 Go 代码比较时间（正确处理时区）
-		if blacklistedUntil.Time.After(time.Now()) {
+		if blacklistedUntil.Time.After(now) {
 			return true, &blacklistedUntil.Time
 		}
 	}
 
+	// 半开状态：仅在试探名额未用完时放行
+	if circuitState.String == CircuitStateOpen || circuitState.String == CircuitStateHalfOpen {
+		levelConfig, err := bs.settingsService.GetBlacklistLevelConfig()
+		if err != nil {
+			levelConfig = DefaultBlacklistLevelConfig()
+		}
+		if effectiveCircuitState(circuitState.String, blacklistedUntil, now, levelConfig) == CircuitStateHalfOpen &&
+			!bs.allowHalfOpenTrial(platform, providerName, model, halfOpenMaxTrials(levelConfig)) {
+			retryAt := now.Add(halfOpenTrialRetrySeconds * time.Second)
+			return true, &retryAt
+		}
+	}
+
 	return false, nil
 }
 
 // ManualUnblockAndReset 手动解除拉黑（保留等级，如需清零请调用 ManualResetLevel）
 func (bs *BlacklistService) ManualUnblockAndReset(platform string, providerName string) error {
+	return bs.manualUnblock(platform, providerName, "")
+}
+
+// ManualUnblockModel 手动解除 provider 某个模型的拉黑（保留等级）
+func (bs *BlacklistService) ManualUnblockModel(platform string, providerName string, model string) error {
+	if strings.TrimSpace(model) == "" {
+		return fmt.Errorf("模型名称不能为空")
+	}
+	return bs.manualUnblock(platform, providerName, strings.TrimSpace(model))
+}
+
+func (bs *BlacklistService) manualUnblock(platform string, providerName string, model string) error {
+	subject := blacklistSubject(providerName, model)
 	db, err := xdb.DB("default")
 	if err != nil {
 		return fmt.Errorf("获取数据库连接失败: %w", err)
@@ -493,11 +703,11 @@ func (bs *BlacklistService) ManualUnblockAndReset(platform string, providerName
 	var exists int
 	err = db.QueryRow(`
 		SELECT 1 FROM provider_blacklist
-		WHERE platform = ? AND provider_name = ?
-	`, platform, providerName).Scan(&exists)
+		WHERE platform = ? AND provider_name = ? AND model = ?
+	`, platform, providerName, model).Scan(&exists)
 
 	if err == sql.ErrNoRows {
-		return fmt.Errorf("provider %s/%s 不在黑名单中", platform, providerName)
+		return fmt.Errorf("provider %s/%s 不在黑名单中", platform, subject)
 	} else if err != nil {
 		return fmt.Errorf("查询黑名单记录失败: %w", err)
 	}
@@ -510,15 +720,28 @@ func (bs *BlacklistService) ManualUnblockAndReset(platform string, providerName
 			failure_count = 0,
 			last_recovered_at = ?,
 			last_degrade_hour = 0,
-			auto_recovered = 0
-		WHERE platform = ? AND provider_name = ?
-	`, now, platform, providerName)
+			auto_recovered = 0,
+			circuit_state = ?,
+			half_open_successes = 0,
+			circuit_changed_at = ?
+		WHERE platform = ? AND provider_name = ? AND model = ?
+	`, now, CircuitStateClosed, now, platform, providerName, model)
 
 	if err != nil {
 		return fmt.Errorf("手动解除拉黑失败: %w", err)
 	}
-
-	log.Printf("✅ 手动解除拉黑: %s/%s（等级保留，重新开始降级计时）", platform, providerName)
+	bs.forgetHalfOpenTrial(platform, providerName, model)
+	bs.resetRateWindow(platform, providerName, model)
+	bs.emitCircuitState(platform, providerName, model, "", CircuitStateClosed)
+
+	recordProviderEvent(ProviderEvent{
+		Platform:     platform,
+		ProviderName: providerName,
+		Model:        model,
+		EventType:    ProviderEventManualUnblock,
+	})
+
+	log.Printf("✅ 手动解除拉黑: %s/%s（等级保留，重新开始降级计时）", platform, subject)
 	return nil
 }
 
@@ -535,11 +758,11 @@ func (bs *BlacklistService) ManualResetLevel(platform string, providerName strin
 	}
 
 	// 先检查记录是否存在
-	var exists int
+	var currentLevel int
 	err = db.QueryRow(`
-		SELECT 1 FROM provider_blacklist
-		WHERE platform = ? AND provider_name = ?
-	`, platform, providerName).Scan(&exists)
+		SELECT blacklist_level FROM provider_blacklist
+		WHERE platform = ? AND provider_name = ? AND model = ''
+	`, platform, providerName).Scan(&currentLevel)
 
 	if err == sql.ErrNoRows {
 		return fmt.Errorf("provider %s/%s 不存在", platform, providerName)
@@ -551,13 +774,21 @@ func (bs *BlacklistService) ManualResetLevel(platform string, providerName strin
 		UPDATE provider_blacklist
 		SET blacklist_level = 0,
 			last_degrade_hour = 0
-		WHERE platform = ? AND provider_name = ?
+		WHERE platform = ? AND provider_name = ? AND model = ''
 	`, platform, providerName)
 
 	if err != nil {
 		return fmt.Errorf("手动清零等级失败: %w", err)
 	}
 
+	recordProviderEvent(ProviderEvent{
+		Platform:     platform,
+		ProviderName: providerName,
+		EventType:    ProviderEventManualReset,
+		FromLevel:    currentLevel,
+		ToLevel:      0,
+	})
+
 	log.Printf("✅ 手动清零等级: %s/%s（等级 → L0，拉黑状态保留）", platform, providerName)
 	return nil
 }
@@ -572,7 +803,7 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 
 	// 查询需要恢复的 provider（移除 SQL 时间比较，改为 Go 代码判断）
 	rows, err := db.Query(`
-		SELECT platform, provider_name, blacklisted_until
+		SELECT platform, provider_name, model, blacklisted_until
 		FROM provider_blacklist
 		WHERE blacklisted_until IS NOT NULL
 			AND auto_recovered = 0
@@ -587,15 +818,16 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 	type RecoverItem struct {
 		Platform     string
 		ProviderName string
+		Model        string
 	}
 	var toRecover []RecoverItem
 
 	// 收集所有需要恢复的 provider
 	for rows.Next() {
-		var platform, providerName string
+		var platform, providerName, model string
 		var blacklistedUntil sql.NullTime
 
-		if err := rows.Scan(&platform, &providerName, &blacklistedUntil); err != nil {
+		if err := rows.Scan(&platform, &providerName, &model, &blacklistedUntil); err != nil {
 			log.Printf("⚠️  读取恢复记录失败: %v", err)
 			continue
 		}
@@ -608,6 +840,7 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 		toRecover = append(toRecover, RecoverItem{
 			Platform:     platform,
 			ProviderName: providerName,
+			Model:        model,
 		})
 	}
 
@@ -619,6 +852,16 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 	var recovered []string
 	var failed []string
 
+	// 到期后进入半开状态（仅放行少量试探请求），关闭半开时直接恢复
+	levelConfig, err := bs.settingsService.GetBlacklistLevelConfig()
+	if err != nil {
+		levelConfig = DefaultBlacklistLevelConfig()
+	}
+	nextState := CircuitStateHalfOpen
+	if levelConfig.HalfOpenDisabled {
+		nextState = CircuitStateClosed
+	}
+
 	// 批量更新所有过期的 provider（使用队列）
 	// 【重要】保留 blacklist_level，让 RecordSuccess 中的降级/宽恕机制逐渐降低等级
 	for _, item := range toRecover {
@@ -627,20 +870,36 @@ func (bs *BlacklistService) AutoRecoverExpired() error {
 			SET auto_recovered = 1,
 				failure_count = 0,
 				last_recovered_at = ?,
-				last_degrade_hour = 0
-			WHERE platform = ? AND provider_name = ?
-		`, now, item.Platform, item.ProviderName)
-
+				last_degrade_hour = 0,
+				circuit_state = ?,
+				half_open_successes = 0,
+				circuit_changed_at = ?
+			WHERE platform = ? AND provider_name = ? AND model = ?
+		`, now, nextState, now, item.Platform, item.ProviderName, item.Model)
+
+		subject := blacklistSubject(item.ProviderName, item.Model)
 		if err != nil {
-			failed = append(failed, fmt.Sprintf("%s/%s", item.Platform, item.ProviderName))
-			log.Printf("⚠️  标记恢复状态失败: %s/%s - %v", item.Platform, item.ProviderName, err)
+			failed = append(failed, fmt.Sprintf("%s/%s", item.Platform, subject))
+			log.Printf("⚠️  标记恢复状态失败: %s/%s - %v", item.Platform, subject, err)
 		} else {
-			recovered = append(recovered, fmt.Sprintf("%s/%s", item.Platform, item.ProviderName))
+			recovered = append(recovered, fmt.Sprintf("%s/%s", item.Platform, subject))
+			recordProviderEvent(ProviderEvent{
+				Platform:     item.Platform,
+				ProviderName: item.ProviderName,
+				Model:        item.Model,
+				EventType:    ProviderEventRecovered,
+				Reason:       "拉黑到期，进入 " + nextState,
+			})
+			bs.emitCircuitState(item.Platform, item.ProviderName, item.Model, CircuitStateOpen, nextState)
+			// 合成探测只针对整个 provider，模型级半开依赖真实流量试探
+			if nextState == CircuitStateHalfOpen && item.Model == "" {
+				bs.startHalfOpenProbe(item.Platform, item.ProviderName, levelConfig)
+			}
 		}
 	}
 
 	if len(recovered) > 0 {
-		log.Printf("✅ 自动恢复 %d 个过期拉黑（等级保留，等待降级）: %v", len(recovered), recovered)
+		log.Printf("✅ 自动恢复 %d 个过期拉黑（状态: %s，等级保留，等待降级）: %v", len(recovered), nextState, recovered)
 	}
 
 	if len(failed) > 0 {
@@ -667,12 +926,16 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 		SELECT
 			platform,
 			provider_name,
+			model,
 			failure_count,
 			blacklisted_at,
 			blacklisted_until,
 			last_failure_at,
 			blacklist_level,
-			last_recovered_at
+			last_recovered_at,
+			circuit_state,
+			half_open_successes,
+			circuit_changed_at
 		FROM provider_blacklist
 		WHERE platform = ?
 		ORDER BY last_failure_at DESC
@@ -688,17 +951,23 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 
 	for rows.Next() {
 		var s BlacklistStatus
-		var blacklistedAt, blacklistedUntil, lastFailureAt, lastRecoveredAt sql.NullTime
+		var blacklistedAt, blacklistedUntil, lastFailureAt, lastRecoveredAt, circuitChangedAt sql.NullTime
+		var circuitState sql.NullString
+		var halfOpenSuccesses sql.NullInt64
 
 		err := rows.Scan(
 			&s.Platform,
 			&s.ProviderName,
+			&s.Model,
 			&s.FailureCount,
 			&blacklistedAt,
 			&blacklistedUntil,
 			&lastFailureAt,
 			&s.BlacklistLevel,
 			&lastRecoveredAt,
+			&circuitState,
+			&halfOpenSuccesses,
+			&circuitChangedAt,
 		)
 
 		if err != nil {
@@ -723,6 +992,14 @@ func (bs *BlacklistService) GetBlacklistStatus(platform string) ([]BlacklistStat
 		if lastRecoveredAt.Valid {
 			s.LastRecoveredAt = &lastRecoveredAt.Time
 		}
+		s.CircuitState = effectiveCircuitState(circuitState.String, blacklistedUntil, now, levelConfig)
+		if s.CircuitState == CircuitStateHalfOpen {
+			s.HalfOpenSuccesses = int(halfOpenSuccesses.Int64)
+		}
+		if circuitChangedAt.Valid {
+			s.CircuitChangedAt = &circuitChangedAt.Time
+		}
+		s.RateWindow, s.RateTripReason = bs.rateWindowSnapshot(platform, s.ProviderName, s.Model, levelConfig, now)
 
 		// 计算宽恕倒计时（如果正在降级计时中）
 		if levelConfig.EnableLevelBlacklist && lastRecoveredAt.Valid && s.BlacklistLevel >= 3 {
@@ -845,3 +1122,59 @@ func (bs *BlacklistService) GetRetryConfig() *RetryConfig {
 		DedupeWindowSeconds: config.DedupeWindowSeconds,
 	}
 }
+
+// blacklistModelScope 返回失败追踪使用的模型维度：未开启按模型拉黑时为空（即整个 provider）
+func blacklistModelScope(levelConfig *BlacklistLevelConfig, model string) string {
+	if levelConfig == nil || !levelConfig.PerModelBlacklist {
+		return ""
+	}
+	return strings.TrimSpace(model)
+}
+
+// resetBlacklistScope 按模型拉黑开关切换后清理旧维度的拉黑记录与内存状态：
+// 切到按模型时旧的 provider 级记录仍会拉黑整个 provider，切回 provider 级时按模型的记录不再被读取
+func (bs *BlacklistService) resetBlacklistScope(perModel bool) {
+	condition := "model <> ''"
+	if perModel {
+		condition = "model = ''"
+	}
+	if GlobalDBQueue != nil {
+		if err := GlobalDBQueue.Exec(`DELETE FROM provider_blacklist WHERE ` + condition); err != nil {
+			log.Printf("⚠️  清理旧拉黑维度记录失败: %v", err)
+		}
+	}
+
+	bs.circuitMu.Lock()
+	bs.halfOpenTrials = make(map[string]*halfOpenTrial)
+	bs.circuitMu.Unlock()
+	bs.rateMu.Lock()
+	bs.rateWindows = make(map[string]*rateWindow)
+	bs.rateMu.Unlock()
+	log.Printf("🔄 按模型拉黑开关已切换（perModel=%v），已清理旧维度的拉黑记录", perModel)
+}
+
+// blacklistSubject 日志/通知中展示的拉黑对象，如 "provider" 或 "provider[model]"
+func blacklistSubject(providerName string, model string) string {
+	if model == "" {
+		return providerName
+	}
+	return providerName + "[" + model + "]"
+}
+
+// truncateEventReason 截断过长的失败原因（上游错误体可能很大）
+func truncateEventReason(reason string) string {
+	const maxLen = 500
+	reason = strings.TrimSpace(reason)
+	runes := []rune(reason)
+	if len(runes) <= maxLen {
+		return reason
+	}
+	return string(runes[:maxLen]) + "..."
+}
+
+// recordFailureEvent 失败被计入（未被去重、未处于拉黑中）时写入事件时间线
+func recordFailureEvent(event *ProviderEvent) {
+	if event != nil {
+		recordProviderEvent(*event)
+	}
+}
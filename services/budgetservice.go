@@ -0,0 +1,533 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+const (
+	BudgetScopeGlobal   = "global"
+	BudgetScopePlatform = "platform"
+	BudgetScopeProvider = "provider"
+
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+
+	// BudgetActionWarn 仅通知
+	BudgetActionWarn = "warn"
+	// BudgetActionBlock 超出上限后拒绝范围内的所有请求
+	BudgetActionBlock = "block"
+	// BudgetActionFlatRateOnly 超出上限后仅允许标记为免费/包月的 provider
+	BudgetActionFlatRateOnly = "flat_rate_only"
+
+	BudgetStateOK       = "ok"
+	BudgetStateWarning  = "warning"
+	BudgetStateExceeded = "exceeded"
+
+	defaultBudgetWarnPercent = 80
+)
+
+// BudgetRule 单条预算规则
+type BudgetRule struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Scope       string  `json:"scope"`              // global / platform / provider
+	Platform    string  `json:"platform,omitempty"` // scope 为 platform / provider 时必填
+	Provider    string  `json:"provider,omitempty"` // scope 为 provider 时必填
+	Period      string  `json:"period"`             // daily / weekly / monthly
+	LimitUSD    float64 `json:"limitUsd"`
+	WarnPercent float64 `json:"warnPercent"` // 预警阈值（百分比），默认 80
+	Action      string  `json:"action"`      // warn / block / flat_rate_only
+	Enabled     bool    `json:"enabled"`
+}
+
+// BudgetConfig 预算配置（~/.code-switch/budgets.json）
+type BudgetConfig struct {
+	Rules []BudgetRule `json:"rules"`
+}
+
+// BudgetStatus 预算规则在当前周期内的消耗情况
+type BudgetStatus struct {
+	Rule        BudgetRule `json:"rule"`
+	PeriodStart string     `json:"periodStart"`
+	PeriodEnd   string     `json:"periodEnd"`
+	SpentUSD    float64    `json:"spentUsd"`
+	Percent     float64    `json:"percent"`
+	State       string     `json:"state"` // ok / warning / exceeded
+}
+
+// BudgetAlert 预算预警 / 超限通知内容
+type BudgetAlert struct {
+	RuleID   string  `json:"ruleId"`
+	RuleName string  `json:"ruleName"`
+	Scope    string  `json:"scope"`
+	Platform string  `json:"platform"`
+	Provider string  `json:"provider"`
+	Period   string  `json:"period"`
+	State    string  `json:"state"` // warning / exceeded
+	Action   string  `json:"action"`
+	SpentUSD float64 `json:"spentUsd"`
+	LimitUSD float64 `json:"limitUsd"`
+	Percent  float64 `json:"percent"`
+}
+
+// budgetSpendKey 按平台 + 供应商累计费用
+type budgetSpendKey struct {
+	Platform string
+	Provider string
+}
+
+// budgetSpendWindow 某一周期（日/周/月）内的费用累计
+type budgetSpendWindow struct {
+	Start  time.Time
+	Spend  map[budgetSpendKey]float64
+	Loaded bool
+}
+
+// BudgetService 预算与消费上限服务
+// 费用来自 modelpricing 计价（与统计页按 request_log_rollup_hourly 的 token 计价一致），
+// 周期开始时从汇总表加载已有消费，之后随请求日志写入在内存中累加。
+type BudgetService struct {
+	notificationService *NotificationService
+	logService          *LogService // 按当前价格配置计价
+
+	mu      sync.Mutex
+	config  *BudgetConfig
+	windows map[string]*budgetSpendWindow // period -> window
+	alerted map[string]string             // ruleID|periodStart -> 已通知的最高状态
+	now     func() time.Time
+}
+
+// NewBudgetService 创建预算服务
+func NewBudgetService(notificationService *NotificationService) *BudgetService {
+	return &BudgetService{
+		notificationService: notificationService,
+		windows:             make(map[string]*budgetSpendWindow),
+		alerted:             make(map[string]string),
+		now:                 time.Now,
+	}
+}
+
+// SetLogService 设置计价使用的日志服务（未设置时按内置价格表计价）
+func (bs *BudgetService) SetLogService(logService *LogService) {
+	bs.logService = logService
+}
+
+// GetBudgetConfigPath 获取预算配置文件路径
+func GetBudgetConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	return filepath.Join(home, ".code-switch", "budgets.json"), nil
+}
+
+// GetBudgetConfig 获取预算配置
+func (bs *BudgetService) GetBudgetConfig() (BudgetConfig, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	config, err := bs.loadConfigLocked()
+	if err != nil {
+		return BudgetConfig{}, err
+	}
+	return cloneBudgetConfig(config), nil
+}
+
+// SaveBudgetConfig 校验并保存预算配置
+func (bs *BudgetService) SaveBudgetConfig(config BudgetConfig) error {
+	normalized, err := normalizeBudgetConfig(config)
+	if err != nil {
+		return err
+	}
+
+	configPath, err := GetBudgetConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := AtomicWriteJSON(configPath, normalized); err != nil {
+		return fmt.Errorf("保存预算配置失败: %w", err)
+	}
+
+	bs.mu.Lock()
+	bs.config = &normalized
+	bs.mu.Unlock()
+	return nil
+}
+
+// GetBudgetStatus 返回所有规则在当前周期的消耗情况
+func (bs *BudgetService) GetBudgetStatus() ([]BudgetStatus, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	config, err := bs.loadConfigLocked()
+	if err != nil {
+		return nil, err
+	}
+	now := bs.now()
+	result := make([]BudgetStatus, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		window, err := bs.windowLocked(rule.Period, now)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, budgetStatusFor(rule, window))
+	}
+	return result, nil
+}
+
+// recordRequestSpend 按请求用量计价后累计消费
+func (bs *BudgetService) recordRequestSpend(d *requestLogRollupDelta) {
+	if bs == nil || d == nil {
+		return
+	}
+	bs.RecordSpend(d.Platform, d.Provider, bs.logService.rollupCostUSD(d).TotalCost)
+}
+
+// RecordSpend 记录一次请求产生的费用，并检查是否越过预警 / 上限阈值
+func (bs *BudgetService) RecordSpend(platform, provider string, costUSD float64) {
+	if bs == nil || costUSD <= 0 {
+		return
+	}
+
+	bs.mu.Lock()
+	config, err := bs.loadConfigLocked()
+	if err != nil || len(config.Rules) == 0 {
+		bs.mu.Unlock()
+		if err != nil {
+			log.Printf("[Budget] 读取预算配置失败: %v", err)
+		}
+		return
+	}
+
+	windows := bs.addSpendLocked(budgetSpendKey{Platform: platform, Provider: provider}, costUSD, bs.now())
+	bs.pruneAlertedLocked(config)
+
+	var alerts []BudgetAlert
+	for _, rule := range config.Rules {
+		if !rule.Enabled || !rule.matches(platform, provider) {
+			continue
+		}
+		window := windows[rule.Period]
+		if window == nil {
+			continue
+		}
+		status := budgetStatusFor(rule, window)
+		if status.State == BudgetStateOK {
+			continue
+		}
+		alertKey := rule.ID + "|" + status.PeriodStart
+		if previous := bs.alerted[alertKey]; previous == status.State || previous == BudgetStateExceeded {
+			continue
+		}
+		bs.alerted[alertKey] = status.State
+		alerts = append(alerts, BudgetAlert{
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			Scope:    rule.Scope,
+			Platform: rule.Platform,
+			Provider: rule.Provider,
+			Period:   rule.Period,
+			State:    status.State,
+			Action:   rule.Action,
+			SpentUSD: status.SpentUSD,
+			LimitUSD: rule.LimitUSD,
+			Percent:  status.Percent,
+		})
+	}
+	bs.mu.Unlock()
+
+	for _, alert := range alerts {
+		log.Printf("[Budget] 预算 %s %s: $%.4f / $%.2f", alert.RuleName, alert.State, alert.SpentUSD, alert.LimitUSD)
+		if bs.notificationService != nil {
+			bs.notificationService.NotifyBudgetAlert(alert)
+		}
+	}
+}
+
+// CheckProvider 检查预算上限是否允许向该 provider 转发请求
+// 返回 false 时附带被触发的规则说明
+func (bs *BudgetService) CheckProvider(platform, provider string, flatRate bool) (bool, string) {
+	if bs == nil {
+		return true, ""
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	config, err := bs.loadConfigLocked()
+	if err != nil || len(config.Rules) == 0 {
+		return true, ""
+	}
+
+	now := bs.now()
+	for _, rule := range config.Rules {
+		if !rule.Enabled || rule.Action == BudgetActionWarn || !rule.matches(platform, provider) {
+			continue
+		}
+		if rule.Action == BudgetActionFlatRateOnly && flatRate {
+			continue
+		}
+		window, err := bs.windowLocked(rule.Period, now)
+		if err != nil {
+			log.Printf("[Budget] 加载 %s 周期消费失败: %v", rule.Period, err)
+			continue
+		}
+		status := budgetStatusFor(rule, window)
+		if status.State != BudgetStateExceeded {
+			continue
+		}
+		return false, fmt.Sprintf("预算 '%s' 已超出上限（$%.2f / $%.2f）", rule.displayName(), status.SpentUSD, rule.LimitUSD)
+	}
+	return true, ""
+}
+
+// loadConfigLocked 读取预算配置（带缓存），调用方需持有 bs.mu
+func (bs *BudgetService) loadConfigLocked() (*BudgetConfig, error) {
+	if bs.config != nil {
+		return bs.config, nil
+	}
+
+	configPath, err := GetBudgetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	config := &BudgetConfig{Rules: []BudgetRule{}}
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取预算配置失败: %w", err)
+	}
+	if err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("解析预算配置失败: %w", err)
+		}
+	}
+	bs.config = config
+	return config, nil
+}
+
+// windowLocked 返回当前周期的消费累计，周期切换时从汇总表重新加载
+func (bs *BudgetService) windowLocked(period string, now time.Time) (*budgetSpendWindow, error) {
+	start := budgetPeriodStart(period, now)
+	window := bs.windows[period]
+	if window != nil && window.Loaded && window.Start.Equal(start) {
+		return window, nil
+	}
+
+	spend, err := loadBudgetSpend(bs.logService, start, budgetPeriodEnd(period, start))
+	if err != nil {
+		return nil, err
+	}
+	window = &budgetSpendWindow{Start: start, Spend: spend, Loaded: true}
+	bs.windows[period] = window
+	return window, nil
+}
+
+// addSpendLocked 在同一临界区内完成各周期窗口的加载 / 切换与累加，返回本次累加所用的窗口；
+// 加载失败的周期不返回，避免用上一周期的旧窗口判断阈值
+func (bs *BudgetService) addSpendLocked(key budgetSpendKey, costUSD float64, now time.Time) map[string]*budgetSpendWindow {
+	windows := make(map[string]*budgetSpendWindow, 3)
+	for _, period := range []string{BudgetPeriodDaily, BudgetPeriodWeekly, BudgetPeriodMonthly} {
+		window, err := bs.windowLocked(period, now)
+		if err != nil {
+			log.Printf("[Budget] 加载 %s 周期消费失败: %v", period, err)
+			continue
+		}
+		window.Spend[key] += costUSD
+		windows[period] = window
+	}
+	return windows
+}
+
+// pruneAlertedLocked 清理已删除规则与已结束周期的通知记录，避免 alerted 无限增长
+func (bs *BudgetService) pruneAlertedLocked(config *BudgetConfig) {
+	current := make(map[string]struct{}, len(config.Rules))
+	for _, rule := range config.Rules {
+		if window := bs.windows[rule.Period]; window != nil {
+			current[rule.ID+"|"+window.Start.Format(timeLayout)] = struct{}{}
+		}
+	}
+	for alertKey := range bs.alerted {
+		if _, ok := current[alertKey]; !ok {
+			delete(bs.alerted, alertKey)
+		}
+	}
+}
+
+// loadBudgetSpend 从小时汇总表读取 [start, end) 内按平台 / 供应商的费用（按当前价格配置计价）
+func loadBudgetSpend(ls *LogService, start, end time.Time) (map[budgetSpendKey]float64, error) {
+	spend := make(map[budgetSpendKey]float64)
+	if _, err := xdb.DB("default"); err != nil {
+		return spend, nil
+	}
+
+	rows, err := queryRequestLogRollups(start, end, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		key := budgetSpendKey{Platform: rows[i].Platform, Provider: rows[i].Provider}
+		spend[key] += ls.rollupCostUSD(&rows[i].requestLogRollupDelta).TotalCost
+	}
+	return spend, nil
+}
+
+// budgetPeriodStart 计算周期起点（本地时间）：日为当天 0 点，周为周一 0 点，月为 1 号 0 点
+func budgetPeriodStart(period string, now time.Time) time.Time {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case BudgetPeriodWeekly:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case BudgetPeriodMonthly:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	default:
+		return day
+	}
+}
+
+// budgetPeriodEnd 计算周期终点（不含）
+func budgetPeriodEnd(period string, start time.Time) time.Time {
+	switch period {
+	case BudgetPeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case BudgetPeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// budgetStatusFor 根据周期消费计算规则状态
+func budgetStatusFor(rule BudgetRule, window *budgetSpendWindow) BudgetStatus {
+	status := BudgetStatus{
+		Rule:        rule,
+		PeriodStart: window.Start.Format(timeLayout),
+		PeriodEnd:   budgetPeriodEnd(rule.Period, window.Start).Format(timeLayout),
+		State:       BudgetStateOK,
+	}
+	for key, cost := range window.Spend {
+		if rule.matches(key.Platform, key.Provider) {
+			status.SpentUSD += cost
+		}
+	}
+	if rule.LimitUSD > 0 {
+		status.Percent = status.SpentUSD / rule.LimitUSD * 100
+	}
+	if !rule.Enabled || rule.LimitUSD <= 0 {
+		return status
+	}
+	switch {
+	case status.SpentUSD >= rule.LimitUSD:
+		status.State = BudgetStateExceeded
+	case status.Percent >= rule.WarnPercent:
+		status.State = BudgetStateWarning
+	}
+	return status
+}
+
+// matches 判断平台 / 供应商是否落在规则范围内
+func (r BudgetRule) matches(platform, provider string) bool {
+	switch r.Scope {
+	case BudgetScopePlatform:
+		return strings.EqualFold(r.Platform, platform)
+	case BudgetScopeProvider:
+		return strings.EqualFold(r.Platform, platform) && strings.EqualFold(r.Provider, provider)
+	default:
+		return true
+	}
+}
+
+func (r BudgetRule) displayName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.ID
+}
+
+// normalizeBudgetConfig 校验规则并补全默认值
+func normalizeBudgetConfig(config BudgetConfig) (BudgetConfig, error) {
+	normalized := BudgetConfig{Rules: make([]BudgetRule, 0, len(config.Rules))}
+	seen := make(map[string]bool)
+	for i, rule := range config.Rules {
+		rule.ID = strings.TrimSpace(rule.ID)
+		rule.Name = strings.TrimSpace(rule.Name)
+		rule.Platform = strings.ToLower(strings.TrimSpace(rule.Platform))
+		rule.Provider = strings.TrimSpace(rule.Provider)
+		rule.Scope = strings.ToLower(strings.TrimSpace(rule.Scope))
+		rule.Period = strings.ToLower(strings.TrimSpace(rule.Period))
+		rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+
+		if rule.ID == "" {
+			rule.ID = "budget-" + strconv.Itoa(i+1)
+		}
+		if seen[rule.ID] {
+			return BudgetConfig{}, fmt.Errorf("预算规则 ID 重复: %s", rule.ID)
+		}
+		seen[rule.ID] = true
+
+		if rule.Scope == "" {
+			rule.Scope = BudgetScopeGlobal
+		}
+		switch rule.Scope {
+		case BudgetScopeGlobal:
+			rule.Platform, rule.Provider = "", ""
+		case BudgetScopePlatform:
+			if rule.Platform == "" {
+				return BudgetConfig{}, fmt.Errorf("预算规则 %s 缺少平台", rule.ID)
+			}
+			rule.Provider = ""
+		case BudgetScopeProvider:
+			if rule.Platform == "" || rule.Provider == "" {
+				return BudgetConfig{}, fmt.Errorf("预算规则 %s 缺少平台或供应商", rule.ID)
+			}
+		default:
+			return BudgetConfig{}, fmt.Errorf("预算规则 %s 的范围无效: %s", rule.ID, rule.Scope)
+		}
+
+		if rule.Period == "" {
+			rule.Period = BudgetPeriodMonthly
+		}
+		switch rule.Period {
+		case BudgetPeriodDaily, BudgetPeriodWeekly, BudgetPeriodMonthly:
+		default:
+			return BudgetConfig{}, fmt.Errorf("预算规则 %s 的周期无效: %s", rule.ID, rule.Period)
+		}
+
+		if rule.Action == "" {
+			rule.Action = BudgetActionWarn
+		}
+		switch rule.Action {
+		case BudgetActionWarn, BudgetActionBlock, BudgetActionFlatRateOnly:
+		default:
+			return BudgetConfig{}, fmt.Errorf("预算规则 %s 的动作无效: %s", rule.ID, rule.Action)
+		}
+
+		if rule.LimitUSD <= 0 {
+			return BudgetConfig{}, fmt.Errorf("预算规则 %s 的上限必须大于 0", rule.ID)
+		}
+		if rule.WarnPercent <= 0 {
+			rule.WarnPercent = defaultBudgetWarnPercent
+		}
+		if rule.WarnPercent > 100 {
+			rule.WarnPercent = 100
+		}
+		normalized.Rules = append(normalized.Rules, rule)
+	}
+	return normalized, nil
+}
+
+func cloneBudgetConfig(config *BudgetConfig) BudgetConfig {
+	rules := make([]BudgetRule, len(config.Rules))
+	copy(rules, config.Rules)
+	return BudgetConfig{Rules: rules}
+}
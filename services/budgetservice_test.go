@@ -0,0 +1,133 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBudgetPeriodStart(t *testing.T) {
+	now := time.Date(2025, 3, 13, 15, 4, 5, 0, time.Local) // 周四
+	cases := map[string]string{
+		BudgetPeriodDaily:   "2025-03-13 00:00:00",
+		BudgetPeriodWeekly:  "2025-03-10 00:00:00",
+		BudgetPeriodMonthly: "2025-03-01 00:00:00",
+	}
+	for period, want := range cases {
+		if got := budgetPeriodStart(period, now).Format(timeLayout); got != want {
+			t.Fatalf("budgetPeriodStart(%s) = %s, want %s", period, got, want)
+		}
+	}
+
+	sunday := time.Date(2025, 3, 16, 23, 0, 0, 0, time.Local)
+	if got := budgetPeriodStart(BudgetPeriodWeekly, sunday).Format(timeLayout); got != "2025-03-10 00:00:00" {
+		t.Fatalf("weekly start for sunday = %s, want 2025-03-10 00:00:00", got)
+	}
+}
+
+func TestNormalizeBudgetConfig(t *testing.T) {
+	config, err := normalizeBudgetConfig(BudgetConfig{Rules: []BudgetRule{
+		{LimitUSD: 10},
+		{ID: "p", Scope: "Provider", Platform: "Claude", Provider: "a", Period: "daily", Action: "block", LimitUSD: 5, WarnPercent: 150},
+	}})
+	if err != nil {
+		t.Fatalf("normalizeBudgetConfig error: %v", err)
+	}
+	first := config.Rules[0]
+	if first.ID != "budget-1" || first.Scope != BudgetScopeGlobal || first.Period != BudgetPeriodMonthly || first.Action != BudgetActionWarn || first.WarnPercent != defaultBudgetWarnPercent {
+		t.Fatalf("defaults not applied: %+v", first)
+	}
+	second := config.Rules[1]
+	if second.Platform != "claude" || second.Scope != BudgetScopeProvider || second.WarnPercent != 100 {
+		t.Fatalf("rule not normalized: %+v", second)
+	}
+
+	if _, err := normalizeBudgetConfig(BudgetConfig{Rules: []BudgetRule{{Scope: BudgetScopeProvider, Platform: "claude", LimitUSD: 1}}}); err == nil {
+		t.Fatalf("expected error for provider scope without provider")
+	}
+	if _, err := normalizeBudgetConfig(BudgetConfig{Rules: []BudgetRule{{LimitUSD: 0}}}); err == nil {
+		t.Fatalf("expected error for non-positive limit")
+	}
+}
+
+func TestBudgetServiceThresholdsAndCheckProvider(t *testing.T) {
+	bs := NewBudgetService(nil)
+	bs.config = &BudgetConfig{Rules: []BudgetRule{
+		{ID: "claude", Scope: BudgetScopePlatform, Platform: "claude", Period: BudgetPeriodDaily, LimitUSD: 10, WarnPercent: 80, Action: BudgetActionFlatRateOnly, Enabled: true},
+	}}
+	bs.windows[BudgetPeriodDaily] = &budgetSpendWindow{Start: budgetPeriodStart(BudgetPeriodDaily, bs.now()), Spend: map[budgetSpendKey]float64{}, Loaded: true}
+	bs.windows[BudgetPeriodWeekly] = &budgetSpendWindow{Start: budgetPeriodStart(BudgetPeriodWeekly, bs.now()), Spend: map[budgetSpendKey]float64{}, Loaded: true}
+	bs.windows[BudgetPeriodMonthly] = &budgetSpendWindow{Start: budgetPeriodStart(BudgetPeriodMonthly, bs.now()), Spend: map[budgetSpendKey]float64{}, Loaded: true}
+
+	bs.RecordSpend("claude", "a", 8.5)
+	bs.RecordSpend("codex", "a", 100)
+	status, err := bs.GetBudgetStatus()
+	if err != nil {
+		t.Fatalf("GetBudgetStatus error: %v", err)
+	}
+	if status[0].State != BudgetStateWarning || status[0].SpentUSD != 8.5 {
+		t.Fatalf("status = %+v, want warning with 8.5 spent", status[0])
+	}
+	if allowed, _ := bs.CheckProvider("claude", "a", false); !allowed {
+		t.Fatalf("provider should be allowed before cap is reached")
+	}
+
+	bs.RecordSpend("claude", "b", 2)
+	if allowed, _ := bs.CheckProvider("claude", "a", false); allowed {
+		t.Fatalf("metered provider should be refused after cap is exceeded")
+	}
+	if allowed, _ := bs.CheckProvider("claude", "flat", true); !allowed {
+		t.Fatalf("flat-rate provider should stay allowed")
+	}
+	if allowed, _ := bs.CheckProvider("codex", "a", false); !allowed {
+		t.Fatalf("other platforms should not be affected")
+	}
+
+	// 已结束周期与已删除规则的通知记录会被清理
+	bs.alerted["claude|2000-01-01 00:00:00"] = BudgetStateExceeded
+	bs.alerted["removed|"+status[0].PeriodStart] = BudgetStateWarning
+	bs.RecordSpend("claude", "a", 1)
+	if len(bs.alerted) != 1 || bs.alerted["claude|"+status[0].PeriodStart] != BudgetStateExceeded {
+		t.Fatalf("alerted = %v, want only the current claude window", bs.alerted)
+	}
+}
+
+func TestBudgetRecordSpendAcrossRotation(t *testing.T) {
+	useTestDatabase(t)
+	bs := NewBudgetService(nil)
+	bs.config = &BudgetConfig{Rules: []BudgetRule{
+		{ID: "daily", Scope: BudgetScopeGlobal, Period: BudgetPeriodDaily, LimitUSD: 1000, WarnPercent: 80, Action: BudgetActionWarn, Enabled: true},
+	}}
+	var nowMu sync.Mutex
+	now := time.Date(2025, 3, 13, 23, 59, 0, 0, time.Local)
+	bs.now = func() time.Time {
+		nowMu.Lock()
+		defer nowMu.Unlock()
+		return now
+	}
+
+	record := func(n int) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bs.RecordSpend("claude", "a", 1)
+			}()
+		}
+		wg.Wait()
+	}
+	record(20)
+	nowMu.Lock()
+	now = now.Add(2 * time.Minute) // 跨过零点，日窗口切换
+	nowMu.Unlock()
+	record(30)
+
+	status, err := bs.GetBudgetStatus()
+	if err != nil {
+		t.Fatalf("GetBudgetStatus error: %v", err)
+	}
+	if status[0].PeriodStart != "2025-03-14 00:00:00" || status[0].SpentUSD != 30 {
+		t.Fatalf("status = %+v, want the new day with 30 spent", status[0])
+	}
+}
@@ -0,0 +1,993 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 配置同步：把工作区导出包的内容镜像到共享目录（同步盘挂载目录或 git 工作副本），定时拉取远端变化并三方合并
+// （base 为上次合并结果）。供应商按类型分文件、按 provider ID 做字段级合并（含自定义 CLI 工具的 custom:{toolId}）；
+// Gemini、MCP、提示词、技能仓库、自定义 CLI 工具与各项设置按条目合并。
+// 密钥只有在设置了同步口令时才以 AES-GCM 密文写入共享目录，否则共享目录中只有脱敏后的配置。
+const (
+	SyncBackendFolder = "folder"
+	SyncBackendGit    = "git"
+
+	syncDirName                = "code-switch-sync"
+	syncManifestFormat         = "code-switch-sync"
+	syncManifestVersion        = 1
+	defaultSyncIntervalSeconds = 300
+	minSyncIntervalSeconds     = 30
+
+	syncItemsFileName = "workspace.json"
+
+	syncSecretPrefix = "sync-enc:"
+	syncPassphraseID = "sync/passphrase"
+	syncCheckID      = "sync/check"
+	syncCheckValue   = "code-switch-sync"
+)
+
+// SyncConfig 同步配置（~/.code-switch/sync.json）
+type SyncConfig struct {
+	Enabled         bool   `json:"enabled"`
+	Backend         string `json:"backend"` // folder | git
+	Path            string `json:"path"`
+	IntervalSeconds int    `json:"intervalSeconds"`
+	EncryptSecrets  bool   `json:"encryptSecrets"` // 使用同步口令加密同步 API Key
+}
+
+// SyncConflict 合并时无法自动解决的差异（均以本地为准保留）
+type SyncConflict struct {
+	Kind       string   `json:"kind"`
+	ProviderID int64    `json:"providerId"`
+	Name       string   `json:"name"`
+	Fields     []string `json:"fields,omitempty"`
+	Reason     string   `json:"reason"`
+}
+
+// SyncStatus 最近一次同步的结果
+type SyncStatus struct {
+	Enabled       bool           `json:"enabled"`
+	Backend       string         `json:"backend"`
+	Path          string         `json:"path"`
+	Running       bool           `json:"running"`
+	HasPassphrase bool           `json:"hasPassphrase"`
+	LastSyncAt    time.Time      `json:"lastSyncAt"`
+	LastError     string         `json:"lastError,omitempty"`
+	LocalChanged  []string       `json:"localChanged"`  // 本次从远端应用了变化的 kind
+	RemoteChanged []string       `json:"remoteChanged"` // 本次写回共享目录的 kind
+	Conflicts     []SyncConflict `json:"conflicts"`
+}
+
+// syncManifest 共享目录中的清单
+type syncManifest struct {
+	Format     string        `json:"format"`
+	Version    int           `json:"version"`
+	Salt       string        `json:"salt,omitempty"` // 同步口令的 PBKDF2 盐（base64），空表示不含密钥
+	Iterations int           `json:"iterations,omitempty"`
+	Check      *sealedSecret `json:"check,omitempty"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
+	UpdatedBy  string        `json:"updatedBy"`
+}
+
+// ConfigSyncService 配置同步服务
+type ConfigSyncService struct {
+	workspaceService *WorkspaceService
+	providerService  *ProviderService
+
+	mu         sync.Mutex // 串行化同步过程
+	stateMu    sync.RWMutex
+	status     SyncStatus
+	passphrase string // 未启用密钥库时仅保存在内存
+	keySalt    string
+	key        []byte
+	running    bool
+	stopChan   chan struct{}
+}
+
+// NewConfigSyncService 创建配置同步服务（同步内容与工作区导出包一致）
+func NewConfigSyncService(workspaceService *WorkspaceService) *ConfigSyncService {
+	return &ConfigSyncService{
+		workspaceService: workspaceService,
+		providerService:  workspaceService.providerService,
+		status:           SyncStatus{LocalChanged: []string{}, RemoteChanged: []string{}, Conflicts: []SyncConflict{}},
+	}
+}
+
+func (css *ConfigSyncService) Start() error { return nil }
+func (css *ConfigSyncService) Stop() error  { return nil }
+
+// GetSyncConfig 读取同步配置
+func (css *ConfigSyncService) GetSyncConfig() (SyncConfig, error) {
+	return loadSyncConfig()
+}
+
+// SaveSyncConfig 校验并保存同步配置，按新配置重启定时同步
+func (css *ConfigSyncService) SaveSyncConfig(cfg SyncConfig) error {
+	cfg.Backend = strings.TrimSpace(cfg.Backend)
+	cfg.Path = strings.TrimSpace(cfg.Path)
+	if cfg.Backend == "" {
+		cfg.Backend = SyncBackendFolder
+	}
+	if cfg.IntervalSeconds <= 0 {
+		cfg.IntervalSeconds = defaultSyncIntervalSeconds
+	}
+	if cfg.IntervalSeconds < minSyncIntervalSeconds {
+		cfg.IntervalSeconds = minSyncIntervalSeconds
+	}
+	if cfg.Enabled {
+		if err := validateSyncTarget(cfg.Backend, cfg.Path); err != nil {
+			return err
+		}
+	} else if cfg.Backend != SyncBackendFolder && cfg.Backend != SyncBackendGit {
+		return fmt.Errorf("不支持的同步方式: %s", cfg.Backend)
+	}
+
+	previous, err := loadSyncConfig()
+	if err != nil {
+		return err
+	}
+	path, err := syncConfigPath()
+	if err != nil {
+		return err
+	}
+	css.mu.Lock()
+	if err := AtomicWriteJSON(path, cfg); err != nil {
+		css.mu.Unlock()
+		return fmt.Errorf("保存同步配置失败: %w", err)
+	}
+	// 换了同步目标后上次的合并基线不再适用
+	if previous.Backend != cfg.Backend || filepath.Clean(previous.Path) != filepath.Clean(cfg.Path) {
+		if dir, err := syncBaseDir(); err == nil {
+			_ = os.RemoveAll(dir)
+		}
+	}
+	css.mu.Unlock()
+
+	css.StopAutoSync()
+	css.StartAutoSync()
+	return nil
+}
+
+// SetSyncPassphrase 设置同步口令：启用密钥库时保存到密钥库，否则只在本次运行期间有效
+func (css *ConfigSyncService) SetSyncPassphrase(passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("口令不能为空")
+	}
+	vault := currentSecretVault()
+	if vault.Enabled() {
+		if vault.Locked() {
+			return errSecretVaultLocked
+		}
+		if _, err := vault.sealAll("sync/", map[string]string{syncPassphraseID: passphrase}); err != nil {
+			return fmt.Errorf("保存同步口令失败: %w", err)
+		}
+	}
+	css.stateMu.Lock()
+	css.passphrase = passphrase
+	css.keySalt = ""
+	css.key = nil
+	css.stateMu.Unlock()
+	return nil
+}
+
+// GetSyncStatus 返回最近一次同步结果
+func (css *ConfigSyncService) GetSyncStatus() SyncStatus {
+	cfg, _ := loadSyncConfig()
+	css.stateMu.RLock()
+	status := css.status
+	status.Running = css.running
+	css.stateMu.RUnlock()
+	status.Enabled = cfg.Enabled
+	status.Backend = cfg.Backend
+	status.Path = cfg.Path
+	status.HasPassphrase = css.currentPassphrase() != ""
+	return status
+}
+
+// SyncNow 立即执行一次同步
+func (css *ConfigSyncService) SyncNow() (SyncStatus, error) {
+	cfg, err := loadSyncConfig()
+	if err != nil {
+		return css.GetSyncStatus(), err
+	}
+	if !cfg.Enabled {
+		return css.GetSyncStatus(), fmt.Errorf("配置同步未启用")
+	}
+
+	css.mu.Lock()
+	result, err := css.syncOnce(cfg)
+	css.mu.Unlock()
+
+	css.stateMu.Lock()
+	if result != nil {
+		css.status = *result
+	}
+	css.status.LastSyncAt = time.Now()
+	css.status.LastError = ""
+	if err != nil {
+		css.status.LastError = err.Error()
+	}
+	css.stateMu.Unlock()
+	return css.GetSyncStatus(), err
+}
+
+// StartAutoSync 按配置的间隔启动定时同步（未启用时不做任何事）
+func (css *ConfigSyncService) StartAutoSync() {
+	cfg, err := loadSyncConfig()
+	if err != nil {
+		log.Printf("[ConfigSync] 读取同步配置失败: %v", err)
+		return
+	}
+	if !cfg.Enabled {
+		return
+	}
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+
+	css.stateMu.Lock()
+	defer css.stateMu.Unlock()
+	if css.running {
+		return
+	}
+	css.stopChan = make(chan struct{})
+	css.running = true
+	stopChan := css.stopChan
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := css.SyncNow(); err != nil {
+				log.Printf("[ConfigSync] 同步失败: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stopChan:
+				log.Println("[ConfigSync] 定时同步已停止")
+				return
+			}
+		}
+	}()
+
+	log.Printf("[ConfigSync] 定时同步已启动（%s: %s，间隔: %v）", cfg.Backend, cfg.Path, interval)
+}
+
+// StopAutoSync 停止定时同步
+func (css *ConfigSyncService) StopAutoSync() {
+	css.stateMu.Lock()
+	defer css.stateMu.Unlock()
+	if !css.running {
+		return
+	}
+	close(css.stopChan)
+	css.running = false
+}
+
+// syncOnce 拉取 → 逐类型三方合并 → 写回本地与共享目录 → 推送，调用方必须持有 css.mu
+// git 推送被拒（其他机器抢先推送）时重新拉取并合并一次；合并基线在推送成功后才更新，
+// 因此被丢弃的本地提交会在重新合并时按本地配置重新生成
+func (css *ConfigSyncService) syncOnce(cfg SyncConfig) (*SyncStatus, error) {
+	if secretVaultLocked() {
+		return nil, errSecretVaultLocked
+	}
+	if err := validateSyncTarget(cfg.Backend, cfg.Path); err != nil {
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		status, err := css.syncAttempt(cfg)
+		if err == errSyncPushRejected && attempt < 2 {
+			log.Printf("[ConfigSync] 推送被拒绝，重新拉取后再试一次")
+			continue
+		}
+		return status, err
+	}
+}
+
+// errSyncPushRejected git 推送因远端有新提交被拒绝
+var errSyncPushRejected = fmt.Errorf("git push 被拒绝：远端有新的提交")
+
+// syncAttempt 执行一轮同步
+func (css *ConfigSyncService) syncAttempt(cfg SyncConfig) (*SyncStatus, error) {
+	if cfg.Backend == SyncBackendGit {
+		if err := gitSyncPull(cfg.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	dir := filepath.Join(cfg.Path, syncDirName)
+	manifest, err := readSyncManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifestChanged := false
+	if manifest == nil {
+		manifest = &syncManifest{Format: syncManifestFormat, Version: syncManifestVersion}
+		manifestChanged = true
+	}
+	crypt, created, err := css.syncCrypt(cfg, manifest)
+	if err != nil {
+		return nil, err
+	}
+	manifestChanged = manifestChanged || created
+
+	status := &SyncStatus{LocalChanged: []string{}, RemoteChanged: []string{}, Conflicts: []SyncConflict{}}
+	// 先合并自定义 CLI 工具等条目，远端新增的工具在本地创建后，其供应商才能参与下面的合并
+	items, err := css.syncItems(dir, crypt, status)
+	if err != nil {
+		return status, fmt.Errorf("同步工作区配置失败: %w", err)
+	}
+	kinds, err := css.syncProviderKinds()
+	if err != nil {
+		return status, err
+	}
+	merged := make(map[string][]Provider, len(kinds))
+	for _, kind := range kinds {
+		result, err := css.syncKind(kind, dir, crypt)
+		if err != nil {
+			return status, fmt.Errorf("同步 %s 配置失败: %w", kind, err)
+		}
+		merged[kind] = result.merged
+		if result.localChanged {
+			status.LocalChanged = append(status.LocalChanged, kind)
+		}
+		if result.remoteChanged {
+			status.RemoteChanged = append(status.RemoteChanged, kind)
+		}
+		status.Conflicts = append(status.Conflicts, result.conflicts...)
+	}
+
+	if manifestChanged || len(status.RemoteChanged) > 0 {
+		manifest.UpdatedAt = time.Now().UTC()
+		manifest.UpdatedBy, _ = os.Hostname()
+		if err := AtomicWriteJSON(filepath.Join(dir, "manifest.json"), manifest); err != nil {
+			return status, fmt.Errorf("写入同步清单失败: %w", err)
+		}
+		if cfg.Backend == SyncBackendGit {
+			if err := gitSyncPush(cfg.Path, status.RemoteChanged); err != nil {
+				return status, err
+			}
+		}
+	}
+	if items != nil {
+		if err := saveSyncItemsBase(items, crypt != nil); err != nil {
+			return status, err
+		}
+	}
+	for _, kind := range kinds {
+		if err := saveSyncBase(kind, merged[kind], crypt != nil); err != nil {
+			return status, err
+		}
+	}
+	if len(status.LocalChanged) > 0 || len(status.Conflicts) > 0 {
+		log.Printf("[ConfigSync] 同步完成：本地更新 %v，冲突 %d 项", status.LocalChanged, len(status.Conflicts))
+	}
+	return status, nil
+}
+
+// syncProviderKinds 参与同步的供应商类型：claude/codex 与本地的自定义 CLI 工具（工具 ID 在各台机器上一致）
+func (css *ConfigSyncService) syncProviderKinds() ([]string, error) {
+	kinds := []string{"claude", "codex"}
+	if css.workspaceService.customCliService == nil {
+		return kinds, nil
+	}
+	tools, err := css.workspaceService.customCliService.ListTools()
+	if err != nil {
+		return nil, fmt.Errorf("加载自定义 CLI 工具失败: %w", err)
+	}
+	for _, tool := range tools {
+		kinds = append(kinds, "custom:"+tool.ID)
+	}
+	return kinds, nil
+}
+
+// syncKindFileName 类型对应的文件名（custom:{toolId} 中的冒号不能出现在 Windows 文件名中）
+func syncKindFileName(kind string) string {
+	return strings.ReplaceAll(kind, ":", "-")
+}
+
+// syncKindResult 单个类型的合并结果
+type syncKindResult struct {
+	merged        []Provider
+	localChanged  bool
+	remoteChanged bool
+	conflicts     []SyncConflict
+}
+
+// syncKind 合并单个类型的供应商配置
+func (css *ConfigSyncService) syncKind(kind, dir string, crypt *syncCrypt) (syncKindResult, error) {
+	remotePath := filepath.Join(dir, "providers-"+syncKindFileName(kind)+".json")
+	remoteRaw, remote, err := readSyncProviders(remotePath)
+	if err != nil {
+		return syncKindResult{}, err
+	}
+	remoteKeys := make(map[int64]string, len(remote))
+	for i := range remote {
+		remoteKeys[remote[i].ID] = remote[i].APIKey
+		remote[i].APIKey = ""
+		if crypt != nil && strings.HasPrefix(remoteKeys[remote[i].ID], syncSecretPrefix) {
+			value, err := crypt.open(kind, remote[i].ID, remoteKeys[remote[i].ID])
+			if err != nil {
+				return syncKindResult{}, fmt.Errorf("解密 %s 的 API Key 失败: %w", remote[i].Name, err)
+			}
+			remote[i].APIKey = value
+		}
+	}
+	base, err := loadSyncBase(kind)
+	if err != nil {
+		return syncKindResult{}, err
+	}
+
+	ps := css.providerService
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	local, err := ps.loadProvidersRaw(kind)
+	if err != nil {
+		return syncKindResult{}, err
+	}
+	if crypt != nil {
+		// 远端没有密文（由未设置口令的机器写入）表示对 API Key 没有意见，不能当作清空
+		localKeys := make(map[int64]string, len(local))
+		for _, p := range local {
+			localKeys[p.ID] = p.APIKey
+		}
+		for i := range remote {
+			if remoteKeys[remote[i].ID] == "" {
+				remote[i].APIKey = localKeys[remote[i].ID]
+			}
+		}
+	}
+	merged, conflicts, renumbered := mergeProviderLists(kind, base, local, remote, crypt != nil)
+
+	localChanged := !reflect.DeepEqual(syncFieldMaps(local, true), syncFieldMaps(merged, true))
+	if len(renumbered) > 0 {
+		// 分两步保存：先把本地供应商挪到新 ID，再让远端供应商占用原 ID，避免触发“name 不可修改”校验
+		staged := cloneProviders(local)
+		for i := range staged {
+			if newID, ok := renumbered[staged[i].ID]; ok {
+				staged[i].ID = newID
+			}
+		}
+		if err := ps.saveProvidersLocked(kind, staged); err != nil {
+			return syncKindResult{conflicts: conflicts}, fmt.Errorf("调整本地供应商 ID 失败: %w", err)
+		}
+	}
+	if localChanged {
+		if err := ps.saveProvidersLocked(kind, cloneProviders(merged)); err != nil {
+			return syncKindResult{conflicts: conflicts}, fmt.Errorf("应用远端配置失败: %w", err)
+		}
+	}
+
+	// 写回共享目录：有同步口令时加密 API Key，否则保留远端已有的密文（本机无法解读，原样透传）
+	shared := cloneProviders(merged)
+	for i := range shared {
+		key := ""
+		if crypt != nil {
+			if shared[i].APIKey != "" {
+				if key, err = crypt.seal(kind, shared[i].ID, shared[i].APIKey); err != nil {
+					return syncKindResult{localChanged: localChanged, conflicts: conflicts}, err
+				}
+				if existing := remoteKeys[shared[i].ID]; existing != "" {
+					// 明文未变化时沿用原密文，避免每次同步都产生新的随机 nonce
+					if value, openErr := crypt.open(kind, shared[i].ID, existing); openErr == nil && value == shared[i].APIKey {
+						key = existing
+					}
+				}
+			}
+		} else if strings.HasPrefix(remoteKeys[shared[i].ID], syncSecretPrefix) {
+			key = remoteKeys[shared[i].ID]
+		}
+		shared[i].APIKey = key
+	}
+	data, err := json.MarshalIndent(providerEnvelope{Providers: shared}, "", "  ")
+	if err != nil {
+		return syncKindResult{localChanged: localChanged, conflicts: conflicts}, err
+	}
+	remoteChanged := !bytes.Equal(remoteRaw, data)
+	if remoteChanged {
+		if err := AtomicWriteBytes(remotePath, data); err != nil {
+			return syncKindResult{localChanged: localChanged, conflicts: conflicts}, fmt.Errorf("写入共享目录失败: %w", err)
+		}
+	}
+
+	return syncKindResult{merged: merged, localChanged: localChanged, remoteChanged: remoteChanged, conflicts: conflicts}, nil
+}
+
+// mergeProviderLists 按 provider ID 三方合并；无法自动解决的字段以本地为准并记录冲突
+// withKeys 为 false 时 API Key 不参与合并，始终保留本地值
+// 第三个返回值为因 ID 冲突而改号的本地供应商（旧 ID -> 新 ID）
+func mergeProviderLists(kind string, base, local, remote []Provider, withKeys bool) ([]Provider, []SyncConflict, map[int64]int64) {
+	baseByID := syncFieldMapByID(base, withKeys)
+	remoteByID := make(map[int64]Provider, len(remote))
+	for _, p := range remote {
+		remoteByID[p.ID] = p
+	}
+	localByID := make(map[int64]Provider, len(local))
+	maxID := int64(0)
+	for _, list := range [][]Provider{base, local, remote} {
+		for _, p := range list {
+			if p.ID > maxID {
+				maxID = p.ID
+			}
+		}
+	}
+
+	merged := make([]Provider, 0, len(local)+len(remote))
+	conflicts := make([]SyncConflict, 0)
+	renumbered := make(map[int64]int64)
+	for _, l := range local {
+		localByID[l.ID] = l
+		b, inBase := baseByID[l.ID]
+		r, inRemote := remoteByID[l.ID]
+		switch {
+		case !inRemote && !inBase:
+			merged = append(merged, l)
+		case !inRemote:
+			if reflect.DeepEqual(syncFieldMap(l, withKeys), b) {
+				continue // 远端已删除，本地未修改
+			}
+			merged = append(merged, l)
+			conflicts = append(conflicts, SyncConflict{Kind: kind, ProviderID: l.ID, Name: l.Name, Reason: "远端已删除，本地有修改，已保留本地"})
+		case !inBase && l.Name != r.Name:
+			// 两台机器各自新增了相同 ID：远端占用该 ID，本地供应商改用新 ID
+			maxID++
+			conflicts = append(conflicts, SyncConflict{Kind: kind, ProviderID: maxID, Name: l.Name, Reason: fmt.Sprintf("与远端 %s 的 ID 冲突，本地已改用新 ID", r.Name)})
+			renumbered[l.ID] = maxID
+			l.ID = maxID
+			merged = append(merged, l)
+			localByID[r.ID] = r
+			merged = append(merged, r)
+		default:
+			p, fields := mergeProviderFields(b, l, r, withKeys)
+			merged = append(merged, p)
+			if len(fields) > 0 {
+				conflicts = append(conflicts, SyncConflict{Kind: kind, ProviderID: l.ID, Name: l.Name, Fields: fields, Reason: "双方修改了相同字段，已保留本地"})
+			}
+		}
+	}
+	for _, r := range remote {
+		if _, ok := localByID[r.ID]; ok {
+			continue
+		}
+		if b, inBase := baseByID[r.ID]; inBase {
+			if reflect.DeepEqual(syncFieldMap(r, withKeys), b) {
+				continue // 本地已删除，远端未修改
+			}
+			conflicts = append(conflicts, SyncConflict{Kind: kind, ProviderID: r.ID, Name: r.Name, Reason: "本地已删除，远端有修改，已保留远端"})
+		}
+		merged = append(merged, r)
+	}
+	return merged, conflicts, renumbered
+}
+
+// mergeProviderFields 字段级三方合并，返回合并结果与冲突字段
+func mergeProviderFields(base map[string]interface{}, local, remote Provider, withKeys bool) (Provider, []string) {
+	l := syncFieldMap(local, withKeys)
+	r := syncFieldMap(remote, withKeys)
+	result := make(map[string]interface{}, len(l))
+	keyFromRemote := false
+	conflicts := make([]string, 0)
+
+	fields := make(map[string]bool, len(l)+len(r))
+	for key := range l {
+		fields[key] = true
+	}
+	for key := range r {
+		fields[key] = true
+	}
+	for field := range fields {
+		lv, lok := l[field]
+		rv, rok := r[field]
+		bv, bok := base[field]
+		takeRemote := false
+		switch {
+		case lok == rok && reflect.DeepEqual(lv, rv):
+		case base != nil && lok == bok && reflect.DeepEqual(lv, bv):
+			takeRemote = true
+		case base != nil && rok == bok && reflect.DeepEqual(rv, bv):
+		default:
+			conflicts = append(conflicts, field)
+		}
+		// name 在本地不可修改（黑名单/统计以 name 为 key），远端改名记为冲突
+		if takeRemote && field == "name" {
+			takeRemote = false
+			conflicts = append(conflicts, field)
+		}
+		if takeRemote {
+			if rok {
+				result[field] = rv
+			}
+			keyFromRemote = keyFromRemote || field == "apiKey"
+		} else if lok {
+			result[field] = lv
+		}
+	}
+	sort.Strings(conflicts)
+
+	merged := Provider{}
+	if data, err := json.Marshal(result); err == nil {
+		_ = json.Unmarshal(data, &merged)
+	}
+	merged.ID = local.ID
+	merged.APIKey = local.APIKey
+	if keyFromRemote {
+		merged.APIKey = remote.APIKey
+	}
+	return merged, conflicts
+}
+
+// syncFieldMap 合并用的字段表：API Key 以摘要参与比较，withKeys 为 false 时不参与
+func syncFieldMap(p Provider, withKeys bool) map[string]interface{} {
+	fields := configFieldMap(p)
+	delete(fields, "apiKey")
+	if withKeys {
+		fields["apiKey"] = secretDigest(p.APIKey)
+	}
+	return fields
+}
+
+func syncFieldMapByID(providers []Provider, withKeys bool) map[int64]map[string]interface{} {
+	result := make(map[int64]map[string]interface{}, len(providers))
+	for _, p := range providers {
+		result[p.ID] = syncFieldMap(p, withKeys)
+	}
+	return result
+}
+
+func syncFieldMaps(providers []Provider, withKeys bool) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(providers))
+	for _, p := range providers {
+		result = append(result, syncFieldMap(p, withKeys))
+	}
+	return result
+}
+
+func cloneProviders(providers []Provider) []Provider {
+	cloned := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		var copied Provider
+		if data, err := json.Marshal(p); err == nil && json.Unmarshal(data, &copied) == nil {
+			cloned = append(cloned, copied)
+		} else {
+			cloned = append(cloned, p)
+		}
+	}
+	return cloned
+}
+
+// syncCrypt 同步口令派生的加密器，密文以 provider 的密钥 ID 作为附加数据
+type syncCrypt struct {
+	key []byte
+}
+
+func (c *syncCrypt) seal(kind string, providerID int64, value string) (string, error) {
+	return c.sealWith(providerSecretID(kind, providerID), value)
+}
+
+func (c *syncCrypt) open(kind string, providerID int64, value string) (string, error) {
+	return c.openWith(providerSecretID(kind, providerID), value)
+}
+
+// syncItemSecretID 工作区条目密文的附加数据
+func syncItemSecretID(key string) string {
+	return "sync/item/" + key
+}
+
+func (c *syncCrypt) sealWith(id, value string) (string, error) {
+	aead, err := newVaultAEAD(c.key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealVaultValue(aead, id, value)
+	if err != nil {
+		return "", err
+	}
+	return syncSecretPrefix + sealed.Nonce + "." + sealed.Data, nil
+}
+
+func (c *syncCrypt) openWith(id, value string) (string, error) {
+	nonce, data, ok := strings.Cut(strings.TrimPrefix(value, syncSecretPrefix), ".")
+	if !ok {
+		return "", fmt.Errorf("密文格式无效")
+	}
+	aead, err := newVaultAEAD(c.key)
+	if err != nil {
+		return "", err
+	}
+	return openVaultValue(aead, id, sealedSecret{Nonce: nonce, Data: data})
+}
+
+// syncCrypt 返回本次同步使用的加密器；未开启加密或共享目录不含密钥时返回 nil
+// 第二个返回值表示清单中新建了盐与校验值
+func (css *ConfigSyncService) syncCrypt(cfg SyncConfig, manifest *syncManifest) (*syncCrypt, bool, error) {
+	if !cfg.EncryptSecrets {
+		return nil, false, nil
+	}
+	passphrase := css.currentPassphrase()
+	if passphrase == "" {
+		return nil, false, fmt.Errorf("已开启密钥同步，请先设置同步口令")
+	}
+
+	created := false
+	if manifest.Salt == "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, false, fmt.Errorf("生成随机数失败: %w", err)
+		}
+		manifest.Salt = base64.StdEncoding.EncodeToString(salt)
+		manifest.Iterations = secretVaultKDFIters
+		manifest.Check = nil
+		created = true
+	}
+
+	css.stateMu.Lock()
+	key := css.key
+	if css.keySalt != manifest.Salt {
+		key = nil
+	}
+	css.stateMu.Unlock()
+	if key == nil {
+		salt, err := base64.StdEncoding.DecodeString(manifest.Salt)
+		if err != nil {
+			return nil, false, fmt.Errorf("同步清单中的盐无效: %w", err)
+		}
+		if err := checkVaultKDFIterations(manifest.Iterations); err != nil {
+			return nil, false, err
+		}
+		if key, err = deriveVaultKey(passphrase, salt, manifest.Iterations); err != nil {
+			return nil, false, err
+		}
+	}
+	aead, err := newVaultAEAD(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if manifest.Check == nil {
+		check, err := sealVaultValue(aead, syncCheckID, syncCheckValue)
+		if err != nil {
+			return nil, false, err
+		}
+		manifest.Check = &check
+		created = true
+	} else if value, err := openVaultValue(aead, syncCheckID, *manifest.Check); err != nil || value != syncCheckValue {
+		return nil, false, fmt.Errorf("同步口令与共享目录不匹配")
+	}
+
+	css.stateMu.Lock()
+	css.keySalt = manifest.Salt
+	css.key = key
+	css.stateMu.Unlock()
+	return &syncCrypt{key: key}, created, nil
+}
+
+// currentPassphrase 优先使用内存中的口令，其次读取密钥库
+func (css *ConfigSyncService) currentPassphrase() string {
+	css.stateMu.RLock()
+	passphrase := css.passphrase
+	css.stateMu.RUnlock()
+	if passphrase != "" {
+		return passphrase
+	}
+	vault := currentSecretVault()
+	if !vault.Enabled() || vault.Locked() {
+		return ""
+	}
+	value, err := vault.resolve(secretRefPrefix + syncPassphraseID)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// validateSyncTarget 校验同步目录；git 方式要求是工作副本
+func validateSyncTarget(backend, path string) error {
+	if backend != SyncBackendFolder && backend != SyncBackendGit {
+		return fmt.Errorf("不支持的同步方式: %s", backend)
+	}
+	if path == "" {
+		return fmt.Errorf("同步目录不能为空")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("同步目录不可用: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("同步路径不是目录: %s", path)
+	}
+	if backend == SyncBackendGit {
+		if _, err := runSyncGit(path, "rev-parse", "--is-inside-work-tree"); err != nil {
+			return fmt.Errorf("同步目录不是 git 工作副本: %w", err)
+		}
+	}
+	return nil
+}
+
+func runSyncGit(dir string, args ...string) (string, error) {
+	cmd := hideWindowCmd("git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("git %s 失败: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// gitSyncHasUpstream 当前分支是否配置了上游（纯本地仓库不拉取/推送）
+func gitSyncHasUpstream(dir string) bool {
+	_, err := runSyncGit(dir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	return err == nil
+}
+
+// gitSyncPull 以 rebase 方式拉取；本地未推送的同步提交与远端冲突时放弃这些提交，
+// 以远端为准（其内容来自本地配置，且未进入合并基线，本轮合并会重新生成）
+func gitSyncPull(dir string) error {
+	if !gitSyncHasUpstream(dir) {
+		return nil
+	}
+	if _, err := runSyncGit(dir, "pull", "--rebase"); err == nil {
+		return nil
+	} else if _, stateErr := runSyncGit(dir, "rev-parse", "--verify", "--quiet", "REBASE_HEAD"); stateErr != nil {
+		return err // 不是 rebase 冲突（如网络错误）
+	}
+	log.Printf("[ConfigSync] 本地同步提交与远端冲突，以远端为准重新合并")
+	if _, err := runSyncGit(dir, "rebase", "--abort"); err != nil {
+		return err
+	}
+	_, err := runSyncGit(dir, "reset", "--keep", "@{u}")
+	return err
+}
+
+// gitSyncPush 提交共享目录的变化并推送
+func gitSyncPush(dir string, kinds []string) error {
+	if _, err := runSyncGit(dir, "add", "--", syncDirName); err != nil {
+		return err
+	}
+	output, err := runSyncGit(dir, "status", "--porcelain", "--", syncDirName)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	message := fmt.Sprintf("code-switch: sync %s from %s", strings.Join(kinds, ", "), host)
+	if len(kinds) == 0 {
+		message = fmt.Sprintf("code-switch: update sync manifest from %s", host)
+	}
+	if _, err := runSyncGit(dir, "commit", "-m", message, "--", syncDirName); err != nil {
+		return err
+	}
+	if !gitSyncHasUpstream(dir) {
+		return nil
+	}
+	if output, err := runSyncGit(dir, "push"); err != nil {
+		if strings.Contains(output, "[rejected]") || strings.Contains(output, "non-fast-forward") || strings.Contains(output, "fetch first") {
+			return errSyncPushRejected
+		}
+		return err
+	}
+	return nil
+}
+
+func readSyncManifest(dir string) (*syncManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取同步清单失败: %w", err)
+	}
+	var manifest syncManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析同步清单失败: %w", err)
+	}
+	if manifest.Format != syncManifestFormat {
+		return nil, fmt.Errorf("不是 code-switch 同步目录")
+	}
+	if manifest.Version > syncManifestVersion {
+		return nil, fmt.Errorf("同步目录版本 %d 过新，请先升级应用", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// readSyncProviders 读取共享目录中的供应商配置，同时返回原始内容用于判断是否需要写回
+func readSyncProviders(path string) ([]byte, []Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, []Provider{}, nil
+		}
+		return nil, nil, err
+	}
+	var envelope providerEnvelope
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, nil, fmt.Errorf("解析 %s 失败: %w", filepath.Base(path), err)
+		}
+	}
+	if envelope.Providers == nil {
+		envelope.Providers = []Provider{}
+	}
+	return data, envelope.Providers, nil
+}
+
+func syncConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "sync.json"), nil
+}
+
+func syncBaseDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "sync-base"), nil
+}
+
+func loadSyncConfig() (SyncConfig, error) {
+	cfg := SyncConfig{Backend: SyncBackendFolder, IntervalSeconds: defaultSyncIntervalSeconds}
+	path, err := syncConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("读取同步配置失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("解析同步配置失败: %w", err)
+	}
+	if cfg.IntervalSeconds < minSyncIntervalSeconds {
+		cfg.IntervalSeconds = defaultSyncIntervalSeconds
+	}
+	return cfg, nil
+}
+
+// loadSyncBase 读取上次合并结果（API Key 为摘要）
+func loadSyncBase(kind string) ([]Provider, error) {
+	dir, err := syncBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	providers, err := readProviderSnapshot(filepath.Join(dir, syncKindFileName(kind)+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取同步基线失败: %w", err)
+	}
+	return providers, nil
+}
+
+func saveSyncBase(kind string, providers []Provider, withKeys bool) error {
+	dir, err := syncBaseDir()
+	if err != nil {
+		return err
+	}
+	stored := cloneProviders(providers)
+	for i := range stored {
+		stored[i].APIKey = ""
+		if withKeys {
+			stored[i].APIKey = secretDigest(providers[i].APIKey)
+		}
+	}
+	if err := AtomicWriteJSON(filepath.Join(dir, syncKindFileName(kind)+".json"), providerEnvelope{Providers: stored}); err != nil {
+		return fmt.Errorf("保存同步基线失败: %w", err)
+	}
+	return nil
+}
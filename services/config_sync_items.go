@@ -0,0 +1,449 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 配置同步中除供应商以外的工作区条目（workspace.json）：key 与导入预览的条目 key 一致，
+// 自定义 CLI 工具按工具 ID、Gemini/MCP 按名称、提示词按 平台/ID、设置按键名。
+// 未设置同步口令时写入脱敏后的明文（应用到本地时由导入逻辑补回本地密钥），设置后每个条目整体加密。
+
+// syncItemsFile 共享目录中的工作区条目
+type syncItemsFile struct {
+	Items  map[string]json.RawMessage `json:"items,omitempty"`
+	Sealed map[string]string          `json:"sealed,omitempty"`
+}
+
+// syncItemsBase 上次合并结果的条目摘要；withKeys 与本次不一致（开关了密钥同步）时基线作废
+type syncItemsBase struct {
+	WithKeys bool              `json:"withKeys"`
+	Items    map[string]string `json:"items"`
+}
+
+// syncItems 按条目三方合并工作区配置并应用到本地，返回需要保存为基线的合并结果；
+// 共享目录中的条目已加密而本机未设置口令时跳过（返回 nil）
+func (css *ConfigSyncService) syncItems(dir string, crypt *syncCrypt, status *SyncStatus) (map[string]json.RawMessage, error) {
+	remotePath := filepath.Join(dir, syncItemsFileName)
+	remoteRaw, file, err := readSyncItems(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if crypt == nil && len(file.Sealed) > 0 {
+		status.Conflicts = append(status.Conflicts, SyncConflict{Kind: "workspace", Reason: "共享目录中的工作区配置已加密，设置同步口令后才能同步"})
+		return nil, nil
+	}
+	remote := make(map[string]json.RawMessage, len(file.Items)+len(file.Sealed))
+	for key, value := range file.Items {
+		remote[key] = canonicalSyncItem(value)
+	}
+	for key, value := range file.Sealed {
+		plain, err := crypt.openWith(syncItemSecretID(key), value)
+		if err != nil {
+			return nil, fmt.Errorf("解密 %s 失败: %w", key, err)
+		}
+		remote[key] = canonicalSyncItem(json.RawMessage(plain))
+	}
+
+	ws := css.workspaceService
+	data, err := ws.collectWorkspace(crypt == nil)
+	if err != nil {
+		return nil, err
+	}
+	local, err := syncItemsFromWorkspace(data)
+	if err != nil {
+		return nil, err
+	}
+	base, err := loadSyncItemsBase(crypt != nil)
+	if err != nil {
+		return nil, err
+	}
+	merged, apply, remove, conflicts := mergeSyncItems(base, local, remote)
+	status.Conflicts = append(status.Conflicts, conflicts...)
+	if err := ws.applySyncItems(apply, remove); err != nil {
+		return nil, err
+	}
+	status.LocalChanged = append(status.LocalChanged, syncItemSections(apply, remove)...)
+
+	// 写回共享目录：明文未变化的条目沿用原密文，避免每次同步都产生新的随机 nonce
+	out := syncItemsFile{Items: merged}
+	if crypt != nil {
+		out.Items = nil
+		out.Sealed = make(map[string]string, len(merged))
+		for key, value := range merged {
+			if existing, ok := file.Sealed[key]; ok && bytes.Equal(remote[key], value) {
+				out.Sealed[key] = existing
+				continue
+			}
+			if out.Sealed[key], err = crypt.sealWith(syncItemSecretID(key), string(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	encoded, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(remoteRaw, encoded) {
+		if err := AtomicWriteBytes(remotePath, encoded); err != nil {
+			return nil, fmt.Errorf("写入共享目录失败: %w", err)
+		}
+		changed := make(map[string]json.RawMessage)
+		removed := make([]string, 0)
+		for key, value := range merged {
+			if !bytes.Equal(remote[key], value) {
+				changed[key] = value
+			}
+		}
+		for key := range remote {
+			if _, ok := merged[key]; !ok {
+				removed = append(removed, key)
+			}
+		}
+		status.RemoteChanged = append(status.RemoteChanged, syncItemSections(changed, removed)...)
+	}
+	return merged, nil
+}
+
+// mergeSyncItems 按条目三方合并：一方未改动时取另一方（含删除），双方都改动时保留本地并记录冲突。
+// 返回合并结果、需要写入本地的条目与需要从本地删除的条目
+func mergeSyncItems(base map[string]string, local, remote map[string]json.RawMessage) (map[string]json.RawMessage, map[string]json.RawMessage, []string, []SyncConflict) {
+	merged := make(map[string]json.RawMessage, len(local)+len(remote))
+	apply := make(map[string]json.RawMessage)
+	remove := make([]string, 0)
+	conflicts := make([]SyncConflict, 0)
+	conflict := func(key, reason string) {
+		section, name, _ := strings.Cut(key, "/")
+		conflicts = append(conflicts, SyncConflict{Kind: section, Name: name, Reason: reason})
+	}
+
+	for key, l := range local {
+		b, inBase := base[key]
+		r, inRemote := remote[key]
+		switch {
+		case inRemote && bytes.Equal(l, r):
+			merged[key] = l
+		case inRemote && inBase && secretDigest(string(l)) == b:
+			merged[key] = r
+			apply[key] = r
+		case inRemote:
+			merged[key] = l
+			if !inBase || secretDigest(string(r)) != b {
+				conflict(key, "双方修改了该条目，已保留本地")
+			}
+		case !inBase:
+			merged[key] = l
+		case secretDigest(string(l)) == b:
+			remove = append(remove, key) // 远端已删除，本地未修改
+		default:
+			merged[key] = l
+			conflict(key, "远端已删除，本地有修改，已保留本地")
+		}
+	}
+	for key, r := range remote {
+		if _, ok := local[key]; ok {
+			continue
+		}
+		if b, inBase := base[key]; inBase {
+			if secretDigest(string(r)) == b {
+				continue // 本地已删除，远端未修改
+			}
+			conflict(key, "本地已删除，远端有修改，已保留远端")
+		}
+		merged[key] = r
+		apply[key] = r
+	}
+
+	sort.Strings(remove)
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Kind != conflicts[j].Kind {
+			return conflicts[i].Kind < conflicts[j].Kind
+		}
+		return conflicts[i].Name < conflicts[j].Name
+	})
+	return merged, apply, remove, conflicts
+}
+
+// syncItemsFromWorkspace 把工作区内容（不含供应商）展开为条目；本机状态（提示词启用状态与时间戳、Gemini UID）不参与同步
+func syncItemsFromWorkspace(data *workspaceData) (map[string]json.RawMessage, error) {
+	items := make(map[string]json.RawMessage)
+	var firstErr error
+	add := func(key string, value interface{}) {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("序列化 %s 失败: %w", key, err)
+			}
+			return
+		}
+		items[key] = canonicalSyncItem(raw)
+	}
+
+	for _, tool := range data.CustomTools {
+		add(WorkspaceSectionCustomTools+"/"+tool.ID, tool)
+	}
+	for _, p := range data.Gemini {
+		p.UID = ""
+		add(WorkspaceSectionGemini+"/"+p.Name, p)
+	}
+	for _, server := range data.MCPServers {
+		add(WorkspaceSectionMCP+"/"+server.Name, server)
+	}
+	for platform, prompts := range data.Prompts {
+		for id, prompt := range prompts {
+			prompt.ID = id
+			prompt.Enabled, prompt.CreatedAt, prompt.UpdatedAt = false, nil, nil
+			add(WorkspaceSectionPrompts+"/"+platform+"/"+id, prompt)
+		}
+	}
+	for _, repo := range data.SkillRepos {
+		repo = normalizeRepoConfig(repo)
+		add(WorkspaceSectionSkillRepos+"/"+repo.Owner+"/"+repo.Name, repo)
+	}
+	for key, value := range data.Settings {
+		add(WorkspaceSectionSettings+"/"+key, value)
+	}
+	if data.AppSettings != nil {
+		add(WorkspaceSectionAppSettings, *data.AppSettings)
+	}
+	return items, firstErr
+}
+
+// workspaceFromSyncItems 把条目还原为工作区内容；未知分区（新版本写入）忽略
+func workspaceFromSyncItems(items map[string]json.RawMessage) (*workspaceData, error) {
+	data := &workspaceData{
+		Providers: map[string][]Provider{},
+		Prompts:   map[string]map[string]Prompt{},
+		Settings:  map[string]string{},
+	}
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := items[key]
+		section, rest, _ := strings.Cut(key, "/")
+		var err error
+		switch section {
+		case WorkspaceSectionCustomTools:
+			var tool CustomCliTool
+			if err = json.Unmarshal(raw, &tool); err == nil {
+				data.CustomTools = append(data.CustomTools, tool)
+			}
+		case WorkspaceSectionGemini:
+			var p GeminiProvider
+			if err = json.Unmarshal(raw, &p); err == nil {
+				data.Gemini = append(data.Gemini, p)
+			}
+		case WorkspaceSectionMCP:
+			var server MCPServer
+			if err = json.Unmarshal(raw, &server); err == nil {
+				data.MCPServers = append(data.MCPServers, server)
+			}
+		case WorkspaceSectionPrompts:
+			platform, id, _ := strings.Cut(rest, "/")
+			var prompt Prompt
+			if err = json.Unmarshal(raw, &prompt); err == nil {
+				if data.Prompts[platform] == nil {
+					data.Prompts[platform] = map[string]Prompt{}
+				}
+				data.Prompts[platform][id] = prompt
+			}
+		case WorkspaceSectionSkillRepos:
+			var repo skillRepoConfig
+			if err = json.Unmarshal(raw, &repo); err == nil {
+				data.SkillRepos = append(data.SkillRepos, repo)
+			}
+		case WorkspaceSectionSettings:
+			var value string
+			if err = json.Unmarshal(raw, &value); err == nil {
+				data.Settings[rest] = value
+			}
+		case WorkspaceSectionAppSettings:
+			var settings AppSettings
+			if err = json.Unmarshal(raw, &settings); err == nil {
+				data.AppSettings = &settings
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", key, err)
+		}
+	}
+	return data, nil
+}
+
+// applySyncItems 先删除远端已删除的条目，再以覆盖方式导入远端的条目（复用工作区导入，补回脱敏的本地密钥）
+func (ws *WorkspaceService) applySyncItems(apply map[string]json.RawMessage, remove []string) error {
+	errs := make([]string, 0)
+	for _, key := range remove {
+		if err := ws.removeSyncItem(key); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if len(apply) > 0 {
+		data, err := workspaceFromSyncItems(apply)
+		if err != nil {
+			return err
+		}
+		entries, err := ws.planWorkspaceImport(data)
+		if err != nil {
+			return err
+		}
+		selected := make([]workspaceEntry, 0, len(entries))
+		for _, entry := range entries {
+			if entry.Status == WorkspaceItemIdentical {
+				continue
+			}
+			entry.strategy = WorkspaceStrategyOverwrite
+			selected = append(selected, entry)
+		}
+		result := &WorkspaceImportResult{Errors: []string{}}
+		ws.applyWorkspaceImport(data, selected, result)
+		errs = append(errs, result.Errors...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("应用远端配置失败: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// removeSyncItem 删除本地条目；设置类条目没有删除语义
+func (ws *WorkspaceService) removeSyncItem(key string) error {
+	section, rest, _ := strings.Cut(key, "/")
+	switch section {
+	case WorkspaceSectionCustomTools:
+		if ws.customCliService != nil {
+			return ws.customCliService.DeleteTool(rest)
+		}
+	case WorkspaceSectionGemini:
+		if ws.geminiService != nil {
+			for _, p := range ws.geminiService.GetProviders() {
+				if p.Name == rest {
+					return ws.geminiService.DeleteProvider(p.ID)
+				}
+			}
+		}
+	case WorkspaceSectionMCP:
+		if ws.mcpService != nil {
+			servers, err := ws.mcpService.ListServers()
+			if err != nil {
+				return err
+			}
+			kept := make([]MCPServer, 0, len(servers))
+			for _, server := range servers {
+				if server.Name != rest {
+					kept = append(kept, server)
+				}
+			}
+			if len(kept) != len(servers) {
+				return ws.mcpService.SaveServers(kept)
+			}
+		}
+	case WorkspaceSectionPrompts:
+		if ws.promptService != nil {
+			platform, id, _ := strings.Cut(rest, "/")
+			return ws.promptService.DeletePrompt(platform, id)
+		}
+	case WorkspaceSectionSkillRepos:
+		if ws.skillService != nil {
+			owner, name, _ := strings.Cut(rest, "/")
+			_, err := ws.skillService.RemoveRepo(owner, name)
+			return err
+		}
+	}
+	return nil
+}
+
+// syncItemSections 变化条目涉及的分区（用于同步状态与 git 提交说明）
+func syncItemSections(changed map[string]json.RawMessage, removed []string) []string {
+	seen := make(map[string]bool)
+	for key := range changed {
+		section, _, _ := strings.Cut(key, "/")
+		seen[section] = true
+	}
+	for _, key := range removed {
+		section, _, _ := strings.Cut(key, "/")
+		seen[section] = true
+	}
+	sections := make([]string, 0, len(seen))
+	for section := range seen {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// canonicalSyncItem 统一 JSON 形式（键排序、无空白），使不同机器写入的相同内容逐字节相等
+func canonicalSyncItem(raw json.RawMessage) json.RawMessage {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return raw
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return raw
+	}
+	return canonical
+}
+
+func readSyncItems(path string) ([]byte, syncItemsFile, error) {
+	var file syncItemsFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, file, nil
+		}
+		return nil, file, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, file, fmt.Errorf("解析 %s 失败: %w", filepath.Base(path), err)
+		}
+	}
+	return data, file, nil
+}
+
+// loadSyncItemsBase 读取上次合并的条目摘要
+func loadSyncItemsBase(withKeys bool) (map[string]string, error) {
+	dir, err := syncBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, syncItemsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取同步基线失败: %w", err)
+	}
+	var base syncItemsBase
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("读取同步基线失败: %w", err)
+	}
+	if base.WithKeys != withKeys {
+		return nil, nil
+	}
+	return base.Items, nil
+}
+
+func saveSyncItemsBase(items map[string]json.RawMessage, withKeys bool) error {
+	dir, err := syncBaseDir()
+	if err != nil {
+		return err
+	}
+	base := syncItemsBase{WithKeys: withKeys, Items: make(map[string]string, len(items))}
+	for key, value := range items {
+		base.Items[key] = secretDigest(string(value))
+	}
+	if err := AtomicWriteJSON(filepath.Join(dir, syncItemsFileName), base); err != nil {
+		return fmt.Errorf("保存同步基线失败: %w", err)
+	}
+	return nil
+}
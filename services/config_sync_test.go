@@ -0,0 +1,373 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMergeProviderLists(t *testing.T) {
+	base := []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://a.example.com", APIKey: secretDigest("sk-1"), Level: 1},
+		{ID: 2, Name: "gone-remote", APIURL: "https://b.example.com"},
+		{ID: 3, Name: "gone-local", APIURL: "https://c.example.com"},
+		{ID: 4, Name: "edited-remote", APIURL: "https://d.example.com"},
+	}
+	local := []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://a.example.com", APIKey: "sk-1", Level: 2, Enabled: true},
+		{ID: 2, Name: "gone-remote", APIURL: "https://b.example.com"},
+		{ID: 5, Name: "local-new", APIURL: "https://l.example.com"},
+	}
+	remote := []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://a2.example.com", APIKey: "sk-rotated", Level: 3},
+		{ID: 3, Name: "gone-local", APIURL: "https://c.example.com"},
+		{ID: 4, Name: "edited-remote", APIURL: "https://d2.example.com"},
+		{ID: 5, Name: "remote-new", APIURL: "https://r.example.com"},
+	}
+
+	merged, conflicts, renumbered := mergeProviderLists("claude", base, local, remote, true)
+	byName := make(map[string]Provider, len(merged))
+	for _, p := range merged {
+		byName[p.Name] = p
+	}
+	if len(merged) != 4 {
+		t.Fatalf("merged = %+v", merged)
+	}
+	relay := byName["relay"]
+	if relay.APIURL != "https://a2.example.com" || relay.APIKey != "sk-rotated" || relay.Level != 2 || !relay.Enabled {
+		t.Fatalf("relay = %+v", relay)
+	}
+	if _, ok := byName["gone-remote"]; ok {
+		t.Fatal("provider deleted remotely and untouched locally should be removed")
+	}
+	if byName["edited-remote"].APIURL != "https://d2.example.com" {
+		t.Fatalf("locally deleted but remotely edited provider should be kept: %+v", merged)
+	}
+	if byName["remote-new"].ID != 5 || byName["local-new"].ID != 6 || renumbered[5] != 6 || len(renumbered) != 1 {
+		t.Fatalf("ID clash: remote should keep ID 5 and local move to 6: %+v", merged)
+	}
+
+	reasons := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		reasons = append(reasons, c.Name+":"+strings.Join(c.Fields, ","))
+	}
+	if got := strings.Join(reasons, ";"); got != "relay:level;local-new:;edited-remote:" {
+		t.Fatalf("conflicts = %s", got)
+	}
+}
+
+func TestConfigSync_FolderRoundTrip(t *testing.T) {
+	shared := t.TempDir()
+
+	homeA, homeB := isolateSyncHomes(t)
+	cfg := SyncConfig{Enabled: true, Backend: SyncBackendFolder, Path: shared, EncryptSecrets: true}
+
+	useSyncHome(t, homeA)
+	psA := NewProviderService()
+	syncA := NewConfigSyncService(NewWorkspaceService(psA, nil, nil, nil, nil, nil, nil, nil))
+	if err := psA.SaveProviders("claude", []Provider{{ID: 1, Name: "relay", APIURL: "https://a.example.com", APIKey: "sk-team"}}); err != nil {
+		t.Fatalf("save A: %v", err)
+	}
+	if err := AtomicWriteJSON(mustSyncConfigPath(t), cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := syncA.SyncNow(); err == nil {
+		t.Fatal("sync without passphrase should fail when secrets are encrypted")
+	}
+	if err := syncA.SetSyncPassphrase("team secret"); err != nil {
+		t.Fatalf("set passphrase: %v", err)
+	}
+	if _, err := syncA.SyncNow(); err != nil {
+		t.Fatalf("sync A: %v", err)
+	}
+	raw, _ := os.ReadFile(shared + "/" + syncDirName + "/providers-claude.json")
+	if strings.Contains(string(raw), "sk-team") || !strings.Contains(string(raw), syncSecretPrefix) {
+		t.Fatalf("shared file should only hold ciphertext: %s", raw)
+	}
+
+	// B 从共享目录拿到配置与解密后的 Key，修改 URL 后推回
+	useSyncHome(t, homeB)
+	psB := NewProviderService()
+	syncB := NewConfigSyncService(NewWorkspaceService(psB, nil, nil, nil, nil, nil, nil, nil))
+	if err := AtomicWriteJSON(mustSyncConfigPath(t), cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := syncB.SetSyncPassphrase("wrong"); err != nil {
+		t.Fatalf("set passphrase: %v", err)
+	}
+	if _, err := syncB.SyncNow(); err == nil {
+		t.Fatal("wrong passphrase should fail")
+	}
+	if err := syncB.SetSyncPassphrase("team secret"); err != nil {
+		t.Fatalf("set passphrase: %v", err)
+	}
+	status, err := syncB.SyncNow()
+	if err != nil || strings.Join(status.LocalChanged, ",") != "claude" {
+		t.Fatalf("sync B = %+v, %v", status, err)
+	}
+	providers, _ := psB.LoadProviders("claude")
+	if len(providers) != 1 || providers[0].APIKey != "sk-team" {
+		t.Fatalf("B providers = %+v", providers)
+	}
+	providers[0].APIURL = "https://b.example.com"
+	if err := psB.SaveProviders("claude", providers); err != nil {
+		t.Fatalf("save B: %v", err)
+	}
+	if _, err := syncB.SyncNow(); err != nil {
+		t.Fatalf("sync B edit: %v", err)
+	}
+
+	// A 同时修改了其他字段：两边的修改都应保留
+	useSyncHome(t, homeA)
+	providers, _ = psA.LoadProviders("claude")
+	providers[0].Level = 3
+	if err := psA.SaveProviders("claude", providers); err != nil {
+		t.Fatalf("save A edit: %v", err)
+	}
+	status, err = syncA.SyncNow()
+	if err != nil || len(status.Conflicts) != 0 {
+		t.Fatalf("sync A edit = %+v, %v", status, err)
+	}
+	providers, _ = psA.LoadProviders("claude")
+	if providers[0].APIURL != "https://b.example.com" || providers[0].Level != 3 || providers[0].APIKey != "sk-team" {
+		t.Fatalf("A providers after merge = %+v", providers)
+	}
+}
+
+func TestConfigSync_WorkspaceItemsFollowToolIDs(t *testing.T) {
+	shared := t.TempDir()
+	homeA, homeB := isolateSyncHomes(t)
+	cfg := SyncConfig{Enabled: true, Backend: SyncBackendFolder, Path: shared}
+	newMachine := func() (*WorkspaceService, *ConfigSyncService) {
+		ws := NewWorkspaceService(NewProviderService(), nil, nil, NewPromptService(), nil, NewCustomCliService("127.0.0.1:18100"), nil, nil)
+		if err := AtomicWriteJSON(mustSyncConfigPath(t), cfg); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		return ws, NewConfigSyncService(ws)
+	}
+
+	// A：自定义 CLI 工具、其供应商与提示词
+	useSyncHome(t, homeA)
+	wsA, syncA := newMachine()
+	tool, err := wsA.customCliService.CreateTool(CustomCliTool{Name: "my-cli", ConfigFiles: []ConfigFile{{Label: "cfg", Path: "~/.my-cli.json", Format: "json"}}})
+	if err != nil {
+		t.Fatalf("create tool: %v", err)
+	}
+	if err := wsA.providerService.SaveProviders("custom:"+tool.ID, []Provider{{ID: 1, Name: "cli-relay", APIURL: "https://cli.example.com", APIKey: "sk-cli"}}); err != nil {
+		t.Fatalf("save custom providers: %v", err)
+	}
+	if err := wsA.promptService.UpsertPrompt("claude", "review", Prompt{Name: "Review", Content: "review carefully"}); err != nil {
+		t.Fatalf("upsert prompt: %v", err)
+	}
+	if _, err := syncA.SyncNow(); err != nil {
+		t.Fatalf("sync A: %v", err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(shared, syncDirName, syncItemsFileName))
+	if !strings.Contains(string(raw), WorkspaceSectionCustomTools+"/"+tool.ID) {
+		t.Fatalf("custom tool should be keyed by its ID: %s", raw)
+	}
+
+	// B：工具以相同 ID 创建，供应商随之同步（未设置口令时不含 Key）
+	useSyncHome(t, homeB)
+	wsB, syncB := newMachine()
+	status, err := syncB.SyncNow()
+	if err != nil || strings.Join(status.LocalChanged, ",") != "customTools,prompts,custom:"+tool.ID {
+		t.Fatalf("sync B = %+v, %v", status, err)
+	}
+	tools, _ := wsB.customCliService.ListTools()
+	if len(tools) != 1 || tools[0].ID != tool.ID {
+		t.Fatalf("B tools = %+v", tools)
+	}
+	providers, _ := wsB.providerService.LoadProviders("custom:" + tool.ID)
+	if len(providers) != 1 || providers[0].Name != "cli-relay" || providers[0].APIKey != "" {
+		t.Fatalf("B custom providers = %+v", providers)
+	}
+	if prompts, _ := wsB.promptService.GetPrompts("claude"); prompts["review"].Content != "review carefully" {
+		t.Fatalf("B prompts = %+v", prompts)
+	}
+
+	// B 删除提示词后，A 同步时一并删除
+	if err := wsB.promptService.DeletePrompt("claude", "review"); err != nil {
+		t.Fatalf("delete prompt: %v", err)
+	}
+	if _, err := syncB.SyncNow(); err != nil {
+		t.Fatalf("sync B delete: %v", err)
+	}
+	useSyncHome(t, homeA)
+	wsA, syncA = newMachine()
+	if _, err := syncA.SyncNow(); err != nil {
+		t.Fatalf("sync A delete: %v", err)
+	}
+	if prompts, _ := wsA.promptService.GetPrompts("claude"); len(prompts) != 0 {
+		t.Fatalf("A prompts after remote delete = %+v", prompts)
+	}
+	if providers, _ := wsA.providerService.LoadProviders("custom:" + tool.ID); len(providers) != 1 || providers[0].APIKey != "sk-cli" {
+		t.Fatalf("A should keep its own key: %+v", providers)
+	}
+}
+
+func TestConfigSync_IDClashBetweenMachines(t *testing.T) {
+	shared := t.TempDir()
+	homeA, homeB := isolateSyncHomes(t)
+	cfg := SyncConfig{Enabled: true, Backend: SyncBackendFolder, Path: shared}
+
+	useSyncHome(t, homeA)
+	psA := NewProviderService()
+	syncA := NewConfigSyncService(NewWorkspaceService(psA, nil, nil, nil, nil, nil, nil, nil))
+	if err := psA.SaveProviders("claude", []Provider{{ID: 1, Name: "alpha", APIURL: "https://a.example.com"}}); err != nil {
+		t.Fatalf("save A: %v", err)
+	}
+	if err := AtomicWriteJSON(mustSyncConfigPath(t), cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := syncA.SyncNow(); err != nil {
+		t.Fatalf("sync A: %v", err)
+	}
+
+	// B 在首次同步前独立新增了同一 ID 的供应商
+	useSyncHome(t, homeB)
+	psB := NewProviderService()
+	syncB := NewConfigSyncService(NewWorkspaceService(psB, nil, nil, nil, nil, nil, nil, nil))
+	if err := psB.SaveProviders("claude", []Provider{{ID: 1, Name: "beta", APIURL: "https://b.example.com"}}); err != nil {
+		t.Fatalf("save B: %v", err)
+	}
+	if err := AtomicWriteJSON(mustSyncConfigPath(t), cfg); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	status, err := syncB.SyncNow()
+	if err != nil || len(status.Conflicts) != 1 {
+		t.Fatalf("sync B = %+v, %v", status, err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := syncB.SyncNow(); err != nil {
+			t.Fatalf("later sync B #%d: %v", i+1, err)
+		}
+	}
+	wantIDs := "1:alpha,2:beta"
+	if got := providerIDNames(t, psB); got != wantIDs {
+		t.Fatalf("B providers = %s, want %s", got, wantIDs)
+	}
+
+	useSyncHome(t, homeA)
+	if _, err := syncA.SyncNow(); err != nil {
+		t.Fatalf("sync A after clash: %v", err)
+	}
+	if got := providerIDNames(t, psA); got != wantIDs {
+		t.Fatalf("A providers = %s, want %s", got, wantIDs)
+	}
+}
+
+func TestConfigSync_GitDivergedCommitIsRemerged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	cloneA := filepath.Join(root, "a")
+	cloneB := filepath.Join(root, "b")
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(env, "sync test")
+	}
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(env, "sync@example.com")
+	}
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	mustGit(t, root, "init", "--bare", "-b", "main", remote)
+	mustGit(t, root, "clone", remote, cloneA)
+	mustGit(t, cloneA, "commit", "--allow-empty", "-m", "init")
+	mustGit(t, cloneA, "push", "-u", "origin", "HEAD:main")
+	mustGit(t, root, "clone", remote, cloneB)
+
+	homeA, homeB := isolateSyncHomes(t)
+	setup := func(home, clone string, provider Provider) (*ProviderService, *ConfigSyncService) {
+		useSyncHome(t, home)
+		ps := NewProviderService()
+		if err := ps.SaveProviders("claude", []Provider{provider}); err != nil {
+			t.Fatalf("save providers: %v", err)
+		}
+		if err := AtomicWriteJSON(mustSyncConfigPath(t), SyncConfig{Enabled: true, Backend: SyncBackendGit, Path: clone}); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+		return ps, NewConfigSyncService(NewWorkspaceService(ps, nil, nil, nil, nil, nil, nil, nil))
+	}
+	psA, syncA := setup(homeA, cloneA, Provider{ID: 1, Name: "alpha", APIURL: "https://a.example.com"})
+	psB, syncB := setup(homeB, cloneB, Provider{ID: 2, Name: "beta", APIURL: "https://b.example.com"})
+
+	// B 的推送失败（远端不可达），留下一个未推送的本地提交
+	mustGit(t, cloneB, "remote", "set-url", "--push", "origin", filepath.Join(root, "missing.git"))
+	if _, err := syncB.SyncNow(); err == nil {
+		t.Fatal("sync B with unreachable remote should fail")
+	}
+	mustGit(t, cloneB, "remote", "set-url", "--push", "origin", remote)
+
+	// 与此同时 A 推送了对同一文件的修改
+	useSyncHome(t, homeA)
+	if _, err := syncA.SyncNow(); err != nil {
+		t.Fatalf("sync A: %v", err)
+	}
+
+	useSyncHome(t, homeB)
+	if _, err := syncB.SyncNow(); err != nil {
+		t.Fatalf("sync B after divergence: %v", err)
+	}
+	if got := providerIDNames(t, psB); got != "1:alpha,2:beta" {
+		t.Fatalf("B providers = %s", got)
+	}
+	useSyncHome(t, homeA)
+	if _, err := syncA.SyncNow(); err != nil {
+		t.Fatalf("sync A again: %v", err)
+	}
+	if got := providerIDNames(t, psA); got != "1:alpha,2:beta" {
+		t.Fatalf("A providers = %s", got)
+	}
+}
+
+// isolateSyncHomes 为两台“机器”各准备一个隔离的 HOME，返回后当前 HOME 为第二个
+func isolateSyncHomes(t *testing.T) (string, string) {
+	t.Helper()
+	isolateHomeDir(t)
+	homeA := os.Getenv("HOME")
+	isolateHomeDir(t)
+	return homeA, os.Getenv("HOME")
+}
+
+func useSyncHome(t *testing.T, home string) {
+	t.Helper()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+}
+
+func providerIDNames(t *testing.T, ps *ProviderService) string {
+	t.Helper()
+	providers, err := ps.LoadProviders("claude")
+	if err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+	items := make([]string, 0, len(providers))
+	for _, p := range providers {
+		items = append(items, fmt.Sprintf("%d:%s", p.ID, p.Name))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func mustGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+}
+
+func mustSyncConfigPath(t *testing.T) string {
+	t.Helper()
+	path, err := syncConfigPath()
+	if err != nil {
+		t.Fatalf("syncConfigPath: %v", err)
+	}
+	return path
+}
@@ -450,7 +450,7 @@ func (cts *ConnectivityTestService) handleBlacklistIntegration(platform, provide
 		}
 	case StatusUnavailable:
 		// 红色：调用 RecordFailure 累计失败
-		if err := cts.blacklistService.RecordFailure(platform, providerName); err != nil {
+		if err := cts.blacklistService.RecordFailure(platform, providerName, result.Message); err != nil {
 			log.Printf("[ConnectivityTest] RecordFailure 失败: %v", err)
 		}
 	case StatusDegraded:
@@ -93,6 +93,11 @@ func (s *CustomCliService) GetTool(id string) (*CustomCliTool, error) {
 
 // CreateTool 创建新工具
 func (s *CustomCliService) CreateTool(tool CustomCliTool) (*CustomCliTool, error) {
+	return s.createTool(tool, "")
+}
+
+// createTool 创建工具；preferredID 未被占用时沿用（导入/同步时保持各台机器上的工具 ID 一致），否则生成新 ID
+func (s *CustomCliService) createTool(tool CustomCliTool, preferredID string) (*CustomCliTool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -104,9 +109,6 @@ func (s *CustomCliService) CreateTool(tool CustomCliTool) (*CustomCliTool, error
 		return nil, errors.New("至少需要一个配置文件")
 	}
 
-	// 生成 ID
-	tool.ID = uuid.New().String()
-
 	// 为配置文件生成 ID（如果未设置）
 	for i := range tool.ConfigFiles {
 		if tool.ConfigFiles[i].ID == "" {
@@ -131,6 +133,18 @@ func (s *CustomCliService) CreateTool(tool CustomCliTool) (*CustomCliTool, error
 	if err != nil {
 		store = &customCliStore{Tools: []CustomCliTool{}}
 	}
+
+	// 生成 ID
+	tool.ID = preferredID
+	for _, existing := range store.Tools {
+		if existing.ID == tool.ID {
+			tool.ID = ""
+			break
+		}
+	}
+	if tool.ID == "" {
+		tool.ID = uuid.New().String()
+	}
 	store.Tools = append(store.Tools, tool)
 
 	if err := s.saveStore(store); err != nil {
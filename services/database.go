@@ -1,6 +1,7 @@
 package services
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -66,6 +67,12 @@ func InitDatabase() error {
 	if err := ensureBlacklistTables(); err != nil {
 		return fmt.Errorf("初始化黑名单表失败: %w", err)
 	}
+	if err := ensureRequestLogRollupTable(); err != nil {
+		return fmt.Errorf("初始化 request_log 汇总表失败: %w", err)
+	}
+	if err := ensureProviderEventsTable(); err != nil {
+		return fmt.Errorf("初始化 provider 事件表失败: %w", err)
+	}
 
 	// 5. 预热连接池：强制建立数据库连接，避免首次写入时失败
 	var count int
@@ -109,12 +116,33 @@ func ensureBlacklistTables() error {
 		last_degrade_hour INTEGER DEFAULT 0,
 		last_failure_window_start DATETIME,
 		auto_recovered INTEGER DEFAULT 0,
-		UNIQUE(platform, provider_name)
+		model TEXT NOT NULL DEFAULT '',
+		UNIQUE(platform, provider_name, model)
 	)`
 	if _, err := db.Exec(createBlacklistSQL); err != nil {
 		return fmt.Errorf("创建 provider_blacklist 表失败: %w", err)
 	}
 
+	// 2.1 熔断状态字段（closed / open / half_open）
+	blacklistColumns := []struct {
+		name       string
+		definition string
+	}{
+		{"circuit_state", "TEXT DEFAULT 'closed'"},
+		{"half_open_successes", "INTEGER DEFAULT 0"},
+		{"circuit_changed_at", "DATETIME"},
+	}
+	for _, column := range blacklistColumns {
+		if err := ensureBlacklistColumn(db, column.name, column.definition); err != nil {
+			return fmt.Errorf("添加 provider_blacklist.%s 字段失败: %w", column.name, err)
+		}
+	}
+
+	// 2.2 按模型拉黑：旧表唯一键为 (platform, provider_name)，需要重建表加入 model 字段
+	if err := migrateBlacklistModelScope(db); err != nil {
+		return fmt.Errorf("升级 provider_blacklist 按模型拉黑失败: %w", err)
+	}
+
 	// 3. 确保 app_settings 中有默认的黑名单配置
 	defaultSettings := []struct {
 		key   string
@@ -136,3 +164,69 @@ func ensureBlacklistTables() error {
 
 	return nil
 }
+
+// migrateBlacklistModelScope 为旧版 provider_blacklist 增加 model 字段（空字符串表示整个 provider）
+// SQLite 无法修改唯一约束，因此在事务内重建表并迁移数据
+func migrateBlacklistModelScope(db *sql.DB) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('provider_blacklist') WHERE name = 'model'").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	const columns = `platform, provider_name, failure_count, blacklisted_at, blacklisted_until,
+		last_failure_at, blacklist_level, last_recovered_at, last_degrade_hour,
+		last_failure_window_start, auto_recovered, circuit_state, half_open_successes, circuit_changed_at`
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`CREATE TABLE provider_blacklist_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			platform TEXT NOT NULL,
+			provider_name TEXT NOT NULL,
+			failure_count INTEGER DEFAULT 0,
+			blacklisted_at DATETIME,
+			blacklisted_until DATETIME,
+			last_failure_at DATETIME,
+			blacklist_level INTEGER DEFAULT 0,
+			last_recovered_at DATETIME,
+			last_degrade_hour INTEGER DEFAULT 0,
+			last_failure_window_start DATETIME,
+			auto_recovered INTEGER DEFAULT 0,
+			circuit_state TEXT DEFAULT 'closed',
+			half_open_successes INTEGER DEFAULT 0,
+			circuit_changed_at DATETIME,
+			model TEXT NOT NULL DEFAULT '',
+			UNIQUE(platform, provider_name, model)
+		)`,
+		fmt.Sprintf("INSERT INTO provider_blacklist_new (%s) SELECT %s FROM provider_blacklist", columns, columns),
+		"DROP TABLE provider_blacklist",
+		"ALTER TABLE provider_blacklist_new RENAME TO provider_blacklist",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ensureBlacklistColumn 为 provider_blacklist 表补充缺失字段（旧版数据库升级）
+func ensureBlacklistColumn(db *sql.DB, column string, definition string) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('provider_blacklist') WHERE name = ?", column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE provider_blacklist ADD COLUMN %s %s", column, definition))
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -37,6 +38,8 @@ func InitGlobalDBQueue() error {
 	// 用途：高频 request_log INSERT（同表同操作，严格同构）
 	// 批量配置：50 条/批，100ms 超时提交
 	GlobalDBQueueLogs = NewDBWriteQueue(db, 5000, true)
+	// 在同一事务内增量维护 request_log 小时汇总表
+	GlobalDBQueueLogs.SetBatchHook(applyRequestLogRollups)
 
 	return nil
 }
@@ -84,16 +87,23 @@ func GetGlobalDBQueueLogsStats() QueueStats {
 
 // WriteTask 写入任务
 type WriteTask struct {
-	SQL    string        // SQL语句
-	Args   []interface{} // 参数
-	Result chan error    // 结果通道（同步等待）
+	SQL    string                 // SQL语句
+	Args   []interface{}          // 参数
+	Meta   interface{}            // 附加数据（可选，仅供 BatchHook 使用）
+	Tx     func(tx *sql.Tx) error // 事务任务（可选，设置后忽略 SQL，仅走单次通道）
+	Result chan error             // 结果通道（同步等待）
 }
 
+// BatchHook 批量提交钩子：在批次 SQL 全部执行成功后、事务提交前调用
+// 用于在同一事务内维护派生数据（如 request_log 汇总表）；失败会重试一次，仍失败则整批回滚并返回错误
+type BatchHook func(tx *sql.Tx, tasks []*WriteTask) error
+
 // DBWriteQueue 数据库写入队列
 type DBWriteQueue struct {
 	db           *sql.DB
 	queue        chan *WriteTask
 	batchQueue   chan *WriteTask // 批量提交队列
+	batchHook    atomic.Value    // BatchHook（可选）
 	shutdownChan chan struct{}
 	wg           sync.WaitGroup
 
@@ -162,6 +172,14 @@ func NewDBWriteQueue(db *sql.DB, queueSize int, enableBatch bool) *DBWriteQueue
 	return q
 }
 
+// SetBatchHook 设置批量提交钩子（仅对批量通道生效）
+func (q *DBWriteQueue) SetBatchHook(hook BatchHook) {
+	if hook == nil {
+		return
+	}
+	q.batchHook.Store(hook)
+}
+
 // worker 单线程顺序处理所有写入
 func (q *DBWriteQueue) worker() {
 	defer q.wg.Done()
@@ -194,7 +212,7 @@ func (q *DBWriteQueue) worker() {
 			currentTask = task // 记录当前任务，用于 panic 时返回错误
 
 			start := time.Now()
-			_, err := q.db.Exec(task.SQL, task.Args...)
+			err := q.execTask(task)
 
 			// 更新统计（单次写入，count=1）
 			q.updateStats(1, time.Since(start), err)
@@ -213,7 +231,7 @@ func (q *DBWriteQueue) worker() {
 					currentTask = task // shutdown 排空时也需要跟踪，防止 panic
 
 					start := time.Now()
-					_, err := q.db.Exec(task.SQL, task.Args...)
+					err := q.execTask(task)
 					q.updateStats(1, time.Since(start), err)
 					task.Result <- err
 					close(task.Result)
@@ -228,6 +246,26 @@ func (q *DBWriteQueue) worker() {
 	}
 }
 
+// execTask 执行单次通道的任务：普通 SQL 直接执行，事务任务在独立事务中执行并提交
+func (q *DBWriteQueue) execTask(task *WriteTask) error {
+	if task.Tx == nil {
+		_, err := q.db.Exec(task.SQL, task.Args...)
+		return err
+	}
+	tx, err := q.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	if err := task.Tx(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
 // batchWorker 批量提交 worker（可选）
 func (q *DBWriteQueue) batchWorker() {
 	defer q.wg.Done()
@@ -360,6 +398,15 @@ func (q *DBWriteQueue) commitBatch(tasks []*WriteTask) {
 		return
 	}
 
+	// 派生数据钩子：重试一次仍失败则整批回滚，避免原始日志与汇总数据不一致
+	if hook, ok := q.batchHook.Load().(BatchHook); ok && hook != nil {
+		if err := runBatchHook(tx, hook, tasks); err != nil {
+			log.Printf("[DBQueue] 批量提交钩子执行失败，本批次 %d 条写入已回滚: %v", len(tasks), err)
+			sendResultToAll(fmt.Errorf("批量提交钩子执行失败: %w", err))
+			return
+		}
+	}
+
 	// 提交事务
 	if err := tx.Commit(); err != nil {
 		sendResultToAll(fmt.Errorf("事务提交失败: %w", err))
@@ -370,6 +417,29 @@ func (q *DBWriteQueue) commitBatch(tasks []*WriteTask) {
 	sendResultToAll(nil)
 }
 
+// runBatchHook 在保存点内执行钩子，失败时回到保存点（撤销钩子的部分写入）再重试一次
+func runBatchHook(tx *sql.Tx, hook BatchHook, tasks []*WriteTask) error {
+	var hookErr error
+	for attempt := 1; attempt <= 2; attempt++ {
+		if _, err := tx.Exec(`SAVEPOINT batch_hook`); err != nil {
+			return fmt.Errorf("创建保存点失败: %w", err)
+		}
+		if hookErr = hook(tx, tasks); hookErr == nil {
+			if _, err := tx.Exec(`RELEASE SAVEPOINT batch_hook`); err != nil {
+				return fmt.Errorf("释放保存点失败: %w", err)
+			}
+			return nil
+		}
+		if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT batch_hook`); err != nil {
+			return fmt.Errorf("回滚保存点失败: %w (钩子错误: %v)", err, hookErr)
+		}
+		if _, err := tx.Exec(`RELEASE SAVEPOINT batch_hook`); err != nil {
+			return fmt.Errorf("释放保存点失败: %w", err)
+		}
+	}
+	return hookErr
+}
+
 // Exec 同步执行写入（阻塞直到完成，默认 30 秒超时）
 // 防御性设计：即使在高频路径误用，也有 30 秒兜底超时，避免永久阻塞
 func (q *DBWriteQueue) Exec(sql string, args ...interface{}) error {
@@ -408,6 +478,63 @@ func (q *DBWriteQueue) Exec(sql string, args ...interface{}) error {
 	}
 }
 
+// ExecTx 在写入队列中以单个事务执行 fn（阻塞直到提交或回滚，默认 30 秒超时）
+// 用于需要原子完成的多表更新；fn 返回错误时整个事务回滚
+func (q *DBWriteQueue) ExecTx(fn func(tx *sql.Tx) error) error {
+	if q.closed.Load() {
+		return fmt.Errorf("写入队列已关闭")
+	}
+
+	task := &WriteTask{
+		Tx:     fn,
+		Result: make(chan error, 1),
+	}
+
+	timeout := time.After(30 * time.Second)
+
+	select {
+	case q.queue <- task:
+		select {
+		case err := <-task.Result:
+			return err
+		case <-timeout:
+			go func() { <-task.Result }()
+			return fmt.Errorf("事务执行超时（30秒），队列可能积压严重")
+		}
+
+	case <-timeout:
+		return fmt.Errorf("入队超时（30秒），队列已满")
+
+	case <-q.shutdownChan:
+		return fmt.Errorf("写入队列已关闭")
+	}
+}
+
+// ExecTxWait 与 ExecTx 相同，但入队后一直等待事务结束（不设执行超时）
+// 用于调用方必须依据事务的最终结果处理事务外副作用的场景（超时返回时事务仍可能提交）
+func (q *DBWriteQueue) ExecTxWait(fn func(tx *sql.Tx) error) error {
+	if q.closed.Load() {
+		return fmt.Errorf("写入队列已关闭")
+	}
+
+	task := &WriteTask{
+		Tx:     fn,
+		Result: make(chan error, 1),
+	}
+
+	select {
+	case q.queue <- task:
+		// worker 关闭时会排空队列，已入队的任务一定会返回结果
+		return <-task.Result
+
+	case <-time.After(30 * time.Second):
+		return fmt.Errorf("入队超时（30秒），队列已满")
+
+	case <-q.shutdownChan:
+		return fmt.Errorf("写入队列已关闭")
+	}
+}
+
 // ExecBatch 批量执行（异步，高吞吐量场景，默认 30 秒超时）
 // 防御性设计：即使误用，也有 30 秒兜底超时
 func (q *DBWriteQueue) ExecBatch(sql string, args ...interface{}) error {
@@ -485,8 +612,22 @@ func (q *DBWriteQueue) ExecCtx(ctx context.Context, sql string, args ...interfac
 	}
 }
 
+// Flush 等待调用前已进入批量通道的写入全部提交
+// 批量通道按入队顺序处理，屏障任务返回时其之前的任务都已随更早或同一批次提交
+func (q *DBWriteQueue) Flush(ctx context.Context) error {
+	if q.batchQueue == nil {
+		return nil
+	}
+	return q.ExecBatchCtx(ctx, `SELECT 1`)
+}
+
 // ExecBatchCtx 支持 context 的批量写入（带超时控制）
 func (q *DBWriteQueue) ExecBatchCtx(ctx context.Context, sql string, args ...interface{}) error {
+	return q.ExecBatchMetaCtx(ctx, nil, sql, args...)
+}
+
+// ExecBatchMetaCtx 与 ExecBatchCtx 相同，额外携带供 BatchHook 使用的附加数据
+func (q *DBWriteQueue) ExecBatchMetaCtx(ctx context.Context, meta interface{}, sql string, args ...interface{}) error {
 	// 先检查关闭状态
 	if q.closed.Load() {
 		return fmt.Errorf("写入队列已关闭")
@@ -499,6 +640,7 @@ func (q *DBWriteQueue) ExecBatchCtx(ctx context.Context, sql string, args ...int
 	task := &WriteTask{
 		SQL:    sql,
 		Args:   args,
+		Meta:   meta,
 		Result: make(chan error, 1),
 	}
 
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// useTestDatabase 在隔离的 HOME 下初始化数据库与全局写入队列，测试结束时关闭
+func useTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	isolateHomeDir(t)
+	if err := InitDatabase(); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	if err := InitGlobalDBQueue(); err != nil {
+		t.Fatalf("init db queue: %v", err)
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		t.Fatalf("get db: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = ShutdownGlobalDBQueue(5 * time.Second)
+		GlobalDBQueue, GlobalDBQueueLogs = nil, nil
+		_ = db.Close()
+	})
+	return db
+}
+
+// writeTestRequestLog 按转发链路的方式写入一条请求日志（同时累加小时汇总）
+func writeTestRequestLog(t *testing.T, entry ReqeustLog) {
+	t.Helper()
+	err := GlobalDBQueueLogs.ExecBatchMetaCtx(context.Background(), newRequestLogRollupDelta(&entry),
+		`INSERT INTO request_log (platform, model, provider, http_code, input_tokens, output_tokens) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Platform, entry.Model, entry.Provider, entry.HttpCode, entry.InputTokens, entry.OutputTokens)
+	if err != nil {
+		t.Fatalf("write request log: %v", err)
+	}
+}
+
+func TestDBWriteQueue_BatchHookRetriesAndRollsBack(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		`CREATE TABLE logs (id INTEGER PRIMARY KEY, value TEXT)`,
+		`CREATE TABLE derived (n INTEGER)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("create table: %v", err)
+		}
+	}
+
+	q := NewDBWriteQueue(db, 10, true)
+	defer q.Shutdown(5 * time.Second)
+
+	// 第一次失败前留下的部分写入必须被撤销，重试成功后只保留一份
+	calls := 0
+	q.SetBatchHook(func(tx *sql.Tx, tasks []*WriteTask) error {
+		calls++
+		if _, err := tx.Exec(`INSERT INTO derived (n) VALUES (?)`, len(tasks)); err != nil {
+			return err
+		}
+		if calls == 1 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	if err := q.ExecBatch(`INSERT INTO logs (value) VALUES (?)`, "a"); err != nil {
+		t.Fatalf("batch with retried hook: %v", err)
+	}
+	if got := countRows(t, db, "derived"); calls != 2 || got != 1 {
+		t.Fatalf("calls = %d, derived rows = %d, want 2 calls and 1 row", calls, got)
+	}
+
+	// 持续失败：整批回滚并把错误返回给调用方
+	q.SetBatchHook(func(tx *sql.Tx, tasks []*WriteTask) error {
+		return errors.New("broken")
+	})
+	if err := q.ExecBatch(`INSERT INTO logs (value) VALUES (?)`, "b"); err == nil {
+		t.Fatal("batch should fail when the hook keeps failing")
+	}
+	if got := countRows(t, db, "logs"); got != 1 {
+		t.Fatalf("logs rows = %d, want 1 (failed batch rolled back)", got)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
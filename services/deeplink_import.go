@@ -0,0 +1,367 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// 深度链接预览/确认导入：先解析链接（含签名校验与远程配置）列出将要发生的变化，
+// 用户确认后再按相同内容导入。确认时重新解析链接并比对摘要，内容变化则拒绝导入。
+
+// DeepLinkPreview 导入预览
+type DeepLinkPreview struct {
+	Resource      string                `json:"resource"`
+	App           string                `json:"app,omitempty"`
+	Signed        bool                  `json:"signed"`
+	Signer        string                `json:"signer,omitempty"` // 校验通过的可信公钥名称
+	Digest        string                `json:"digest"`           // 确认导入时回传
+	Items         []WorkspaceImportItem `json:"items"`
+	SkillInstalls []string              `json:"skillInstalls"` // 导入技能仓库后将安装的技能目录
+	Warnings      []string              `json:"warnings"`
+}
+
+// DeepLinkConfirmRequest 确认导入请求
+type DeepLinkConfirmRequest struct {
+	URL             string            `json:"url"`
+	Digest          string            `json:"digest"`
+	DefaultStrategy string            `json:"defaultStrategy"` // 冲突条目的默认策略，默认 skip
+	Strategies      map[string]string `json:"strategies"`      // 按条目 key 指定策略
+}
+
+// deepLinkSkillConfig resource=skill 的配置内容
+type deepLinkSkillConfig struct {
+	Owner       string   `json:"owner"`
+	Name        string   `json:"name"`
+	Branch      string   `json:"branch"`
+	Directories []string `json:"directories"` // 可选：导入仓库后安装的技能目录
+}
+
+// deepLinkPromptConfig resource=prompt 的配置内容（name 参数作为提示词 ID）
+type deepLinkPromptConfig struct {
+	Name        string  `json:"name"`
+	Content     string  `json:"content"`
+	Description *string `json:"description,omitempty"`
+}
+
+// deepLinkMCPConfig resource=mcp 的配置内容：单个服务器，或 Claude 风格的 mcpServers 映射
+type deepLinkMCPConfig struct {
+	MCPServer
+	Servers map[string]rawMCPServer `json:"mcpServers"`
+}
+
+// deepLinkPlan 解析后的链接内容
+type deepLinkPlan struct {
+	request       *DeepLinkImportRequest
+	signer        string
+	data          *workspaceData
+	skillInstalls []installRequest
+	digest        string
+	warnings      []string
+}
+
+// PreviewDeepLink 解析链接并列出导入后将新增/覆盖的条目，不做任何修改
+func (s *DeepLinkService) PreviewDeepLink(urlStr string) (*DeepLinkPreview, error) {
+	if s.workspaceService == nil {
+		return nil, fmt.Errorf("工作区服务未初始化")
+	}
+	plan, err := s.resolveDeepLink(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.workspaceService.previewWorkspaceData(plan.data)
+	if err != nil {
+		return nil, err
+	}
+	preview := &DeepLinkPreview{
+		Resource:      plan.request.Resource,
+		App:           plan.request.App,
+		Signed:        plan.signer != "",
+		Signer:        plan.signer,
+		Digest:        plan.digest,
+		Items:         items,
+		SkillInstalls: make([]string, 0, len(plan.skillInstalls)),
+		Warnings:      plan.warnings,
+	}
+	for _, install := range plan.skillInstalls {
+		preview.SkillInstalls = append(preview.SkillInstalls, install.Directory)
+	}
+	return preview, nil
+}
+
+// ConfirmDeepLinkImport 按预览确认导入；新增条目默认导入，冲突条目默认跳过
+func (s *DeepLinkService) ConfirmDeepLinkImport(req DeepLinkConfirmRequest) (*WorkspaceImportResult, error) {
+	if s.workspaceService == nil {
+		return nil, fmt.Errorf("工作区服务未初始化")
+	}
+	plan, err := s.resolveDeepLink(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if req.Digest != plan.digest {
+		return nil, fmt.Errorf("链接内容与预览时不一致，请重新预览")
+	}
+	result, err := s.workspaceService.importWorkspaceData(plan.data, req.DefaultStrategy, req.Strategies)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plan.skillInstalls) > 0 && s.workspaceService.skillService != nil {
+		for _, install := range plan.skillInstalls {
+			if err := s.workspaceService.skillService.InstallSkill(install); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("skills/%s: %v", install.Directory, err))
+				continue
+			}
+			result.Imported++
+		}
+	}
+	log.Printf("[DeepLink] 已导入 %s 链接（签名: %s）：导入 %d 项，跳过 %d 项，失败 %d 项",
+		plan.request.Resource, plan.signer, result.Imported, result.Skipped, len(result.Errors))
+	return result, nil
+}
+
+// resolveDeepLink 解析链接、校验签名并把内容转换为工作区导入数据
+func (s *DeepLinkService) resolveDeepLink(urlStr string) (*deepLinkPlan, error) {
+	request, err := s.ParseDeepLinkURL(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := verifyDeepLinkSignature(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	plan := &deepLinkPlan{
+		request:  request,
+		signer:   signer,
+		data:     &workspaceData{Providers: map[string][]Provider{}, Prompts: map[string]map[string]Prompt{}},
+		warnings: []string{},
+	}
+	if signer == "" {
+		plan.warnings = append(plan.warnings, "链接未签名，无法确认来源")
+	}
+	if request.ConfigURL != nil {
+		host := *request.ConfigURL
+		if parsed, err := url.Parse(host); err == nil {
+			host = parsed.Host
+		}
+		plan.warnings = append(plan.warnings, fmt.Sprintf("配置内容来自远程地址 %s", host))
+	}
+
+	switch request.Resource {
+	case DeepLinkResourceProvider:
+		err = s.planProviderLink(plan)
+	case DeepLinkResourcePrompt:
+		err = planPromptLink(plan)
+	case DeepLinkResourceMCP:
+		err = planMCPLink(plan)
+	case DeepLinkResourceSkill:
+		err = planSkillLink(plan)
+	case DeepLinkResourceBundle:
+		err = planBundleLink(plan)
+	}
+	if err != nil {
+		return nil, err
+	}
+	plan.warnings = append(plan.warnings, deepLinkContentWarnings(plan.data)...)
+
+	digest, err := json.Marshal(struct {
+		Data   *workspaceData   `json:"data"`
+		Skills []installRequest `json:"skills"`
+	}{plan.data, plan.skillInstalls})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(digest)
+	plan.digest = hex.EncodeToString(sum[:])
+	return plan, nil
+}
+
+// planProviderLink 单个供应商：沿用 ImportProviderFromDeepLink 的合并与校验规则
+func (s *DeepLinkService) planProviderLink(plan *deepLinkPlan) error {
+	merged, err := s.parseAndMergeConfig(plan.request)
+	if err != nil {
+		return err
+	}
+	if merged.APIKey == "" {
+		return fmt.Errorf("API key 是必需的（在 URL 或配置文件中）")
+	}
+	if merged.Endpoint == "" {
+		return fmt.Errorf("Endpoint 是必需的（在 URL 或配置文件中）")
+	}
+	if merged.Homepage == "" {
+		return fmt.Errorf("Homepage 是必需的（在 URL 或配置文件中）")
+	}
+
+	if merged.App == "gemini" {
+		// ID 由名称派生，保证预览与确认的摘要一致；与本地 ID 冲突时导入逻辑会另行分配
+		nameSum := sha256.Sum256([]byte(normalizeName(merged.Name)))
+		provider := GeminiProvider{
+			ID:         "deeplink-" + hex.EncodeToString(nameSum[:6]),
+			Name:       merged.Name,
+			WebsiteURL: merged.Homepage,
+			BaseURL:    merged.Endpoint,
+			APIKey:     merged.APIKey,
+			Category:   "custom",
+		}
+		if merged.Model != nil {
+			provider.Model = *merged.Model
+		}
+		plan.data.Gemini = []GeminiProvider{provider}
+		return nil
+	}
+	provider, err := s.buildProviderFromRequest(merged)
+	if err != nil {
+		return err
+	}
+	// ID 在导入时按本地列表分配，这里清零以保证预览与确认的摘要一致
+	provider.ID = 0
+	plan.data.Providers[merged.App] = []Provider{*provider}
+	return nil
+}
+
+func planPromptLink(plan *deepLinkPlan) error {
+	var config deepLinkPromptConfig
+	if err := loadDeepLinkConfig(plan.request, &config); err != nil {
+		return err
+	}
+	if strings.TrimSpace(config.Content) == "" {
+		return fmt.Errorf("提示词内容不能为空")
+	}
+	id := plan.request.Name
+	if config.Name == "" {
+		config.Name = id
+	}
+	plan.data.Prompts[plan.request.App] = map[string]Prompt{
+		id: {ID: id, Name: config.Name, Content: config.Content, Description: config.Description},
+	}
+	return nil
+}
+
+func planMCPLink(plan *deepLinkPlan) error {
+	var config deepLinkMCPConfig
+	if err := loadDeepLinkConfig(plan.request, &config); err != nil {
+		return err
+	}
+	if len(config.Servers) > 0 {
+		names := make([]string, 0, len(config.Servers))
+		for name := range config.Servers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			raw := config.Servers[name]
+			plan.data.MCPServers = append(plan.data.MCPServers, MCPServer{
+				Name:           name,
+				Type:           raw.Type,
+				Command:        raw.Command,
+				Args:           raw.Args,
+				Env:            raw.Env,
+				URL:            raw.URL,
+				Website:        raw.Website,
+				Tips:           raw.Tips,
+				EnablePlatform: raw.EnablePlatform,
+			})
+		}
+		return nil
+	}
+	server := config.MCPServer
+	if server.Name == "" {
+		server.Name = plan.request.Name
+	}
+	if strings.TrimSpace(server.Name) == "" {
+		return fmt.Errorf("MCP 服务器名称不能为空")
+	}
+	if server.Command == "" && server.URL == "" {
+		return fmt.Errorf("MCP 服务器 %s 需要提供 command 或 url", server.Name)
+	}
+	server.MissingPlaceholders = nil
+	plan.data.MCPServers = []MCPServer{server}
+	return nil
+}
+
+func planSkillLink(plan *deepLinkPlan) error {
+	var config deepLinkSkillConfig
+	if err := loadDeepLinkConfig(plan.request, &config); err != nil {
+		return err
+	}
+	repo := normalizeRepoConfig(skillRepoConfig{Owner: config.Owner, Name: config.Name, Branch: config.Branch, Enabled: true})
+	if err := validateRepoConfig(repo); err != nil {
+		return err
+	}
+	plan.data.SkillRepos = []skillRepoConfig{repo}
+	for _, directory := range config.Directories {
+		directory = strings.TrimSpace(directory)
+		if directory == "" || strings.Contains(directory, "..") {
+			return fmt.Errorf("技能目录无效: %s", directory)
+		}
+		plan.skillInstalls = append(plan.skillInstalls, installRequest{
+			Directory: directory,
+			RepoOwner: repo.Owner,
+			RepoName:  repo.Name,
+			Branch:    repo.Branch,
+		})
+	}
+	return nil
+}
+
+// planBundleLink 批量导入：内容与工作区导出格式相同，但只接受供应商、MCP、提示词与技能仓库，
+// 设置与自定义 CLI 工具不允许通过链接修改
+func planBundleLink(plan *deepLinkPlan) error {
+	var data workspaceData
+	if err := loadDeepLinkConfig(plan.request, &data); err != nil {
+		return err
+	}
+	for kind := range data.Providers {
+		if kind != "claude" && kind != "codex" {
+			return fmt.Errorf("链接不支持导入 %s 类型的供应商", kind)
+		}
+	}
+	if len(data.Settings) > 0 || data.AppSettings != nil || len(data.CustomTools) > 0 {
+		plan.warnings = append(plan.warnings, "链接中的设置与自定义 CLI 工具已忽略")
+	}
+	data.Settings, data.AppSettings, data.CustomTools = nil, nil, nil
+	if data.Providers == nil {
+		data.Providers = map[string][]Provider{}
+	}
+	if data.Prompts == nil {
+		data.Prompts = map[string]map[string]Prompt{}
+	}
+	if len(data.Providers)+len(data.Gemini)+len(data.MCPServers)+len(data.Prompts)+len(data.SkillRepos) == 0 {
+		return fmt.Errorf("链接中没有可导入的内容")
+	}
+	plan.data = &data
+	return nil
+}
+
+// deepLinkContentWarnings 提示需要用户特别留意的内容：携带密钥、将在本机执行的命令
+func deepLinkContentWarnings(data *workspaceData) []string {
+	warnings := make([]string, 0)
+	withKeys := 0
+	for _, providers := range data.Providers {
+		for _, p := range providers {
+			if p.APIKey != "" {
+				withKeys++
+			}
+		}
+	}
+	for _, p := range data.Gemini {
+		if p.APIKey != "" {
+			withKeys++
+		}
+	}
+	if withKeys > 0 {
+		warnings = append(warnings, fmt.Sprintf("链接包含 %d 个 API Key", withKeys))
+	}
+	for _, server := range data.MCPServers {
+		if server.Command != "" {
+			command := strings.TrimSpace(server.Command + " " + strings.Join(server.Args, " "))
+			warnings = append(warnings, fmt.Sprintf("MCP 服务器 %s 将在本机执行命令: %s", server.Name, command))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func deepLinkURL(params map[string]string) string {
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, value)
+	}
+	return "ccswitch://v1/import?" + values.Encode()
+}
+
+func TestDeepLink_SignedBundlePreviewAndConfirm(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 3, Name: "team-a", APIURL: "https://old.example.com", APIKey: "sk-local"}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+	dls := NewDeepLinkService(ps)
+	dls.SetWorkspaceService(NewWorkspaceService(ps, nil, NewMCPService(), nil, nil, nil, nil, nil))
+
+	key, err := dls.GenerateDeepLinkSigningKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if err := dls.SaveDeepLinkTrust(DeepLinkTrustConfig{RequireSigned: true, TrustedKeys: []DeepLinkTrustedKey{{Name: "admin", PublicKey: key.PublicKey}}}); err != nil {
+		t.Fatalf("save trust: %v", err)
+	}
+
+	bundle := `{"providers":{"claude":[{"name":"team-a","apiUrl":"https://new.example.com"},{"name":"team-b","apiUrl":"https://b.example.com","apiKey":"sk-b"}]},"settings":{"x":"y"}}`
+	unsigned := deepLinkURL(map[string]string{"resource": "bundle", "config": base64.StdEncoding.EncodeToString([]byte(bundle))})
+	if _, err := dls.PreviewDeepLink(unsigned); err == nil {
+		t.Fatal("unsigned link should be rejected when signatures are required")
+	}
+	signed, err := dls.SignDeepLinkURL(unsigned, key.PrivateKey)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := dls.PreviewDeepLink(strings.Replace(signed, "resource=bundle", "resource=bundle&name=x", 1)); err == nil {
+		t.Fatal("tampered link should fail signature verification")
+	}
+
+	preview, err := dls.PreviewDeepLink(signed)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if !preview.Signed || preview.Signer != "admin" || len(preview.Items) != 2 {
+		t.Fatalf("preview = %+v", preview)
+	}
+	statuses := preview.Items[0].Key + "=" + preview.Items[0].Status + "," + preview.Items[1].Key + "=" + preview.Items[1].Status
+	if statuses != "providers/claude/team-a=conflict,providers/claude/team-b=new" {
+		t.Fatalf("items = %s", statuses)
+	}
+	if strings.Join(preview.Warnings, ";") != "链接中的设置与自定义 CLI 工具已忽略;链接包含 1 个 API Key" {
+		t.Fatalf("warnings = %v", preview.Warnings)
+	}
+
+	if _, err := dls.ConfirmDeepLinkImport(DeepLinkConfirmRequest{URL: signed, Digest: "stale"}); err == nil {
+		t.Fatal("confirm with a mismatched digest should fail")
+	}
+	result, err := dls.ConfirmDeepLinkImport(DeepLinkConfirmRequest{
+		URL:        signed,
+		Digest:     preview.Digest,
+		Strategies: map[string]string{"providers/claude/team-a": WorkspaceStrategyMerge},
+	})
+	if err != nil || result.Imported != 2 || len(result.Errors) != 0 {
+		t.Fatalf("confirm = %+v, %v", result, err)
+	}
+	providers, _ := ps.LoadProviders("claude")
+	if len(providers) != 2 || providers[0].APIURL != "https://new.example.com" || providers[0].APIKey != "sk-local" || providers[1].APIKey != "sk-b" {
+		t.Fatalf("providers = %+v", providers)
+	}
+}
+
+func TestDeepLink_DirectProviderImportRequiresSignature(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	dls := NewDeepLinkService(ps)
+	key, err := dls.GenerateDeepLinkSigningKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if err := dls.SaveDeepLinkTrust(DeepLinkTrustConfig{RequireSigned: true, TrustedKeys: []DeepLinkTrustedKey{{Name: "admin", PublicKey: key.PublicKey}}}); err != nil {
+		t.Fatalf("save trust: %v", err)
+	}
+
+	unsigned := deepLinkURL(map[string]string{
+		"resource": "provider", "app": "claude", "name": "relay",
+		"homepage": "https://relay.example.com", "endpoint": "https://api.relay.example.com", "apiKey": "sk-link",
+	})
+	if _, err := dls.ImportProviderFromDeepLink(unsigned); err == nil {
+		t.Fatal("unsigned provider link should be rejected when signatures are required")
+	}
+	if providers, _ := ps.LoadProviders("claude"); len(providers) != 0 {
+		t.Fatalf("rejected link must not add providers: %+v", providers)
+	}
+
+	signed, err := dls.SignDeepLinkURL(unsigned, key.PrivateKey)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := dls.ImportProviderFromDeepLink(signed); err != nil {
+		t.Fatalf("import signed link: %v", err)
+	}
+	providers, _ := ps.LoadProviders("claude")
+	if len(providers) != 1 || providers[0].Name != "relay" || providers[0].APIKey != "sk-link" {
+		t.Fatalf("providers = %+v", providers)
+	}
+}
+
+func TestDeepLink_ParseResources(t *testing.T) {
+	dls := NewDeepLinkService(nil)
+	config := base64.StdEncoding.EncodeToString([]byte(`{"mcpServers":{"fs":{"type":"stdio","command":"npx","args":["fs-server"]}}}`))
+
+	cases := []struct {
+		params map[string]string
+		ok     bool
+	}{
+		{map[string]string{"resource": "mcp", "config": config}, true},
+		{map[string]string{"resource": "mcp"}, false},
+		{map[string]string{"resource": "prompt", "app": "claude", "config": config}, false},
+		{map[string]string{"resource": "prompt", "app": "claude", "name": "review", "config": config}, true},
+		{map[string]string{"resource": "bundle", "configUrl": "ftp://example.com/x.json"}, false},
+		{map[string]string{"resource": "theme", "config": config}, false},
+	}
+	for _, tc := range cases {
+		_, err := dls.ParseDeepLinkURL(deepLinkURL(tc.params))
+		if (err == nil) != tc.ok {
+			t.Errorf("ParseDeepLinkURL(%v) err = %v, want ok=%v", tc.params, err, tc.ok)
+		}
+	}
+
+	plan := &deepLinkPlan{request: &DeepLinkImportRequest{Resource: "mcp", Config: &config}, data: &workspaceData{}}
+	if err := planMCPLink(plan); err != nil {
+		t.Fatalf("planMCPLink: %v", err)
+	}
+	warnings := deepLinkContentWarnings(plan.data)
+	if len(plan.data.MCPServers) != 1 || len(warnings) != 1 || !strings.Contains(warnings[0], "npx fs-server") {
+		t.Fatalf("servers = %+v, warnings = %v", plan.data.MCPServers, warnings)
+	}
+}
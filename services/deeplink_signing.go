@@ -0,0 +1,208 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 签名链接：管理员用 ed25519 私钥对链接签名（sig 参数），成员在本机登记可信公钥后即可校验来源。
+// 签名覆盖除 sig 以外的全部查询参数（按 key 排序编码）；使用 configUrl 时必须同时签入 configSha256，
+// 否则远程内容可在签名后被替换。
+const deepLinkSignatureParam = "sig"
+
+// DeepLinkTrustConfig 深度链接信任配置（~/.code-switch/deeplink-trust.json）
+type DeepLinkTrustConfig struct {
+	RequireSigned bool                 `json:"requireSigned"` // 开启后拒绝未签名的链接
+	TrustedKeys   []DeepLinkTrustedKey `json:"trustedKeys"`
+}
+
+// DeepLinkTrustedKey 可信签名公钥
+type DeepLinkTrustedKey struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"publicKey"` // base64
+}
+
+// DeepLinkSigningKey 新生成的签名密钥对（私钥只应保存在管理员机器上）
+type DeepLinkSigningKey struct {
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey"`
+}
+
+// GetDeepLinkTrust 读取信任配置
+func (s *DeepLinkService) GetDeepLinkTrust() (DeepLinkTrustConfig, error) {
+	return loadDeepLinkTrust()
+}
+
+// SaveDeepLinkTrust 校验并保存信任配置
+func (s *DeepLinkService) SaveDeepLinkTrust(cfg DeepLinkTrustConfig) error {
+	seen := make(map[string]bool, len(cfg.TrustedKeys))
+	keys := make([]DeepLinkTrustedKey, 0, len(cfg.TrustedKeys))
+	for _, key := range cfg.TrustedKeys {
+		key.Name = strings.TrimSpace(key.Name)
+		key.PublicKey = strings.TrimSpace(key.PublicKey)
+		if key.Name == "" {
+			return fmt.Errorf("公钥名称不能为空")
+		}
+		if _, err := decodeDeepLinkPublicKey(key.PublicKey); err != nil {
+			return fmt.Errorf("公钥 %s 无效: %w", key.Name, err)
+		}
+		if seen[key.PublicKey] {
+			continue
+		}
+		seen[key.PublicKey] = true
+		keys = append(keys, key)
+	}
+	if cfg.RequireSigned && len(keys) == 0 {
+		return fmt.Errorf("要求签名时至少需要一个可信公钥")
+	}
+	cfg.TrustedKeys = keys
+
+	path, err := deepLinkTrustPath()
+	if err != nil {
+		return err
+	}
+	if err := AtomicWriteJSON(path, cfg); err != nil {
+		return fmt.Errorf("保存信任配置失败: %w", err)
+	}
+	return nil
+}
+
+// GenerateDeepLinkSigningKey 生成签名密钥对（供管理员使用）
+func (s *DeepLinkService) GenerateDeepLinkSigningKey() (*DeepLinkSigningKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %w", err)
+	}
+	return &DeepLinkSigningKey{
+		PublicKey:  base64.StdEncoding.EncodeToString(publicKey),
+		PrivateKey: base64.StdEncoding.EncodeToString(privateKey.Seed()),
+	}, nil
+}
+
+// SignDeepLinkURL 为链接签名；使用 configUrl 且未携带 configSha256 时先下载内容计算摘要
+func (s *DeepLinkService) SignDeepLinkURL(urlStr, privateKey string) (string, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(privateKey))
+	if err != nil || (len(seed) != ed25519.SeedSize && len(seed) != ed25519.PrivateKeySize) {
+		return "", fmt.Errorf("私钥格式无效")
+	}
+	key := ed25519.PrivateKey(seed)
+	if len(seed) == ed25519.SeedSize {
+		key = ed25519.NewKeyFromSeed(seed)
+	}
+	if _, err := s.ParseDeepLinkURL(urlStr); err != nil {
+		return "", err
+	}
+
+	parsedURL, _ := url.Parse(urlStr)
+	params := parsedURL.Query()
+	params.Del(deepLinkSignatureParam)
+	if configURL := params.Get("configUrl"); configURL != "" && params.Get("configSha256") == "" {
+		content, err := fetchDeepLinkConfig(configURL)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(content)
+		params.Set("configSha256", hex.EncodeToString(sum[:]))
+	}
+	parsedURL.RawQuery = params.Encode()
+	signature := ed25519.Sign(key, []byte(deepLinkSigningPayload(parsedURL)))
+	params.Set(deepLinkSignatureParam, base64.RawURLEncoding.EncodeToString(signature))
+	parsedURL.RawQuery = params.Encode()
+	return parsedURL.String(), nil
+}
+
+// verifyDeepLinkSignature 校验链接签名，返回签名者名称（未签名时为空）
+// 带签名但校验失败的链接一律拒绝；信任配置要求签名时拒绝未签名链接
+func verifyDeepLinkSignature(urlStr string) (string, error) {
+	trust, err := loadDeepLinkTrust()
+	if err != nil {
+		return "", err
+	}
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("无效的深度链接 URL: %w", err)
+	}
+	params := parsedURL.Query()
+	encoded := params.Get(deepLinkSignatureParam)
+	if encoded == "" {
+		if trust.RequireSigned {
+			return "", fmt.Errorf("已开启签名校验，拒绝未签名的链接")
+		}
+		return "", nil
+	}
+	if params.Get("configUrl") != "" && params.Get("configSha256") == "" {
+		return "", fmt.Errorf("签名链接使用 configUrl 时必须携带 configSha256")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("签名格式无效")
+	}
+	params.Del(deepLinkSignatureParam)
+	parsedURL.RawQuery = params.Encode()
+	payload := []byte(deepLinkSigningPayload(parsedURL))
+	for _, key := range trust.TrustedKeys {
+		publicKey, err := decodeDeepLinkPublicKey(key.PublicKey)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(publicKey, payload, signature) {
+			return key.Name, nil
+		}
+	}
+	return "", fmt.Errorf("链接签名无法通过任何可信公钥校验")
+}
+
+// deepLinkSigningPayload 签名原文：scheme://version/path?排序后的参数（不含 sig）
+func deepLinkSigningPayload(parsedURL *url.URL) string {
+	return parsedURL.Scheme + "://" + parsedURL.Host + parsedURL.Path + "?" + parsedURL.Query().Encode()
+}
+
+func decodeDeepLinkPublicKey(encoded string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("长度应为 %d 字节", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+func deepLinkTrustPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "deeplink-trust.json"), nil
+}
+
+func loadDeepLinkTrust() (DeepLinkTrustConfig, error) {
+	cfg := DeepLinkTrustConfig{TrustedKeys: []DeepLinkTrustedKey{}}
+	path, err := deepLinkTrustPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("读取信任配置失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("解析信任配置失败: %w", err)
+	}
+	if cfg.TrustedKeys == nil {
+		cfg.TrustedKeys = []DeepLinkTrustedKey{}
+	}
+	return cfg, nil
+}
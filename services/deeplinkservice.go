@@ -1,9 +1,14 @@
 package services
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -28,11 +33,37 @@ type DeepLinkImportRequest struct {
 	Config       *string `json:"config,omitempty"`     // Base64 编码的配置
 	ConfigFormat *string `json:"configFormat,omitempty"` // 配置格式 (json/toml)
 	ConfigURL    *string `json:"configUrl,omitempty"`  // 远程配置 URL
+	ConfigSHA256 *string `json:"configSha256,omitempty"` // 远程配置内容的 SHA-256（签名链接使用 configUrl 时必填）
+	Signature    *string `json:"signature,omitempty"`  // ed25519 签名（见 deeplink_signing.go）
+}
+
+// 深度链接资源类型
+const (
+	DeepLinkResourceProvider = "provider"
+	DeepLinkResourceMCP      = "mcp"
+	DeepLinkResourcePrompt   = "prompt"
+	DeepLinkResourceSkill    = "skill"
+	DeepLinkResourceBundle   = "bundle" // 一次导入多个供应商（以及 MCP / 提示词 / 技能仓库）
+)
+
+// 远程配置（configUrl）下载限制
+const (
+	deepLinkConfigTimeout  = 15 * time.Second
+	maxDeepLinkConfigBytes = 1 << 20
+)
+
+var deepLinkResources = map[string]bool{
+	DeepLinkResourceProvider: true,
+	DeepLinkResourceMCP:      true,
+	DeepLinkResourcePrompt:   true,
+	DeepLinkResourceSkill:    true,
+	DeepLinkResourceBundle:   true,
 }
 
 // DeepLinkService 深度链接服务
 type DeepLinkService struct {
-	providerService *ProviderService
+	providerService  *ProviderService
+	workspaceService *WorkspaceService // 预览/确认导入复用工作区导入逻辑
 }
 
 // NewDeepLinkService 创建深度链接服务
@@ -42,6 +73,11 @@ func NewDeepLinkService(providerService *ProviderService) *DeepLinkService {
 	}
 }
 
+// SetWorkspaceService 注入工作区服务（预览/确认导入时使用）
+func (s *DeepLinkService) SetWorkspaceService(workspaceService *WorkspaceService) {
+	s.workspaceService = workspaceService
+}
+
 // Start Wails生命周期方法
 func (s *DeepLinkService) Start() error {
 	return nil
@@ -54,6 +90,7 @@ func (s *DeepLinkService) Stop() error {
 
 // ParseDeepLinkURL 解析 ccswitch:// URL
 // 预期格式: ccswitch://v1/import?resource=provider&app=claude&name=...&homepage=...&endpoint=...&apiKey=...
+// resource 为 mcp/prompt/skill/bundle 时内容放在 config（Base64 JSON）或 configUrl 中
 func (s *DeepLinkService) ParseDeepLinkURL(urlStr string) (*DeepLinkImportRequest, error) {
 	// 解析 URL
 	parsedURL, err := url.Parse(urlStr)
@@ -85,21 +122,23 @@ func (s *DeepLinkService) ParseDeepLinkURL(urlStr string) (*DeepLinkImportReques
 	if resource == "" {
 		return nil, fmt.Errorf("缺少 'resource' 参数")
 	}
-	if resource != "provider" {
+	if !deepLinkResources[resource] {
 		return nil, fmt.Errorf("不支持的资源类型: %s", resource)
 	}
+	// provider 与 prompt 需要指定目标应用和名称；mcp/skill/bundle 的内容全部来自配置
+	needsTarget := resource == DeepLinkResourceProvider || resource == DeepLinkResourcePrompt
 
 	// 提取必需字段
 	app := params.Get("app")
-	if app == "" {
+	if app == "" && needsTarget {
 		return nil, fmt.Errorf("缺少 'app' 参数")
 	}
-	if app != "claude" && app != "codex" && app != "gemini" {
+	if app != "" && app != "claude" && app != "codex" && app != "gemini" {
 		return nil, fmt.Errorf("无效的 app 类型: 必须是 'claude', 'codex', 或 'gemini', 得到 '%s'", app)
 	}
 
 	name := params.Get("name")
-	if name == "" {
+	if name == "" && needsTarget {
 		return nil, fmt.Errorf("缺少 'name' 参数")
 	}
 
@@ -121,7 +160,7 @@ func (s *DeepLinkService) ParseDeepLinkURL(urlStr string) (*DeepLinkImportReques
 	}
 
 	// 提取可选字段
-	var model, notes, haikuModel, sonnetModel, opusModel, config, configFormat, configURL *string
+	var model, notes, haikuModel, sonnetModel, opusModel, config, configFormat, configURL, configSHA256, signature *string
 	if v := params.Get("model"); v != "" {
 		model = &v
 	}
@@ -144,8 +183,20 @@ func (s *DeepLinkService) ParseDeepLinkURL(urlStr string) (*DeepLinkImportReques
 		configFormat = &v
 	}
 	if v := params.Get("configUrl"); v != "" {
+		if err := validateHTTPURL(v, "configUrl"); err != nil {
+			return nil, err
+		}
 		configURL = &v
 	}
+	if v := params.Get("configSha256"); v != "" {
+		configSHA256 = &v
+	}
+	if v := params.Get("sig"); v != "" {
+		signature = &v
+	}
+	if resource != DeepLinkResourceProvider && config == nil && configURL == nil {
+		return nil, fmt.Errorf("缺少 'config' 或 'configUrl' 参数")
+	}
 
 	return &DeepLinkImportRequest{
 		Version:      version,
@@ -163,11 +214,29 @@ func (s *DeepLinkService) ParseDeepLinkURL(urlStr string) (*DeepLinkImportReques
 		Config:       config,
 		ConfigFormat: configFormat,
 		ConfigURL:    configURL,
+		ConfigSHA256: configSHA256,
+		Signature:    signature,
 	}, nil
 }
 
 // ImportProviderFromDeepLink 从深度链接导入供应商
-func (s *DeepLinkService) ImportProviderFromDeepLink(request *DeepLinkImportRequest) (string, error) {
+// 接收原始链接而非解析结果，以便按信任配置校验签名（开启强制签名时拒绝未签名链接）
+func (s *DeepLinkService) ImportProviderFromDeepLink(urlStr string) (string, error) {
+	signer, err := verifyDeepLinkSignature(urlStr)
+	if err != nil {
+		return "", err
+	}
+	request, err := s.ParseDeepLinkURL(urlStr)
+	if err != nil {
+		return "", err
+	}
+	if request.Resource != DeepLinkResourceProvider {
+		return "", fmt.Errorf("%s 链接请通过预览确认后导入", request.Resource)
+	}
+	if signer != "" {
+		log.Printf("[DeepLink] 供应商链接签名校验通过（签名: %s）", signer)
+	}
+
 	// 1. 合并配置文件（如果提供）
 	merged, err := s.parseAndMergeConfig(request)
 	if err != nil {
@@ -256,38 +325,9 @@ func (s *DeepLinkService) parseAndMergeConfig(request *DeepLinkImportRequest) (*
 	}
 
 	// 获取配置内容
-	var configContent string
-	if request.Config != nil {
-		// 解码 Base64 内联配置
-		decoded, err := base64.StdEncoding.DecodeString(*request.Config)
-		if err != nil {
-			return nil, fmt.Errorf("无效的 Base64 编码: %w", err)
-		}
-		configContent = string(decoded)
-	} else if request.ConfigURL != nil {
-		// 远程配置（TODO: 下一阶段实现）
-		return nil, fmt.Errorf("远程配置 URL 暂不支持，请使用内联配置")
-	} else {
-		return request, nil
-	}
-
-	// 解析配置（基于格式）
-	format := "json"
-	if request.ConfigFormat != nil {
-		format = *request.ConfigFormat
-	}
-
 	var configData map[string]interface{}
-	switch format {
-	case "json":
-		if err := json.Unmarshal([]byte(configContent), &configData); err != nil {
-			return nil, fmt.Errorf("无效的 JSON 配置: %w", err)
-		}
-	case "toml":
-		// TOML 解析（暂不实现，后续添加）
-		return nil, fmt.Errorf("TOML 配置格式暂不支持")
-	default:
-		return nil, fmt.Errorf("不支持的配置格式: %s", format)
+	if err := loadDeepLinkConfig(request, &configData); err != nil {
+		return nil, err
 	}
 
 	// 合并配置（基于 app 类型）
@@ -418,6 +458,77 @@ func (s *DeepLinkService) mergeGeminiConfig(request *DeepLinkImportRequest, conf
 	}
 }
 
+// loadDeepLinkConfig 读取内联（Base64）或远程配置并按 JSON 解析到 target
+func loadDeepLinkConfig(request *DeepLinkImportRequest, target interface{}) error {
+	var content []byte
+	if request.Config != nil {
+		// 解码 Base64 内联配置
+		decoded, err := base64.StdEncoding.DecodeString(*request.Config)
+		if err != nil {
+			return fmt.Errorf("无效的 Base64 编码: %w", err)
+		}
+		content = decoded
+	} else if request.ConfigURL != nil {
+		fetched, err := fetchDeepLinkConfig(*request.ConfigURL)
+		if err != nil {
+			return err
+		}
+		content = fetched
+	} else {
+		return fmt.Errorf("缺少配置内容")
+	}
+	if request.ConfigSHA256 != nil {
+		sum := sha256.Sum256(content)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), *request.ConfigSHA256) {
+			return fmt.Errorf("配置内容与 configSha256 不匹配")
+		}
+	}
+
+	// 解析配置（基于格式）
+	format := "json"
+	if request.ConfigFormat != nil {
+		format = *request.ConfigFormat
+	}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(content, target); err != nil {
+			return fmt.Errorf("无效的 JSON 配置: %w", err)
+		}
+	case "toml":
+		// TOML 解析（暂不实现，后续添加）
+		return fmt.Errorf("TOML 配置格式暂不支持")
+	default:
+		return fmt.Errorf("不支持的配置格式: %s", format)
+	}
+	return nil
+}
+
+// fetchDeepLinkConfig 下载远程配置（仅 HTTPS，限制大小）
+func fetchDeepLinkConfig(rawURL string) ([]byte, error) {
+	if err := validateHTTPURL(rawURL, "configUrl"); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(strings.ToLower(rawURL), "https://") {
+		return nil, fmt.Errorf("远程配置仅支持 HTTPS 地址")
+	}
+	resp, err := GetHTTPClientWithTimeout(deepLinkConfigTimeout).Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("下载远程配置失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载远程配置失败: HTTP %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxDeepLinkConfigBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取远程配置失败: %w", err)
+	}
+	if len(content) > maxDeepLinkConfigBytes {
+		return nil, fmt.Errorf("远程配置超过 %d KB", maxDeepLinkConfigBytes/1024)
+	}
+	return content, nil
+}
+
 // validateHTTPURL 验证 HTTP(S) URL
 func validateHTTPURL(urlStr, fieldName string) error {
 	parsedURL, err := url.Parse(urlStr)
@@ -40,6 +40,10 @@ func loadProviderSnapshot(kind string) ([]Provider, error) {
 	if path == "" {
 		return nil, nil
 	}
+	// 锁定时 API Key 仍是密钥库引用，不能用于直连应用或按 Key 匹配
+	if secretVaultLocked() {
+		return nil, errSecretVaultLocked
+	}
 
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -57,6 +61,7 @@ func loadProviderSnapshot(kind string) ([]Provider, error) {
 	if err := json.Unmarshal(data, &envelope); err != nil {
 		return nil, err
 	}
+	openProviderSecrets(envelope.Providers)
 
 	return envelope.Providers, nil
 }
@@ -23,6 +23,7 @@ const (
 // GeminiProvider Gemini 供应商配置
 type GeminiProvider struct {
 	ID                    string            `json:"id"`
+	UID                   string            `json:"uid,omitempty"` // 稳定标识：保存时自动分配，改名后保持不变
 	Name                  string            `json:"name"`
 	WebsiteURL            string            `json:"websiteUrl,omitempty"`
 	APIKeyURL             string            `json:"apiKeyUrl,omitempty"`
@@ -35,8 +36,14 @@ type GeminiProvider struct {
 	Enabled               bool              `json:"enabled"`
 	Level                 int               `json:"level,omitempty"`                 // 优先级分组 (1-10, 默认 1)
 	MaxConcurrentRequests int               `json:"maxConcurrentRequests,omitempty"` // 最大并发请求数（0=不限制）
+	FlatRate              bool              `json:"flatRate,omitempty"`              // 免费 / 包月标记（预算超限时仍可使用）
 	EnvConfig             map[string]string `json:"envConfig,omitempty"`             // .env 配置
 	SettingsConfig        map[string]any    `json:"settingsConfig,omitempty"`        // settings.json 配置
+
+	// 可用性监控（与 Provider 同名字段含义一致）
+	AvailabilityMonitorEnabled bool                `json:"availabilityMonitorEnabled,omitempty"`
+	ConnectivityAutoBlacklist  bool                `json:"connectivityAutoBlacklist,omitempty"`
+	AvailabilityConfig         *AvailabilityConfig `json:"availabilityConfig,omitempty"`
 }
 
 // GeminiPreset 预设供应商
@@ -135,9 +142,18 @@ func (s *GeminiService) Stop() error {
 
 // GetPresets 获取预设供应商列表
 func (s *GeminiService) GetPresets() []GeminiPreset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.presets
 }
 
+// setPresets 替换预设列表（供应商目录刷新后调用）
+func (s *GeminiService) setPresets(presets []GeminiPreset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presets = presets
+}
+
 // GetProviders 获取已配置的供应商列表
 func (s *GeminiService) GetProviders() []GeminiProvider {
 	s.mu.Lock()
@@ -163,7 +179,11 @@ func (s *GeminiService) AddProvider(provider GeminiProvider) error {
 	}
 
 	s.providers = append(s.providers, provider)
-	return s.saveProviders()
+	if err := s.saveProviders(); err != nil {
+		return err
+	}
+	recordProviderConfigChanges("gemini", nil, map[string]interface{}{provider.Name: provider})
+	return nil
 }
 
 // UpdateProvider 更新供应商
@@ -177,8 +197,19 @@ func (s *GeminiService) UpdateProvider(provider GeminiProvider) error {
 			if strings.TrimSpace(provider.APIKey) == "" {
 				provider.APIKey = p.APIKey
 			}
+			// 与 Claude/Codex 一致：改名需通过 ProviderRenameService 迁移黑名单与统计数据
+			if provider.Name != p.Name {
+				return fmt.Errorf("供应商 '%s' 的 name 不可直接修改，请使用改名功能", p.ID)
+			}
+			if provider.UID == "" {
+				provider.UID = p.UID
+			}
 			s.providers[i] = provider
-			return s.saveProviders()
+			if err := s.saveProviders(); err != nil {
+				return err
+			}
+			recordProviderConfigChanges("gemini", map[string]interface{}{p.Name: p}, map[string]interface{}{provider.Name: provider})
+			return nil
 		}
 	}
 	return fmt.Errorf("未找到 ID 为 '%s' 的供应商", provider.ID)
@@ -192,7 +223,11 @@ func (s *GeminiService) DeleteProvider(id string) error {
 	for i, p := range s.providers {
 		if p.ID == id {
 			s.providers = append(s.providers[:i], s.providers[i+1:]...)
-			return s.saveProviders()
+			if err := s.saveProviders(); err != nil {
+				return err
+			}
+			recordProviderConfigChanges("gemini", map[string]interface{}{p.Name: p}, nil)
+			return nil
 		}
 	}
 	return fmt.Errorf("未找到 ID 为 '%s' 的供应商", id)
@@ -603,7 +638,25 @@ func (s *GeminiService) loadProviders() error {
 		return err
 	}
 
-	return json.Unmarshal(data, &s.providers)
+	if err := json.Unmarshal(data, &s.providers); err != nil {
+		return err
+	}
+	openGeminiSecrets(s.providers)
+	return nil
+}
+
+// ReloadProviders 重新加载供应商配置（密钥库解锁后解析 API Key）
+func (s *GeminiService) ReloadProviders() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadProviders()
+}
+
+// rewriteProviders 按当前密钥库状态重写配置文件
+func (s *GeminiService) rewriteProviders() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveProviders()
 }
 
 // saveProviders 保存供应商配置
@@ -614,13 +667,22 @@ func (s *GeminiService) saveProviders() error {
 		return err
 	}
 
-	data, err := json.MarshalIndent(s.providers, "", "  ")
+	for i := range s.providers {
+		if s.providers[i].UID == "" {
+			s.providers[i].UID = legacyProviderUID("gemini", s.providers[i].ID, s.providers[i].Name)
+		}
+	}
+	stored, err := sealGeminiSecrets(s.providers)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
 	if err != nil {
 		return err
 	}
 
 	tmpPath := path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
 		return err
 	}
 	return os.Rename(tmpPath, path)
@@ -629,20 +691,30 @@ func (s *GeminiService) saveProviders() error {
 // CreateProviderFromPreset 从预设创建供应商
 func (s *GeminiService) CreateProviderFromPreset(presetName string, apiKey string) (*GeminiProvider, error) {
 	var preset *GeminiPreset
-	for i := range s.presets {
-		if s.presets[i].Name == presetName {
-			preset = &s.presets[i]
+	for _, candidate := range s.GetPresets() {
+		if candidate.Name == presetName {
+			preset = &candidate
 			break
 		}
 	}
 	if preset == nil {
 		return nil, fmt.Errorf("未找到预设 '%s'", presetName)
 	}
+	return s.createProviderFromPreset(*preset, preset.Name, apiKey)
+}
+
+// createProviderFromPreset 按给定预设创建名为 name 的供应商（名称不可与已有供应商重复）
+func (s *GeminiService) createProviderFromPreset(preset GeminiPreset, name string, apiKey string) (*GeminiProvider, error) {
+	for _, existing := range s.GetProviders() {
+		if existing.Name == name {
+			return nil, fmt.Errorf("供应商名称已存在: %s", name)
+		}
+	}
 
 	// 创建供应商
 	provider := GeminiProvider{
-		ID:                  fmt.Sprintf("gemini-%s-%d", strings.ToLower(strings.ReplaceAll(presetName, " ", "-")), len(s.providers)+1),
-		Name:                preset.Name,
+		ID:                  fmt.Sprintf("gemini-%s-%d", strings.ToLower(strings.ReplaceAll(preset.Name, " ", "-")), len(s.GetProviders())+1),
+		Name:                name,
 		WebsiteURL:          preset.WebsiteURL,
 		APIKeyURL:           preset.APIKeyURL,
 		BaseURL:             preset.BaseURL,
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 模型能力校验子项（仅校验声明为支持的布尔能力；上下文窗口等数值上限探测代价过高，不做主动验证）
+const (
+	HealthSubCheckImages        = "images"         // 图片输入
+	HealthSubCheckThinking      = "thinking"       // thinking / reasoning
+	HealthSubCheckPromptCaching = "prompt_caching" // 两次相同长前缀请求应命中缓存
+)
+
+const (
+	healthImagePrompt         = "What color is this image? Reply with one word."
+	healthThinkingBudget      = 1024
+	healthThinkingMaxTokens   = healthThinkingBudget + 64
+	healthCachePrefixSentence = "Code Switch prompt caching probe, this sentence is repeated to exceed the minimum cacheable prefix. "
+	healthCachePrefixRepeat   = 160 // 约 2.5k token，高于 Anthropic / OpenAI 的最小缓存长度
+	healthCacheKey            = "code-switch-health-cache"
+)
+
+// healthProbeImagePNG 1x1 红色像素 PNG
+const healthProbeImagePNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8DwHwAFBQIAX8jx0gAAAABJRU5ErkJggg=="
+
+// runCapabilityChecks 按测试模型的能力声明逐项验证；工具调用已在检测档案中校验时不重复发起
+func (hcs *HealthCheckService) runCapabilityChecks(ctx context.Context, provider *Provider, platform, model, targetURL string, timeout int) []HealthSubCheck {
+	if platform == "gemini" {
+		return nil
+	}
+	capability, ok := provider.ModelCapabilityFor(model)
+	if !ok {
+		return nil
+	}
+	declared := func(flag *bool) bool { return flag != nil && *flag }
+
+	checks := make([]HealthSubCheck, 0, 4)
+	if declared(capability.SupportsTools) && !provider.AvailabilityConfig.CheckToolUse {
+		checks = append(checks, hcs.runToolUseCheck(ctx, provider, platform, model, targetURL, timeout))
+	}
+	if declared(capability.SupportsImages) {
+		checks = append(checks, hcs.runCapabilityRequest(ctx, provider, platform, targetURL, timeout, HealthSubCheckImages,
+			buildImageCheckRequest(platform, model), nil))
+	}
+	if declared(capability.SupportsThinking) {
+		checks = append(checks, hcs.runCapabilityRequest(ctx, provider, platform, targetURL, timeout, HealthSubCheckThinking,
+			buildThinkingCheckRequest(platform, model), func(body []byte) string { return evaluateThinkingResponse(platform, body) }))
+	}
+	if declared(capability.SupportsPromptCaching) {
+		checks = append(checks, hcs.runPromptCachingCheck(ctx, provider, platform, model, targetURL, timeout))
+	}
+	return checks
+}
+
+// runCapabilityRequest 发送一次能力探测请求；evaluate 非空时对 2xx 响应做额外校验，返回失败原因
+func (hcs *HealthCheckService) runCapabilityRequest(ctx context.Context, provider *Provider, platform, targetURL string, timeout int, name string, reqBody []byte, evaluate func([]byte) string) HealthSubCheck {
+	check := HealthSubCheck{Name: name}
+	statusCode, body, latencyMs, err := hcs.doCheckRequest(ctx, provider, platform, targetURL, reqBody, timeout, false, healthProfileBodyLimit)
+	check.LatencyMs = latencyMs
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		check.Message = fmt.Sprintf("HTTP %d", statusCode)
+		return check
+	}
+	if evaluate != nil {
+		if reason := evaluate(body); reason != "" {
+			check.Message = reason
+			return check
+		}
+	}
+	check.Passed = true
+	return check
+}
+
+// runPromptCachingCheck 连续发送两次相同长前缀的请求，任一次响应报告缓存写入或命中即通过
+func (hcs *HealthCheckService) runPromptCachingCheck(ctx context.Context, provider *Provider, platform, model, targetURL string, timeout int) (check HealthSubCheck) {
+	check = HealthSubCheck{Name: HealthSubCheckPromptCaching}
+	start := time.Now()
+	defer func() {
+		check.LatencyMs = int(time.Since(start).Milliseconds())
+	}()
+
+	reqBody := buildPromptCachingCheckRequest(platform, model)
+	for attempt := 1; attempt <= 2; attempt++ {
+		statusCode, body, _, err := hcs.doCheckRequest(ctx, provider, platform, targetURL, reqBody, timeout, false, healthProfileBodyLimit)
+		if err != nil {
+			check.Message = err.Error()
+			return check
+		}
+		if statusCode < 200 || statusCode >= 300 {
+			check.Message = fmt.Sprintf("第 %d 次请求 HTTP %d", attempt, statusCode)
+			return check
+		}
+		if promptCacheTokens(body) > 0 {
+			check.Passed = true
+			return check
+		}
+	}
+	check.Message = "两次请求均未报告缓存 token"
+	return check
+}
+
+func buildImageCheckRequest(platform, model string) []byte {
+	var reqBody map[string]interface{}
+	switch platform {
+	case "claude":
+		reqBody = map[string]interface{}{
+			"model":      model,
+			"max_tokens": healthProfileMaxTokens,
+			"messages": []map[string]interface{}{
+				{"role": "user", "content": []map[string]interface{}{
+					{"type": "image", "source": map[string]string{"type": "base64", "media_type": "image/png", "data": healthProbeImagePNG}},
+					{"type": "text", "text": healthImagePrompt},
+				}},
+			},
+		}
+	case "codex":
+		reqBody = map[string]interface{}{
+			"model":             model,
+			"max_output_tokens": healthProfileMaxTokens,
+			"input": []map[string]interface{}{
+				{"role": "user", "content": []map[string]interface{}{
+					{"type": "input_image", "image_url": "data:image/png;base64," + healthProbeImagePNG},
+					{"type": "input_text", "text": healthImagePrompt},
+				}},
+			},
+		}
+	default:
+		reqBody = map[string]interface{}{
+			"model":      model,
+			"max_tokens": healthProfileMaxTokens,
+			"messages": []map[string]interface{}{
+				{"role": "user", "content": []map[string]interface{}{
+					{"type": "image_url", "image_url": map[string]string{"url": "data:image/png;base64," + healthProbeImagePNG}},
+					{"type": "text", "text": healthImagePrompt},
+				}},
+			},
+		}
+	}
+	data, _ := json.Marshal(reqBody)
+	return data
+}
+
+func buildThinkingCheckRequest(platform, model string) []byte {
+	var reqBody map[string]interface{}
+	switch platform {
+	case "claude":
+		reqBody = map[string]interface{}{
+			"model":      model,
+			"max_tokens": healthThinkingMaxTokens,
+			"thinking":   map[string]interface{}{"type": "enabled", "budget_tokens": healthThinkingBudget},
+			"messages": []map[string]interface{}{
+				{"role": "user", "content": "What is 17 * 23?"},
+			},
+		}
+	case "codex":
+		reqBody = map[string]interface{}{
+			"model":             model,
+			"max_output_tokens": healthThinkingMaxTokens,
+			"reasoning":         map[string]string{"effort": "low", "summary": "auto"},
+			"input":             []map[string]string{{"role": "user", "content": "What is 17 * 23?"}},
+		}
+	default:
+		reqBody = map[string]interface{}{
+			"model":                 model,
+			"max_completion_tokens": healthThinkingMaxTokens,
+			"reasoning_effort":      "low",
+			"messages":              []map[string]string{{"role": "user", "content": "What is 17 * 23?"}},
+		}
+	}
+	data, _ := json.Marshal(reqBody)
+	return data
+}
+
+// evaluateThinkingResponse 上游可能静默忽略 thinking 参数，因此要求响应中确有推理内容或推理 token
+func evaluateThinkingResponse(platform string, body []byte) string {
+	root := gjson.ParseBytes(body)
+	switch platform {
+	case "claude":
+		for _, block := range root.Get("content").Array() {
+			if kind := block.Get("type").String(); kind == "thinking" || kind == "redacted_thinking" {
+				return ""
+			}
+		}
+		return "响应中没有 thinking 内容块"
+	case "codex":
+		for _, item := range root.Get("output").Array() {
+			if item.Get("type").String() == "reasoning" {
+				return ""
+			}
+		}
+		if root.Get("usage.output_tokens_details.reasoning_tokens").Int() > 0 {
+			return ""
+		}
+		return "响应中没有 reasoning 输出"
+	default:
+		if root.Get("usage.completion_tokens_details.reasoning_tokens").Int() > 0 {
+			return ""
+		}
+		return "usage 中没有 reasoning token"
+	}
+}
+
+func buildPromptCachingCheckRequest(platform, model string) []byte {
+	prefix := strings.Repeat(healthCachePrefixSentence, healthCachePrefixRepeat)
+	var reqBody map[string]interface{}
+	switch platform {
+	case "claude":
+		reqBody = map[string]interface{}{
+			"model":      model,
+			"max_tokens": 1,
+			"system": []map[string]interface{}{
+				{"type": "text", "text": prefix, "cache_control": map[string]string{"type": "ephemeral"}},
+			},
+			"messages": []map[string]string{{"role": "user", "content": defaultHealthBasicTestInput}},
+		}
+	case "codex":
+		reqBody = map[string]interface{}{
+			"model":             model,
+			"max_output_tokens": 16,
+			"instructions":      prefix,
+			"prompt_cache_key":  healthCacheKey,
+			"input":             []map[string]string{{"role": "user", "content": defaultHealthBasicTestInput}},
+		}
+	default:
+		reqBody = map[string]interface{}{
+			"model":      model,
+			"max_tokens": 1,
+			"messages": []map[string]string{
+				{"role": "system", "content": prefix},
+				{"role": "user", "content": defaultHealthBasicTestInput},
+			},
+		}
+	}
+	data, _ := json.Marshal(reqBody)
+	return data
+}
+
+// promptCacheTokens 从 Anthropic / Responses / Chat Completions 的 usage 中读取缓存写入与命中 token
+func promptCacheTokens(body []byte) int64 {
+	usage := gjson.GetBytes(body, "usage")
+	return usage.Get("cache_creation_input_tokens").Int() +
+		usage.Get("cache_read_input_tokens").Int() +
+		usage.Get("input_tokens_details.cached_tokens").Int() +
+		usage.Get("prompt_tokens_details.cached_tokens").Int()
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+)
+
+// 官方 Gemini API 地址（GeminiProvider 未配置 baseUrl 时使用）
+const defaultGeminiBaseURL = "https://generativelanguage.googleapis.com"
+
+// SetGeminiService 注入 GeminiService，使可用性监控覆盖 Gemini 供应商
+func (hcs *HealthCheckService) SetGeminiService(geminiService *GeminiService) {
+	hcs.geminiService = geminiService
+}
+
+// SetCustomCliService 注入 CustomCliService，使可用性监控覆盖 custom:{toolId} 供应商
+func (hcs *HealthCheckService) SetCustomCliService(customCliService *CustomCliService) {
+	hcs.customCliService = customCliService
+}
+
+// healthCheckFormat 平台对应的请求格式：自定义 CLI 走 Anthropic /v1/messages（与 customCliProxyHandler 一致）
+func healthCheckFormat(platform string) string {
+	if strings.HasPrefix(platform, "custom:") {
+		return "claude"
+	}
+	return strings.ToLower(platform)
+}
+
+// monitoredPlatforms 返回需要监控的全部平台（含 custom:{toolId}）
+func (hcs *HealthCheckService) monitoredPlatforms() []string {
+	platforms := []string{"claude", "codex", "gemini"}
+	if hcs.customCliService == nil {
+		return platforms
+	}
+	tools, err := hcs.customCliService.ListTools()
+	if err != nil {
+		log.Printf("[HealthCheck] 加载自定义 CLI 工具失败: %v", err)
+		return platforms
+	}
+	for _, tool := range tools {
+		platforms = append(platforms, "custom:"+tool.ID)
+	}
+	return platforms
+}
+
+// loadPlatformProviders 加载平台供应商；Gemini 供应商转换为 Provider 以复用检测流程
+func (hcs *HealthCheckService) loadPlatformProviders(platform string) ([]Provider, error) {
+	if platform != "gemini" {
+		return hcs.providerService.LoadProviders(platform)
+	}
+	if hcs.geminiService == nil {
+		return nil, nil
+	}
+	geminiProviders := hcs.geminiService.GetProviders()
+	providers := make([]Provider, 0, len(geminiProviders))
+	for _, gp := range geminiProviders {
+		providers = append(providers, geminiAsProvider(gp))
+	}
+	return providers, nil
+}
+
+// geminiProviderID 将 Gemini 供应商的字符串 ID 映射为稳定的数字 ID（32 位，前端 number 可安全表示）
+func geminiProviderID(id string) int64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int64(h.Sum32())
+}
+
+// geminiAsProvider 将 GeminiProvider 转换为健康检查使用的 Provider
+func geminiAsProvider(gp GeminiProvider) Provider {
+	baseURL := strings.TrimSpace(gp.BaseURL)
+	if baseURL == "" {
+		baseURL = defaultGeminiBaseURL
+	}
+
+	var config *AvailabilityConfig
+	if gp.AvailabilityConfig != nil {
+		copied := *gp.AvailabilityConfig
+		config = &copied
+	}
+	// 未单独配置测试模型时使用供应商自身的模型
+	if gp.Model != "" && (config == nil || config.TestModel == "") {
+		if config == nil {
+			config = &AvailabilityConfig{}
+		}
+		config.TestModel = gp.Model
+	}
+
+	return Provider{
+		ID:                         geminiProviderID(gp.ID),
+		Name:                       gp.Name,
+		APIURL:                     baseURL,
+		APIKey:                     gp.APIKey,
+		Enabled:                    gp.Enabled,
+		AvailabilityMonitorEnabled: gp.AvailabilityMonitorEnabled,
+		ConnectivityAutoBlacklist:  gp.ConnectivityAutoBlacklist,
+		AvailabilityConfig:         config,
+	}
+}
+
+// updatePlatformProvider 修改指定供应商的监控相关配置并保存（Gemini 写回 GeminiService）
+func (hcs *HealthCheckService) updatePlatformProvider(platform string, providerID int64, apply func(p *Provider) error) error {
+	if platform == "gemini" {
+		if hcs.geminiService == nil {
+			return fmt.Errorf("Gemini 服务未初始化")
+		}
+		for _, gp := range hcs.geminiService.GetProviders() {
+			if geminiProviderID(gp.ID) != providerID {
+				continue
+			}
+			provider := Provider{
+				AvailabilityMonitorEnabled: gp.AvailabilityMonitorEnabled,
+				ConnectivityAutoBlacklist:  gp.ConnectivityAutoBlacklist,
+				AvailabilityConfig:         gp.AvailabilityConfig,
+			}
+			if err := apply(&provider); err != nil {
+				return err
+			}
+			gp.AvailabilityMonitorEnabled = provider.AvailabilityMonitorEnabled
+			gp.ConnectivityAutoBlacklist = provider.ConnectivityAutoBlacklist
+			gp.AvailabilityConfig = provider.AvailabilityConfig
+			if err := hcs.geminiService.UpdateProvider(gp); err != nil {
+				return fmt.Errorf("保存供应商配置失败: %w", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("未找到供应商 ID: %d", providerID)
+	}
+
+	providers, err := hcs.providerService.LoadProviders(platform)
+	if err != nil {
+		return fmt.Errorf("加载供应商失败: %w", err)
+	}
+
+	found := false
+	for i := range providers {
+		if providers[i].ID == providerID {
+			if err := apply(&providers[i]); err != nil {
+				return err
+			}
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("未找到供应商 ID: %d", providerID)
+	}
+
+	if err := hcs.providerService.SaveProviders(platform, providers); err != nil {
+		return fmt.Errorf("保存供应商配置失败: %w", err)
+	}
+	return nil
+}
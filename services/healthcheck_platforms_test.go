@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthCheck_GeminiNativeProbe(t *testing.T) {
+	var gotPath, gotKey string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-goog-api-key")
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &gotBody)
+		_, _ = w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"ok"}]}}],"usageMetadata":{"promptTokenCount":1}}`))
+	}))
+	defer server.Close()
+
+	provider := geminiAsProvider(GeminiProvider{
+		ID:      "gemini-1",
+		Name:    "g",
+		BaseURL: server.URL,
+		APIKey:  "secret",
+		Model:   "gemini-2.5-flash",
+		AvailabilityConfig: &AvailabilityConfig{
+			RequireUsage: true,
+		},
+	})
+
+	hcs := &HealthCheckService{}
+	result := hcs.checkProvider(context.Background(), provider, "gemini")
+	if result.Status != HealthStatusOperational {
+		t.Fatalf("status = %s (%s), want operational", result.Status, result.ErrorMessage)
+	}
+	if gotPath != "/v1beta/models/gemini-2.5-flash:generateContent" {
+		t.Fatalf("path = %s", gotPath)
+	}
+	if gotKey != "secret" {
+		t.Fatalf("x-goog-api-key = %q", gotKey)
+	}
+	if _, ok := gotBody["contents"]; !ok {
+		t.Fatalf("request body should use Gemini contents, got %v", gotBody)
+	}
+	if result.ProviderID != geminiProviderID("gemini-1") {
+		t.Fatalf("provider id = %d", result.ProviderID)
+	}
+}
+
+func TestHealthCheck_CustomCliUsesMessagesFormat(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"ok"}]}`))
+	}))
+	defer server.Close()
+
+	provider := Provider{ID: 7, Name: "c", APIURL: server.URL, APIKey: "k"}
+	hcs := &HealthCheckService{}
+	result := hcs.checkProvider(context.Background(), provider, "custom:tool-1")
+	if result.Status != HealthStatusOperational {
+		t.Fatalf("status = %s (%s), want operational", result.Status, result.ErrorMessage)
+	}
+	if gotPath != "/v1/messages" {
+		t.Fatalf("path = %s, want /v1/messages", gotPath)
+	}
+	if result.Platform != "custom:tool-1" {
+		t.Fatalf("platform = %s", result.Platform)
+	}
+}
@@ -0,0 +1,540 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 检测档案子项名称
+const (
+	HealthSubCheckStream  = "stream"   // 流式响应完整性
+	HealthSubCheckToolUse = "tool_use" // 工具调用往返
+	HealthSubCheckContent = "content"  // 回复包含期望子串
+	HealthSubCheckUsage   = "usage"    // 响应包含 token 用量
+)
+
+const (
+	healthProfileMaxTokens      = 32
+	healthToolUseMaxTokens      = 64
+	healthProfileBodyLimit      = 64 << 10
+	healthStreamBodyLimit       = 256 << 10
+	healthToolName              = "get_weather"
+	healthToolPrompt            = "What is the weather in Paris? Use the get_weather tool."
+	healthToolResult            = "sunny, 25C"
+	defaultHealthContentPrompt  = "Reply with exactly: %s"
+	defaultHealthBasicTestInput = "hi"
+)
+
+// HealthSubCheck 检测档案中单个子项的结果
+type HealthSubCheck struct {
+	Name      string `json:"name"`
+	Passed    bool   `json:"passed"`
+	LatencyMs int    `json:"latencyMs,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// healthRequestOptions 测试请求参数（默认 "hi" + 1 token）
+type healthRequestOptions struct {
+	Prompt    string
+	MaxTokens int
+	Stream    bool
+}
+
+// healthToolCall 从上游响应中解析出的工具调用
+type healthToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // JSON 字符串
+}
+
+func defaultHealthRequestOptions() healthRequestOptions {
+	return healthRequestOptions{Prompt: defaultHealthBasicTestInput, MaxTokens: 1}
+}
+
+// hasProfileChecks 是否配置了超出“状态码 + 延迟”的检测项
+func (c *AvailabilityConfig) hasProfileChecks() bool {
+	return c != nil && (c.CheckStream || c.CheckToolUse || c.ExpectContains != "" || c.RequireUsage || c.CheckCapabilities)
+}
+
+// mainRequestOptions 主检测请求参数：需要校验内容/用量时放宽 max_tokens，让上游真正生成回复
+func (c *AvailabilityConfig) mainRequestOptions() healthRequestOptions {
+	opts := defaultHealthRequestOptions()
+	if c == nil || (c.ExpectContains == "" && !c.RequireUsage) {
+		return opts
+	}
+	opts.MaxTokens = healthProfileMaxTokens
+	switch {
+	case strings.TrimSpace(c.TestPrompt) != "":
+		opts.Prompt = c.TestPrompt
+	case c.ExpectContains != "":
+		opts.Prompt = fmt.Sprintf(defaultHealthContentPrompt, c.ExpectContains)
+	}
+	return opts
+}
+
+// runProfileChecks 在主请求成功后执行检测档案中的各子项，任一失败则标记为 validation_failed
+func (hcs *HealthCheckService) runProfileChecks(ctx context.Context, provider *Provider, platform, model, targetURL string, timeout int, body []byte, result *HealthCheckResult) {
+	config := provider.AvailabilityConfig
+	if !config.hasProfileChecks() {
+		return
+	}
+	if result.Status != HealthStatusOperational && result.Status != HealthStatusDegraded {
+		return
+	}
+
+	checks := make([]HealthSubCheck, 0, 4)
+	if config.ExpectContains != "" {
+		checks = append(checks, evaluateContentCheck(platform, body, config.ExpectContains))
+	}
+	if config.RequireUsage {
+		checks = append(checks, evaluateUsageCheck(body))
+	}
+	if config.CheckStream {
+		checks = append(checks, hcs.runStreamCheck(ctx, provider, platform, model, targetURL, timeout))
+	}
+	if config.CheckToolUse {
+		checks = append(checks, hcs.runToolUseCheck(ctx, provider, platform, model, targetURL, timeout))
+	}
+	if config.CheckCapabilities {
+		checks = append(checks, hcs.runCapabilityChecks(ctx, provider, platform, model, targetURL, timeout)...)
+	}
+	result.Checks = checks
+
+	var failed []string
+	for _, check := range checks {
+		if !check.Passed {
+			failed = append(failed, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+	}
+	if len(failed) > 0 {
+		result.Status = HealthStatusValidationError
+		result.ErrorMessage = "校验未通过 - " + strings.Join(failed, "; ")
+	}
+}
+
+// evaluateContentCheck 回复内容校验（与 ConnectivityTestService.evaluateContent 一致，按子串匹配）
+func evaluateContentCheck(platform string, body []byte, expected string) HealthSubCheck {
+	check := HealthSubCheck{Name: HealthSubCheckContent}
+	text := extractHealthResponseText(platform, body)
+	if strings.Contains(text, expected) || strings.Contains(string(body), expected) {
+		check.Passed = true
+		return check
+	}
+	if strings.TrimSpace(text) == "" {
+		check.Message = "回复内容为空"
+	} else {
+		check.Message = fmt.Sprintf("回复未包含 %q", expected)
+	}
+	return check
+}
+
+// evaluateUsageCheck 校验响应中是否有 token 用量
+func evaluateUsageCheck(body []byte) HealthSubCheck {
+	check := HealthSubCheck{Name: HealthSubCheckUsage}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		check.Message = "响应不是有效 JSON"
+		return check
+	}
+	usage, _ := payload["usage"].(map[string]interface{})
+	if usage == nil {
+		// Gemini 原生格式
+		usage, _ = payload["usageMetadata"].(map[string]interface{})
+	}
+	if usage == nil {
+		// Codex 流式/部分兼容实现把用量放在 response 对象内
+		if response, ok := payload["response"].(map[string]interface{}); ok {
+			usage, _ = response["usage"].(map[string]interface{})
+		}
+	}
+	if usage == nil {
+		check.Message = "响应缺少 usage 字段"
+		return check
+	}
+	for _, key := range []string{"input_tokens", "output_tokens", "prompt_tokens", "completion_tokens", "total_tokens", "promptTokenCount", "totalTokenCount"} {
+		if value, ok := usage[key].(float64); ok && value > 0 {
+			check.Passed = true
+			return check
+		}
+	}
+	check.Message = "usage 中 token 数均为 0"
+	return check
+}
+
+// extractHealthResponseText 提取非流式响应中的文本（Anthropic / Responses / Gemini / Chat Completions）
+func extractHealthResponseText(platform string, body []byte) string {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	var builder strings.Builder
+	switch platform {
+	case "claude":
+		for _, item := range jsonArray(payload["content"]) {
+			if block, ok := item.(map[string]interface{}); ok && block["type"] == "text" {
+				builder.WriteString(jsonString(block["text"]))
+			}
+		}
+	case "codex":
+		if text := jsonString(payload["output_text"]); text != "" {
+			return text
+		}
+		for _, item := range jsonArray(payload["output"]) {
+			output, ok := item.(map[string]interface{})
+			if !ok || output["type"] != "message" {
+				continue
+			}
+			for _, part := range jsonArray(output["content"]) {
+				if content, ok := part.(map[string]interface{}); ok {
+					builder.WriteString(jsonString(content["text"]))
+				}
+			}
+		}
+	case "gemini":
+		for _, part := range geminiCandidateParts(payload) {
+			builder.WriteString(jsonString(part["text"]))
+		}
+	default:
+		for _, item := range jsonArray(payload["choices"]) {
+			if choice, ok := item.(map[string]interface{}); ok {
+				if message, ok := choice["message"].(map[string]interface{}); ok {
+					builder.WriteString(jsonString(message["content"]))
+				}
+			}
+		}
+	}
+	return builder.String()
+}
+
+// runStreamCheck 发起流式请求，要求收到 SSE 数据并以平台的结束事件收尾
+func (hcs *HealthCheckService) runStreamCheck(ctx context.Context, provider *Provider, platform, model, targetURL string, timeout int) HealthSubCheck {
+	check := HealthSubCheck{Name: HealthSubCheckStream}
+	opts := provider.AvailabilityConfig.mainRequestOptions()
+	opts.Stream = true
+	reqBody := hcs.buildTestRequestWithOptions(platform, model, "default", opts)
+	if platform == "gemini" {
+		// Gemini 流式使用独立方法名，并通过 alt=sse 返回 SSE
+		targetURL = strings.Replace(targetURL, ":generateContent", ":streamGenerateContent", 1)
+		if strings.Contains(targetURL, "?") {
+			targetURL += "&alt=sse"
+		} else {
+			targetURL += "?alt=sse"
+		}
+	}
+
+	statusCode, body, latencyMs, err := hcs.doCheckRequest(ctx, provider, platform, targetURL, reqBody, timeout, true, healthStreamBodyLimit)
+	check.LatencyMs = latencyMs
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		check.Message = fmt.Sprintf("HTTP %d", statusCode)
+		return check
+	}
+	check.Passed, check.Message = evaluateStreamBody(platform, body)
+	return check
+}
+
+// evaluateStreamBody 判断 SSE 响应是否完整
+func evaluateStreamBody(platform string, body []byte) (bool, string) {
+	text := string(body)
+	if !strings.Contains(text, "data:") {
+		return false, "响应不是 SSE 流"
+	}
+	var terminal string
+	switch platform {
+	case "claude":
+		terminal = "message_stop"
+	case "codex":
+		terminal = "response.completed"
+	case "gemini":
+		// Gemini 没有独立的结束事件，最后一个分块带 finishReason
+		terminal = "finishReason"
+	default:
+		terminal = "[DONE]"
+	}
+	if !strings.Contains(text, terminal) {
+		return false, fmt.Sprintf("未收到结束事件 %s", terminal)
+	}
+	return true, ""
+}
+
+// runToolUseCheck 工具调用往返：强制模型调用工具，再回传工具结果，两步都成功才算通过
+func (hcs *HealthCheckService) runToolUseCheck(ctx context.Context, provider *Provider, platform, model, targetURL string, timeout int) (check HealthSubCheck) {
+	check = HealthSubCheck{Name: HealthSubCheckToolUse}
+	start := time.Now()
+	// 命名返回值：defer 中记录的耗时才会写入返回结果
+	defer func() {
+		check.LatencyMs = int(time.Since(start).Milliseconds())
+	}()
+
+	statusCode, body, _, err := hcs.doCheckRequest(ctx, provider, platform, targetURL, buildToolUseRequest(platform, model, nil), timeout, false, healthProfileBodyLimit)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		check.Message = fmt.Sprintf("工具调用请求 HTTP %d", statusCode)
+		return check
+	}
+	call, ok := parseHealthToolCall(platform, body)
+	if !ok {
+		check.Message = "响应中没有工具调用"
+		return check
+	}
+
+	statusCode, _, _, err = hcs.doCheckRequest(ctx, provider, platform, targetURL, buildToolUseRequest(platform, model, &call), timeout, false, healthProfileBodyLimit)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		check.Message = fmt.Sprintf("工具结果回传 HTTP %d", statusCode)
+		return check
+	}
+	check.Passed = true
+	return check
+}
+
+// buildToolUseRequest 构建工具调用请求；call 非空时构建携带工具结果的第二轮请求
+func buildToolUseRequest(platform, model string, call *healthToolCall) []byte {
+	parameters := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"city": map[string]string{"type": "string"},
+		},
+		"required": []string{"city"},
+	}
+
+	var reqBody map[string]interface{}
+	switch platform {
+	case "claude":
+		messages := []interface{}{
+			map[string]interface{}{"role": "user", "content": healthToolPrompt},
+		}
+		if call != nil {
+			var input interface{}
+			if err := json.Unmarshal([]byte(call.Arguments), &input); err != nil || input == nil {
+				input = map[string]interface{}{}
+			}
+			messages = append(messages,
+				map[string]interface{}{"role": "assistant", "content": []map[string]interface{}{
+					{"type": "tool_use", "id": call.ID, "name": call.Name, "input": input},
+				}},
+				map[string]interface{}{"role": "user", "content": []map[string]interface{}{
+					{"type": "tool_result", "tool_use_id": call.ID, "content": healthToolResult},
+				}},
+			)
+		}
+		reqBody = map[string]interface{}{
+			"model":      model,
+			"max_tokens": healthToolUseMaxTokens,
+			"messages":   messages,
+			"tools": []map[string]interface{}{
+				{"name": healthToolName, "description": "Get the current weather", "input_schema": parameters},
+			},
+		}
+		if call == nil {
+			reqBody["tool_choice"] = map[string]string{"type": "tool", "name": healthToolName}
+		}
+	case "codex":
+		input := []interface{}{
+			map[string]interface{}{"role": "user", "content": healthToolPrompt},
+		}
+		if call != nil {
+			input = append(input,
+				map[string]interface{}{"type": "function_call", "call_id": call.ID, "name": call.Name, "arguments": call.Arguments},
+				map[string]interface{}{"type": "function_call_output", "call_id": call.ID, "output": healthToolResult},
+			)
+		}
+		reqBody = map[string]interface{}{
+			"model":             model,
+			"max_output_tokens": healthToolUseMaxTokens,
+			"input":             input,
+			"tools": []map[string]interface{}{
+				{"type": "function", "name": healthToolName, "description": "Get the current weather", "parameters": parameters},
+			},
+		}
+		if call == nil {
+			reqBody["tool_choice"] = map[string]string{"type": "function", "name": healthToolName}
+		}
+	case "gemini":
+		contents := []interface{}{
+			map[string]interface{}{"role": "user", "parts": []map[string]string{{"text": healthToolPrompt}}},
+		}
+		if call != nil {
+			var args interface{}
+			if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil || args == nil {
+				args = map[string]interface{}{}
+			}
+			contents = append(contents,
+				map[string]interface{}{"role": "model", "parts": []map[string]interface{}{
+					{"functionCall": map[string]interface{}{"name": call.Name, "args": args}},
+				}},
+				map[string]interface{}{"role": "user", "parts": []map[string]interface{}{
+					{"functionResponse": map[string]interface{}{"name": call.Name, "response": map[string]string{"result": healthToolResult}}},
+				}},
+			)
+		}
+		reqBody = map[string]interface{}{
+			"contents": contents,
+			"tools": []map[string]interface{}{
+				{"functionDeclarations": []map[string]interface{}{
+					{"name": healthToolName, "description": "Get the current weather", "parameters": parameters},
+				}},
+			},
+			"generationConfig": map[string]interface{}{"maxOutputTokens": healthToolUseMaxTokens},
+		}
+		if call == nil {
+			reqBody["toolConfig"] = map[string]interface{}{
+				"functionCallingConfig": map[string]interface{}{"mode": "ANY", "allowedFunctionNames": []string{healthToolName}},
+			}
+		}
+	default:
+		messages := []interface{}{
+			map[string]interface{}{"role": "user", "content": healthToolPrompt},
+		}
+		if call != nil {
+			messages = append(messages,
+				map[string]interface{}{"role": "assistant", "content": nil, "tool_calls": []map[string]interface{}{
+					{"id": call.ID, "type": "function", "function": map[string]string{"name": call.Name, "arguments": call.Arguments}},
+				}},
+				map[string]interface{}{"role": "tool", "tool_call_id": call.ID, "content": healthToolResult},
+			)
+		}
+		reqBody = map[string]interface{}{
+			"model":      model,
+			"max_tokens": healthToolUseMaxTokens,
+			"messages":   messages,
+			"tools": []map[string]interface{}{
+				{"type": "function", "function": map[string]interface{}{
+					"name": healthToolName, "description": "Get the current weather", "parameters": parameters,
+				}},
+			},
+		}
+		if call == nil {
+			reqBody["tool_choice"] = map[string]interface{}{"type": "function", "function": map[string]string{"name": healthToolName}}
+		}
+	}
+	data, _ := json.Marshal(reqBody)
+	return data
+}
+
+// parseHealthToolCall 从非流式响应中解析第一个工具调用
+func parseHealthToolCall(platform string, body []byte) (healthToolCall, bool) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return healthToolCall{}, false
+	}
+	switch platform {
+	case "claude":
+		for _, item := range jsonArray(payload["content"]) {
+			block, ok := item.(map[string]interface{})
+			if !ok || block["type"] != "tool_use" {
+				continue
+			}
+			arguments, _ := json.Marshal(block["input"])
+			return healthToolCall{ID: jsonString(block["id"]), Name: jsonString(block["name"]), Arguments: string(arguments)}, true
+		}
+	case "codex":
+		for _, item := range jsonArray(payload["output"]) {
+			output, ok := item.(map[string]interface{})
+			if !ok || output["type"] != "function_call" {
+				continue
+			}
+			return healthToolCall{ID: jsonString(output["call_id"]), Name: jsonString(output["name"]), Arguments: jsonString(output["arguments"])}, true
+		}
+	case "gemini":
+		// Gemini 的 functionCall 没有 ID，回传时按名称对应
+		for _, part := range geminiCandidateParts(payload) {
+			functionCall, ok := part["functionCall"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			arguments, _ := json.Marshal(functionCall["args"])
+			name := jsonString(functionCall["name"])
+			return healthToolCall{ID: name, Name: name, Arguments: string(arguments)}, true
+		}
+	default:
+		for _, item := range jsonArray(payload["choices"]) {
+			choice, _ := item.(map[string]interface{})
+			message, _ := choice["message"].(map[string]interface{})
+			for _, raw := range jsonArray(message["tool_calls"]) {
+				toolCall, ok := raw.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				function, _ := toolCall["function"].(map[string]interface{})
+				return healthToolCall{ID: jsonString(toolCall["id"]), Name: jsonString(function["name"]), Arguments: jsonString(function["arguments"])}, true
+			}
+		}
+	}
+	return healthToolCall{}, false
+}
+
+// doCheckRequest 发送一次检测请求并读取（受限大小的）响应体
+func (hcs *HealthCheckService) doCheckRequest(ctx context.Context, provider *Provider, platform, targetURL string, reqBody []byte, timeout int, stream bool, bodyLimit int64) (int, []byte, int, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "POST", targetURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+	hcs.setCheckHeaders(req, provider, platform)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	start := time.Now()
+	resp, err := GetHTTPClient().Do(req)
+	if err != nil {
+		latencyMs := int(time.Since(start).Milliseconds())
+		if isTimeoutError(err) {
+			return 0, nil, latencyMs, fmt.Errorf("响应超时 (>%dms)", timeout)
+		}
+		return 0, nil, latencyMs, fmt.Errorf("网络错误: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, bodyLimit))
+	latencyMs := int(time.Since(start).Milliseconds())
+	if err != nil && !stream {
+		return resp.StatusCode, nil, latencyMs, fmt.Errorf("读取响应失败: %w", err)
+	}
+	return resp.StatusCode, body, latencyMs, nil
+}
+
+// geminiCandidateParts 返回第一个候选回复的 parts
+func geminiCandidateParts(payload map[string]interface{}) []map[string]interface{} {
+	candidates := jsonArray(payload["candidates"])
+	if len(candidates) == 0 {
+		return nil
+	}
+	candidate, _ := candidates[0].(map[string]interface{})
+	content, _ := candidate["content"].(map[string]interface{})
+	parts := make([]map[string]interface{}, 0)
+	for _, item := range jsonArray(content["parts"]) {
+		if part, ok := item.(map[string]interface{}); ok {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func jsonArray(value interface{}) []interface{} {
+	items, _ := value.([]interface{})
+	return items
+}
+
+func jsonString(value interface{}) string {
+	text, _ := value.(string)
+	return text
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newClaudeProfileServer 模拟 Anthropic 上游：支持流式、工具调用往返与普通回复
+func newClaudeProfileServer(t *testing.T, reply string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]interface{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request json: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\"}\n\nevent: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+			return
+		}
+		if _, ok := req["tool_choice"]; ok {
+			_, _ = w.Write([]byte(`{"content":[{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],"usage":{"input_tokens":10,"output_tokens":5}}`))
+			return
+		}
+		if _, ok := req["tools"]; ok {
+			messages, _ := req["messages"].([]interface{})
+			if len(messages) != 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		_, _ = w.Write([]byte(reply))
+	}))
+}
+
+func TestHealthCheck_ProfileChecksPass(t *testing.T) {
+	server := newClaudeProfileServer(t, `{"content":[{"type":"text","text":"PONG"}],"usage":{"input_tokens":8,"output_tokens":2}}`)
+	defer server.Close()
+
+	provider := Provider{
+		ID:     1,
+		Name:   "profile",
+		APIURL: server.URL,
+		APIKey: "key",
+		AvailabilityConfig: &AvailabilityConfig{
+			CheckStream:    true,
+			CheckToolUse:   true,
+			ExpectContains: "PONG",
+			RequireUsage:   true,
+		},
+	}
+
+	hcs := &HealthCheckService{}
+	result := hcs.checkProvider(context.Background(), provider, "claude")
+	if result.Status != HealthStatusOperational {
+		t.Fatalf("status = %s (%s), want operational", result.Status, result.ErrorMessage)
+	}
+	if len(result.Checks) != 4 {
+		t.Fatalf("checks = %+v, want 4 sub-results", result.Checks)
+	}
+	for _, check := range result.Checks {
+		if !check.Passed {
+			t.Fatalf("sub-check %s failed: %s", check.Name, check.Message)
+		}
+	}
+}
+
+func TestHealthCheck_ProfileChecksEmptyReply(t *testing.T) {
+	server := newClaudeProfileServer(t, `{}`)
+	defer server.Close()
+
+	provider := Provider{
+		ID:     1,
+		Name:   "empty",
+		APIURL: server.URL,
+		APIKey: "key",
+		AvailabilityConfig: &AvailabilityConfig{
+			ExpectContains: "PONG",
+			RequireUsage:   true,
+		},
+	}
+
+	hcs := &HealthCheckService{}
+	result := hcs.checkProvider(context.Background(), provider, "claude")
+	if result.Status != HealthStatusValidationError {
+		t.Fatalf("status = %s, want validation_failed", result.Status)
+	}
+	if !strings.Contains(result.ErrorMessage, HealthSubCheckContent) || !strings.Contains(result.ErrorMessage, HealthSubCheckUsage) {
+		t.Fatalf("error message = %q, want content and usage failures", result.ErrorMessage)
+	}
+}
+
+func TestParseHealthToolCall(t *testing.T) {
+	cases := []struct {
+		platform string
+		body     string
+		id       string
+	}{
+		{"claude", `{"content":[{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]}`, "toolu_1"},
+		{"codex", `{"output":[{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{}"}]}`, "call_1"},
+		{"gemini", `{"candidates":[{"content":{"parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}]}`, "get_weather"},
+		{"openai", `{"choices":[{"message":{"tool_calls":[{"id":"call_2","function":{"name":"get_weather","arguments":"{}"}}]}}]}`, "call_2"},
+	}
+	for _, tc := range cases {
+		call, ok := parseHealthToolCall(tc.platform, []byte(tc.body))
+		if !ok || call.ID != tc.id || call.Name != healthToolName {
+			t.Fatalf("%s: parseHealthToolCall = %+v, %v", tc.platform, call, ok)
+		}
+	}
+	if _, ok := parseHealthToolCall("claude", []byte(`{"content":[{"type":"text","text":"hi"}]}`)); ok {
+		t.Fatal("text-only response should not yield a tool call")
+	}
+}
+
+func TestHealthCheck_SubRequestsGetOwnTimeout(t *testing.T) {
+	isolateHomeDir(t)
+	inner := newClaudeProfileServer(t, `{"content":[{"type":"text","text":"PONG"}],"usage":{"input_tokens":8,"output_tokens":2}}`)
+	defer inner.Close()
+	// 每个请求都接近超时，但合计远超单个超时
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{
+		ID:     1,
+		Name:   "slow",
+		APIURL: server.URL,
+		APIKey: "key",
+		AvailabilityConfig: &AvailabilityConfig{
+			Timeout:      400,
+			CheckStream:  true,
+			CheckToolUse: true,
+		},
+	}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+
+	hcs := NewHealthCheckService(ps, nil, nil)
+	healthy, err := hcs.ProbeProvider("claude", "slow")
+	if err != nil || !healthy {
+		t.Fatalf("probe = %v, %v", healthy, err)
+	}
+	result := hcs.latestResults["claude"][1]
+	if result == nil || len(result.Checks) != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+	for _, check := range result.Checks {
+		if !check.Passed {
+			t.Fatalf("sub-check %s failed: %s", check.Name, check.Message)
+		}
+		if check.LatencyMs < 150 {
+			t.Fatalf("sub-check %s latency = %dms, want >= 150ms", check.Name, check.LatencyMs)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// 自适应巡检默认值
+const (
+	scheduleTickInterval        = 5 * time.Second // 调度器检查到期任务的频率
+	minScheduledCheckInterval   = 5 * time.Second // 单个 provider 的最小检测间隔
+	defaultRecoveryCheckSeconds = 15              // 首次失败后的快速复检间隔
+	defaultMaxBackoffSeconds    = 30 * 60         // 持续失败时的最大退避间隔
+	defaultCheckJitterPercent   = 10              // 默认抖动幅度（±%）
+	maxCheckJitterPercent       = 50              // 抖动幅度上限
+	maxScheduledCheckSeconds    = 24 * 60 * 60    // 间隔类配置的上限
+	quietHoursLayout            = "15:04"         // 静默时段格式 HH:MM
+)
+
+// providerSchedule 单个 provider 的巡检调度状态（仅内存）
+type providerSchedule struct {
+	NextCheckAt      time.Time
+	ConsecutiveFails int
+	InFlight         bool
+}
+
+// maxConcurrentChecks 同时进行的检测数上限（availability_max_concurrent_checks，默认 MaxConcurrentChecks）
+func (hcs *HealthCheckService) maxConcurrentChecks() int {
+	if hcs.settingsService != nil {
+		if limit := hcs.settingsService.GetIntSetting("availability_max_concurrent_checks"); limit > 0 {
+			return limit
+		}
+	}
+	return MaxConcurrentChecks
+}
+
+// runDueChecks 启动所有到期 provider 的检测（不等待完成，由 InFlight 防止重复）
+func (hcs *HealthCheckService) runDueChecks(now time.Time, sem chan struct{}) {
+	// 密钥库锁定时暂停巡检，避免用引用当作 API Key 探测导致误拉黑
+	if secretVaultLocked() {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, platform := range hcs.monitoredPlatforms() {
+		providers, err := hcs.loadPlatformProviders(platform)
+		if err != nil {
+			log.Printf("[HealthCheck] 加载 %s 供应商失败: %v", platform, err)
+			continue
+		}
+		for _, provider := range providers {
+			if !provider.AvailabilityMonitorEnabled {
+				continue
+			}
+			key := scheduleKey(platform, provider.Name)
+			seen[key] = true
+			if !hcs.claimDueCheck(key, provider.AvailabilityConfig, now) {
+				continue
+			}
+			go func(platform string, p Provider) {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				hcs.runScheduledCheck(platform, p)
+			}(platform, provider)
+		}
+	}
+
+	// 清理已删除或关闭监控的 provider
+	hcs.scheduleMu.Lock()
+	for key, schedule := range hcs.schedules {
+		if !seen[key] && !schedule.InFlight {
+			delete(hcs.schedules, key)
+		}
+	}
+	hcs.scheduleMu.Unlock()
+}
+
+// claimDueCheck 判断 provider 是否到期且不在静默时段，是则标记为检测中
+func (hcs *HealthCheckService) claimDueCheck(key string, config *AvailabilityConfig, now time.Time) bool {
+	hcs.scheduleMu.Lock()
+	defer hcs.scheduleMu.Unlock()
+
+	schedule := hcs.schedules[key]
+	if schedule == nil {
+		schedule = &providerSchedule{NextCheckAt: now}
+		hcs.schedules[key] = schedule
+	}
+	if schedule.InFlight || now.Before(schedule.NextCheckAt) {
+		return false
+	}
+	if config != nil && inQuietHours(config.QuietHours, now) {
+		return false
+	}
+	schedule.InFlight = true
+	return true
+}
+
+// runScheduledCheck 执行一次调度检测并安排下一次
+func (hcs *HealthCheckService) runScheduledCheck(platform string, provider Provider) {
+	key := scheduleKey(platform, provider.Name)
+
+	// 近期真实流量已证明可用时省去一次主动探测，改记一条由被动评分合成的结果（手动检测不跳过）
+	result := hcs.passiveProbeResult(platform, &provider)
+	if result == nil {
+		result = hcs.checkProvider(context.Background(), provider, platform)
+	}
+	if err := hcs.saveResult(result); err != nil {
+		log.Printf("[HealthCheck] 保存结果失败: %v", err)
+	}
+	hcs.updateCache(result)
+	hcs.handleBlacklistIntegration(&provider, result)
+
+	healthy := result.Status == HealthStatusOperational || result.Status == HealthStatusDegraded
+	next := hcs.finishScheduledCheck(key, provider.AvailabilityConfig, healthy)
+	log.Printf("[HealthCheck] %s/%s: status=%s, latency=%dms, 下次检测: %s",
+		platform, provider.Name, result.Status, result.LatencyMs, next.Format("15:04:05"))
+}
+
+// finishScheduledCheck 根据结果更新连续失败次数并计算下次检测时间
+func (hcs *HealthCheckService) finishScheduledCheck(key string, config *AvailabilityConfig, healthy bool) time.Time {
+	hcs.mu.RLock()
+	baseInterval := hcs.pollInterval
+	hcs.mu.RUnlock()
+
+	hcs.scheduleMu.Lock()
+	defer hcs.scheduleMu.Unlock()
+
+	schedule := hcs.schedules[key]
+	if schedule == nil {
+		schedule = &providerSchedule{}
+		hcs.schedules[key] = schedule
+	}
+	schedule.InFlight = false
+	if healthy {
+		schedule.ConsecutiveFails = 0
+	} else {
+		schedule.ConsecutiveFails++
+	}
+	schedule.NextCheckAt = time.Now().Add(nextCheckDelay(config, baseInterval, schedule.ConsecutiveFails, rand.Float64()))
+	return schedule.NextCheckAt
+}
+
+// nextCheckAt 返回 provider 的下次计划检测时间（未调度时返回 nil）
+func (hcs *HealthCheckService) nextCheckAt(platform, providerName string) *time.Time {
+	hcs.scheduleMu.Lock()
+	defer hcs.scheduleMu.Unlock()
+	schedule := hcs.schedules[scheduleKey(platform, providerName)]
+	if schedule == nil || schedule.NextCheckAt.IsZero() {
+		return nil
+	}
+	next := schedule.NextCheckAt
+	return &next
+}
+
+// nextCheckDelay 计算下次检测间隔：
+//   - 正常：基础间隔
+//   - 首次失败：快速复检（确认是否已恢复）
+//   - 连续失败：基础间隔 × 2^(n-2)，不超过最大退避
+//
+// 最终结果再叠加 ±jitter% 的随机抖动，rnd 取值 [0,1)
+func nextCheckDelay(config *AvailabilityConfig, baseInterval time.Duration, consecutiveFails int, rnd float64) time.Duration {
+	if baseInterval <= 0 {
+		baseInterval = time.Duration(DefaultPollIntervalSeconds) * time.Second
+	}
+	recovery := time.Duration(defaultRecoveryCheckSeconds) * time.Second
+	maxBackoff := time.Duration(defaultMaxBackoffSeconds) * time.Second
+	jitterPercent := defaultCheckJitterPercent
+	if config != nil {
+		if config.IntervalSeconds > 0 {
+			baseInterval = time.Duration(config.IntervalSeconds) * time.Second
+		}
+		if config.RecoveryCheckSeconds > 0 {
+			recovery = time.Duration(config.RecoveryCheckSeconds) * time.Second
+		}
+		if config.MaxBackoffSeconds > 0 {
+			maxBackoff = time.Duration(config.MaxBackoffSeconds) * time.Second
+		}
+		if config.JitterPercent != nil {
+			jitterPercent = *config.JitterPercent
+		}
+	}
+	if maxBackoff < baseInterval {
+		maxBackoff = baseInterval
+	}
+
+	delay := baseInterval
+	switch {
+	case consecutiveFails == 1:
+		if recovery < baseInterval {
+			delay = recovery
+		}
+	case consecutiveFails > 1:
+		for i := 2; i < consecutiveFails && delay < maxBackoff; i++ {
+			delay *= 2
+		}
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+
+	if jitterPercent > 0 {
+		delay += time.Duration(float64(delay) * float64(jitterPercent) / 100 * (2*rnd - 1))
+	}
+	if delay < minScheduledCheckInterval {
+		delay = minScheduledCheckInterval
+	}
+	return delay
+}
+
+// inQuietHours 判断时间是否处于静默时段（"HH:MM-HH:MM"，本地时间，支持跨零点；格式错误视为无静默）
+func inQuietHours(spec string, t time.Time) bool {
+	start, end, err := parseQuietHours(spec)
+	if err != nil || start == end {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// parseQuietHours 解析静默时段，返回起止的当日分钟数；空字符串返回 0,0
+func parseQuietHours(spec string) (int, int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, 0, nil
+	}
+	parts := strings.Split(spec, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("静默时段格式应为 HH:MM-HH:MM: %s", spec)
+	}
+	bounds := make([]int, 2)
+	for i, part := range parts {
+		parsed, err := time.Parse(quietHoursLayout, strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("静默时段时间无效 %q: %w", part, err)
+		}
+		bounds[i] = parsed.Hour()*60 + parsed.Minute()
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// validateScheduleConfig 校验 AvailabilityConfig 中的调度字段
+func validateScheduleConfig(config *AvailabilityConfig) error {
+	if config == nil {
+		return nil
+	}
+	fields := []struct {
+		name  string
+		value int
+	}{
+		{"intervalSeconds", config.IntervalSeconds},
+		{"recoveryCheckSeconds", config.RecoveryCheckSeconds},
+		{"maxBackoffSeconds", config.MaxBackoffSeconds},
+	}
+	for _, field := range fields {
+		if field.value < 0 || field.value > maxScheduledCheckSeconds {
+			return fmt.Errorf("%s 必须在 0-%d 之间", field.name, maxScheduledCheckSeconds)
+		}
+	}
+	if config.JitterPercent != nil && (*config.JitterPercent < 0 || *config.JitterPercent > maxCheckJitterPercent) {
+		return fmt.Errorf("jitterPercent 必须在 0-%d 之间", maxCheckJitterPercent)
+	}
+	if _, _, err := parseQuietHours(config.QuietHours); err != nil {
+		return err
+	}
+	return nil
+}
+
+func scheduleKey(platform, providerName string) string {
+	return platform + ":" + providerName
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCheckDelay(t *testing.T) {
+	base := time.Minute
+	noJitter := 0.5 // rnd=0.5 时抖动为 0
+
+	cases := []struct {
+		fails int
+		want  time.Duration
+	}{
+		{0, time.Minute},
+		{1, 15 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{20, 30 * time.Minute},
+	}
+	for _, tc := range cases {
+		if got := nextCheckDelay(nil, base, tc.fails, noJitter); got != tc.want {
+			t.Fatalf("fails=%d delay = %v, want %v", tc.fails, got, tc.want)
+		}
+	}
+
+	jitter := 20
+	config := &AvailabilityConfig{IntervalSeconds: 120, MaxBackoffSeconds: 300, JitterPercent: &jitter}
+	if got := nextCheckDelay(config, base, 10, noJitter); got != 5*time.Minute {
+		t.Fatalf("capped delay = %v, want 5m", got)
+	}
+	if got := nextCheckDelay(config, base, 0, 0); got != 96*time.Second {
+		t.Fatalf("min jitter delay = %v, want 96s", got)
+	}
+
+	// 显式 0 关闭抖动
+	jitter = 0
+	if got := nextCheckDelay(config, base, 0, 0); got != 2*time.Minute {
+		t.Fatalf("disabled jitter delay = %v, want 2m", got)
+	}
+	if got := nextCheckDelay(&AvailabilityConfig{IntervalSeconds: 120}, base, 0, 0); got != 108*time.Second {
+		t.Fatalf("default jitter delay = %v, want 108s", got)
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+	if !inQuietHours("23:00-07:00", at(2, 0)) || inQuietHours("23:00-07:00", at(12, 0)) {
+		t.Fatal("overnight quiet hours mismatch")
+	}
+	if !inQuietHours("12:00-13:30", at(13, 29)) || inQuietHours("12:00-13:30", at(13, 30)) {
+		t.Fatal("daytime quiet hours mismatch")
+	}
+	if inQuietHours("", at(1, 0)) {
+		t.Fatal("empty quiet hours should never match")
+	}
+	if err := validateScheduleConfig(&AvailabilityConfig{QuietHours: "25:00-07:00"}); err == nil {
+		t.Fatal("invalid quiet hours should fail validation")
+	}
+}
+
+func TestClaimDueCheck(t *testing.T) {
+	hcs := &HealthCheckService{schedules: make(map[string]*providerSchedule)}
+	now := time.Now()
+	if !hcs.claimDueCheck("claude:p", nil, now) {
+		t.Fatal("new provider should be due immediately")
+	}
+	if hcs.claimDueCheck("claude:p", nil, now) {
+		t.Fatal("in-flight provider must not be claimed twice")
+	}
+	next := hcs.finishScheduledCheck("claude:p", nil, false)
+	if hcs.claimDueCheck("claude:p", nil, now) {
+		t.Fatal("provider should not be due before its next check time")
+	}
+	if !hcs.claimDueCheck("claude:p", nil, next) {
+		t.Fatal("provider should be due at its next check time")
+	}
+}
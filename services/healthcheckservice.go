@@ -51,6 +51,8 @@ type HealthCheckResult struct {
 	LatencyMs    int       `json:"latencyMs"`    // 响应延迟（毫秒）
 	ErrorMessage string    `json:"errorMessage"` // 错误消息
 	CheckedAt    time.Time `json:"checkedAt"`    // 检测时间
+
+	Checks []HealthSubCheck `json:"checks,omitempty"` // 检测档案各子项结果（未配置时为空）
 }
 
 // HealthCheckHistory 健康检查历史（单个 Provider 的时间线）
@@ -76,6 +78,8 @@ type ProviderTimeline struct {
 	Latest                     *HealthCheckResult  `json:"latest"`                       // 最新一条
 	Uptime                     float64             `json:"uptime"`                       // 可用率
 	AvgLatencyMs               int                 `json:"avgLatencyMs"`                 // 平均延迟
+	Passive                    *PassiveHealthScore `json:"passive,omitempty"`            // 真实流量的被动评分
+	NextCheckAt                *time.Time          `json:"nextCheckAt,omitempty"`        // 下次计划检测时间（后台巡检运行时）
 }
 
 // AvailabilityFailureCounter 可用性失败计数器（独立于真实请求）
@@ -91,11 +95,21 @@ type HealthCheckService struct {
 	providerService  *ProviderService
 	blacklistService *BlacklistService
 	settingsService  *SettingsService
+	geminiService    *GeminiService    // 可选：监控 Gemini 供应商
+	customCliService *CustomCliService // 可选：监控 custom:{toolId} 供应商
 
 	mu            sync.RWMutex
 	failCounters  map[string]*AvailabilityFailureCounter  // key: platform:providerName
 	latestResults map[string]map[int64]*HealthCheckResult // platform -> providerID -> result
 
+	// 自适应巡检调度状态
+	scheduleMu sync.Mutex
+	schedules  map[string]*providerSchedule // key: platform:providerName
+
+	// 被动健康评分（真实转发结果）
+	passiveMu      sync.Mutex
+	passiveSamples map[string][]PassiveOutcome // key: platform:providerName
+
 	// 后台轮询
 	running      bool
 	stopChan     chan struct{}
@@ -113,6 +127,8 @@ func NewHealthCheckService(
 		blacklistService: blacklistService,
 		settingsService:  settingsService,
 		failCounters:     make(map[string]*AvailabilityFailureCounter),
+		passiveSamples:   make(map[string][]PassiveOutcome),
+		schedules:        make(map[string]*providerSchedule),
 		latestResults: map[string]map[int64]*HealthCheckResult{
 			"claude": {},
 			"codex":  {},
@@ -169,6 +185,17 @@ func (hcs *HealthCheckService) ensureTable() error {
 		log.Printf("[HealthCheck] 创建索引警告: %v", err)
 	}
 
+	// 旧版数据库升级：检测档案子项结果（JSON）
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('health_check_history') WHERE name = 'checks'").Scan(&count); err != nil {
+		return fmt.Errorf("检查 health_check_history 字段失败: %w", err)
+	}
+	if count == 0 {
+		if _, err := db.Exec("ALTER TABLE health_check_history ADD COLUMN checks TEXT"); err != nil {
+			return fmt.Errorf("添加 checks 字段失败: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -177,9 +204,9 @@ func (hcs *HealthCheckService) ensureTable() error {
 func (hcs *HealthCheckService) GetLatestResults() (map[string][]ProviderTimeline, error) {
 	results := make(map[string][]ProviderTimeline)
 
-	// 遍历所有平台
-	for _, platform := range []string{"claude", "codex", "gemini"} {
-		providers, err := hcs.providerService.LoadProviders(platform)
+	// 遍历所有平台（含 Gemini 与自定义 CLI）
+	for _, platform := range hcs.monitoredPlatforms() {
+		providers, err := hcs.loadPlatformProviders(platform)
 		if err != nil {
 			log.Printf("[HealthCheck] 加载 %s 供应商失败: %v", platform, err)
 			continue
@@ -210,6 +237,8 @@ func (hcs *HealthCheckService) GetLatestResults() (map[string][]ProviderTimeline
 				timeline.Uptime = history.Uptime
 				timeline.AvgLatencyMs = history.AvgLatencyMs
 			}
+			mergePassiveTimeline(&timeline, hcs.GetPassiveHealth(platform, p.Name), time.Now())
+			timeline.NextCheckAt = hcs.nextCheckAt(platform, p.Name)
 
 			timelines = append(timelines, timeline)
 		}
@@ -230,7 +259,7 @@ func (hcs *HealthCheckService) batchGetHistories(platform string) (map[string]*H
 	// 批量查询：按平台一次性拉取所有记录，按 checked_at 倒序排列
 	// 限制最多 5000 条记录，避免全表扫描
 	query := `
-		SELECT id, provider_id, provider_name, platform, model, endpoint, status, latency_ms, error_message, checked_at
+		SELECT id, provider_id, provider_name, platform, model, endpoint, status, latency_ms, error_message, checked_at, checks
 		FROM health_check_history
 		WHERE platform = ?
 		ORDER BY checked_at DESC
@@ -248,12 +277,12 @@ func (hcs *HealthCheckService) batchGetHistories(platform string) (map[string]*H
 
 	for rows.Next() {
 		var r HealthCheckResult
-		var model, endpoint, errorMsg sql.NullString
+		var model, endpoint, errorMsg, checks sql.NullString
 		var latencyMs sql.NullInt64
 
 		if err := rows.Scan(
 			&r.ID, &r.ProviderID, &r.ProviderName, &r.Platform,
-			&model, &endpoint, &r.Status, &latencyMs, &errorMsg, &r.CheckedAt,
+			&model, &endpoint, &r.Status, &latencyMs, &errorMsg, &r.CheckedAt, &checks,
 		); err != nil {
 			log.Printf("[HealthCheck] 解析历史记录失败: %v", err)
 			continue
@@ -271,6 +300,9 @@ func (hcs *HealthCheckService) batchGetHistories(platform string) (map[string]*H
 		if errorMsg.Valid {
 			r.ErrorMessage = errorMsg.String
 		}
+		if checks.Valid && checks.String != "" {
+			_ = json.Unmarshal([]byte(checks.String), &r.Checks)
+		}
 
 		// 获取或创建该 provider 的 history
 		history, ok := historiesMap[r.ProviderName]
@@ -328,7 +360,7 @@ func (hcs *HealthCheckService) GetHistory(platform, providerName string, limit i
 	}
 
 	query := `
-		SELECT id, provider_id, provider_name, platform, model, endpoint, status, latency_ms, error_message, checked_at
+		SELECT id, provider_id, provider_name, platform, model, endpoint, status, latency_ms, error_message, checked_at, checks
 		FROM health_check_history
 		WHERE platform = ? AND provider_name = ?
 		ORDER BY checked_at DESC
@@ -352,12 +384,12 @@ func (hcs *HealthCheckService) GetHistory(platform, providerName string, limit i
 
 	for rows.Next() {
 		var r HealthCheckResult
-		var model, endpoint, errorMsg sql.NullString
+		var model, endpoint, errorMsg, checks sql.NullString
 		var latencyMs sql.NullInt64
 
 		if err := rows.Scan(
 			&r.ID, &r.ProviderID, &r.ProviderName, &r.Platform,
-			&model, &endpoint, &r.Status, &latencyMs, &errorMsg, &r.CheckedAt,
+			&model, &endpoint, &r.Status, &latencyMs, &errorMsg, &r.CheckedAt, &checks,
 		); err != nil {
 			continue
 		}
@@ -374,6 +406,9 @@ func (hcs *HealthCheckService) GetHistory(platform, providerName string, limit i
 		if errorMsg.Valid {
 			r.ErrorMessage = errorMsg.String
 		}
+		if checks.Valid && checks.String != "" {
+			_ = json.Unmarshal([]byte(checks.String), &r.Checks)
+		}
 
 		history.Items = append(history.Items, r)
 		history.ProviderID = r.ProviderID
@@ -399,7 +434,7 @@ func (hcs *HealthCheckService) GetHistory(platform, providerName string, limit i
 
 // RunSingleCheck 手动触发单个 Provider 检测
 func (hcs *HealthCheckService) RunSingleCheck(platform string, providerID int64) (*HealthCheckResult, error) {
-	providers, err := hcs.providerService.LoadProviders(platform)
+	providers, err := hcs.loadPlatformProviders(platform)
 	if err != nil {
 		return nil, fmt.Errorf("加载供应商失败: %w", err)
 	}
@@ -416,12 +451,8 @@ func (hcs *HealthCheckService) RunSingleCheck(platform string, providerID int64)
 		return nil, fmt.Errorf("未找到供应商 ID: %d", providerID)
 	}
 
-	// 执行检测（使用 Provider 配置的有效超时）
-	timeout := hcs.getEffectiveTimeout(targetProvider)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
-	defer cancel()
-
-	result := hcs.checkProvider(ctx, *targetProvider, platform)
+	// 执行检测（主请求与各子请求分别按 Provider 配置的有效超时计时）
+	result := hcs.checkProvider(context.Background(), *targetProvider, platform)
 
 	// 保存结果
 	if err := hcs.saveResult(result); err != nil {
@@ -437,11 +468,39 @@ func (hcs *HealthCheckService) RunSingleCheck(platform string, providerID int64)
 	return result, nil
 }
 
+// ProbeProvider 熔断半开时的合成探测：按名称检测一次，operational/degraded 视为成功
+// 结果由 BlacklistService 记录，这里不做拉黑联动
+func (hcs *HealthCheckService) ProbeProvider(platform string, providerName string) (bool, error) {
+	providers, err := hcs.loadPlatformProviders(platform)
+	if err != nil {
+		return false, fmt.Errorf("加载供应商失败: %w", err)
+	}
+
+	var targetProvider *Provider
+	for i := range providers {
+		if providers[i].Name == providerName {
+			targetProvider = &providers[i]
+			break
+		}
+	}
+	if targetProvider == nil {
+		return false, fmt.Errorf("未找到供应商: %s/%s", platform, providerName)
+	}
+
+	result := hcs.checkProvider(context.Background(), *targetProvider, platform)
+	if err := hcs.saveResult(result); err != nil {
+		log.Printf("[HealthCheck] 保存结果失败: %v", err)
+	}
+	hcs.updateCache(result)
+
+	return result.Status == HealthStatusOperational || result.Status == HealthStatusDegraded, nil
+}
+
 // RunAllChecks 手动触发全部检测
 func (hcs *HealthCheckService) RunAllChecks() (map[string][]HealthCheckResult, error) {
 	results := make(map[string][]HealthCheckResult)
 
-	for _, platform := range []string{"claude", "codex", "gemini"} {
+	for _, platform := range hcs.monitoredPlatforms() {
 		platformResults := hcs.checkAllProviders(platform)
 		results[platform] = platformResults
 	}
@@ -451,7 +510,11 @@ func (hcs *HealthCheckService) RunAllChecks() (map[string][]HealthCheckResult, e
 
 // checkAllProviders 检测指定平台的所有启用监控的供应商
 func (hcs *HealthCheckService) checkAllProviders(platform string) []HealthCheckResult {
-	providers, err := hcs.providerService.LoadProviders(platform)
+	// 密钥库锁定时 API Key 仍是引用，检测必然失败且可能误触发拉黑
+	if secretVaultLocked() {
+		return nil
+	}
+	providers, err := hcs.loadPlatformProviders(platform)
 	if err != nil {
 		log.Printf("[HealthCheck] 加载 %s 供应商失败: %v", platform, err)
 		return nil
@@ -460,10 +523,7 @@ func (hcs *HealthCheckService) checkAllProviders(platform string) []HealthCheckR
 	var results []HealthCheckResult
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	sem := make(chan struct{}, MaxConcurrentChecks)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	sem := make(chan struct{}, hcs.maxConcurrentChecks())
 
 	for _, provider := range providers {
 		// 只检测启用了可用性监控的供应商
@@ -477,7 +537,7 @@ func (hcs *HealthCheckService) checkAllProviders(platform string) []HealthCheckR
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			result := hcs.checkProvider(ctx, p, platform)
+			result := hcs.checkProvider(context.Background(), p, platform)
 
 			// 保存结果
 			if err := hcs.saveResult(result); err != nil {
@@ -504,6 +564,7 @@ func (hcs *HealthCheckService) checkAllProviders(platform string) []HealthCheckR
 }
 
 // checkProvider 执行单个 Provider 的健康检查
+// ctx 只用于取消：主请求与流式/工具调用/能力等子请求各自按有效超时计时，不共享同一个截止时间
 func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provider, platform string) *HealthCheckResult {
 	result := &HealthCheckResult{
 		ProviderID:   provider.ID,
@@ -513,9 +574,10 @@ func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provi
 		CheckedAt:    time.Now(),
 	}
 
-	// 获取有效的测试参数
-	model := hcs.getEffectiveModel(&provider, platform)
-	endpoint := hcs.getEffectiveEndpoint(&provider, platform)
+	// 获取有效的测试参数（custom:{toolId} 按 Anthropic 格式检测）
+	format := healthCheckFormat(platform)
+	model := hcs.getEffectiveModel(&provider, format)
+	endpoint := hcs.getEffectiveEndpoint(&provider, format)
 	timeout := hcs.getEffectiveTimeout(&provider)
 
 	// 应用模型映射（关键修复：与 ProviderRelayService 对齐）
@@ -525,11 +587,15 @@ func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provi
 		log.Printf("[HealthCheck] [%s/%s] 模型映射: %s -> %s", platform, provider.Name, model, mappedModel)
 	}
 
+	// Gemini 原生端点包含模型名
+	endpoint = strings.ReplaceAll(endpoint, "{model}", mappedModel)
+
 	result.Model = model
 	result.Endpoint = endpoint
 
 	// 构建请求体（使用映射后的模型名）
-	reqBody := hcs.buildTestRequest(platform, mappedModel)
+	requestOptions := provider.AvailabilityConfig.mainRequestOptions()
+	reqBody := hcs.buildTestRequestWithOptions(format, mappedModel, "default", requestOptions)
 	if reqBody == nil {
 		result.ErrorMessage = "无法构建测试请求"
 		return result
@@ -546,41 +612,7 @@ func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provi
 	}
 
 	// 设置 Headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json") // 修复：添加 Accept 头，某些提供商或代理需要此头
-	if strings.ToLower(platform) == "claude" {
-		req.Header.Set("anthropic-version", "2023-06-01")
-	}
-	if ua := strings.TrimSpace(GetDefaultUserAgent()); ua != "" {
-		req.Header.Set("User-Agent", ua)
-	}
-	if provider.APIKey != "" {
-		// 根据认证方式设置请求头
-		authTypeRaw := strings.TrimSpace(provider.ConnectivityAuthType)
-		authType := strings.ToLower(authTypeRaw)
-		if authType == "" {
-			// 空值时使用平台默认（claude: x-api-key, codex: bearer）
-			if strings.ToLower(platform) == "claude" {
-				authType = "x-api-key"
-			} else {
-				authType = "bearer"
-			}
-		}
-		switch authType {
-		case "x-api-key":
-			req.Header.Set("x-api-key", provider.APIKey)
-			req.Header.Set("anthropic-version", "2023-06-01")
-		case "bearer":
-			req.Header.Set("Authorization", "Bearer "+provider.APIKey)
-		default:
-			// 自定义 Header 名
-			headerName := authTypeRaw
-			if headerName == "" || strings.EqualFold(headerName, "custom") {
-				headerName = "Authorization"
-			}
-			req.Header.Set(headerName, provider.APIKey)
-		}
-	}
+	hcs.setCheckHeaders(req, &provider, format)
 
 	// 获取当前代理配置（用于日志记录）
 	proxyConfig := GetProxyConfig()
@@ -623,17 +655,21 @@ func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provi
 		return result
 	}
 
-	// 读取响应体（限制大小）
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	// 读取响应体（限制大小；配置检测档案时需要完整响应用于内容/用量校验）
+	bodyLimit := int64(4096)
+	if provider.AvailabilityConfig.hasProfileChecks() {
+		bodyLimit = healthProfileBodyLimit
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, bodyLimit))
 	if err != nil {
 		body = []byte{}
 	}
 
 	// Codex 兼容性回退：部分上游仅接受 string input
-	if platform == "codex" && resp.StatusCode == http.StatusBadRequest {
+	if format == "codex" && resp.StatusCode == http.StatusBadRequest {
 		_ = resp.Body.Close()
 
-		fallbackBody := hcs.buildTestRequestWithVariant(platform, mappedModel, "codex-input-string")
+		fallbackBody := hcs.buildTestRequestWithOptions(format, mappedModel, "codex-input-string", requestOptions)
 		fallbackReq, reqErr := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(fallbackBody))
 		if reqErr == nil {
 			fallbackReq.Header = req.Header.Clone()
@@ -648,7 +684,7 @@ func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provi
 			if fallbackErr == nil {
 				resp = fallbackResp
 				result.LatencyMs = fallbackLatencyMs
-				body, err = io.ReadAll(io.LimitReader(resp.Body, 4096))
+				body, err = io.ReadAll(io.LimitReader(resp.Body, bodyLimit))
 				if err != nil {
 					body = []byte{}
 				}
@@ -663,6 +699,9 @@ func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provi
 	// 判定状态
 	result.Status, result.ErrorMessage = hcs.determineStatus(resp.StatusCode, result.LatencyMs, body)
 
+	// 检测档案：流式 / 工具调用 / 内容 / 用量校验
+	hcs.runProfileChecks(ctx, &provider, format, mappedModel, targetURL, timeout, body, result)
+
 	// 日志：检测完成
 	log.Printf("[HealthCheck] [%s/%s] 检测结果: %s, 延迟: %dms (模式: %s)",
 		platform, provider.Name, result.Status, result.LatencyMs, proxyMode)
@@ -670,15 +709,53 @@ func (hcs *HealthCheckService) checkProvider(ctx context.Context, provider Provi
 	return result
 }
 
+// setCheckHeaders 设置检测请求头（Content-Type / UA / 认证）
+func (hcs *HealthCheckService) setCheckHeaders(req *http.Request, provider *Provider, platform string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json") // 修复：添加 Accept 头，某些提供商或代理需要此头
+	if strings.ToLower(platform) == "claude" {
+		req.Header.Set("anthropic-version", "2023-06-01")
+	}
+	if ua := strings.TrimSpace(GetDefaultUserAgent()); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	if provider.APIKey != "" {
+		// 根据认证方式设置请求头
+		authTypeRaw := strings.TrimSpace(provider.ConnectivityAuthType)
+		authType := strings.ToLower(authTypeRaw)
+		if authType == "" {
+			// 空值时使用平台默认（claude: x-api-key, gemini: x-goog-api-key, codex: bearer）
+			switch strings.ToLower(platform) {
+			case "claude":
+				authType = "x-api-key"
+			case "gemini":
+				authTypeRaw = "x-goog-api-key"
+				authType = authTypeRaw
+			default:
+				authType = "bearer"
+			}
+		}
+		switch authType {
+		case "x-api-key":
+			req.Header.Set("x-api-key", provider.APIKey)
+			req.Header.Set("anthropic-version", "2023-06-01")
+		case "bearer":
+			req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+		default:
+			// 自定义 Header 名（含 Gemini 的 x-goog-api-key）
+			headerName := authTypeRaw
+			if headerName == "" || strings.EqualFold(headerName, "custom") {
+				headerName = "Authorization"
+			}
+			req.Header.Set(headerName, provider.APIKey)
+		}
+	}
+}
+
 // determineStatus 根据 HTTP 状态码和延迟判定健康状态
 func (hcs *HealthCheckService) determineStatus(statusCode, latencyMs int, body []byte) (string, string) {
 	// 获取正常阈值（全局配置）
-	operationalThresholdMs := DefaultOperationalThresholdMs
-	if hcs.settingsService != nil {
-		if threshold := hcs.settingsService.GetIntSetting("availability_operational_threshold_ms"); threshold > 0 {
-			operationalThresholdMs = threshold
-		}
-	}
+	operationalThresholdMs := hcs.operationalThresholdMs()
 
 	// 2xx = 成功
 	if statusCode >= 200 && statusCode < 300 {
@@ -745,6 +822,9 @@ func (hcs *HealthCheckService) getEffectiveEndpoint(provider *Provider, platform
 		defaultEndpoint = "/v1/messages"
 	case "codex":
 		defaultEndpoint = "/v1/responses"
+	case "gemini":
+		// Gemini 原生 generateContent，{model} 在检测时替换为实际模型
+		defaultEndpoint = "/v1beta/models/{model}:generateContent"
 	default:
 		defaultEndpoint = "/v1/chat/completions"
 	}
@@ -770,17 +850,39 @@ func (hcs *HealthCheckService) buildTestRequest(platform, model string) []byte {
 
 // buildTestRequestWithVariant 构建不同变体的测试请求体（用于兼容不同上游实现）
 func (hcs *HealthCheckService) buildTestRequestWithVariant(platform, model, variant string) []byte {
+	return hcs.buildTestRequestWithOptions(platform, model, variant, defaultHealthRequestOptions())
+}
+
+// buildTestRequestWithOptions 按检测档案参数构建测试请求体（提示词 / max_tokens / 流式）
+func (hcs *HealthCheckService) buildTestRequestWithOptions(platform, model, variant string, opts healthRequestOptions) []byte {
+	// Gemini 原生格式（模型在 URL 中）
+	if platform == "gemini" {
+		reqBody := map[string]interface{}{
+			"contents": []map[string]interface{}{
+				{
+					"role":  "user",
+					"parts": []map[string]string{{"text": opts.Prompt}},
+				},
+			},
+			"generationConfig": map[string]interface{}{
+				"maxOutputTokens": opts.MaxTokens,
+			},
+		}
+		data, _ := json.Marshal(reqBody)
+		return data
+	}
+
 	// Anthropic 格式
 	if platform == "claude" {
 		reqBody := map[string]interface{}{
 			"model":      model,
-			"max_tokens": 1,
-			"stream":     false,
+			"max_tokens": opts.MaxTokens,
+			"stream":     opts.Stream,
 			"messages": []map[string]interface{}{
 				{
 					"role": "user",
 					"content": []map[string]string{
-						{"type": "text", "text": "hi"},
+						{"type": "text", "text": opts.Prompt},
 					},
 				},
 			},
@@ -793,16 +895,19 @@ func (hcs *HealthCheckService) buildTestRequestWithVariant(platform, model, vari
 	if platform == "codex" {
 		reqBody := map[string]interface{}{
 			"model":             model,
-			"max_output_tokens": 1,
+			"max_output_tokens": opts.MaxTokens,
+		}
+		if opts.Stream {
+			reqBody["stream"] = true
 		}
 
 		if variant == "codex-input-string" {
 			// 某些兼容实现仅接受字符串 input
-			reqBody["input"] = "hi"
+			reqBody["input"] = opts.Prompt
 		} else {
 			// Responses API: input 必须是数组；默认优先使用消息对象形态
 			reqBody["input"] = []map[string]string{
-				{"role": "user", "content": "hi"},
+				{"role": "user", "content": opts.Prompt},
 			}
 		}
 
@@ -813,11 +918,14 @@ func (hcs *HealthCheckService) buildTestRequestWithVariant(platform, model, vari
 	// OpenAI 格式
 	reqBody := map[string]interface{}{
 		"model":      model,
-		"max_tokens": 1,
+		"max_tokens": opts.MaxTokens,
 		"messages": []map[string]string{
-			{"role": "user", "content": "hi"},
+			{"role": "user", "content": opts.Prompt},
 		},
 	}
+	if opts.Stream {
+		reqBody["stream"] = true
+	}
 	data, _ := json.Marshal(reqBody)
 	return data
 }
@@ -829,10 +937,17 @@ func (hcs *HealthCheckService) saveResult(result *HealthCheckResult) error {
 	}
 
 	const insertSQL = `
-		INSERT INTO health_check_history (provider_id, provider_name, platform, model, endpoint, status, latency_ms, error_message, checked_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO health_check_history (provider_id, provider_name, platform, model, endpoint, status, latency_ms, error_message, checked_at, checks)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	var checks interface{}
+	if len(result.Checks) > 0 {
+		if data, err := json.Marshal(result.Checks); err == nil {
+			checks = string(data)
+		}
+	}
+
 	return GlobalDBQueue.Exec(insertSQL,
 		result.ProviderID,
 		result.ProviderName,
@@ -843,18 +958,33 @@ func (hcs *HealthCheckService) saveResult(result *HealthCheckResult) error {
 		result.LatencyMs,
 		result.ErrorMessage,
 		result.CheckedAt,
+		checks,
 	)
 }
 
 // updateCache 更新内存缓存
 func (hcs *HealthCheckService) updateCache(result *HealthCheckResult) {
 	hcs.mu.Lock()
-	defer hcs.mu.Unlock()
-
 	if hcs.latestResults[result.Platform] == nil {
 		hcs.latestResults[result.Platform] = make(map[int64]*HealthCheckResult)
 	}
+	previous := hcs.latestResults[result.Platform][result.ProviderID]
 	hcs.latestResults[result.Platform][result.ProviderID] = result
+	hcs.mu.Unlock()
+
+	// 状态变化写入 provider 事件时间线
+	if previous != nil && previous.Status != result.Status {
+		reason := fmt.Sprintf("%s → %s", previous.Status, result.Status)
+		if result.ErrorMessage != "" {
+			reason += ": " + truncateEventReason(result.ErrorMessage)
+		}
+		recordProviderEvent(ProviderEvent{
+			Platform:     result.Platform,
+			ProviderName: result.ProviderName,
+			EventType:    ProviderEventHealthChanged,
+			Reason:       reason,
+		})
+	}
 }
 
 // handleBlacklistIntegration 处理与拉黑服务的联动
@@ -889,7 +1019,8 @@ func (hcs *HealthCheckService) handleBlacklistIntegration(provider *Provider, re
 	var shouldRecordSuccess bool
 	var prevFails int
 
-	if result.Status == HealthStatusFailed {
+	// validation_failed（回复内容/流式/工具调用异常）与请求失败同等计入
+	if result.Status == HealthStatusFailed || result.Status == HealthStatusValidationError {
 		counter.ConsecutiveFails++
 		counter.LastFailedAt = time.Now()
 		prevFails = counter.ConsecutiveFails
@@ -920,7 +1051,7 @@ func (hcs *HealthCheckService) handleBlacklistIntegration(provider *Provider, re
 
 	// 在锁外执行耗时的 RPC 调用，避免阻塞其他检测
 	if shouldTriggerBlacklist {
-		if err := hcs.blacklistService.RecordFailure(result.Platform, provider.Name); err != nil {
+		if err := hcs.blacklistService.RecordFailure(result.Platform, provider.Name, result.ErrorMessage); err != nil {
 			log.Printf("[HealthCheck] 触发拉黑失败: %v", err)
 		} else {
 			log.Printf("[HealthCheck] Provider %s 连续失败 %d 次，已触发拉黑！", provider.Name, failureThreshold)
@@ -955,31 +1086,35 @@ func (hcs *HealthCheckService) StartBackgroundPolling() {
 
 	hcs.stopChan = make(chan struct{})
 	hcs.running = true
+	stopChan := hcs.stopChan
+	sem := make(chan struct{}, hcs.maxConcurrentChecks())
 
 	go func() {
 		// 启动时延迟随机时间（0-10s），避免整点风暴
 		jitter := time.Duration(rand.Intn(10000)) * time.Millisecond
-		time.Sleep(jitter)
-
-		// 立即执行一次
-		hcs.runAllPlatformChecks()
+		select {
+		case <-time.After(jitter):
+		case <-stopChan:
+			return
+		}
 
-		// 添加抖动（±10%）
-		ticker := time.NewTicker(hcs.pollInterval)
+		// 自适应调度：每个 provider 按自己的间隔/退避到期后检测
+		hcs.runDueChecks(time.Now(), sem)
+		ticker := time.NewTicker(scheduleTickInterval)
 		defer ticker.Stop()
 
 		for {
 			select {
-			case <-ticker.C:
-				hcs.runAllPlatformChecks()
-			case <-hcs.stopChan:
+			case now := <-ticker.C:
+				hcs.runDueChecks(now, sem)
+			case <-stopChan:
 				log.Println("[HealthCheck] 后台巡检已停止")
 				return
 			}
 		}
 	}()
 
-	log.Printf("[HealthCheck] 后台巡检已启动（间隔: %v）", hcs.pollInterval)
+	log.Printf("[HealthCheck] 后台巡检已启动（基础间隔: %v，最大并发: %d）", hcs.pollInterval, cap(sem))
 }
 
 // StopBackgroundPolling 停止后台巡检
@@ -1015,36 +1150,14 @@ func (hcs *HealthCheckService) SetAutoAvailabilityPolling(enabled bool) {
 	}
 }
 
-// runAllPlatformChecks 执行所有平台的检测
-func (hcs *HealthCheckService) runAllPlatformChecks() {
-	platforms := []string{"claude", "codex"}
-	for _, platform := range platforms {
-		hcs.checkAllProviders(platform)
-	}
-}
-
 // SetAvailabilityMonitorEnabled 启用/禁用指定 Provider 的可用性监控
 func (hcs *HealthCheckService) SetAvailabilityMonitorEnabled(platform string, providerID int64, enabled bool) error {
-	providers, err := hcs.providerService.LoadProviders(platform)
+	err := hcs.updatePlatformProvider(platform, providerID, func(p *Provider) error {
+		p.AvailabilityMonitorEnabled = enabled
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("加载供应商失败: %w", err)
-	}
-
-	found := false
-	for i := range providers {
-		if providers[i].ID == providerID {
-			providers[i].AvailabilityMonitorEnabled = enabled
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		return fmt.Errorf("未找到供应商 ID: %d", providerID)
-	}
-
-	if err := hcs.providerService.SaveProviders(platform, providers); err != nil {
-		return fmt.Errorf("保存供应商配置失败: %w", err)
+		return err
 	}
 
 	log.Printf("[HealthCheck] Provider %d 可用性监控已%s", providerID, map[bool]string{true: "启用", false: "禁用"}[enabled])
@@ -1053,30 +1166,16 @@ func (hcs *HealthCheckService) SetAvailabilityMonitorEnabled(platform string, pr
 
 // SetConnectivityAutoBlacklist 启用/禁用指定 Provider 的连通性自动拉黑
 func (hcs *HealthCheckService) SetConnectivityAutoBlacklist(platform string, providerID int64, enabled bool) error {
-	providers, err := hcs.providerService.LoadProviders(platform)
-	if err != nil {
-		return fmt.Errorf("加载供应商失败: %w", err)
-	}
-
-	found := false
-	for i := range providers {
-		if providers[i].ID == providerID {
-			// 前置条件检查：必须先启用可用性监控
-			if enabled && !providers[i].AvailabilityMonitorEnabled {
-				return fmt.Errorf("请先在可用性页面启用监控")
-			}
-			providers[i].ConnectivityAutoBlacklist = enabled
-			found = true
-			break
+	err := hcs.updatePlatformProvider(platform, providerID, func(p *Provider) error {
+		// 前置条件检查：必须先启用可用性监控
+		if enabled && !p.AvailabilityMonitorEnabled {
+			return fmt.Errorf("请先在可用性页面启用监控")
 		}
-	}
-
-	if !found {
-		return fmt.Errorf("未找到供应商 ID: %d", providerID)
-	}
-
-	if err := hcs.providerService.SaveProviders(platform, providers); err != nil {
-		return fmt.Errorf("保存供应商配置失败: %w", err)
+		p.ConnectivityAutoBlacklist = enabled
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("[HealthCheck] Provider %d 自动拉黑已%s", providerID, map[bool]string{true: "启用", false: "禁用"}[enabled])
@@ -1085,44 +1184,29 @@ func (hcs *HealthCheckService) SetConnectivityAutoBlacklist(platform string, pro
 
 // SaveAvailabilityConfig 保存 Provider 的可用性高级配置
 func (hcs *HealthCheckService) SaveAvailabilityConfig(platform string, providerID int64, config *AvailabilityConfig) error {
-	providers, err := hcs.providerService.LoadProviders(platform)
-	if err != nil {
-		return fmt.Errorf("加载供应商失败: %w", err)
+	if err := validateScheduleConfig(config); err != nil {
+		return err
 	}
-
-	found := false
-	for i := range providers {
-		if providers[i].ID == providerID {
-			providers[i].AvailabilityConfig = config
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		return fmt.Errorf("未找到供应商 ID: %d", providerID)
-	}
-
-	if err := hcs.providerService.SaveProviders(platform, providers); err != nil {
-		return fmt.Errorf("保存供应商配置失败: %w", err)
+	err := hcs.updatePlatformProvider(platform, providerID, func(p *Provider) error {
+		p.AvailabilityConfig = config
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Printf("[HealthCheck] Provider %d 高级配置已保存", providerID)
 	return nil
 }
 
-// CleanupOldRecords 清理过期的历史记录（保留最近 N 天）
+// CleanupOldRecords 清理过期的历史记录（保留最近 N 天，且至少保留到上个自然月月初）
 func (hcs *HealthCheckService) CleanupOldRecords(daysToKeep int) (int64, error) {
-	if daysToKeep <= 0 {
-		daysToKeep = 7 // 默认保留 7 天
-	}
-
 	db, err := xdb.DB("default")
 	if err != nil {
 		return 0, fmt.Errorf("获取数据库连接失败: %w", err)
 	}
 
-	cutoff := time.Now().AddDate(0, 0, -daysToKeep)
+	cutoff := healthHistoryCleanupCutoff(time.Now(), daysToKeep)
 
 	result, err := db.Exec(`DELETE FROM health_check_history WHERE checked_at < ?`, cutoff)
 	if err != nil {
@@ -1136,3 +1220,16 @@ func (hcs *HealthCheckService) CleanupOldRecords(daysToKeep int) (int64, error)
 
 	return rowsAffected, nil
 }
+
+// healthHistoryCleanupCutoff 计算清理截止时间：默认保留 7 天，
+// 但不早于上个自然月月初，保证 30 天与上月 SLA 报告仍有检测数据
+func healthHistoryCleanupCutoff(now time.Time, daysToKeep int) time.Time {
+	if daysToKeep <= 0 {
+		daysToKeep = 7 // 默认保留 7 天
+	}
+	cutoff := now.AddDate(0, 0, -daysToKeep)
+	if slaStart := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, now.Location()); cutoff.After(slaStart) {
+		cutoff = slaStart
+	}
+	return cutoff
+}
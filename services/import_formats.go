@@ -0,0 +1,612 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 其他工具的配置格式（留空时按文件内容自动识别）
+const (
+	ExternalFormatClaudeSettings = "claude-settings" // Claude Code settings.json 的 env 块（可为多 profile 目录）
+	ExternalFormatCodexConfig    = "codex-config"    // Codex config.toml 的 model_providers 表
+	ExternalFormatLiteLLM        = "litellm"         // LiteLLM config.yaml 的 model_list
+	ExternalFormatChannels       = "channels"        // one-api / new-api / OpenRouter 风格的渠道导出
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	defaultOpenAIBaseURL    = "https://api.openai.com"
+)
+
+// ExternalImportCandidate 外部配置中待导入的供应商（不回传 API Key 明文）
+type ExternalImportCandidate struct {
+	Platform  string   `json:"platform"`
+	Name      string   `json:"name"`
+	APIURL    string   `json:"apiUrl"`
+	HasAPIKey bool     `json:"hasApiKey"`
+	Models    []string `json:"models,omitempty"`
+}
+
+// ExternalImportPreview 外部配置导入预览
+type ExternalImportPreview struct {
+	Format     string                    `json:"format"`
+	Path       string                    `json:"path"`
+	Candidates []ExternalImportCandidate `json:"candidates"`
+	Skipped    int                       `json:"skipped"` // 与现有供应商重复而跳过的条目数
+}
+
+// ExternalImportResult 外部配置导入结果（按平台计数）
+type ExternalImportResult struct {
+	Format   string         `json:"format"`
+	Imported map[string]int `json:"imported"`
+	Total    int            `json:"total"`
+	Skipped  int            `json:"skipped"`
+}
+
+// PreviewExternalImport 解析外部配置并列出去重后将要导入的供应商
+func (is *ImportService) PreviewExternalImport(path, format string) (*ExternalImportPreview, error) {
+	format, pending, skipped, err := is.pendingExternalProviders(path, format)
+	if err != nil {
+		return nil, err
+	}
+	preview := &ExternalImportPreview{
+		Format:     format,
+		Path:       filepath.Clean(strings.TrimSpace(path)),
+		Candidates: []ExternalImportCandidate{},
+		Skipped:    skipped,
+	}
+	for _, kind := range []string{"claude", "codex"} {
+		for _, candidate := range pending[kind] {
+			models := make([]string, 0, len(candidate.SupportedModels))
+			for model := range candidate.SupportedModels {
+				models = append(models, model)
+			}
+			sort.Strings(models)
+			preview.Candidates = append(preview.Candidates, ExternalImportCandidate{
+				Platform:  kind,
+				Name:      candidate.Name,
+				APIURL:    candidate.APIURL,
+				HasAPIKey: candidate.APIKey != "",
+				Models:    models,
+			})
+		}
+	}
+	return preview, nil
+}
+
+// ImportExternalConfig 从外部配置导入供应商，跳过与现有供应商 URL 或名称重复的条目
+func (is *ImportService) ImportExternalConfig(path, format string) (*ExternalImportResult, error) {
+	format, pending, skipped, err := is.pendingExternalProviders(path, format)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExternalImportResult{Format: format, Imported: map[string]int{}, Skipped: skipped}
+	for _, kind := range []string{"claude", "codex"} {
+		if len(pending[kind]) == 0 {
+			continue
+		}
+		added, err := is.saveProviders(kind, pending[kind])
+		if err != nil {
+			return result, fmt.Errorf("导入 %s 供应商失败: %w", kind, err)
+		}
+		result.Imported[kind] = added
+		result.Total += added
+	}
+	log.Printf("✅ 外部配置导入完成 (%s): %d 个供应商", format, result.Total)
+	return result, nil
+}
+
+// pendingExternalProviders 解析外部配置并与现有供应商做差集
+func (is *ImportService) pendingExternalProviders(path, format string) (string, map[string][]providerCandidate, int, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", nil, 0, errors.New("导入路径为空")
+	}
+	path = filepath.Clean(path)
+	format, parsed, err := loadExternalCandidates(path, format)
+	if err != nil {
+		return format, nil, 0, err
+	}
+	pending := make(map[string][]providerCandidate, len(parsed))
+	skipped := 0
+	for kind, candidates := range parsed {
+		existing, err := is.providerService.LoadProviders(kind)
+		if err != nil {
+			return format, nil, 0, err
+		}
+		pending[kind] = filterNewProviderCandidates(candidates, existing)
+		skipped += len(candidates) - len(pending[kind])
+	}
+	return format, pending, skipped, nil
+}
+
+// loadExternalCandidates 按格式解析外部配置，返回实际使用的格式与按平台分组的候选
+func loadExternalCandidates(path, format string) (string, map[string][]providerCandidate, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return format, nil, fmt.Errorf("读取导入路径失败: %w", err)
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		if format, err = detectExternalFormat(path, info); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var candidates map[string][]providerCandidate
+	switch format {
+	case ExternalFormatClaudeSettings:
+		candidates, err = parseClaudeSettingsCandidates(path, info)
+	case ExternalFormatCodexConfig:
+		candidates, err = parseCodexConfigCandidates(path, info)
+	case ExternalFormatLiteLLM:
+		candidates, err = parseLiteLLMCandidates(path)
+	case ExternalFormatChannels:
+		candidates, err = parseChannelExportCandidates(path)
+	default:
+		return format, nil, fmt.Errorf("不支持的导入格式: %s", format)
+	}
+	return format, candidates, err
+}
+
+// detectExternalFormat 根据扩展名与顶层字段识别配置格式
+func detectExternalFormat(path string, info os.FileInfo) (string, error) {
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, "config.toml")); err == nil {
+			return ExternalFormatCodexConfig, nil
+		}
+		return ExternalFormatClaudeSettings, nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return ExternalFormatCodexConfig, nil
+	case ".yaml", ".yml":
+		return ExternalFormatLiteLLM, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return "", fmt.Errorf("无法识别的配置格式: %w", err)
+	}
+	switch value := raw.(type) {
+	case []interface{}:
+		return ExternalFormatChannels, nil
+	case map[string]interface{}:
+		if _, ok := value["model_list"]; ok {
+			return ExternalFormatLiteLLM, nil
+		}
+		if _, ok := value["data"]; ok {
+			return ExternalFormatChannels, nil
+		}
+		if _, ok := value["channels"]; ok {
+			return ExternalFormatChannels, nil
+		}
+		return ExternalFormatClaudeSettings, nil
+	}
+	return "", errors.New("无法识别的配置格式")
+}
+
+// ---- Claude Code settings.json ----
+
+type claudeSettingsFile struct {
+	Env      stringMap                     `json:"env"`
+	Profiles map[string]claudeSettingsFile `json:"profiles"`
+}
+
+// parseClaudeSettingsCandidates 解析 settings.json 的 env 块
+// 支持单个文件、带 profiles 的文件，以及存放多个 profile 文件的目录（如 settings.work.json）
+func parseClaudeSettingsCandidates(path string, info os.FileInfo) (map[string][]providerCandidate, error) {
+	files := []string{path}
+	if info.IsDir() {
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = matches
+	}
+
+	candidates := make([]providerCandidate, 0)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", filepath.Base(file), err)
+		}
+		profiles, err := parseClaudeSettingsProfiles(data)
+		if err != nil {
+			if info.IsDir() {
+				log.Printf("ℹ️  外部导入: 跳过无法解析的文件 %s: %v", filepath.Base(file), err)
+				continue
+			}
+			return nil, fmt.Errorf("解析 %s 失败: %w", filepath.Base(file), err)
+		}
+		fileProfile := claudeProfileNameFromFile(file)
+		for _, name := range sortedKeys(profiles) {
+			env := profiles[name]
+			if name == "" {
+				name = fileProfile
+			}
+			apiURL := strings.TrimSpace(env["ANTHROPIC_BASE_URL"])
+			apiKey := pickFirstNonEmpty(env["ANTHROPIC_AUTH_TOKEN"], env["ANTHROPIC_API_KEY"])
+			if apiURL == "" || apiKey == "" {
+				log.Printf("ℹ️  外部导入: 跳过 claude profile [%s]: 缺少 ANTHROPIC_BASE_URL 或 ANTHROPIC_AUTH_TOKEN", name)
+				continue
+			}
+			if name == "" {
+				name = hostNameOf(apiURL)
+			}
+			candidates = append(candidates, providerCandidate{Name: name, APIURL: apiURL, APIKey: apiKey})
+		}
+	}
+	return map[string][]providerCandidate{"claude": candidates}, nil
+}
+
+// parseClaudeSettingsProfiles 返回 profile 名称到 env 的映射；顶层 env 对应空名称
+// 兼容 {"profiles": {"work": {"env": {...}}}} 与 {"work": {"env": {...}}} 两种多 profile 写法
+func parseClaudeSettingsProfiles(data []byte) (map[string]stringMap, error) {
+	var settings claudeSettingsFile
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]stringMap)
+	if len(settings.Env) > 0 {
+		profiles[""] = settings.Env
+	}
+	for name, profile := range settings.Profiles {
+		if len(profile.Env) > 0 {
+			profiles[strings.TrimSpace(name)] = profile.Env
+		}
+	}
+	if len(profiles) > 0 {
+		return profiles, nil
+	}
+
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(data, &named); err != nil {
+		return profiles, nil
+	}
+	for name, raw := range named {
+		var profile claudeSettingsFile
+		if json.Unmarshal(raw, &profile) == nil && len(profile.Env) > 0 {
+			profiles[strings.TrimSpace(name)] = profile.Env
+		}
+	}
+	return profiles, nil
+}
+
+// claudeProfileNameFromFile settings.work.json -> work；settings.json 与 settings.local.json 返回空
+func claudeProfileNameFromFile(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	name = strings.TrimPrefix(name, "settings")
+	name = strings.Trim(name, ".-_")
+	if name == "local" {
+		return ""
+	}
+	return name
+}
+
+// ---- Codex config.toml ----
+
+type codexModelProvidersFile struct {
+	Providers map[string]ccImportCodexProviderConfig `toml:"model_providers"`
+}
+
+// parseCodexConfigCandidates 解析 config.toml 中的每个 model_providers 表
+// API Key 依次取 experimental_bearer_token、同目录 auth.json 中 env_key 对应的值、同名环境变量
+func parseCodexConfigCandidates(path string, info os.FileInfo) (map[string][]providerCandidate, error) {
+	if info.IsDir() {
+		path = filepath.Join(path, "config.toml")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 config.toml 失败: %w", err)
+	}
+	var cfg codexModelProvidersFile
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析 config.toml 失败: %w", err)
+	}
+
+	auth := stringMap{}
+	if authData, err := os.ReadFile(filepath.Join(filepath.Dir(path), "auth.json")); err == nil {
+		if err := json.Unmarshal(authData, &auth); err != nil {
+			log.Printf("ℹ️  外部导入: 忽略无法解析的 auth.json: %v", err)
+		}
+	}
+
+	candidates := make([]providerCandidate, 0, len(cfg.Providers))
+	for _, key := range sortedKeys(cfg.Providers) {
+		provider := cfg.Providers[key]
+		apiURL := strings.TrimSpace(provider.BaseURL)
+		envKey := strings.TrimSpace(provider.EnvKey)
+		if envKey == "" {
+			envKey = "OPENAI_API_KEY"
+		}
+		apiKey := pickFirstNonEmpty(provider.BearerToken, auth[envKey], os.Getenv(envKey))
+		if apiURL == "" || apiKey == "" {
+			log.Printf("ℹ️  外部导入: 跳过 codex provider [%s]: 缺少 base_url 或 %s", key, envKey)
+			continue
+		}
+		name := pickFirstNonEmpty(provider.Name, key)
+		candidates = append(candidates, providerCandidate{Name: name, APIURL: apiURL, APIKey: apiKey})
+	}
+	return map[string][]providerCandidate{"codex": candidates}, nil
+}
+
+// ---- LiteLLM config.yaml ----
+
+type liteLLMConfig struct {
+	ModelList []struct {
+		ModelName string `yaml:"model_name"`
+		Params    struct {
+			Model   string `yaml:"model"`
+			APIBase string `yaml:"api_base"`
+			APIKey  string `yaml:"api_key"`
+		} `yaml:"litellm_params"`
+	} `yaml:"model_list"`
+}
+
+// parseLiteLLMCandidates 按 api_base + api_key 聚合 model_list：anthropic/ 前缀归入 claude，其余归入 codex
+// 底层模型写入 supportedModels，model_name 与底层模型不同时写入 modelMapping
+func parseLiteLLMCandidates(path string) (map[string][]providerCandidate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 LiteLLM 配置失败: %w", err)
+	}
+	var cfg liteLLMConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析 LiteLLM 配置失败: %w", err)
+	}
+
+	result := map[string][]providerCandidate{}
+	index := map[string]int{}
+	hostCount := map[string]int{}
+	for _, entry := range cfg.ModelList {
+		providerPrefix, model := "openai", strings.TrimSpace(entry.Params.Model)
+		if prefix, rest, ok := strings.Cut(model, "/"); ok {
+			providerPrefix, model = strings.ToLower(prefix), rest
+		}
+		if model == "" {
+			continue
+		}
+		kind, fallbackURL := "codex", ""
+		switch providerPrefix {
+		case "anthropic":
+			kind, fallbackURL = "claude", defaultAnthropicBaseURL
+		case "openai", "text-completion-openai":
+			fallbackURL = defaultOpenAIBaseURL
+		}
+		apiURL := pickFirstNonEmpty(entry.Params.APIBase, fallbackURL)
+		apiKey := resolveLiteLLMSecret(entry.Params.APIKey)
+		if apiURL == "" || apiKey == "" {
+			log.Printf("ℹ️  外部导入: 跳过 LiteLLM 模型 [%s]: 缺少 api_base 或 api_key", entry.ModelName)
+			continue
+		}
+
+		// 同一 api_base 下不同 api_key 视为不同账号，分别生成候选
+		groupKey := kind + "|" + normalizeURL(apiURL) + "|" + apiKey
+		pos, ok := index[groupKey]
+		if !ok {
+			hostKey := kind + "|" + normalizeURL(apiURL)
+			hostCount[hostKey]++
+			name := hostNameOf(apiURL)
+			if hostCount[hostKey] > 1 {
+				name = fmt.Sprintf("%s (%d)", name, hostCount[hostKey])
+			}
+			pos = len(result[kind])
+			index[groupKey] = pos
+			result[kind] = append(result[kind], providerCandidate{
+				Name:            name,
+				APIURL:          apiURL,
+				APIKey:          apiKey,
+				SupportedModels: map[string]bool{},
+				ModelMapping:    map[string]string{},
+			})
+		}
+		addCandidateModel(&result[kind][pos], strings.TrimSpace(entry.ModelName), model)
+	}
+	return result, nil
+}
+
+// resolveLiteLLMSecret 展开 os.environ/VAR 形式的引用
+func resolveLiteLLMSecret(value string) string {
+	value = strings.TrimSpace(value)
+	if name, ok := strings.CutPrefix(value, "os.environ/"); ok {
+		return strings.TrimSpace(os.Getenv(name))
+	}
+	return value
+}
+
+// ---- one-api / new-api / OpenRouter 风格渠道导出 ----
+
+type channelExportEntry struct {
+	Name         string          `json:"name"`
+	Type         json.RawMessage `json:"type"`
+	Key          string          `json:"key"`
+	APIKey       string          `json:"api_key"`
+	BaseURL      string          `json:"base_url"`
+	BaseURLAlt   string          `json:"baseUrl"`
+	APIBase      string          `json:"api_base"`
+	Models       json.RawMessage `json:"models"`
+	ModelMapping json.RawMessage `json:"model_mapping"`
+}
+
+// one-api 渠道类型：1 = OpenAI，14 = Anthropic
+const (
+	channelTypeOpenAI    = 1
+	channelTypeAnthropic = 14
+)
+
+// parseChannelExportCandidates 解析渠道导出（顶层数组，或 data / data.items / channels 包裹）
+// Anthropic 类型渠道归入 claude，其余归入 codex；多行 key 只取第一个
+func parseChannelExportCandidates(path string) (map[string][]providerCandidate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取渠道导出失败: %w", err)
+	}
+	entries, err := unwrapChannelExport(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析渠道导出失败: %w", err)
+	}
+
+	result := map[string][]providerCandidate{}
+	for i, entry := range entries {
+		kind, fallbackURL := channelPlatform(entry.Type)
+		apiURL := pickFirstNonEmpty(entry.BaseURL, entry.BaseURLAlt, entry.APIBase, fallbackURL)
+		apiKey := strings.TrimSpace(pickFirstNonEmpty(entry.Key, entry.APIKey))
+		if first, _, ok := strings.Cut(apiKey, "\n"); ok {
+			apiKey = strings.TrimSpace(first)
+		}
+		name := strings.TrimSpace(entry.Name)
+		if name == "" {
+			name = hostNameOf(apiURL)
+		}
+		if apiURL == "" || apiKey == "" {
+			log.Printf("ℹ️  外部导入: 跳过渠道 #%d [%s]: 缺少 base_url 或 key", i+1, name)
+			continue
+		}
+
+		candidate := providerCandidate{
+			Name:            name,
+			APIURL:          apiURL,
+			APIKey:          apiKey,
+			SupportedModels: map[string]bool{},
+			ModelMapping:    map[string]string{},
+		}
+		for _, model := range parseChannelModels(entry.Models) {
+			candidate.SupportedModels[model] = true
+		}
+		for from, to := range parseChannelModelMapping(entry.ModelMapping) {
+			addCandidateModel(&candidate, from, to)
+		}
+		result[kind] = append(result[kind], candidate)
+	}
+	return result, nil
+}
+
+func unwrapChannelExport(data []byte) ([]channelExportEntry, error) {
+	var entries []channelExportEntry
+	if err := json.Unmarshal(data, &entries); err == nil {
+		return entries, nil
+	}
+	var wrapper struct {
+		Data     json.RawMessage      `json:"data"`
+		Channels []channelExportEntry `json:"channels"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return nil, err
+	}
+	if len(wrapper.Channels) > 0 {
+		return wrapper.Channels, nil
+	}
+	if len(wrapper.Data) == 0 {
+		return nil, errors.New("未找到渠道列表")
+	}
+	if err := json.Unmarshal(wrapper.Data, &entries); err == nil {
+		return entries, nil
+	}
+	var page struct {
+		Items []channelExportEntry `json:"items"`
+	}
+	if err := json.Unmarshal(wrapper.Data, &page); err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// channelPlatform 渠道类型可为 one-api 数字类型或 "anthropic" / "openai" 等字符串
+func channelPlatform(raw json.RawMessage) (kind, fallbackURL string) {
+	var typeName string
+	if err := json.Unmarshal(raw, &typeName); err != nil {
+		typeName = strings.TrimSpace(string(raw))
+	}
+	typeName = strings.ToLower(strings.TrimSpace(typeName))
+	switch typeName {
+	case strconv.Itoa(channelTypeAnthropic), "anthropic", "claude":
+		return "claude", defaultAnthropicBaseURL
+	case strconv.Itoa(channelTypeOpenAI), "openai":
+		return "codex", defaultOpenAIBaseURL
+	}
+	return "codex", ""
+}
+
+// parseChannelModels models 可为逗号分隔的字符串或字符串数组
+func parseChannelModels(raw json.RawMessage) []string {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var joined string
+		if err := json.Unmarshal(raw, &joined); err != nil {
+			return nil
+		}
+		list = strings.Split(joined, ",")
+	}
+	models := make([]string, 0, len(list))
+	for _, model := range list {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// parseChannelModelMapping model_mapping 可为 JSON 对象或 JSON 字符串（one-api 以字符串存储）
+func parseChannelModelMapping(raw json.RawMessage) map[string]string {
+	var mapping map[string]string
+	if err := json.Unmarshal(raw, &mapping); err == nil {
+		return mapping
+	}
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err != nil || strings.TrimSpace(encoded) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(encoded), &mapping); err != nil {
+		return nil
+	}
+	return mapping
+}
+
+// ---- 公共辅助 ----
+
+// addCandidateModel 登记对外模型名到底层模型的映射；目标模型同时加入白名单以通过配置校验
+func addCandidateModel(candidate *providerCandidate, name, target string) {
+	name, target = strings.TrimSpace(name), strings.TrimSpace(target)
+	if target == "" {
+		return
+	}
+	candidate.SupportedModels[target] = true
+	if name != "" && name != target {
+		candidate.ModelMapping[name] = target
+	}
+}
+
+// hostNameOf 以 URL 主机名作为默认供应商名称
+func hostNameOf(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Hostname() == "" {
+		return strings.TrimSpace(rawURL)
+	}
+	return parsed.Hostname()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
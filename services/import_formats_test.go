@@ -0,0 +1,135 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeImportFixture(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestExternalImport_DetectAndParseFormats(t *testing.T) {
+	isolateHomeDir(t)
+	t.Setenv("LITELLM_TEST_KEY", "sk-litellm")
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "existing", APIURL: "https://dup.example.com/", APIKey: "sk-old"}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+	is := NewImportService(ps, nil)
+
+	claudeDir := t.TempDir()
+	writeImportFixture(t, claudeDir, "settings.json", `{"env":{"ANTHROPIC_BASE_URL":"https://main.example.com","ANTHROPIC_AUTH_TOKEN":"sk-main"}}`)
+	writeImportFixture(t, claudeDir, "settings.work.json", `{"env":{"ANTHROPIC_BASE_URL":"https://work.example.com","ANTHROPIC_API_KEY":"sk-work"}}`)
+	writeImportFixture(t, claudeDir, "profiles.json", `{"profiles":{"dup":{"env":{"ANTHROPIC_BASE_URL":"https://dup.example.com","ANTHROPIC_AUTH_TOKEN":"sk-dup"}},"nokey":{"env":{"ANTHROPIC_BASE_URL":"https://nokey.example.com"}}}}`)
+
+	preview, err := is.PreviewExternalImport(claudeDir, "")
+	if err != nil {
+		t.Fatalf("preview claude: %v", err)
+	}
+	names := make([]string, 0)
+	for _, candidate := range preview.Candidates {
+		names = append(names, candidate.Platform+"/"+candidate.Name)
+	}
+	if preview.Format != ExternalFormatClaudeSettings || strings.Join(names, ",") != "claude/main.example.com,claude/work" || preview.Skipped != 1 {
+		t.Fatalf("claude preview = %+v", preview)
+	}
+
+	codexDir := t.TempDir()
+	writeImportFixture(t, codexDir, "config.toml", `
+model_provider = "relay"
+
+[model_providers.relay]
+name = "Relay"
+base_url = "https://relay.example.com/v1"
+env_key = "RELAY_KEY"
+
+[model_providers.token]
+base_url = "https://token.example.com/v1"
+experimental_bearer_token = "sk-token"
+
+[model_providers.missing]
+base_url = "https://missing.example.com/v1"
+env_key = "CODE_SWITCH_UNSET_KEY"
+`)
+	writeImportFixture(t, codexDir, "auth.json", `{"RELAY_KEY":"sk-relay"}`)
+
+	litellm := writeImportFixture(t, t.TempDir(), "config.yaml", `
+model_list:
+  - model_name: claude-sonnet
+    litellm_params:
+      model: anthropic/claude-sonnet-4
+      api_base: https://proxy.example.com
+      api_key: os.environ/LITELLM_TEST_KEY
+  - model_name: claude-haiku
+    litellm_params:
+      model: anthropic/claude-haiku-4
+      api_base: https://proxy.example.com
+      api_key: os.environ/LITELLM_TEST_KEY
+  - model_name: claude-opus
+    litellm_params:
+      model: anthropic/claude-opus-4
+      api_base: https://proxy.example.com
+      api_key: sk-litellm-team
+  - model_name: gpt-4o
+    litellm_params:
+      model: openai/gpt-4o
+      api_key: sk-openai
+`)
+
+	channels := writeImportFixture(t, t.TempDir(), "channels.json", `{"data":{"items":[
+  {"name":"one-claude","type":14,"key":"sk-a\nsk-b","base_url":"","models":"claude-3-5-sonnet,claude-3-haiku","model_mapping":"{\"claude-3-haiku\":\"claude-haiku-4\"}"},
+  {"name":"router","type":"openai","key":"sk-r","base_url":"https://openrouter.example.com/api","models":["gpt-4o"]},
+  {"name":"broken","type":8,"key":"sk-x"}
+]}}`)
+
+	for _, path := range []string{codexDir, litellm, channels} {
+		if _, err := is.ImportExternalConfig(path, ""); err != nil {
+			t.Fatalf("import %s: %v", path, err)
+		}
+	}
+
+	codex, _ := ps.LoadProviders("codex")
+	got := make(map[string]Provider)
+	for _, provider := range codex {
+		got[provider.Name] = provider
+	}
+	if len(codex) != 4 || got["Relay"].APIKey != "sk-relay" || got["token"].APIKey != "sk-token" ||
+		got["api.openai.com"].ModelMapping != nil || !got["api.openai.com"].SupportedModels["gpt-4o"] || got["router"].APIURL != "https://openrouter.example.com/api" {
+		t.Fatalf("codex providers = %+v", codex)
+	}
+
+	claude, _ := ps.LoadProviders("claude")
+	for _, provider := range claude {
+		got[provider.Name] = provider
+	}
+	proxy := got["proxy.example.com"]
+	if len(claude) != 4 || proxy.APIKey != "sk-litellm" || proxy.ModelMapping["claude-sonnet"] != "claude-sonnet-4" || len(proxy.SupportedModels) != 2 {
+		t.Fatalf("litellm provider = %+v", proxy)
+	}
+	// 同一 api_base 下的另一个 api_key 单独成为供应商
+	if team := got["proxy.example.com (2)"]; team.APIKey != "sk-litellm-team" || !team.SupportedModels["claude-opus-4"] || len(team.SupportedModels) != 1 {
+		t.Fatalf("litellm second key provider = %+v", team)
+	}
+	oneAPI := got["one-claude"]
+	if oneAPI.APIKey != "sk-a" || oneAPI.APIURL != defaultAnthropicBaseURL || oneAPI.ModelMapping["claude-3-haiku"] != "claude-haiku-4" || !oneAPI.SupportedModels["claude-3-5-sonnet"] {
+		t.Fatalf("channel provider = %+v", oneAPI)
+	}
+
+	// 再次导入时全部视为重复
+	result, err := is.ImportExternalConfig(channels, ExternalFormatChannels)
+	if err != nil || result.Total != 0 || result.Skipped != 2 {
+		t.Fatalf("re-import = %+v, %v", result, err)
+	}
+	if _, err := is.PreviewExternalImport(channels, "unknown"); err == nil {
+		t.Fatal("unknown format should fail")
+	}
+}
@@ -545,11 +545,13 @@ type ccMCPServerConfig struct {
 }
 
 type providerCandidate struct {
-	Name   string
-	APIURL string
-	APIKey string
-	Site   string
-	Icon   string
+	Name            string
+	APIURL          string
+	APIKey          string
+	Site            string
+	Icon            string
+	SupportedModels map[string]bool
+	ModelMapping    map[string]string
 }
 
 func (is *ImportService) pendingProviders(cfg *ccSwitchConfig) (map[string][]providerCandidate, error) {
@@ -574,6 +576,17 @@ func diffProviderCandidates(kind string, entries map[string]ccProviderEntry, exi
 	if len(entries) == 0 {
 		return []providerCandidate{}
 	}
+	parsed := make([]providerCandidate, 0, len(entries))
+	for key, entry := range entries {
+		if candidate, ok := parseProviderEntry(kind, key, entry); ok {
+			parsed = append(parsed, candidate)
+		}
+	}
+	return filterNewProviderCandidates(parsed, existing)
+}
+
+// filterNewProviderCandidates 剔除与现有供应商 URL 或名称重复的候选，并按 URL + Key（缺省时按名称）去重
+func filterNewProviderCandidates(parsed []providerCandidate, existing []Provider) []providerCandidate {
 	existingURL := make(map[string]struct{})
 	existingNames := make(map[string]struct{})
 	for _, provider := range existing {
@@ -585,17 +598,13 @@ func diffProviderCandidates(kind string, entries map[string]ccProviderEntry, exi
 		}
 	}
 	seen := make(map[string]struct{})
-	candidates := make([]providerCandidate, 0, len(entries))
-	for key, entry := range entries {
-		candidate, ok := parseProviderEntry(kind, key, entry)
-		if !ok {
-			continue
-		}
+	candidates := make([]providerCandidate, 0, len(parsed))
+	for _, candidate := range parsed {
 		if url := normalizeURL(candidate.APIURL); url != "" {
 			if _, exists := existingURL[url]; exists {
 				continue
 			}
-			if _, dup := seen[url]; dup {
+			if _, dup := seen[url+"|"+candidate.APIKey]; dup {
 				continue
 			}
 		}
@@ -605,7 +614,9 @@ func diffProviderCandidates(kind string, entries map[string]ccProviderEntry, exi
 			}
 		}
 		dedupKey := normalizeURL(candidate.APIURL)
-		if dedupKey == "" {
+		if dedupKey != "" {
+			dedupKey += "|" + candidate.APIKey
+		} else {
 			dedupKey = normalizeName(candidate.Name)
 		}
 		if dedupKey != "" {
@@ -666,8 +677,10 @@ type ccImportCodexConfig struct {
 }
 
 type ccImportCodexProviderConfig struct {
-	Name    string `toml:"name"`
-	BaseURL string `toml:"base_url"`
+	Name        string `toml:"name"`
+	BaseURL     string `toml:"base_url"`
+	EnvKey      string `toml:"env_key"`
+	BearerToken string `toml:"experimental_bearer_token"`
 }
 
 func resolveCodexAPIURL(raw string) string {
@@ -764,6 +777,12 @@ func (is *ImportService) saveProviders(kind string, candidates []providerCandida
 			Accent:  accent,
 			Enabled: true,
 		}
+		if len(candidate.SupportedModels) > 0 {
+			provider.SupportedModels = candidate.SupportedModels
+		}
+		if len(candidate.ModelMapping) > 0 {
+			provider.ModelMapping = candidate.ModelMapping
+		}
 		merged = append(merged, provider)
 		nextID++
 	}
@@ -30,6 +30,8 @@ type LogService struct {
 	retentionStopChan chan struct{}
 	retentionWg       sync.WaitGroup
 	retentionMu       sync.Mutex
+	pricingMu         sync.RWMutex
+	pricingRules      *pricingRules
 }
 
 func NewLogService(appSettings *AppSettingsService) *LogService {
@@ -105,17 +107,33 @@ func (ls *LogService) RunRetentionCleanup() (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	if !settings.LogRetentionEnabled {
-		return 0, nil
-	}
-
 	normalizeLogRetentionSettings(&settings)
-	cutoffStart := startOfDay(time.Now().In(time.Local).AddDate(0, 0, -settings.LogRetentionDays))
 	db, err := xdb.DB("default")
 	if err != nil {
 		return 0, err
 	}
 
+	// 小时汇总表独立保留（默认永久），至少不短于原始日志
+	if settings.RollupRetentionDays > 0 {
+		rollupDays := settings.RollupRetentionDays
+		if settings.LogRetentionEnabled && rollupDays < settings.LogRetentionDays {
+			rollupDays = settings.LogRetentionDays
+		}
+		rollupCutoff := startOfDay(time.Now().In(time.Local).AddDate(0, 0, -rollupDays))
+		if _, err := db.Exec(`DELETE FROM `+requestLogRollupTable+` WHERE bucket_hour < ?`, storageTimestamp(rollupCutoff)); err != nil && !isNoSuchTableErr(err) {
+			log.Printf("[LogService] 清理过期汇总数据失败: %v", err)
+		}
+		// provider 事件时间线与汇总数据保留同样时长
+		if _, err := db.Exec(`DELETE FROM `+providerEventsTable+` WHERE created_at < ?`, storageTimestamp(rollupCutoff)); err != nil && !isNoSuchTableErr(err) {
+			log.Printf("[LogService] 清理过期 provider 事件失败: %v", err)
+		}
+	}
+
+	if !settings.LogRetentionEnabled {
+		return 0, nil
+	}
+
+	cutoffStart := startOfDay(time.Now().In(time.Local).AddDate(0, 0, -settings.LogRetentionDays))
 	result, err := db.Exec(`DELETE FROM request_log WHERE created_at < ?`, storageTimestamp(cutoffStart))
 	if err != nil {
 		if strings.Contains(err.Error(), "no such table") {
@@ -123,6 +141,10 @@ func (ls *LogService) RunRetentionCleanup() (int64, error) {
 		}
 		return 0, err
 	}
+	// 记录清理边界，早于该时间的统计改走汇总表
+	if err := markRequestLogsPrunedBefore(db, cutoffStart); err != nil {
+		log.Printf("[LogService] 记录日志清理边界失败: %v", err)
+	}
 	deleted, _ := result.RowsAffected()
 	if deleted > 0 {
 		log.Printf("[LogService] 已清理 %d 条过期日志（保留 %d 天）", deleted, settings.LogRetentionDays)
@@ -331,6 +353,7 @@ func (ls *LogService) ListProvidersOnDate(platform string, date string) ([]strin
 	return providers, nil
 }
 
+// HeatmapStats 按小时返回最近 days 天的用量，直接读取小时汇总表（不受原始日志保留天数影响）
 func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 	if days <= 0 {
 		days = 30
@@ -340,61 +363,28 @@ func (ls *LogService) HeatmapStats(days int) ([]HeatmapStat, error) {
 		totalHours = 24
 	}
 	rangeStart := startOfHour(time.Now())
+	rangeEnd := rangeStart.Add(time.Hour)
 	if totalHours > 1 {
 		rangeStart = rangeStart.Add(-time.Duration(totalHours-1) * time.Hour)
 	}
-	model := xdb.New("request_log")
-	options := []xdb.Option{
-		xdb.WhereGe("created_at", storageTimestamp(rangeStart)),
-		xdb.Field(
-			"model",
-			"input_tokens",
-			"output_tokens",
-			"reasoning_tokens",
-			"cache_create_tokens",
-			"cache_read_tokens",
-			"created_at",
-		),
-		xdb.OrderByDesc("created_at"),
-	}
-	records, err := model.Selects(options...)
+	rows, err := queryRequestLogRollups(rangeStart, rangeEnd, "")
 	if err != nil {
-		if errors.Is(err, xdb.ErrNotFound) || isNoSuchTableErr(err) {
-			return []HeatmapStat{}, nil
-		}
 		return nil, err
 	}
+	rate := ls.costDisplayRate()
 	hourBuckets := map[int64]*HeatmapStat{}
-	for _, record := range records {
-		createdAt, _ := parseCreatedAt(record)
-		if createdAt.IsZero() {
-			continue
-		}
-		hourStart := startOfHour(createdAt)
-		hourKey := hourStart.Unix()
+	for _, row := range rows {
+		hourKey := row.Hour.Unix()
 		bucket := hourBuckets[hourKey]
 		if bucket == nil {
-			bucket = &HeatmapStat{Day: hourStart.Format("01-02 15")}
+			bucket = &HeatmapStat{Day: row.Hour.Format("01-02 15")}
 			hourBuckets[hourKey] = bucket
 		}
-		bucket.TotalRequests++
-		input := record.GetInt("input_tokens")
-		output := record.GetInt("output_tokens")
-		reasoning := record.GetInt("reasoning_tokens")
-		cacheCreate := record.GetInt("cache_create_tokens")
-		cacheRead := record.GetInt("cache_read_tokens")
-		bucket.InputTokens += int64(input)
-		bucket.OutputTokens += int64(output)
-		bucket.ReasoningTokens += int64(reasoning)
-		usage := modelpricing.UsageSnapshot{
-			InputTokens:       input,
-			OutputTokens:      output,
-			ReasoningTokens:   reasoning,
-			CacheCreateTokens: cacheCreate,
-			CacheReadTokens:   cacheRead,
-		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
-		bucket.TotalCost += cost.TotalCost
+		bucket.TotalRequests += row.TotalRequests
+		bucket.InputTokens += row.InputTokens
+		bucket.OutputTokens += row.OutputTokens
+		bucket.ReasoningTokens += row.ReasoningTokens
+		bucket.TotalCost += ls.rollupCostUSD(&row.requestLogRollupDelta).Scale(rate).TotalCost
 	}
 	if len(hourBuckets) == 0 {
 		return []HeatmapStat{}, nil
@@ -423,13 +413,18 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 	model := xdb.New("request_log")
 	seriesStart := startOfDay(now)
 	seriesEnd := seriesStart.Add(seriesHours * time.Hour)
-	queryStart := seriesStart.Add(-24 * time.Hour)
+	queryStart := seriesStart.Add(-requestLogStatsLookback)
 	summaryStart := seriesStart
+	// 原始日志已被清理时改用小时汇总表
+	if useRequestLogRollups(seriesStart, requestLogStatsLookback) {
+		return ls.logStatsFromRollups(platform, seriesStart)
+	}
 	options := []xdb.Option{
 		xdb.WhereGte("created_at", storageTimestamp(queryStart)),
 		xdb.Field(
 			"id",
 			"platform",
+			"provider",
 			"model",
 			"http_code",
 			"input_tokens",
@@ -528,7 +523,7 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 			CacheCreateTokens: cacheCreate,
 			CacheReadTokens:   cacheRead,
 		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
+		cost := ls.calculateCost(record.GetString("platform"), record.GetString("provider"), record.GetString("model"), usage)
 
 		bucket.TotalRequests++
 		bucket.InputTokens += int64(input)
@@ -582,7 +577,10 @@ func (ls *LogService) StatsSince(platform string) (LogStats, error) {
 func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat, error) {
 	start := startOfDay(time.Now())
 	end := start.Add(24 * time.Hour)
-	queryStart := start.Add(-24 * time.Hour)
+	if useRequestLogRollups(start, requestLogStatsLookback) {
+		return ls.providerStatsFromRollups(platform, start, end)
+	}
+	queryStart := start.Add(-requestLogStatsLookback)
 	model := xdb.New("request_log")
 	options := []xdb.Option{
 		xdb.WhereGte("created_at", storageTimestamp(queryStart)),
@@ -660,7 +658,7 @@ func (ls *LogService) ProviderDailyStats(platform string) ([]ProviderDailyStat,
 			CacheCreateTokens: cacheCreate,
 			CacheReadTokens:   cacheRead,
 		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
+		cost := ls.calculateCost(record.GetString("platform"), record.GetString("provider"), record.GetString("model"), usage)
 		stat.TotalRequests++
 		// 只有 HTTP 200-299 且 output_tokens > 0 才算成功
 		if httpCode >= 200 && httpCode < 300 && output > 0 {
@@ -713,14 +711,18 @@ func (ls *LogService) StatsOnDate(platform string, date string) (LogStats, error
 	if err != nil {
 		return stats, err
 	}
+	if useRequestLogRollups(dayStart, requestLogStatsLookback) {
+		return ls.logStatsFromRollups(platform, dayStart)
+	}
 
 	model := xdb.New("request_log")
-	queryStart := dayStart.Add(-24 * time.Hour)
+	queryStart := dayStart.Add(-requestLogStatsLookback)
 	options := []xdb.Option{
 		xdb.WhereGte("created_at", storageTimestamp(queryStart)),
 		xdb.Field(
 			"id",
 			"platform",
+			"provider",
 			"model",
 			"http_code",
 			"input_tokens",
@@ -804,7 +806,7 @@ func (ls *LogService) StatsOnDate(platform string, date string) (LogStats, error
 			CacheCreateTokens: cacheCreate,
 			CacheReadTokens:   cacheRead,
 		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
+		cost := ls.calculateCost(record.GetString("platform"), record.GetString("provider"), record.GetString("model"), usage)
 
 		bucket.TotalRequests++
 		bucket.InputTokens += int64(input)
@@ -857,9 +859,12 @@ func (ls *LogService) ProviderDailyStatsOnDate(platform string, date string) ([]
 	if err != nil {
 		return nil, err
 	}
+	if useRequestLogRollups(dayStart, requestLogStatsLookback) {
+		return ls.providerStatsFromRollups(platform, dayStart, dayEnd)
+	}
 
 	model := xdb.New("request_log")
-	queryStart := dayStart.Add(-24 * time.Hour)
+	queryStart := dayStart.Add(-requestLogStatsLookback)
 	options := []xdb.Option{
 		xdb.WhereGte("created_at", storageTimestamp(queryStart)),
 		xdb.Field(
@@ -938,7 +943,7 @@ func (ls *LogService) ProviderDailyStatsOnDate(platform string, date string) ([]
 			CacheCreateTokens: cacheCreate,
 			CacheReadTokens:   cacheRead,
 		}
-		cost := ls.calculateCost(record.GetString("model"), usage)
+		cost := ls.calculateCost(record.GetString("platform"), record.GetString("provider"), record.GetString("model"), usage)
 
 		stat.TotalRequests++
 		if httpCode >= 200 && httpCode < 300 && output > 0 {
@@ -983,7 +988,7 @@ func (ls *LogService) ProviderDailyStatsOnDate(platform string, date string) ([]
 }
 
 func (ls *LogService) decorateCost(logEntry *ReqeustLog) {
-	if ls == nil || ls.pricing == nil || logEntry == nil {
+	if ls == nil || logEntry == nil {
 		return
 	}
 	usage := modelpricing.UsageSnapshot{
@@ -993,7 +998,7 @@ func (ls *LogService) decorateCost(logEntry *ReqeustLog) {
 		CacheCreateTokens: logEntry.CacheCreateTokens,
 		CacheReadTokens:   logEntry.CacheReadTokens,
 	}
-	cost := ls.pricing.CalculateCost(logEntry.Model, usage)
+	cost := ls.calculateCost(logEntry.Platform, logEntry.Provider, logEntry.Model, usage)
 	logEntry.HasPricing = cost.HasPricing
 	logEntry.InputCost = cost.InputCost
 	logEntry.OutputCost = cost.OutputCost
@@ -1005,13 +1010,6 @@ func (ls *LogService) decorateCost(logEntry *ReqeustLog) {
 	logEntry.TotalCost = cost.TotalCost
 }
 
-func (ls *LogService) calculateCost(model string, usage modelpricing.UsageSnapshot) modelpricing.CostBreakdown {
-	if ls == nil || ls.pricing == nil {
-		return modelpricing.CostBreakdown{}
-	}
-	return ls.pricing.CalculateCost(model, usage)
-}
-
 func parseDateRange(date string) (time.Time, time.Time, error) {
 	trimmed := strings.TrimSpace(date)
 	if trimmed == "" {
@@ -0,0 +1,558 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// 统计粒度
+const (
+	UsageGranularityMinute = "minute"
+	UsageGranularityHour   = "hour"
+	UsageGranularityDay    = "day"
+	UsageGranularityWeek   = "week"
+	UsageGranularityMonth  = "month"
+)
+
+// 分组维度
+const (
+	UsageGroupPlatform = "platform"
+	UsageGroupProvider = "provider"
+	UsageGroupModel    = "model"
+	UsageGroupStatus   = "status"
+	UsageGroupStream   = "stream"
+)
+
+// maxUsageBuckets 单次查询允许的最大时间桶数量，避免 minute 粒度查询数月数据
+const maxUsageBuckets = 5000
+
+// UsageQuery 通用用量查询参数
+// Start/End 使用本地时间，支持 "2006-01-02"、"2006-01-02 15:04:05" 和 RFC3339；
+// End 仅给日期时视为包含当天。
+type UsageQuery struct {
+	Start       string   `json:"start"`
+	End         string   `json:"end"`
+	Granularity string   `json:"granularity"` // minute/hour/day/week/month
+	GroupBy     []string `json:"group_by"`    // platform/provider/model/status/stream
+	Platform    string   `json:"platform"`
+	Provider    string   `json:"provider"`
+	Model       string   `json:"model"`
+}
+
+// UsageBucket 单个时间桶 + 分组的聚合结果
+type UsageBucket struct {
+	Bucket             string            `json:"bucket"`
+	Group              map[string]string `json:"group"`
+	TotalRequests      int64             `json:"total_requests"`
+	SuccessfulRequests int64             `json:"successful_requests"`
+	FailedRequests     int64             `json:"failed_requests"`
+	SuccessRate        float64           `json:"success_rate"`
+	InputTokens        int64             `json:"input_tokens"`
+	OutputTokens       int64             `json:"output_tokens"`
+	ReasoningTokens    int64             `json:"reasoning_tokens"`
+	CacheCreateTokens  int64             `json:"cache_create_tokens"`
+	CacheReadTokens    int64             `json:"cache_read_tokens"`
+	CacheHitRequests   int64             `json:"cache_hit_requests"`
+	CacheHitRate       float64           `json:"cache_hit_rate"`
+	DurationSamples    int64             `json:"duration_samples"`
+	DurationAvgSec     float64           `json:"duration_avg_sec"`
+	DurationP95Sec     float64           `json:"duration_p95_sec"`
+	DurationP99Sec     float64           `json:"duration_p99_sec"`
+	SlowRequests       int64             `json:"slow_requests"`
+	SlowRate           float64           `json:"slow_rate"`
+	CostInput          float64           `json:"cost_input"`
+	CostOutput         float64           `json:"cost_output"`
+	CostCacheCreate    float64           `json:"cost_cache_create"`
+	CostCacheRead      float64           `json:"cost_cache_read"`
+	CostTotal          float64           `json:"cost_total"`
+}
+
+// UsageReport 通用用量查询结果
+type UsageReport struct {
+	Start       string        `json:"start"`
+	End         string        `json:"end"`
+	Granularity string        `json:"granularity"`
+	GroupBy     []string      `json:"group_by"`
+	Currency    string        `json:"currency"` // 费用币种（计价配置中的展示币种）
+	Buckets     []UsageBucket `json:"buckets"`
+}
+
+// QueryUsageStats 按任意时间范围、粒度和分组维度聚合 request_log
+// token、请求数在 SQL 中按 (时间桶, 分组, 模型) 聚合，费用按模型在 Go 中计算；
+// 延迟分位数需要原始样本，因此单独只读取 duration_sec 一列。
+// 范围早于原始日志清理边界时改用小时汇总表。
+func (ls *LogService) QueryUsageStats(query UsageQuery) (UsageReport, error) {
+	start, end, err := parseUsageRange(query.Start, query.End)
+	if err != nil {
+		return UsageReport{}, err
+	}
+	granularity := normalizeUsageGranularity(query.Granularity)
+	if err := checkUsageBucketCount(start, end, granularity); err != nil {
+		return UsageReport{}, err
+	}
+	groupBy, err := normalizeUsageGroupBy(query.GroupBy)
+	if err != nil {
+		return UsageReport{}, err
+	}
+
+	report := UsageReport{
+		Start:       start.Format(timeLayout),
+		End:         end.Format(timeLayout),
+		Granularity: granularity,
+		GroupBy:     groupBy,
+		Currency:    ls.costDisplayCurrency(),
+		Buckets:     []UsageBucket{},
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		return report, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	groupExprs := make([]string, 0, len(groupBy))
+	for _, dim := range groupBy {
+		groupExprs = append(groupExprs, usageGroupExpr(dim))
+	}
+
+	// 原始日志已被清理时改用小时汇总表（分钟粒度无法由汇总表提供）
+	if granularity != UsageGranularityMinute && useRequestLogRollups(start, 0) {
+		return ls.queryUsageStatsFromRollups(db, report, query, start, end, groupExprs)
+	}
+
+	bucketExpr := usageBucketExpr(granularity, "created_at")
+	where, args := usageWhereClause(query, "created_at", start, end)
+
+	// 1. 聚合 token/请求数（按平台、供应商、模型拆分以便计算费用）
+	selectCols := append([]string{bucketExpr + " AS bucket"}, groupExprs...)
+	selectCols = append(selectCols,
+		"COALESCE(platform, '') AS cost_platform",
+		"COALESCE(provider, '') AS cost_provider",
+		"COALESCE(model, '') AS cost_model",
+	)
+	groupCols := make([]string, 0, len(groupExprs)+4)
+	for i := 0; i < len(groupExprs)+4; i++ {
+		groupCols = append(groupCols, fmt.Sprintf("%d", i+1))
+	}
+	aggSQL := fmt.Sprintf(`
+		SELECT %s,
+			COUNT(*),
+			SUM(CASE WHEN http_code >= 200 AND http_code < 300 AND COALESCE(output_tokens, 0) > 0 THEN 1 ELSE 0 END),
+			SUM(COALESCE(input_tokens, 0)),
+			SUM(COALESCE(output_tokens, 0)),
+			SUM(COALESCE(reasoning_tokens, 0)),
+			SUM(COALESCE(cache_create_tokens, 0)),
+			SUM(COALESCE(cache_read_tokens, 0)),
+			SUM(CASE WHEN COALESCE(cache_read_tokens, 0) > 0 OR codex_prompt_cache_hit = 1 THEN 1 ELSE 0 END)
+		FROM request_log
+		WHERE %s
+		GROUP BY %s
+	`, strings.Join(selectCols, ", "), where, strings.Join(groupCols, ", "))
+
+	rows, err := db.Query(aggSQL, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return report, nil
+		}
+		return report, fmt.Errorf("聚合用量失败: %w", err)
+	}
+	defer rows.Close()
+
+	bucketMap := map[string]*UsageBucket{}
+	for rows.Next() {
+		var bucket, costPlatform, costProvider, costModel string
+		groupValues := make([]string, len(groupBy))
+		var total, success, input, output, reasoning, cacheCreate, cacheRead, cacheHits int64
+
+		dest := []interface{}{&bucket}
+		for i := range groupValues {
+			dest = append(dest, &groupValues[i])
+		}
+		dest = append(dest, &costPlatform, &costProvider, &costModel, &total, &success, &input, &output, &reasoning, &cacheCreate, &cacheRead, &cacheHits)
+		if err := rows.Scan(dest...); err != nil {
+			return report, fmt.Errorf("读取聚合结果失败: %w", err)
+		}
+
+		item := usageBucketFor(bucketMap, bucket, groupBy, groupValues)
+		item.TotalRequests += total
+		item.SuccessfulRequests += success
+		item.InputTokens += input
+		item.OutputTokens += output
+		item.ReasoningTokens += reasoning
+		item.CacheCreateTokens += cacheCreate
+		item.CacheReadTokens += cacheRead
+		item.CacheHitRequests += cacheHits
+
+		cost := ls.calculateCost(costPlatform, costProvider, costModel, modelpricing.UsageSnapshot{
+			InputTokens:       int(input),
+			OutputTokens:      int(output),
+			ReasoningTokens:   int(reasoning),
+			CacheCreateTokens: int(cacheCreate),
+			CacheReadTokens:   int(cacheRead),
+		})
+		item.CostInput += cost.InputCost
+		item.CostOutput += cost.OutputCost
+		item.CostCacheCreate += cost.CacheCreateCost
+		item.CostCacheRead += cost.CacheReadCost
+		item.CostTotal += cost.TotalCost
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("读取聚合结果失败: %w", err)
+	}
+
+	// 2. 读取耗时样本计算分位数
+	durationCols := append([]string{bucketExpr + " AS bucket"}, groupExprs...)
+	durationSQL := fmt.Sprintf(`
+		SELECT %s, duration_sec
+		FROM request_log
+		WHERE %s AND duration_sec > 0
+	`, strings.Join(durationCols, ", "), where)
+	durationRows, err := db.Query(durationSQL, args...)
+	if err != nil {
+		return report, fmt.Errorf("查询耗时样本失败: %w", err)
+	}
+	defer durationRows.Close()
+
+	durationMap := map[string]*durationAccumulator{}
+	for durationRows.Next() {
+		var bucket string
+		var durationSec float64
+		groupValues := make([]string, len(groupBy))
+		dest := []interface{}{&bucket}
+		for i := range groupValues {
+			dest = append(dest, &groupValues[i])
+		}
+		dest = append(dest, &durationSec)
+		if err := durationRows.Scan(dest...); err != nil {
+			return report, fmt.Errorf("读取耗时样本失败: %w", err)
+		}
+		key := usageBucketKey(bucket, groupValues)
+		acc := durationMap[key]
+		if acc == nil {
+			acc = &durationAccumulator{}
+			durationMap[key] = acc
+		}
+		acc.Add(durationSec)
+	}
+	if err := durationRows.Err(); err != nil {
+		return report, fmt.Errorf("读取耗时样本失败: %w", err)
+	}
+
+	for key, item := range bucketMap {
+		item.FailedRequests = item.TotalRequests - item.SuccessfulRequests
+		if item.TotalRequests > 0 {
+			item.SuccessRate = float64(item.SuccessfulRequests) / float64(item.TotalRequests)
+			item.CacheHitRate = float64(item.CacheHitRequests) / float64(item.TotalRequests)
+		}
+		applyDurationStatsToUsageBucket(item, durationMap[key])
+		report.Buckets = append(report.Buckets, *item)
+	}
+	sortUsageBuckets(report.Buckets, groupBy)
+
+	return report, nil
+}
+
+func usageBucketFor(bucketMap map[string]*UsageBucket, bucket string, groupBy []string, groupValues []string) *UsageBucket {
+	key := usageBucketKey(bucket, groupValues)
+	item := bucketMap[key]
+	if item == nil {
+		group := make(map[string]string, len(groupBy))
+		for i, dim := range groupBy {
+			group[dim] = groupValues[i]
+		}
+		item = &UsageBucket{Bucket: bucket, Group: group}
+		bucketMap[key] = item
+	}
+	return item
+}
+
+func usageBucketKey(bucket string, groupValues []string) string {
+	return bucket + "\x00" + strings.Join(groupValues, "\x00")
+}
+
+func applyDurationStatsToUsageBucket(item *UsageBucket, acc durationSummary) {
+	if item == nil || acc == nil {
+		return
+	}
+	item.DurationSamples = acc.SampleCount()
+	if item.DurationSamples <= 0 {
+		return
+	}
+	item.DurationAvgSec = acc.AvgSec()
+	item.DurationP95Sec = acc.P95Sec()
+	item.DurationP99Sec = acc.P99Sec()
+	item.SlowRequests = acc.SlowRequests()
+	item.SlowRate = acc.SlowRate()
+}
+
+func sortUsageBuckets(buckets []UsageBucket, groupBy []string) {
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Bucket != buckets[j].Bucket {
+			return buckets[i].Bucket < buckets[j].Bucket
+		}
+		for _, dim := range groupBy {
+			if buckets[i].Group[dim] != buckets[j].Group[dim] {
+				return buckets[i].Group[dim] < buckets[j].Group[dim]
+			}
+		}
+		return false
+	})
+}
+
+// parseUsageRange 解析查询时间范围（本地时间），默认最近 24 小时
+func parseUsageRange(startRaw, endRaw string) (time.Time, time.Time, error) {
+	// 默认结束时间取下一分钟整点，避免漏掉当前秒内刚写入的记录
+	end := time.Now().In(time.Local).Truncate(time.Minute).Add(time.Minute)
+	if strings.TrimSpace(endRaw) != "" {
+		parsed, dateOnly, err := parseUsageTime(endRaw)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		end = parsed
+		if dateOnly {
+			end = parsed.AddDate(0, 0, 1)
+		}
+	}
+
+	start := end.Add(-24 * time.Hour)
+	if strings.TrimSpace(startRaw) != "" {
+		parsed, _, err := parseUsageTime(startRaw)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		start = parsed
+	}
+
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("开始时间必须早于结束时间")
+	}
+	return start, end, nil
+}
+
+func parseUsageTime(value string) (time.Time, bool, error) {
+	trimmed := strings.TrimSpace(value)
+	if parsed, err := time.ParseInLocation(dayLayout, trimmed, time.Local); err == nil {
+		return parsed, true, nil
+	}
+	if parsed, err := time.ParseInLocation(timeLayout, trimmed, time.Local); err == nil {
+		return parsed, false, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, trimmed); err == nil {
+		return parsed.In(time.Local), false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid time format %q, expected YYYY-MM-DD or YYYY-MM-DD HH:MM:SS", trimmed)
+}
+
+func normalizeUsageGranularity(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case UsageGranularityMinute:
+		return UsageGranularityMinute
+	case UsageGranularityHour:
+		return UsageGranularityHour
+	case UsageGranularityWeek:
+		return UsageGranularityWeek
+	case UsageGranularityMonth:
+		return UsageGranularityMonth
+	default:
+		return UsageGranularityDay
+	}
+}
+
+func checkUsageBucketCount(start, end time.Time, granularity string) error {
+	var step time.Duration
+	switch granularity {
+	case UsageGranularityMinute:
+		step = time.Minute
+	case UsageGranularityHour:
+		step = time.Hour
+	default:
+		return nil
+	}
+	if count := int64(end.Sub(start) / step); count > maxUsageBuckets {
+		return fmt.Errorf("时间范围过大：%s 粒度最多 %d 个时间桶，当前约 %d 个", granularity, maxUsageBuckets, count)
+	}
+	return nil
+}
+
+func normalizeUsageGroupBy(values []string) ([]string, error) {
+	result := make([]string, 0, len(values))
+	seen := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		dim := strings.ToLower(strings.TrimSpace(value))
+		if dim == "" {
+			continue
+		}
+		if usageGroupExpr(dim) == "" {
+			return nil, fmt.Errorf("不支持的分组维度: %s", value)
+		}
+		if _, ok := seen[dim]; ok {
+			continue
+		}
+		seen[dim] = struct{}{}
+		result = append(result, dim)
+	}
+	return result, nil
+}
+
+// usageBucketExpr 返回时间桶的 SQL 表达式
+// created_at / bucket_hour 均为 UTC，需转为本地时间后再截断
+func usageBucketExpr(granularity string, column string) string {
+	switch granularity {
+	case UsageGranularityMinute:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:%%M:00', %s, 'localtime')", column)
+	case UsageGranularityHour:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s, 'localtime')", column)
+	case UsageGranularityWeek:
+		// 以周一为一周开始
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s, 'localtime', 'weekday 0', '-6 days')", column)
+	case UsageGranularityMonth:
+		return fmt.Sprintf("strftime('%%Y-%%m-01', %s, 'localtime')", column)
+	default:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s, 'localtime')", column)
+	}
+}
+
+func usageGroupExpr(dim string) string {
+	switch dim {
+	case UsageGroupPlatform:
+		return "COALESCE(platform, '')"
+	case UsageGroupProvider:
+		return "COALESCE(NULLIF(TRIM(provider), ''), '(unknown)')"
+	case UsageGroupModel:
+		return "COALESCE(model, '')"
+	case UsageGroupStatus:
+		return "CAST(COALESCE(http_code, 0) AS TEXT)"
+	case UsageGroupStream:
+		return "CASE WHEN is_stream = 1 THEN 'stream' ELSE 'non-stream' END"
+	default:
+		return ""
+	}
+}
+
+func usageWhereClause(query UsageQuery, timeColumn string, start, end time.Time) (string, []interface{}) {
+	conditions := []string{timeColumn + " >= ?", timeColumn + " < ?"}
+	args := []interface{}{storageTimestamp(start), storageTimestamp(end)}
+	if platform := strings.TrimSpace(query.Platform); platform != "" {
+		conditions = append(conditions, "platform = ?")
+		args = append(args, platform)
+	}
+	if provider := strings.TrimSpace(query.Provider); provider != "" {
+		conditions = append(conditions, "provider = ?")
+		args = append(args, provider)
+	}
+	if model := strings.TrimSpace(query.Model); model != "" {
+		conditions = append(conditions, "model = ?")
+		args = append(args, model)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// queryUsageStatsFromRollups 基于小时汇总表聚合（费用按汇总 token 在读取时计价，耗时分位数来自直方图，为近似值）
+func (ls *LogService) queryUsageStatsFromRollups(db *sql.DB, report UsageReport, query UsageQuery, start, end time.Time, groupExprs []string) (UsageReport, error) {
+	groupBy := report.GroupBy
+	where, args := usageWhereClause(query, "bucket_hour", start, end)
+
+	// 按平台、供应商、模型与状态码拆分以便计价
+	selectCols := append([]string{usageBucketExpr(report.Granularity, "bucket_hour") + " AS bucket"}, groupExprs...)
+	selectCols = append(selectCols, "platform", "provider", "model", "http_code")
+	groupCols := make([]string, 0, len(groupExprs)+5)
+	for i := 0; i < len(groupExprs)+5; i++ {
+		groupCols = append(groupCols, fmt.Sprintf("%d", i+1))
+	}
+	sums := []string{
+		"total_requests", "successful_requests",
+		"input_tokens", "output_tokens", "reasoning_tokens", "cache_create_tokens", "cache_read_tokens",
+		"cache_hit_requests",
+		"duration_samples", "duration_sum", "slow_requests",
+	}
+	for i := 0; i < rollupDurationBucketCount; i++ {
+		sums = append(sums, fmt.Sprintf("duration_b%d", i))
+	}
+	aggCols := make([]string, 0, len(sums)+1)
+	for _, column := range sums {
+		aggCols = append(aggCols, fmt.Sprintf("SUM(%s)", column))
+	}
+	aggCols = append(aggCols, "MAX(duration_max)")
+	rate := ls.costDisplayRate()
+
+	aggSQL := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s GROUP BY %s`,
+		strings.Join(selectCols, ", "), strings.Join(aggCols, ", "), requestLogRollupTable, where, strings.Join(groupCols, ", "))
+	rows, err := db.Query(aggSQL, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return report, nil
+		}
+		return report, fmt.Errorf("聚合用量失败: %w", err)
+	}
+	defer rows.Close()
+
+	bucketMap := map[string]*UsageBucket{}
+	durationMap := map[string]*durationHistogram{}
+	for rows.Next() {
+		var bucket string
+		var d requestLogRollupDelta
+		groupValues := make([]string, len(groupBy))
+		dest := []interface{}{&bucket}
+		for i := range groupValues {
+			dest = append(dest, &groupValues[i])
+		}
+		dest = append(dest,
+			&d.Platform, &d.Provider, &d.Model, &d.HttpCode,
+			&d.TotalRequests, &d.SuccessfulRequests,
+			&d.InputTokens, &d.OutputTokens, &d.ReasoningTokens, &d.CacheCreateTokens, &d.CacheReadTokens,
+			&d.CacheHitRequests,
+			&d.Duration.Samples, &d.Duration.Total, &d.Duration.Slow,
+		)
+		for i := range d.Duration.Buckets {
+			dest = append(dest, &d.Duration.Buckets[i])
+		}
+		dest = append(dest, &d.Duration.Max)
+		if err := rows.Scan(dest...); err != nil {
+			return report, fmt.Errorf("读取聚合结果失败: %w", err)
+		}
+
+		item := usageBucketFor(bucketMap, bucket, groupBy, groupValues)
+		item.TotalRequests += d.TotalRequests
+		item.SuccessfulRequests += d.SuccessfulRequests
+		item.InputTokens += d.InputTokens
+		item.OutputTokens += d.OutputTokens
+		item.ReasoningTokens += d.ReasoningTokens
+		item.CacheCreateTokens += d.CacheCreateTokens
+		item.CacheReadTokens += d.CacheReadTokens
+		item.CacheHitRequests += d.CacheHitRequests
+
+		cost := ls.rollupCostUSD(&d).Scale(rate)
+		item.CostInput += cost.InputCost
+		item.CostOutput += cost.OutputCost
+		item.CostCacheCreate += cost.CacheCreateCost
+		item.CostCacheRead += cost.CacheReadCost
+		item.CostTotal += cost.TotalCost
+
+		key := usageBucketKey(bucket, groupValues)
+		if durationMap[key] == nil {
+			durationMap[key] = &durationHistogram{}
+		}
+		durationMap[key].Merge(&d.Duration)
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("读取聚合结果失败: %w", err)
+	}
+
+	for key, item := range bucketMap {
+		item.FailedRequests = item.TotalRequests - item.SuccessfulRequests
+		if item.TotalRequests > 0 {
+			item.SuccessRate = float64(item.SuccessfulRequests) / float64(item.TotalRequests)
+			item.CacheHitRate = float64(item.CacheHitRequests) / float64(item.TotalRequests)
+		}
+		applyDurationStatsToUsageBucket(item, durationMap[key])
+		report.Buckets = append(report.Buckets, *item)
+	}
+	sortUsageBuckets(report.Buckets, groupBy)
+	return report, nil
+}
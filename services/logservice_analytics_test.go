@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUsageRangeDateOnlyEndIsInclusive(t *testing.T) {
+	start, end, err := parseUsageRange("2025-01-01", "2025-01-02")
+	if err != nil {
+		t.Fatalf("parseUsageRange error: %v", err)
+	}
+	if got := start.Format(timeLayout); got != "2025-01-01 00:00:00" {
+		t.Fatalf("start = %s, want 2025-01-01 00:00:00", got)
+	}
+	if got := end.Format(timeLayout); got != "2025-01-03 00:00:00" {
+		t.Fatalf("end = %s, want 2025-01-03 00:00:00", got)
+	}
+}
+
+func TestParseUsageRangeRejectsInvalidInput(t *testing.T) {
+	if _, _, err := parseUsageRange("2025-01-02", "2025-01-01 00:00:00"); err == nil {
+		t.Fatalf("expected error when start is after end")
+	}
+	if _, _, err := parseUsageRange("yesterday", ""); err == nil {
+		t.Fatalf("expected error for unsupported time format")
+	}
+}
+
+func TestNormalizeUsageGroupBy(t *testing.T) {
+	got, err := normalizeUsageGroupBy([]string{" Provider ", "model", "provider", ""})
+	if err != nil {
+		t.Fatalf("normalizeUsageGroupBy error: %v", err)
+	}
+	if len(got) != 2 || got[0] != UsageGroupProvider || got[1] != UsageGroupModel {
+		t.Fatalf("normalizeUsageGroupBy = %v, want [provider model]", got)
+	}
+	if _, err := normalizeUsageGroupBy([]string{"api_key"}); err == nil {
+		t.Fatalf("expected error for unknown group dimension")
+	}
+}
+
+func TestCheckUsageBucketCount(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	if err := checkUsageBucketCount(start, start.AddDate(0, 0, 7), UsageGranularityMinute); err == nil {
+		t.Fatalf("expected error for 7 days at minute granularity")
+	}
+	if err := checkUsageBucketCount(start, start.AddDate(0, 0, 7), UsageGranularityHour); err != nil {
+		t.Fatalf("unexpected error for 7 days at hour granularity: %v", err)
+	}
+	if err := checkUsageBucketCount(start, start.AddDate(5, 0, 0), UsageGranularityDay); err != nil {
+		t.Fatalf("unexpected error for day granularity: %v", err)
+	}
+}
+
+func TestSortUsageBucketsOrdersByBucketThenGroup(t *testing.T) {
+	groupBy := []string{UsageGroupProvider}
+	buckets := []UsageBucket{
+		{Bucket: "2025-01-02", Group: map[string]string{"provider": "a"}},
+		{Bucket: "2025-01-01", Group: map[string]string{"provider": "b"}},
+		{Bucket: "2025-01-01", Group: map[string]string{"provider": "a"}},
+	}
+	sortUsageBuckets(buckets, groupBy)
+	want := []string{"2025-01-01/a", "2025-01-01/b", "2025-01-02/a"}
+	for i, item := range buckets {
+		if got := item.Bucket + "/" + item.Group["provider"]; got != want[i] {
+			t.Fatalf("buckets[%d] = %s, want %s", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// 导出格式
+const (
+	UsageExportFormatCSV   = "csv"
+	UsageExportFormatJSONL = "jsonl"
+)
+
+// 导出内容
+const (
+	UsageExportKindRaw     = "raw"     // 原始请求日志（含费用明细）
+	UsageExportKindSummary = "summary" // 按天 + 平台 + 供应商汇总
+)
+
+// maxUsageExportRows 原始日志单次导出上限，防止一次性占用过多内存
+const maxUsageExportRows = 500000
+
+// UsageExportRequest 用量/费用导出参数
+// 时间范围与过滤条件同 UsageQuery（Granularity/GroupBy 忽略）
+type UsageExportRequest struct {
+	UsageQuery
+	Format string `json:"format"` // csv/jsonl
+	Kind   string `json:"kind"`   // raw/summary
+}
+
+// UsageExportResult 导出结果
+type UsageExportResult struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Kind   string `json:"kind"`
+	Rows   int    `json:"rows"`
+}
+
+// usageExportRawRow 原始日志导出行
+type usageExportRawRow struct {
+	ID                int64   `json:"id"`
+	CreatedAt         string  `json:"created_at"`
+	Platform          string  `json:"platform"`
+	Provider          string  `json:"provider"`
+	Model             string  `json:"model"`
+	HttpCode          int     `json:"http_code"`
+	IsStream          bool    `json:"is_stream"`
+	DurationSec       float64 `json:"duration_sec"`
+	InputTokens       int     `json:"input_tokens"`
+	OutputTokens      int     `json:"output_tokens"`
+	ReasoningTokens   int     `json:"reasoning_tokens"`
+	CacheCreateTokens int     `json:"cache_create_tokens"`
+	CacheReadTokens   int     `json:"cache_read_tokens"`
+	InputCost         float64 `json:"input_cost"`
+	OutputCost        float64 `json:"output_cost"`
+	ReasoningCost     float64 `json:"reasoning_cost"`
+	CacheCreateCost   float64 `json:"cache_create_cost"`
+	CacheReadCost     float64 `json:"cache_read_cost"`
+	Ephemeral5mCost   float64 `json:"ephemeral_5m_cost"`
+	Ephemeral1hCost   float64 `json:"ephemeral_1h_cost"`
+	TotalCost         float64 `json:"total_cost"`
+	Currency          string  `json:"currency"` // 费用币种（计价配置中的展示币种）
+	HasPricing        bool    `json:"has_pricing"`
+}
+
+var usageExportRawHeader = []string{
+	"id", "created_at", "platform", "provider", "model", "http_code", "is_stream", "duration_sec",
+	"input_tokens", "output_tokens", "reasoning_tokens", "cache_create_tokens", "cache_read_tokens",
+	"input_cost", "output_cost", "reasoning_cost", "cache_create_cost", "cache_read_cost",
+	"ephemeral_5m_cost", "ephemeral_1h_cost", "total_cost", "currency", "has_pricing",
+}
+
+func (r usageExportRawRow) csvRecord() []string {
+	return []string{
+		strconv.FormatInt(r.ID, 10),
+		r.CreatedAt,
+		r.Platform,
+		r.Provider,
+		r.Model,
+		strconv.Itoa(r.HttpCode),
+		strconv.FormatBool(r.IsStream),
+		formatExportFloat(r.DurationSec),
+		strconv.Itoa(r.InputTokens),
+		strconv.Itoa(r.OutputTokens),
+		strconv.Itoa(r.ReasoningTokens),
+		strconv.Itoa(r.CacheCreateTokens),
+		strconv.Itoa(r.CacheReadTokens),
+		formatExportFloat(r.InputCost),
+		formatExportFloat(r.OutputCost),
+		formatExportFloat(r.ReasoningCost),
+		formatExportFloat(r.CacheCreateCost),
+		formatExportFloat(r.CacheReadCost),
+		formatExportFloat(r.Ephemeral5mCost),
+		formatExportFloat(r.Ephemeral1hCost),
+		formatExportFloat(r.TotalCost),
+		r.Currency,
+		strconv.FormatBool(r.HasPricing),
+	}
+}
+
+// usageExportSummaryRow 按天/供应商汇总导出行
+type usageExportSummaryRow struct {
+	Date               string  `json:"date"`
+	Platform           string  `json:"platform"`
+	Provider           string  `json:"provider"`
+	TotalRequests      int64   `json:"total_requests"`
+	SuccessfulRequests int64   `json:"successful_requests"`
+	FailedRequests     int64   `json:"failed_requests"`
+	SuccessRate        float64 `json:"success_rate"`
+	InputTokens        int64   `json:"input_tokens"`
+	OutputTokens       int64   `json:"output_tokens"`
+	ReasoningTokens    int64   `json:"reasoning_tokens"`
+	CacheCreateTokens  int64   `json:"cache_create_tokens"`
+	CacheReadTokens    int64   `json:"cache_read_tokens"`
+	CostInput          float64 `json:"cost_input"`
+	CostOutput         float64 `json:"cost_output"`
+	CostCacheCreate    float64 `json:"cost_cache_create"`
+	CostCacheRead      float64 `json:"cost_cache_read"`
+	CostTotal          float64 `json:"cost_total"`
+	Currency           string  `json:"currency"` // 费用币种（计价配置中的展示币种）
+}
+
+var usageExportSummaryHeader = []string{
+	"date", "platform", "provider", "total_requests", "successful_requests", "failed_requests", "success_rate",
+	"input_tokens", "output_tokens", "reasoning_tokens", "cache_create_tokens", "cache_read_tokens",
+	"cost_input", "cost_output", "cost_cache_create", "cost_cache_read", "cost_total", "currency",
+}
+
+func (r usageExportSummaryRow) csvRecord() []string {
+	return []string{
+		r.Date,
+		r.Platform,
+		r.Provider,
+		strconv.FormatInt(r.TotalRequests, 10),
+		strconv.FormatInt(r.SuccessfulRequests, 10),
+		strconv.FormatInt(r.FailedRequests, 10),
+		formatExportFloat(r.SuccessRate),
+		strconv.FormatInt(r.InputTokens, 10),
+		strconv.FormatInt(r.OutputTokens, 10),
+		strconv.FormatInt(r.ReasoningTokens, 10),
+		strconv.FormatInt(r.CacheCreateTokens, 10),
+		strconv.FormatInt(r.CacheReadTokens, 10),
+		formatExportFloat(r.CostInput),
+		formatExportFloat(r.CostOutput),
+		formatExportFloat(r.CostCacheCreate),
+		formatExportFloat(r.CostCacheRead),
+		formatExportFloat(r.CostTotal),
+		r.Currency,
+	}
+}
+
+// ExportUsageToFile 按请求导出用量到指定路径（原子写入）
+func (ls *LogService) ExportUsageToFile(req UsageExportRequest, path string) (UsageExportResult, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return UsageExportResult{}, fmt.Errorf("导出路径不能为空")
+	}
+	format, kind, err := normalizeUsageExportRequest(req)
+	if err != nil {
+		return UsageExportResult{}, err
+	}
+
+	var data []byte
+	var rows int
+	switch kind {
+	case UsageExportKindSummary:
+		data, rows, err = ls.buildUsageSummaryExport(req.UsageQuery, format)
+	default:
+		data, rows, err = ls.buildUsageRawExport(req.UsageQuery, format)
+	}
+	if err != nil {
+		return UsageExportResult{}, err
+	}
+
+	if err := AtomicWriteBytes(path, data); err != nil {
+		return UsageExportResult{}, err
+	}
+	return UsageExportResult{Path: path, Format: format, Kind: kind, Rows: rows}, nil
+}
+
+// ExportUsage 弹出系统保存对话框，由用户选择导出位置
+// 用户取消时返回空 Path 且不报错
+func (ls *LogService) ExportUsage(req UsageExportRequest) (UsageExportResult, error) {
+	format, kind, err := normalizeUsageExportRequest(req)
+	if err != nil {
+		return UsageExportResult{}, err
+	}
+
+	dialog := application.SaveFileDialog().
+		CanCreateDirectories(true).
+		SetFilename(defaultUsageExportFilename(kind, format, time.Now()))
+	if format == UsageExportFormatCSV {
+		dialog.AddFilter("CSV (*.csv)", "*.csv")
+	} else {
+		dialog.AddFilter("JSON Lines (*.jsonl)", "*.jsonl")
+	}
+	path, err := dialog.PromptForSingleSelection()
+	if err != nil {
+		return UsageExportResult{}, fmt.Errorf("打开保存对话框失败: %w", err)
+	}
+	if strings.TrimSpace(path) == "" {
+		return UsageExportResult{Format: format, Kind: kind}, nil
+	}
+	if filepath.Ext(path) == "" {
+		path += "." + format
+	}
+
+	req.Format = format
+	req.Kind = kind
+	return ls.ExportUsageToFile(req, path)
+}
+
+func normalizeUsageExportRequest(req UsageExportRequest) (string, string, error) {
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	switch format {
+	case "":
+		format = UsageExportFormatCSV
+	case UsageExportFormatCSV, UsageExportFormatJSONL:
+	default:
+		return "", "", fmt.Errorf("不支持的导出格式: %s", req.Format)
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	switch kind {
+	case "":
+		kind = UsageExportKindRaw
+	case UsageExportKindRaw, UsageExportKindSummary:
+	default:
+		return "", "", fmt.Errorf("不支持的导出类型: %s", req.Kind)
+	}
+	return format, kind, nil
+}
+
+func defaultUsageExportFilename(kind, format string, now time.Time) string {
+	return fmt.Sprintf("code-switch-usage-%s-%s.%s", kind, now.Format("20060102-150405"), format)
+}
+
+// buildUsageRawExport 导出范围内的原始日志（仅包含尚未被保留策略清理的记录）
+func (ls *LogService) buildUsageRawExport(query UsageQuery, format string) ([]byte, int, error) {
+	start, end, err := parseUsageRange(query.Start, query.End)
+	if err != nil {
+		return nil, 0, err
+	}
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	where, args := usageWhereClause(query, "created_at", start, end)
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, created_at, COALESCE(platform, ''), COALESCE(provider, ''), COALESCE(model, ''),
+			COALESCE(http_code, 0), COALESCE(is_stream, 0), COALESCE(duration_sec, 0),
+			COALESCE(input_tokens, 0), COALESCE(output_tokens, 0), COALESCE(reasoning_tokens, 0),
+			COALESCE(cache_create_tokens, 0), COALESCE(cache_read_tokens, 0)
+		FROM request_log
+		WHERE %s
+		ORDER BY created_at ASC, id ASC
+		LIMIT %d
+	`, where, maxUsageExportRows+1), args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return encodeUsageExport(format, usageExportRawHeader, nil)
+		}
+		return nil, 0, fmt.Errorf("查询请求日志失败: %w", err)
+	}
+	defer rows.Close()
+
+	currency := ls.costDisplayCurrency()
+	items := make([]usageExportCSVRow, 0)
+	for rows.Next() {
+		var entry ReqeustLog
+		var createdAt interface{}
+		var isStream int
+		if err := rows.Scan(
+			&entry.ID, &createdAt, &entry.Platform, &entry.Provider, &entry.Model,
+			&entry.HttpCode, &isStream, &entry.DurationSec,
+			&entry.InputTokens, &entry.OutputTokens, &entry.ReasoningTokens,
+			&entry.CacheCreateTokens, &entry.CacheReadTokens,
+		); err != nil {
+			return nil, 0, fmt.Errorf("读取请求日志失败: %w", err)
+		}
+		if len(items) >= maxUsageExportRows {
+			return nil, 0, fmt.Errorf("导出记录超过 %d 条，请缩小时间范围", maxUsageExportRows)
+		}
+		entry.IsStream = isStream == 1
+		ls.decorateCost(&entry)
+
+		createdLocal := ""
+		if t, ok := parseCreatedAt(xdb.Record{"created_at": createdAt}); ok {
+			createdLocal = t.Format(timeLayout)
+		}
+		items = append(items, usageExportRawRow{
+			ID:                entry.ID,
+			CreatedAt:         createdLocal,
+			Platform:          entry.Platform,
+			Provider:          entry.Provider,
+			Model:             entry.Model,
+			HttpCode:          entry.HttpCode,
+			IsStream:          entry.IsStream,
+			DurationSec:       entry.DurationSec,
+			InputTokens:       entry.InputTokens,
+			OutputTokens:      entry.OutputTokens,
+			ReasoningTokens:   entry.ReasoningTokens,
+			CacheCreateTokens: entry.CacheCreateTokens,
+			CacheReadTokens:   entry.CacheReadTokens,
+			InputCost:         entry.InputCost,
+			OutputCost:        entry.OutputCost,
+			ReasoningCost:     entry.ReasoningCost,
+			CacheCreateCost:   entry.CacheCreateCost,
+			CacheReadCost:     entry.CacheReadCost,
+			Ephemeral5mCost:   entry.Ephemeral5mCost,
+			Ephemeral1hCost:   entry.Ephemeral1hCost,
+			TotalCost:         entry.TotalCost,
+			Currency:          currency,
+			HasPricing:        entry.HasPricing,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("读取请求日志失败: %w", err)
+	}
+	return encodeUsageExport(format, usageExportRawHeader, items)
+}
+
+// buildUsageSummaryExport 按天 + 平台 + 供应商汇总（复用 QueryUsageStats，超出原始日志保留期时自动使用汇总表）
+func (ls *LogService) buildUsageSummaryExport(query UsageQuery, format string) ([]byte, int, error) {
+	query.Granularity = UsageGranularityDay
+	query.GroupBy = []string{UsageGroupPlatform, UsageGroupProvider}
+	report, err := ls.QueryUsageStats(query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]usageExportCSVRow, 0, len(report.Buckets))
+	for _, bucket := range report.Buckets {
+		items = append(items, usageExportSummaryRow{
+			Date:               bucket.Bucket,
+			Platform:           bucket.Group[UsageGroupPlatform],
+			Provider:           bucket.Group[UsageGroupProvider],
+			TotalRequests:      bucket.TotalRequests,
+			SuccessfulRequests: bucket.SuccessfulRequests,
+			FailedRequests:     bucket.FailedRequests,
+			SuccessRate:        bucket.SuccessRate,
+			InputTokens:        bucket.InputTokens,
+			OutputTokens:       bucket.OutputTokens,
+			ReasoningTokens:    bucket.ReasoningTokens,
+			CacheCreateTokens:  bucket.CacheCreateTokens,
+			CacheReadTokens:    bucket.CacheReadTokens,
+			CostInput:          bucket.CostInput,
+			CostOutput:         bucket.CostOutput,
+			CostCacheCreate:    bucket.CostCacheCreate,
+			CostCacheRead:      bucket.CostCacheRead,
+			CostTotal:          bucket.CostTotal,
+			Currency:           report.Currency,
+		})
+	}
+	return encodeUsageExport(format, usageExportSummaryHeader, items)
+}
+
+type usageExportCSVRow interface {
+	csvRecord() []string
+}
+
+// encodeUsageExport 将导出行编码为 CSV（带表头）或 JSON Lines
+func encodeUsageExport(format string, header []string, items []usageExportCSVRow) ([]byte, int, error) {
+	var buf bytes.Buffer
+	switch format {
+	case UsageExportFormatJSONL:
+		encoder := json.NewEncoder(&buf)
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return nil, 0, fmt.Errorf("编码 JSON 失败: %w", err)
+			}
+		}
+	default:
+		// UTF-8 BOM，便于 Excel 正确识别中文供应商名称
+		buf.WriteString("\ufeff")
+		writer := csv.NewWriter(&buf)
+		if err := writer.Write(header); err != nil {
+			return nil, 0, err
+		}
+		for _, item := range items {
+			if err := writer.Write(item.csvRecord()); err != nil {
+				return nil, 0, err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return nil, 0, fmt.Errorf("编码 CSV 失败: %w", err)
+		}
+	}
+	return buf.Bytes(), len(items), nil
+}
+
+func formatExportFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
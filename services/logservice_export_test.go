@@ -0,0 +1,64 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeUsageExportRequestDefaults(t *testing.T) {
+	format, kind, err := normalizeUsageExportRequest(UsageExportRequest{})
+	if err != nil {
+		t.Fatalf("normalizeUsageExportRequest error: %v", err)
+	}
+	if format != UsageExportFormatCSV || kind != UsageExportKindRaw {
+		t.Fatalf("defaults = (%s, %s), want (csv, raw)", format, kind)
+	}
+	if _, _, err := normalizeUsageExportRequest(UsageExportRequest{Format: "parquet"}); err == nil {
+		t.Fatalf("expected error for unsupported format")
+	}
+	if _, _, err := normalizeUsageExportRequest(UsageExportRequest{Kind: "weekly"}); err == nil {
+		t.Fatalf("expected error for unsupported kind")
+	}
+}
+
+func TestEncodeUsageExportCSV(t *testing.T) {
+	rows := []usageExportCSVRow{
+		usageExportSummaryRow{Date: "2025-01-01", Platform: "claude", Provider: "中转, A", TotalRequests: 2, CostTotal: 0.5, Currency: "CNY"},
+	}
+	data, count, err := encodeUsageExport(UsageExportFormatCSV, usageExportSummaryHeader, rows)
+	if err != nil {
+		t.Fatalf("encodeUsageExport error: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("count = %d, want 1", count)
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %d, want 2: %q", len(lines), text)
+	}
+	if !strings.HasPrefix(lines[0], "date,platform,provider,") {
+		t.Fatalf("unexpected header: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `2025-01-01,claude,"中转, A",2,`) || !strings.HasSuffix(lines[1], ",0.5,CNY") {
+		t.Fatalf("unexpected row: %s", lines[1])
+	}
+}
+
+func TestEncodeUsageExportJSONL(t *testing.T) {
+	rows := []usageExportCSVRow{
+		usageExportRawRow{ID: 1, Model: "m1", TotalCost: 1.25, Currency: "USD"},
+		usageExportRawRow{ID: 2, Model: "m2"},
+	}
+	data, count, err := encodeUsageExport(UsageExportFormatJSONL, usageExportRawHeader, rows)
+	if err != nil {
+		t.Fatalf("encodeUsageExport error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if count != 2 || len(lines) != 2 {
+		t.Fatalf("count = %d, lines = %d, want 2", count, len(lines))
+	}
+	if !strings.Contains(lines[0], `"total_cost":1.25,"currency":"USD"`) || !strings.Contains(lines[1], `"model":"m2"`) {
+		t.Fatalf("unexpected jsonl: %s", data)
+	}
+}
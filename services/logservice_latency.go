@@ -7,6 +7,16 @@ import (
 
 const slowRequestThresholdSec = 5.0
 
+// durationSummary 耗时统计摘要（原始样本或汇总直方图）
+type durationSummary interface {
+	SampleCount() int64
+	AvgSec() float64
+	P95Sec() float64
+	P99Sec() float64
+	SlowRequests() int64
+	SlowRate() float64
+}
+
 type durationAccumulator struct {
 	values       []float64
 	total        float64
@@ -25,6 +35,9 @@ func (a *durationAccumulator) Add(value float64) {
 }
 
 func (a *durationAccumulator) SampleCount() int64 {
+	if a == nil {
+		return 0
+	}
 	return int64(len(a.values))
 }
 
@@ -85,7 +98,7 @@ func percentileDuration(sorted []float64, percentile float64) float64 {
 	return sorted[rank]
 }
 
-func applyDurationStatsToLogStats(stats *LogStats, acc *durationAccumulator) {
+func applyDurationStatsToLogStats(stats *LogStats, acc durationSummary) {
 	if stats == nil || acc == nil {
 		return
 	}
@@ -100,7 +113,7 @@ func applyDurationStatsToLogStats(stats *LogStats, acc *durationAccumulator) {
 	stats.SlowRate = acc.SlowRate()
 }
 
-func applyDurationStatsToProviderStat(stat *ProviderDailyStat, acc *durationAccumulator) {
+func applyDurationStatsToProviderStat(stat *ProviderDailyStat, acc durationSummary) {
 	if stat == nil || acc == nil {
 		return
 	}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	modelpricing "codeswitch/resources/model-pricing"
+)
+
+const (
+	pricingBaseCurrency = "USD"
+	// pricingWildcardModel 供应商覆盖中匹配所有模型的键
+	pricingWildcardModel = "*"
+	tokensPerMillion     = 1000000
+)
+
+// ModelPrice 自定义模型单价（每百万 tokens）
+type ModelPrice struct {
+	Currency              string  `json:"currency,omitempty"` // 价格币种，默认 USD
+	InputPerMillion       float64 `json:"inputPerMillion"`
+	OutputPerMillion      float64 `json:"outputPerMillion"`
+	ReasoningPerMillion   float64 `json:"reasoningPerMillion,omitempty"`
+	CacheCreatePerMillion float64 `json:"cacheCreatePerMillion,omitempty"` // 为 0 时按输入价 1.25 倍
+	CacheReadPerMillion   float64 `json:"cacheReadPerMillion,omitempty"`   // 为 0 时按输入价 0.1 倍
+}
+
+// ProviderPricingOverride 供应商价格覆盖：显式单价优先，否则按倍率折算官方价
+type ProviderPricingOverride struct {
+	Platform   string                `json:"platform"`
+	Provider   string                `json:"provider"`
+	Multiplier float64               `json:"multiplier,omitempty"` // 如 0.3 表示官方价 3 折，0 视为 1
+	Models     map[string]ModelPrice `json:"models,omitempty"`     // "*" 匹配所有模型
+}
+
+// PricingConfig 计价配置（~/.code-switch/pricing.json）
+type PricingConfig struct {
+	DisplayCurrency string                    `json:"displayCurrency"`         // 费用展示币种
+	ExchangeRates   map[string]float64        `json:"exchangeRates,omitempty"` // 1 USD 兑换的目标币种数量
+	TableSource     string                    `json:"tableSource,omitempty"`   // 最近一次导入的价格表路径，用于刷新
+	Models          map[string]ModelPrice     `json:"models,omitempty"`        // 用户价格表，覆盖内置价格
+	Providers       []ProviderPricingOverride `json:"providers,omitempty"`
+}
+
+// pricingRules 由 PricingConfig 解析出的计价规则（单价统一为美元/token）
+type pricingRules struct {
+	currency  string
+	rate      float64 // USD -> 展示币种
+	models    map[string]modelpricing.PricingEntry
+	providers map[string]providerPricingRule
+}
+
+type providerPricingRule struct {
+	multiplier float64
+	models     map[string]modelpricing.PricingEntry
+}
+
+// GetPricingConfigPath 获取计价配置文件路径
+func GetPricingConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	return filepath.Join(home, ".code-switch", "pricing.json"), nil
+}
+
+// GetPricingConfig 获取计价配置
+func (ls *LogService) GetPricingConfig() (PricingConfig, error) {
+	return loadPricingConfig()
+}
+
+// SavePricingConfig 校验并保存计价配置，立即作用于后续费用计算
+func (ls *LogService) SavePricingConfig(config PricingConfig) error {
+	normalized, err := normalizePricingConfig(config)
+	if err != nil {
+		return err
+	}
+	rules, err := buildPricingRules(normalized)
+	if err != nil {
+		return err
+	}
+	configPath, err := GetPricingConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := AtomicWriteJSON(configPath, normalized); err != nil {
+		return fmt.Errorf("保存计价配置失败: %w", err)
+	}
+	ls.setPricingRules(rules)
+	return nil
+}
+
+// ImportPricingTable 从本地 JSON 文件导入价格表，合并到用户价格表（同名模型覆盖）
+// 支持两种格式：本应用的 {"models": {...}}（每百万 tokens），或与内置价格表相同的 LiteLLM 格式（每 token）
+func (ls *LogService) ImportPricingTable(path string) (int, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return 0, fmt.Errorf("价格表路径不能为空")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("读取价格表失败: %w", err)
+	}
+	imported, err := parsePricingTable(data)
+	if err != nil {
+		return 0, err
+	}
+
+	config, err := loadPricingConfig()
+	if err != nil {
+		return 0, err
+	}
+	if config.Models == nil {
+		config.Models = make(map[string]ModelPrice, len(imported))
+	}
+	for name, price := range imported {
+		config.Models[name] = price
+	}
+	config.TableSource = path
+	if err := ls.SavePricingConfig(config); err != nil {
+		return 0, err
+	}
+	return len(imported), nil
+}
+
+// RefreshPricingTable 重新导入最近一次使用的价格表文件
+func (ls *LogService) RefreshPricingTable() (int, error) {
+	config, err := loadPricingConfig()
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(config.TableSource) == "" {
+		return 0, fmt.Errorf("尚未导入过价格表")
+	}
+	return ls.ImportPricingTable(config.TableSource)
+}
+
+// calculateCost 计算展示币种下的费用（应用用户价格表、供应商覆盖与汇率）
+func (ls *LogService) calculateCost(platform, provider, model string, usage modelpricing.UsageSnapshot) modelpricing.CostBreakdown {
+	if ls == nil {
+		return modelpricing.CostBreakdown{}
+	}
+	return ls.calculateCostUSD(platform, provider, model, usage).Scale(ls.currentPricingRules().rate)
+}
+
+// calculateCostUSD 计算美元费用（写入汇总表与预算累计使用，不受展示币种影响）
+func (ls *LogService) calculateCostUSD(platform, provider, model string, usage modelpricing.UsageSnapshot) modelpricing.CostBreakdown {
+	if ls == nil {
+		return modelpricing.CostBreakdown{}
+	}
+	rules := ls.currentPricingRules()
+	if override, ok := rules.providers[pricingProviderKey(platform, provider)]; ok {
+		if entry, ok := lookupPricingEntry(override.models, model); ok {
+			return modelpricing.CalculateCostWithEntry(entry, usage)
+		}
+		return ls.baseCost(rules, model, usage).Scale(override.multiplier)
+	}
+	return ls.baseCost(rules, model, usage)
+}
+
+// costDisplayRate 美元费用换算为展示币种的倍率（用于汇总表中已存储的美元费用）
+func (ls *LogService) costDisplayRate() float64 {
+	if ls == nil {
+		return 1
+	}
+	return ls.currentPricingRules().rate
+}
+
+// costDisplayCurrency 费用展示币种
+func (ls *LogService) costDisplayCurrency() string {
+	if ls == nil {
+		return pricingBaseCurrency
+	}
+	return ls.currentPricingRules().currency
+}
+
+func (ls *LogService) baseCost(rules *pricingRules, model string, usage modelpricing.UsageSnapshot) modelpricing.CostBreakdown {
+	if entry, ok := lookupPricingEntry(rules.models, model); ok {
+		return modelpricing.CalculateCostWithEntry(entry, usage)
+	}
+	if ls.pricing == nil {
+		return modelpricing.CostBreakdown{}
+	}
+	return ls.pricing.CalculateCost(model, usage)
+}
+
+// currentPricingRules 返回当前计价规则，首次使用时从配置文件加载
+func (ls *LogService) currentPricingRules() *pricingRules {
+	ls.pricingMu.RLock()
+	rules := ls.pricingRules
+	ls.pricingMu.RUnlock()
+	if rules != nil {
+		return rules
+	}
+
+	rules = defaultPricingRules()
+	if config, err := loadPricingConfig(); err == nil {
+		if built, err := buildPricingRules(config); err == nil {
+			rules = built
+		}
+	}
+	ls.setPricingRules(rules)
+	return rules
+}
+
+func (ls *LogService) setPricingRules(rules *pricingRules) {
+	ls.pricingMu.Lock()
+	ls.pricingRules = rules
+	ls.pricingMu.Unlock()
+}
+
+func defaultPricingRules() *pricingRules {
+	return &pricingRules{
+		currency:  pricingBaseCurrency,
+		rate:      1,
+		models:    map[string]modelpricing.PricingEntry{},
+		providers: map[string]providerPricingRule{},
+	}
+}
+
+func loadPricingConfig() (PricingConfig, error) {
+	config := PricingConfig{DisplayCurrency: pricingBaseCurrency}
+	configPath, err := GetPricingConfigPath()
+	if err != nil {
+		return config, err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, fmt.Errorf("读取计价配置失败: %w", err)
+	}
+	if len(data) == 0 {
+		return config, nil
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("解析计价配置失败: %w", err)
+	}
+	return normalizePricingConfig(config)
+}
+
+// normalizePricingConfig 规范化币种与键名，并校验价格和汇率
+func normalizePricingConfig(config PricingConfig) (PricingConfig, error) {
+	config.DisplayCurrency = normalizeCurrency(config.DisplayCurrency)
+	config.TableSource = strings.TrimSpace(config.TableSource)
+
+	rates := make(map[string]float64, len(config.ExchangeRates))
+	for currency, rate := range config.ExchangeRates {
+		currency = normalizeCurrency(currency)
+		if currency == pricingBaseCurrency {
+			continue
+		}
+		if rate <= 0 {
+			return config, fmt.Errorf("币种 %s 的汇率必须大于 0", currency)
+		}
+		rates[currency] = rate
+	}
+	config.ExchangeRates = rates
+	if config.DisplayCurrency != pricingBaseCurrency && rates[config.DisplayCurrency] == 0 {
+		return config, fmt.Errorf("未配置展示币种 %s 的汇率", config.DisplayCurrency)
+	}
+
+	models, err := normalizeModelPrices(config.Models, rates)
+	if err != nil {
+		return config, err
+	}
+	config.Models = models
+
+	providers := make([]ProviderPricingOverride, 0, len(config.Providers))
+	seen := make(map[string]bool, len(config.Providers))
+	for _, override := range config.Providers {
+		override.Platform = strings.ToLower(strings.TrimSpace(override.Platform))
+		override.Provider = strings.TrimSpace(override.Provider)
+		if override.Platform == "" || override.Provider == "" {
+			return config, fmt.Errorf("供应商价格覆盖缺少平台或供应商名称")
+		}
+		key := pricingProviderKey(override.Platform, override.Provider)
+		if seen[key] {
+			return config, fmt.Errorf("供应商 %s/%s 的价格覆盖重复", override.Platform, override.Provider)
+		}
+		seen[key] = true
+		if override.Multiplier < 0 {
+			return config, fmt.Errorf("供应商 %s 的价格倍率不能为负数", override.Provider)
+		}
+		if override.Models, err = normalizeModelPrices(override.Models, rates); err != nil {
+			return config, err
+		}
+		providers = append(providers, override)
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		if providers[i].Platform != providers[j].Platform {
+			return providers[i].Platform < providers[j].Platform
+		}
+		return providers[i].Provider < providers[j].Provider
+	})
+	config.Providers = providers
+	return config, nil
+}
+
+func normalizeModelPrices(models map[string]ModelPrice, rates map[string]float64) (map[string]ModelPrice, error) {
+	result := make(map[string]ModelPrice, len(models))
+	for name, price := range models {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		price.Currency = normalizeCurrency(price.Currency)
+		if price.Currency != pricingBaseCurrency && rates[price.Currency] == 0 {
+			return nil, fmt.Errorf("模型 %s 使用的币种 %s 未配置汇率", name, price.Currency)
+		}
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 || price.ReasoningPerMillion < 0 ||
+			price.CacheCreatePerMillion < 0 || price.CacheReadPerMillion < 0 {
+			return nil, fmt.Errorf("模型 %s 的价格不能为负数", name)
+		}
+		result[name] = price
+	}
+	return result, nil
+}
+
+// buildPricingRules 将配置转换为美元/token 的计价规则
+func buildPricingRules(config PricingConfig) (*pricingRules, error) {
+	rules := defaultPricingRules()
+	rules.currency = normalizeCurrency(config.DisplayCurrency)
+	if rules.currency != pricingBaseCurrency {
+		rate := config.ExchangeRates[rules.currency]
+		if rate <= 0 {
+			return nil, fmt.Errorf("未配置展示币种 %s 的汇率", rules.currency)
+		}
+		rules.rate = rate
+	}
+
+	rules.models = buildPricingEntries(config.Models, config.ExchangeRates)
+	for _, override := range config.Providers {
+		multiplier := override.Multiplier
+		if multiplier == 0 {
+			multiplier = 1
+		}
+		rules.providers[pricingProviderKey(override.Platform, override.Provider)] = providerPricingRule{
+			multiplier: multiplier,
+			models:     buildPricingEntries(override.Models, config.ExchangeRates),
+		}
+	}
+	return rules, nil
+}
+
+func buildPricingEntries(models map[string]ModelPrice, rates map[string]float64) map[string]modelpricing.PricingEntry {
+	entries := make(map[string]modelpricing.PricingEntry, len(models))
+	for name, price := range models {
+		toUSD := 1.0
+		if currency := normalizeCurrency(price.Currency); currency != pricingBaseCurrency {
+			toUSD = 1 / rates[currency]
+		}
+		perToken := func(perMillion float64) float64 {
+			return perMillion * toUSD / tokensPerMillion
+		}
+		entries[strings.ToLower(name)] = modelpricing.PricingEntry{
+			InputCostPerToken:           perToken(price.InputPerMillion),
+			OutputCostPerToken:          perToken(price.OutputPerMillion),
+			OutputCostPerReasoningToken: perToken(price.ReasoningPerMillion),
+			CacheCreationInputTokenCost: perToken(price.CacheCreatePerMillion),
+			CacheReadInputTokenCost:     perToken(price.CacheReadPerMillion),
+		}
+	}
+	return entries
+}
+
+// lookupPricingEntry 按模型名（不区分大小写）查找单价，找不到时回退到 "*"
+func lookupPricingEntry(entries map[string]modelpricing.PricingEntry, model string) (modelpricing.PricingEntry, bool) {
+	if len(entries) == 0 {
+		return modelpricing.PricingEntry{}, false
+	}
+	if entry, ok := entries[strings.ToLower(strings.TrimSpace(model))]; ok {
+		return entry, true
+	}
+	entry, ok := entries[pricingWildcardModel]
+	return entry, ok
+}
+
+// parsePricingTable 解析导入的价格表文件
+func parsePricingTable(data []byte) (map[string]ModelPrice, error) {
+	var wrapper struct {
+		Models map[string]json.RawMessage `json:"models"`
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &wrapper); err == nil && len(wrapper.Models) > 0 {
+		raw = wrapper.Models
+	} else if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("解析价格表失败: %w", err)
+	}
+
+	result := make(map[string]ModelPrice, len(raw))
+	for name, item := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "sample_spec" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(item, &fields); err != nil {
+			continue
+		}
+		if _, ok := fields["input_cost_per_token"]; ok {
+			var entry modelpricing.PricingEntry
+			if err := json.Unmarshal(item, &entry); err != nil {
+				return nil, fmt.Errorf("解析模型 %s 的价格失败: %w", name, err)
+			}
+			result[name] = ModelPrice{
+				Currency:              pricingBaseCurrency,
+				InputPerMillion:       entry.InputCostPerToken * tokensPerMillion,
+				OutputPerMillion:      entry.OutputCostPerToken * tokensPerMillion,
+				ReasoningPerMillion:   entry.OutputCostPerReasoningToken * tokensPerMillion,
+				CacheCreatePerMillion: entry.CacheCreationInputTokenCost * tokensPerMillion,
+				CacheReadPerMillion:   entry.CacheReadInputTokenCost * tokensPerMillion,
+			}
+			continue
+		}
+		if _, ok := fields["inputPerMillion"]; ok {
+			var price ModelPrice
+			if err := json.Unmarshal(item, &price); err != nil {
+				return nil, fmt.Errorf("解析模型 %s 的价格失败: %w", name, err)
+			}
+			result[name] = price
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("价格表中没有可识别的模型价格")
+	}
+	return result, nil
+}
+
+func pricingProviderKey(platform, provider string) string {
+	return strings.ToLower(strings.TrimSpace(platform)) + "/" + strings.ToLower(strings.TrimSpace(provider))
+}
+
+func normalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return pricingBaseCurrency
+	}
+	return currency
+}
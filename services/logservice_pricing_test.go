@@ -0,0 +1,136 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestCalculateCostAppliesProviderOverrides(t *testing.T) {
+	ls := NewLogService(nil)
+	config, err := normalizePricingConfig(PricingConfig{
+		DisplayCurrency: "cny",
+		ExchangeRates:   map[string]float64{"CNY": 7},
+		Models: map[string]ModelPrice{
+			"my-model": {InputPerMillion: 1, OutputPerMillion: 2},
+		},
+		Providers: []ProviderPricingOverride{
+			{Platform: "claude", Provider: "cheap", Multiplier: 0.5},
+			{Platform: "claude", Provider: "flat", Models: map[string]ModelPrice{
+				"*": {Currency: "CNY", InputPerMillion: 7, OutputPerMillion: 14},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("normalizePricingConfig error: %v", err)
+	}
+	rules, err := buildPricingRules(config)
+	if err != nil {
+		t.Fatalf("buildPricingRules error: %v", err)
+	}
+	ls.setPricingRules(rules)
+
+	usage := modelpricing.UsageSnapshot{InputTokens: 1000000, OutputTokens: 1000000}
+
+	base := ls.calculateCostUSD("claude", "other", "my-model", usage)
+	if !almostEqual(base.TotalCost, 3) {
+		t.Fatalf("custom table cost = %v, want 3", base.TotalCost)
+	}
+	if got := ls.calculateCostUSD("claude", "cheap", "my-model", usage).TotalCost; !almostEqual(got, 1.5) {
+		t.Fatalf("multiplier cost = %v, want 1.5", got)
+	}
+	// 7 CNY + 14 CNY = 21 CNY = 3 USD
+	if got := ls.calculateCostUSD("claude", "flat", "anything", usage).TotalCost; !almostEqual(got, 3) {
+		t.Fatalf("explicit provider price = %v USD, want 3", got)
+	}
+	if got := ls.calculateCost("claude", "cheap", "my-model", usage).TotalCost; !almostEqual(got, 10.5) {
+		t.Fatalf("display cost = %v CNY, want 10.5", got)
+	}
+	if got := ls.costDisplayCurrency(); got != "CNY" {
+		t.Fatalf("currency = %s, want CNY", got)
+	}
+}
+
+func TestNormalizePricingConfigRejectsMissingRate(t *testing.T) {
+	if _, err := normalizePricingConfig(PricingConfig{DisplayCurrency: "EUR"}); err == nil {
+		t.Fatalf("expected error when display currency has no exchange rate")
+	}
+	if _, err := normalizePricingConfig(PricingConfig{Models: map[string]ModelPrice{"m": {Currency: "CNY", InputPerMillion: 1}}}); err == nil {
+		t.Fatalf("expected error when model price currency has no exchange rate")
+	}
+}
+
+func TestParsePricingTableFormats(t *testing.T) {
+	litellm := []byte(`{"sample_spec": {"input_cost_per_token": 0}, "m1": {"input_cost_per_token": 0.000003, "output_cost_per_token": 0.000015}}`)
+	prices, err := parsePricingTable(litellm)
+	if err != nil {
+		t.Fatalf("parsePricingTable(litellm) error: %v", err)
+	}
+	if len(prices) != 1 || !almostEqual(prices["m1"].InputPerMillion, 3) || !almostEqual(prices["m1"].OutputPerMillion, 15) {
+		t.Fatalf("litellm prices = %+v", prices)
+	}
+
+	native := []byte(`{"models": {"m2": {"currency": "CNY", "inputPerMillion": 4, "outputPerMillion": 16}}}`)
+	prices, err = parsePricingTable(native)
+	if err != nil {
+		t.Fatalf("parsePricingTable(native) error: %v", err)
+	}
+	if prices["m2"].Currency != "CNY" || prices["m2"].OutputPerMillion != 16 {
+		t.Fatalf("native prices = %+v", prices)
+	}
+
+	if _, err := parsePricingTable([]byte(`{"foo": {"bar": 1}}`)); err == nil {
+		t.Fatalf("expected error for table without recognizable prices")
+	}
+}
+
+func TestRollupCostsFollowCurrentPricing(t *testing.T) {
+	useTestDatabase(t)
+	ls := NewLogService(nil)
+	applyPricing := func(input float64) {
+		config, err := normalizePricingConfig(PricingConfig{Models: map[string]ModelPrice{
+			"my-model": {InputPerMillion: input, OutputPerMillion: 2},
+		}})
+		if err != nil {
+			t.Fatalf("normalizePricingConfig error: %v", err)
+		}
+		rules, err := buildPricingRules(config)
+		if err != nil {
+			t.Fatalf("buildPricingRules error: %v", err)
+		}
+		ls.setPricingRules(rules)
+	}
+	applyPricing(1)
+
+	for i := 0; i < 2; i++ {
+		writeTestRequestLog(t, ReqeustLog{Platform: "claude", Model: "my-model", Provider: "a", HttpCode: 200, InputTokens: 500000, OutputTokens: 500000})
+	}
+	start, end := time.Now().Add(-2*time.Hour), time.Now().Add(2*time.Hour)
+	stats, err := ls.providerStatsFromRollups("claude", start, end)
+	if err != nil || len(stats) != 1 || !almostEqual(stats[0].CostTotal, 3) {
+		t.Fatalf("stats = %+v, err = %v, want cost 3", stats, err)
+	}
+
+	// 改价后汇总表中的历史用量按新价格计价
+	applyPricing(4)
+	stats, err = ls.providerStatsFromRollups("claude", start, end)
+	if err != nil || len(stats) != 1 || !almostEqual(stats[0].CostTotal, 6) {
+		t.Fatalf("stats after repricing = %+v, err = %v, want cost 6", stats, err)
+	}
+	spend, err := loadBudgetSpend(ls, start, end)
+	if err != nil || !almostEqual(spend[budgetSpendKey{Platform: "claude", Provider: "a"}], 6) {
+		t.Fatalf("budget spend = %v, err = %v, want 6", spend, err)
+	}
+
+	// 按累计 token 计价，不因平均用量取整丢失精度
+	cost := ls.rollupCostUSD(&requestLogRollupDelta{requestLogRollupKey: requestLogRollupKey{Platform: "claude", Provider: "a", Model: "my-model"}, TotalRequests: 3, InputTokens: 1000001})
+	if !almostEqual(cost.TotalCost, 4.000004) {
+		t.Fatalf("rollup cost = %v, want 4.000004", cost.TotalCost)
+	}
+}
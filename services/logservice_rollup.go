@@ -0,0 +1,708 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	modelpricing "codeswitch/resources/model-pricing"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// request_log 小时汇总表
+// - 由 GlobalDBQueueLogs 的批量提交钩子在同一事务内增量维护
+// - bucket_hour 与 request_log.created_at 一致，使用 UTC
+// - 只累加 token，费用在读取时按当前价格配置计价（改价、供应商倍率与导入价格表对历史数据同样生效）
+// - 耗时只保留固定分桶直方图，分位数为近似值
+//
+// 统计查询的数据源：
+// - 热力图与预算消费始终读取汇总表
+// - 日统计（StatsSince / StatsOnDate）与供应商统计（ProviderDailyStats / ProviderDailyStatsOnDate）
+// 在原始日志完整时读取原始日志（Codex 缓存可匹配分析与耗时分位数需要逐条数据），
+// 查询窗口（含回看窗口）早于清理边界时整个窗口改用汇总表
+// - 用量分析（QueryUsageStats）小时及以上粒度同上，分钟粒度只读取原始日志
+const requestLogRollupTable = "request_log_rollup_hourly"
+
+const (
+	// requestLogPrunedBeforeKey 记录原始日志已被清理到的时间点（UTC），早于该时间的统计只能走汇总表
+	requestLogPrunedBeforeKey = "request_log_pruned_before"
+	// requestLogRollupBackfilledKey 标记历史 request_log 是否已回填到汇总表
+	requestLogRollupBackfilledKey = "request_log_rollup_backfilled"
+)
+
+// rollupDurationBounds 耗时直方图上界（秒），最后一个桶收纳超过最大上界的样本
+var rollupDurationBounds = [...]float64{1, 2, 3, 5, 8, 13, 20, 30, 60, 120}
+
+const rollupDurationBucketCount = len(rollupDurationBounds) + 1
+
+// rollupCostUSD 按汇总行累计的 token 直接计价（美元）
+// 长上下文档位按行内单次平均输入判断，不会因为整行 token 相加而误判
+func (ls *LogService) rollupCostUSD(d *requestLogRollupDelta) modelpricing.CostBreakdown {
+	if d == nil || d.TotalRequests <= 0 {
+		return modelpricing.CostBreakdown{}
+	}
+	usage := modelpricing.UsageSnapshot{
+		InputTokens:       int(d.InputTokens),
+		OutputTokens:      int(d.OutputTokens),
+		ReasoningTokens:   int(d.ReasoningTokens),
+		CacheCreateTokens: int(d.CacheCreateTokens),
+		CacheReadTokens:   int(d.CacheReadTokens),
+		Requests:          int(d.TotalRequests),
+	}
+	if ls == nil {
+		if svc, err := modelpricing.DefaultService(); err == nil && svc != nil {
+			return svc.CalculateCost(d.Model, usage)
+		}
+		return modelpricing.CostBreakdown{}
+	}
+	return ls.calculateCostUSD(d.Platform, d.Provider, d.Model, usage)
+}
+
+// durationHistogram 固定分桶的耗时直方图，可跨小时合并
+type durationHistogram struct {
+	Buckets [rollupDurationBucketCount]int64
+	Samples int64
+	Total   float64
+	Max     float64
+	Slow    int64
+}
+
+func (h *durationHistogram) Add(value float64) {
+	if value <= 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	h.Buckets[durationHistogramIndex(value)]++
+	h.Samples++
+	h.Total += value
+	if value > h.Max {
+		h.Max = value
+	}
+	if value >= slowRequestThresholdSec {
+		h.Slow++
+	}
+}
+
+func (h *durationHistogram) Merge(other *durationHistogram) {
+	if other == nil {
+		return
+	}
+	for i := range h.Buckets {
+		h.Buckets[i] += other.Buckets[i]
+	}
+	h.Samples += other.Samples
+	h.Total += other.Total
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+	h.Slow += other.Slow
+}
+
+func (h *durationHistogram) SampleCount() int64 {
+	if h == nil {
+		return 0
+	}
+	return h.Samples
+}
+
+func (h *durationHistogram) AvgSec() float64 {
+	if h.SampleCount() <= 0 {
+		return 0
+	}
+	return h.Total / float64(h.Samples)
+}
+
+func (h *durationHistogram) P95Sec() float64 {
+	return h.percentile(0.95)
+}
+
+func (h *durationHistogram) P99Sec() float64 {
+	return h.percentile(0.99)
+}
+
+func (h *durationHistogram) SlowRequests() int64 {
+	if h == nil {
+		return 0
+	}
+	return h.Slow
+}
+
+func (h *durationHistogram) SlowRate() float64 {
+	if h.SampleCount() <= 0 {
+		return 0
+	}
+	return float64(h.Slow) / float64(h.Samples)
+}
+
+// percentile 返回目标分位所在桶的上界（不超过观测到的最大值）
+func (h *durationHistogram) percentile(p float64) float64 {
+	if h.SampleCount() <= 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(float64(h.Samples) * p))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range h.Buckets {
+		seen += count
+		if seen < rank {
+			continue
+		}
+		if i < len(rollupDurationBounds) && rollupDurationBounds[i] < h.Max {
+			return rollupDurationBounds[i]
+		}
+		return h.Max
+	}
+	return h.Max
+}
+
+func durationHistogramIndex(value float64) int {
+	for i, bound := range rollupDurationBounds {
+		if value <= bound {
+			return i
+		}
+	}
+	return len(rollupDurationBounds)
+}
+
+// requestLogRollupKey 汇总维度（bucket_hour 由写入时的数据库时间决定）
+type requestLogRollupKey struct {
+	Platform string
+	Provider string
+	Model    string
+	HttpCode int
+	IsStream bool
+}
+
+// requestLogRollupDelta 单条或多条请求日志的增量
+type requestLogRollupDelta struct {
+	requestLogRollupKey
+	TotalRequests              int64
+	SuccessfulRequests         int64
+	InputTokens                int64
+	OutputTokens               int64
+	ReasoningTokens            int64
+	CacheCreateTokens          int64
+	CacheReadTokens            int64
+	CacheHitRequests           int64
+	CodexCacheEnabledRequests  int64
+	CodexCacheEligibleRequests int64
+	CodexCacheHitRequests      int64
+	Duration                   durationHistogram
+}
+
+// newRequestLogRollupDelta 根据即将写入的请求日志构造汇总增量
+func newRequestLogRollupDelta(entry *ReqeustLog) *requestLogRollupDelta {
+	if entry == nil {
+		return nil
+	}
+	delta := &requestLogRollupDelta{
+		requestLogRollupKey: requestLogRollupKey{
+			Platform: entry.Platform,
+			Provider: entry.Provider,
+			Model:    entry.Model,
+			HttpCode: entry.HttpCode,
+			IsStream: entry.IsStream,
+		},
+		TotalRequests:     1,
+		InputTokens:       int64(entry.InputTokens),
+		OutputTokens:      int64(entry.OutputTokens),
+		ReasoningTokens:   int64(entry.ReasoningTokens),
+		CacheCreateTokens: int64(entry.CacheCreateTokens),
+		CacheReadTokens:   int64(entry.CacheReadTokens),
+	}
+	if isRequestLogSuccessful(*entry) {
+		delta.SuccessfulRequests = 1
+	}
+	if entry.CacheReadTokens > 0 || entry.CodexPromptCacheHit {
+		delta.CacheHitRequests = 1
+	}
+	if entry.CodexPromptCacheEnabled {
+		delta.CodexCacheEnabledRequests = 1
+		if entry.CodexPromptCacheEligible {
+			delta.CodexCacheEligibleRequests = 1
+			if entry.CodexPromptCacheHit || entry.CacheReadTokens > 0 {
+				delta.CodexCacheHitRequests = 1
+			}
+		}
+	}
+	delta.Duration.Add(entry.DurationSec)
+	return delta
+}
+
+func (d *requestLogRollupDelta) Merge(other *requestLogRollupDelta) {
+	if other == nil {
+		return
+	}
+	d.TotalRequests += other.TotalRequests
+	d.SuccessfulRequests += other.SuccessfulRequests
+	d.InputTokens += other.InputTokens
+	d.OutputTokens += other.OutputTokens
+	d.ReasoningTokens += other.ReasoningTokens
+	d.CacheCreateTokens += other.CacheCreateTokens
+	d.CacheReadTokens += other.CacheReadTokens
+	d.CacheHitRequests += other.CacheHitRequests
+	d.CodexCacheEnabledRequests += other.CodexCacheEnabledRequests
+	d.CodexCacheEligibleRequests += other.CodexCacheEligibleRequests
+	d.CodexCacheHitRequests += other.CodexCacheHitRequests
+	d.Duration.Merge(&other.Duration)
+}
+
+// mergeRequestLogRollupDeltas 将批次内的增量按维度合并，减少 UPSERT 次数
+func mergeRequestLogRollupDeltas(deltas []*requestLogRollupDelta) []*requestLogRollupDelta {
+	merged := make(map[requestLogRollupKey]*requestLogRollupDelta)
+	order := make([]requestLogRollupKey, 0, len(deltas))
+	for _, delta := range deltas {
+		if delta == nil {
+			continue
+		}
+		existing := merged[delta.requestLogRollupKey]
+		if existing == nil {
+			copied := *delta
+			merged[delta.requestLogRollupKey] = &copied
+			order = append(order, delta.requestLogRollupKey)
+			continue
+		}
+		existing.Merge(delta)
+	}
+	result := make([]*requestLogRollupDelta, 0, len(order))
+	for _, key := range order {
+		result = append(result, merged[key])
+	}
+	return result
+}
+
+var requestLogRollupValueColumns = func() []string {
+	columns := []string{
+		"total_requests", "successful_requests",
+		"input_tokens", "output_tokens", "reasoning_tokens", "cache_create_tokens", "cache_read_tokens",
+		"cache_hit_requests",
+		"codex_cache_enabled_requests", "codex_cache_eligible_requests", "codex_cache_hit_requests",
+		"duration_samples", "duration_sum", "slow_requests",
+	}
+	for i := 0; i < rollupDurationBucketCount; i++ {
+		columns = append(columns, fmt.Sprintf("duration_b%d", i))
+	}
+	return columns
+}()
+
+func (d *requestLogRollupDelta) values() []interface{} {
+	values := []interface{}{
+		d.TotalRequests, d.SuccessfulRequests,
+		d.InputTokens, d.OutputTokens, d.ReasoningTokens, d.CacheCreateTokens, d.CacheReadTokens,
+		d.CacheHitRequests,
+		d.CodexCacheEnabledRequests, d.CodexCacheEligibleRequests, d.CodexCacheHitRequests,
+		d.Duration.Samples, d.Duration.Total, d.Duration.Slow,
+	}
+	for _, count := range d.Duration.Buckets {
+		values = append(values, count)
+	}
+	return values
+}
+
+// requestLogRollupUpsertSQL 生成 UPSERT 语句，bucketExpr 为 bucket_hour 的 SQL 表达式
+func requestLogRollupUpsertSQL(bucketExpr string) string {
+	columns := append([]string{"bucket_hour", "platform", "provider", "model", "http_code", "is_stream"}, requestLogRollupValueColumns...)
+	columns = append(columns, "duration_max")
+	placeholders := make([]string, 0, len(columns))
+	placeholders = append(placeholders, bucketExpr)
+	for i := 1; i < len(columns); i++ {
+		placeholders = append(placeholders, "?")
+	}
+	return fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)
+		ON CONFLICT(bucket_hour, platform, provider, model, http_code, is_stream) DO UPDATE SET %s`,
+		requestLogRollupTable,
+		strings.Join(columns, ", "),
+		strings.Join(placeholders, ", "),
+		requestLogRollupMergeClause(),
+	)
+}
+
+// requestLogRollupMergeClause 汇总行主键冲突时的累加子句
+func requestLogRollupMergeClause() string {
+	updates := make([]string, 0, len(requestLogRollupValueColumns)+1)
+	for _, column := range requestLogRollupValueColumns {
+		updates = append(updates, fmt.Sprintf("%s = %s + excluded.%s", column, column, column))
+	}
+	updates = append(updates, "duration_max = MAX(duration_max, excluded.duration_max)")
+	return strings.Join(updates, ", ")
+}
+
+func (d *requestLogRollupDelta) upsertArgs(bucket ...interface{}) []interface{} {
+	args := append([]interface{}{}, bucket...)
+	args = append(args, d.Platform, d.Provider, d.Model, d.HttpCode, boolToInt(d.IsStream))
+	args = append(args, d.values()...)
+	args = append(args, d.Duration.Max)
+	return args
+}
+
+// applyRequestLogRollups GlobalDBQueueLogs 的批量钩子：把本批次日志累加到当前小时的汇总行
+func applyRequestLogRollups(tx *sql.Tx, tasks []*WriteTask) error {
+	deltas := make([]*requestLogRollupDelta, 0, len(tasks))
+	for _, task := range tasks {
+		if delta, ok := task.Meta.(*requestLogRollupDelta); ok && delta != nil {
+			deltas = append(deltas, delta)
+		}
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	stmt := requestLogRollupUpsertSQL("strftime('%Y-%m-%d %H:00:00', 'now')")
+	for _, delta := range mergeRequestLogRollupDeltas(deltas) {
+		if _, err := tx.Exec(stmt, delta.upsertArgs()...); err != nil {
+			return fmt.Errorf("更新 %s 失败: %w", requestLogRollupTable, err)
+		}
+	}
+	return nil
+}
+
+func ensureRequestLogRollupTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return err
+	}
+
+	columnDefs := []string{
+		"bucket_hour TEXT NOT NULL",
+		"platform TEXT NOT NULL DEFAULT ''",
+		"provider TEXT NOT NULL DEFAULT ''",
+		"model TEXT NOT NULL DEFAULT ''",
+		"http_code INTEGER NOT NULL DEFAULT 0",
+		"is_stream INTEGER NOT NULL DEFAULT 0",
+	}
+	for _, column := range requestLogRollupValueColumns {
+		columnType := "INTEGER"
+		if column == "duration_sum" {
+			columnType = "REAL"
+		}
+		columnDefs = append(columnDefs, fmt.Sprintf("%s %s DEFAULT 0", column, columnType))
+	}
+	columnDefs = append(columnDefs,
+		"duration_max REAL DEFAULT 0",
+		"PRIMARY KEY (bucket_hour, platform, provider, model, http_code, is_stream)",
+	)
+	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t\t%s\n\t)", requestLogRollupTable, strings.Join(columnDefs, ",\n\t\t"))
+	if _, err := db.Exec(createSQL); err != nil {
+		return fmt.Errorf("创建 %s 表失败: %w", requestLogRollupTable, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_request_log_rollup_platform ON %s(platform, bucket_hour)`, requestLogRollupTable)); err != nil {
+		return fmt.Errorf("创建 %s 索引失败: %w", requestLogRollupTable, err)
+	}
+
+	return backfillRequestLogRollups(db)
+}
+
+// backfillRequestLogRollups 首次启用汇总表时，把已有的 request_log 一次性汇总进去
+// 在 InitDatabase 阶段执行（写入队列尚未启动），直接使用事务写入
+func backfillRequestLogRollups(db *sql.DB) error {
+	var done string
+	err := db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, requestLogRollupBackfilledKey).Scan(&done)
+	if err == nil && done == "1" {
+		return nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("读取汇总回填状态失败: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT strftime('%Y-%m-%d %H:00:00', created_at),
+			COALESCE(platform, ''), COALESCE(provider, ''), COALESCE(model, ''),
+			COALESCE(http_code, 0), COALESCE(is_stream, 0),
+			COALESCE(input_tokens, 0), COALESCE(output_tokens, 0), COALESCE(reasoning_tokens, 0),
+			COALESCE(cache_create_tokens, 0), COALESCE(cache_read_tokens, 0),
+			COALESCE(duration_sec, 0),
+			COALESCE(codex_prompt_cache_enabled, 0), COALESCE(codex_prompt_cache_eligible, 0), COALESCE(codex_prompt_cache_hit, 0)
+		FROM request_log
+		WHERE created_at IS NOT NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("读取历史日志失败: %w", err)
+	}
+
+	type bucketedKey struct {
+		bucket string
+		key    requestLogRollupKey
+	}
+	merged := map[bucketedKey]*requestLogRollupDelta{}
+	var total int64
+	for rows.Next() {
+		var bucket sql.NullString
+		var entry ReqeustLog
+		var isStream, cacheEnabled, cacheEligible, cacheHit int
+		if err := rows.Scan(
+			&bucket,
+			&entry.Platform, &entry.Provider, &entry.Model,
+			&entry.HttpCode, &isStream,
+			&entry.InputTokens, &entry.OutputTokens, &entry.ReasoningTokens,
+			&entry.CacheCreateTokens, &entry.CacheReadTokens,
+			&entry.DurationSec,
+			&cacheEnabled, &cacheEligible, &cacheHit,
+		); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取历史日志失败: %w", err)
+		}
+		if !bucket.Valid || bucket.String == "" {
+			continue
+		}
+		entry.IsStream = isStream == 1
+		entry.CodexPromptCacheEnabled = cacheEnabled == 1
+		entry.CodexPromptCacheEligible = cacheEligible == 1
+		entry.CodexPromptCacheHit = cacheHit == 1
+		delta := newRequestLogRollupDelta(&entry)
+		key := bucketedKey{bucket: bucket.String, key: delta.requestLogRollupKey}
+		if existing := merged[key]; existing != nil {
+			existing.Merge(delta)
+		} else {
+			merged[key] = delta
+		}
+		total++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取历史日志失败: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := requestLogRollupUpsertSQL("?")
+	for key, delta := range merged {
+		if _, err := tx.Exec(stmt, delta.upsertArgs(key.bucket)...); err != nil {
+			return fmt.Errorf("回填 %s 失败: %w", requestLogRollupTable, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO app_settings (key, value) VALUES (?, '1')`, requestLogRollupBackfilledKey); err != nil {
+		return fmt.Errorf("写入汇总回填状态失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if total > 0 {
+		log.Printf("[LogService] 已将 %d 条历史日志回填到 %s（%d 行）", total, requestLogRollupTable, len(merged))
+	}
+	return nil
+}
+
+// rawRequestLogsCover 判断 [start, ...) 范围内的原始日志是否完整（未被保留策略清理）
+func rawRequestLogsCover(start time.Time) bool {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return true
+	}
+	var prunedBefore string
+	if err := db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, requestLogPrunedBeforeKey).Scan(&prunedBefore); err != nil {
+		return true
+	}
+	prunedBefore = strings.TrimSpace(prunedBefore)
+	return prunedBefore == "" || storageTimestamp(start) >= prunedBefore
+}
+
+// requestLogStatsLookback 日统计额外读取的前一日原始日志（Codex 缓存可匹配分析需要前序请求）
+const requestLogStatsLookback = 24 * time.Hour
+
+// useRequestLogRollups 原始日志与汇总表的统一分界：查询实际读取的最早时间（含回看窗口）
+// 已被清理时整个窗口改用汇总表，同一窗口内不混用两种数据源，也不基于被截断的原始日志计算
+func useRequestLogRollups(start time.Time, lookback time.Duration) bool {
+	return !rawRequestLogsCover(start.Add(-lookback))
+}
+
+// markRequestLogsPrunedBefore 记录原始日志清理边界（只前进不后退）
+func markRequestLogsPrunedBefore(db *sql.DB, cutoff time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO app_settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value WHERE excluded.value > app_settings.value
+	`, requestLogPrunedBeforeKey, storageTimestamp(cutoff))
+	return err
+}
+
+// requestLogRollupRow 从汇总表读取的一行（Hour 为本地时间）
+type requestLogRollupRow struct {
+	Hour time.Time
+	requestLogRollupDelta
+}
+
+// queryRequestLogRollups 读取 [start, end) 范围内的汇总行
+func queryRequestLogRollups(start, end time.Time, platform string) ([]requestLogRollupRow, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, err
+	}
+
+	columns := append([]string{"bucket_hour", "platform", "provider", "model", "http_code", "is_stream"}, requestLogRollupValueColumns...)
+	columns = append(columns, "duration_max")
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE bucket_hour >= ? AND bucket_hour < ?`, strings.Join(columns, ", "), requestLogRollupTable)
+	args := []interface{}{storageTimestamp(start), storageTimestamp(end)}
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query += " ORDER BY bucket_hour ASC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]requestLogRollupRow, 0)
+	for rows.Next() {
+		var row requestLogRollupRow
+		var bucket string
+		var isStream int
+		d := &row.requestLogRollupDelta
+		dest := []interface{}{
+			&bucket, &d.Platform, &d.Provider, &d.Model, &d.HttpCode, &isStream,
+			&d.TotalRequests, &d.SuccessfulRequests,
+			&d.InputTokens, &d.OutputTokens, &d.ReasoningTokens, &d.CacheCreateTokens, &d.CacheReadTokens,
+			&d.CacheHitRequests,
+			&d.CodexCacheEnabledRequests, &d.CodexCacheEligibleRequests, &d.CodexCacheHitRequests,
+			&d.Duration.Samples, &d.Duration.Total, &d.Duration.Slow,
+		}
+		for i := range d.Duration.Buckets {
+			dest = append(dest, &d.Duration.Buckets[i])
+		}
+		dest = append(dest, &d.Duration.Max)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		hour, err := time.ParseInLocation(timeLayout, normalizeRollupBucket(bucket), time.UTC)
+		if err != nil {
+			continue
+		}
+		row.Hour = hour.In(time.Local)
+		d.IsStream = isStream == 1
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// normalizeRollupBucket 兼容驱动把 TEXT 时间读回为 RFC3339 的情况
+func normalizeRollupBucket(value string) string {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Format(timeLayout)
+	}
+	return value
+}
+
+// logStatsFromRollups 使用汇总表构建某一天的 LogStats（原始日志已被清理时使用）
+// Codex 缓存“可匹配”数需要逐条指纹分析，汇总表中以“符合条件”数近似
+func (ls *LogService) logStatsFromRollups(platform string, dayStart time.Time) (LogStats, error) {
+	const seriesHours = 24
+	stats := LogStats{
+		Series: make([]LogStatsSeries, seriesHours),
+	}
+	for i := 0; i < seriesHours; i++ {
+		stats.Series[i].Day = dayStart.Add(time.Duration(i) * time.Hour).Format(timeLayout)
+	}
+
+	rows, err := queryRequestLogRollups(dayStart, dayStart.Add(seriesHours*time.Hour), platform)
+	if err != nil {
+		return stats, err
+	}
+
+	rate := ls.costDisplayRate()
+	duration := &durationHistogram{}
+	for _, row := range rows {
+		index := int(row.Hour.Sub(dayStart) / time.Hour)
+		if index < 0 || index >= seriesHours {
+			continue
+		}
+		cost := ls.rollupCostUSD(&row.requestLogRollupDelta).Scale(rate)
+		bucket := &stats.Series[index]
+		bucket.TotalRequests += row.TotalRequests
+		bucket.InputTokens += row.InputTokens
+		bucket.OutputTokens += row.OutputTokens
+		bucket.ReasoningTokens += row.ReasoningTokens
+		bucket.CacheCreateTokens += row.CacheCreateTokens
+		bucket.CacheReadTokens += row.CacheReadTokens
+		bucket.TotalCost += cost.TotalCost
+
+		stats.TotalRequests += row.TotalRequests
+		stats.InputTokens += row.InputTokens
+		stats.OutputTokens += row.OutputTokens
+		stats.ReasoningTokens += row.ReasoningTokens
+		stats.CacheCreateTokens += row.CacheCreateTokens
+		stats.CacheReadTokens += row.CacheReadTokens
+		stats.CostInput += cost.InputCost
+		stats.CostOutput += cost.OutputCost
+		stats.CostCacheCreate += cost.CacheCreateCost
+		stats.CostCacheRead += cost.CacheReadCost
+		stats.CostTotal += cost.TotalCost
+		stats.CodexPromptCacheEnabledRequests += row.CodexCacheEnabledRequests
+		stats.CodexPromptCacheEligibleRequests += row.CodexCacheEligibleRequests
+		stats.CodexPromptCacheHitRequests += row.CodexCacheHitRequests
+		duration.Merge(&row.Duration)
+	}
+	stats.CodexPromptCacheMatchableRequests = stats.CodexPromptCacheEligibleRequests
+	if stats.CodexPromptCacheMatchableRequests > 0 {
+		stats.CodexPromptCacheHitRate = float64(stats.CodexPromptCacheHitRequests) / float64(stats.CodexPromptCacheMatchableRequests)
+	}
+	applyDurationStatsToLogStats(&stats, duration)
+	return stats, nil
+}
+
+// providerStatsFromRollups 使用汇总表构建 [start, end) 的供应商统计
+func (ls *LogService) providerStatsFromRollups(platform string, start, end time.Time) ([]ProviderDailyStat, error) {
+	rows, err := queryRequestLogRollups(start, end, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := ls.costDisplayRate()
+	statMap := map[string]*ProviderDailyStat{}
+	durationMap := map[string]*durationHistogram{}
+	for _, row := range rows {
+		provider := providerNameForStats(row.Provider)
+		stat := statMap[provider]
+		if stat == nil {
+			stat = &ProviderDailyStat{Provider: provider}
+			statMap[provider] = stat
+			durationMap[provider] = &durationHistogram{}
+		}
+		stat.TotalRequests += row.TotalRequests
+		stat.SuccessfulRequests += row.SuccessfulRequests
+		stat.InputTokens += row.InputTokens
+		stat.OutputTokens += row.OutputTokens
+		stat.ReasoningTokens += row.ReasoningTokens
+		stat.CacheCreateTokens += row.CacheCreateTokens
+		stat.CacheReadTokens += row.CacheReadTokens
+		stat.CostTotal += ls.rollupCostUSD(&row.requestLogRollupDelta).Scale(rate).TotalCost
+		stat.CodexPromptCacheEnabledRequests += row.CodexCacheEnabledRequests
+		stat.CodexPromptCacheEligibleRequests += row.CodexCacheEligibleRequests
+		stat.CodexPromptCacheHitRequests += row.CodexCacheHitRequests
+		durationMap[provider].Merge(&row.Duration)
+	}
+
+	stats := make([]ProviderDailyStat, 0, len(statMap))
+	for provider, stat := range statMap {
+		stat.FailedRequests = stat.TotalRequests - stat.SuccessfulRequests
+		if stat.TotalRequests > 0 {
+			stat.SuccessRate = float64(stat.SuccessfulRequests) / float64(stat.TotalRequests)
+		}
+		stat.CodexPromptCacheMatchableRequests = stat.CodexPromptCacheEligibleRequests
+		if stat.CodexPromptCacheMatchableRequests > 0 {
+			stat.CodexPromptCacheHitRate = float64(stat.CodexPromptCacheHitRequests) / float64(stat.CodexPromptCacheMatchableRequests)
+		}
+		applyDurationStatsToProviderStat(stat, durationMap[provider])
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalRequests == stats[j].TotalRequests {
+			return stats[i].Provider < stats[j].Provider
+		}
+		return stats[i].TotalRequests > stats[j].TotalRequests
+	})
+	return stats, nil
+}
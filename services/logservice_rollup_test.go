@@ -0,0 +1,78 @@
+package services
+
+import "testing"
+
+func TestDurationHistogramSummaries(t *testing.T) {
+	h := &durationHistogram{}
+	for _, value := range []float64{0, 0.5, 1.5, 4, 6, 25} {
+		h.Add(value)
+	}
+
+	if got := h.SampleCount(); got != 5 {
+		t.Fatalf("SampleCount = %d, want 5", got)
+	}
+	if got := h.SlowRequests(); got != 2 {
+		t.Fatalf("SlowRequests = %d, want 2", got)
+	}
+	if got := h.AvgSec(); got != 7.4 {
+		t.Fatalf("AvgSec = %v, want 7.4", got)
+	}
+	// 第 3 个样本落在 (3,5] 桶，返回桶上界
+	if got := h.percentile(0.5); got != 5 {
+		t.Fatalf("percentile(0.5) = %v, want 5", got)
+	}
+	// 最大样本所在桶的上界超过最大值时，返回最大值
+	if got := h.P99Sec(); got != 25 {
+		t.Fatalf("P99Sec = %v, want 25", got)
+	}
+}
+
+func TestDurationHistogramMerge(t *testing.T) {
+	a := &durationHistogram{}
+	a.Add(1)
+	b := &durationHistogram{}
+	b.Add(200)
+	a.Merge(b)
+
+	if got := a.SampleCount(); got != 2 {
+		t.Fatalf("SampleCount = %d, want 2", got)
+	}
+	if a.Max != 200 {
+		t.Fatalf("Max = %v, want 200", a.Max)
+	}
+	if got := a.Buckets[len(rollupDurationBounds)]; got != 1 {
+		t.Fatalf("overflow bucket = %d, want 1", got)
+	}
+
+	var nilHistogram *durationHistogram
+	if got := nilHistogram.SampleCount(); got != 0 {
+		t.Fatalf("nil SampleCount = %d, want 0", got)
+	}
+}
+
+func TestMergeRequestLogRollupDeltas(t *testing.T) {
+	deltas := []*requestLogRollupDelta{
+		newRequestLogRollupDelta(&ReqeustLog{Platform: "claude", Provider: "a", Model: "m", HttpCode: 200, OutputTokens: 10, DurationSec: 1}),
+		newRequestLogRollupDelta(&ReqeustLog{Platform: "claude", Provider: "a", Model: "m", HttpCode: 200, OutputTokens: 0, DurationSec: 6}),
+		newRequestLogRollupDelta(&ReqeustLog{Platform: "claude", Provider: "b", Model: "m", HttpCode: 500}),
+		nil,
+	}
+
+	merged := mergeRequestLogRollupDeltas(deltas)
+	if len(merged) != 2 {
+		t.Fatalf("len(merged) = %d, want 2", len(merged))
+	}
+	first := merged[0]
+	if first.Provider != "a" || first.TotalRequests != 2 || first.SuccessfulRequests != 1 {
+		t.Fatalf("merged[0] = %+v, want provider a with 2 requests / 1 success", first)
+	}
+	if first.OutputTokens != 10 || first.Duration.SampleCount() != 2 || first.Duration.SlowRequests() != 1 {
+		t.Fatalf("merged[0] tokens/duration mismatch: %+v", first)
+	}
+	if deltas[0].TotalRequests != 1 {
+		t.Fatalf("input delta mutated: %+v", deltas[0])
+	}
+	if got := len(first.upsertArgs("2025-01-01 00:00:00")); got != 6+len(requestLogRollupValueColumns)+1 {
+		t.Fatalf("upsert args = %d, want %d", got, 6+len(requestLogRollupValueColumns)+1)
+	}
+}
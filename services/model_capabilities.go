@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// ModelCapability 单个模型的能力声明；未声明的布尔项为 nil，视为未知（不参与过滤）
+type ModelCapability struct {
+	ContextWindow         int   `json:"contextWindow,omitempty"`   // 上下文窗口（token）
+	MaxOutputTokens       int   `json:"maxOutputTokens,omitempty"` // 单次最大输出 token
+	SupportsTools         *bool `json:"supportsTools,omitempty"`
+	SupportsImages        *bool `json:"supportsImages,omitempty"`
+	SupportsThinking      *bool `json:"supportsThinking,omitempty"` // extended thinking / reasoning
+	SupportsPromptCaching *bool `json:"supportsPromptCaching,omitempty"`
+}
+
+// requestCapabilityNeeds 从请求体推断出的能力需求
+type requestCapabilityNeeds struct {
+	Tools           bool
+	Images          bool
+	Thinking        bool
+	PromptCaching   bool
+	InputTokens     int // 粗略估算（字符数 / 4，不含图片数据）
+	MaxOutputTokens int
+}
+
+// ModelCapabilityFor 查找模型的能力声明：先按映射后的模型名，再按请求模型名；均支持通配符
+func (p *Provider) ModelCapabilityFor(requestedModel string) (ModelCapability, bool) {
+	if len(p.ModelCapabilities) == 0 || requestedModel == "" {
+		return ModelCapability{}, false
+	}
+	candidates := []string{p.GetEffectiveModel(requestedModel), requestedModel}
+	for _, model := range candidates {
+		if capability, ok := p.ModelCapabilities[model]; ok {
+			return capability, true
+		}
+	}
+
+	// 通配符按模式长度降序匹配，越具体越优先
+	for _, model := range candidates {
+		if pattern, ok := mostSpecificWildcard(p.ModelCapabilities, model); ok {
+			return p.ModelCapabilities[pattern], true
+		}
+	}
+	return ModelCapability{}, false
+}
+
+// CapabilityMismatch 返回 provider 无法处理该请求的原因；可处理或未声明能力时返回空字符串
+func (p *Provider) CapabilityMismatch(requestedModel string, needs requestCapabilityNeeds) string {
+	capability, ok := p.ModelCapabilityFor(requestedModel)
+	if !ok {
+		return ""
+	}
+	declaredFalse := func(flag *bool) bool { return flag != nil && !*flag }
+	switch {
+	case needs.Tools && declaredFalse(capability.SupportsTools):
+		return "不支持工具调用"
+	case needs.Images && declaredFalse(capability.SupportsImages):
+		return "不支持图片输入"
+	case needs.Thinking && declaredFalse(capability.SupportsThinking):
+		return "不支持 thinking / reasoning"
+	case needs.PromptCaching && declaredFalse(capability.SupportsPromptCaching):
+		return "不支持 prompt caching"
+	}
+	if capability.MaxOutputTokens > 0 && needs.MaxOutputTokens > capability.MaxOutputTokens {
+		return fmt.Sprintf("请求输出上限 %d 超过模型上限 %d", needs.MaxOutputTokens, capability.MaxOutputTokens)
+	}
+	if capability.ContextWindow > 0 && needs.InputTokens+needs.MaxOutputTokens > capability.ContextWindow {
+		return fmt.Sprintf("请求约 %d token 超过上下文窗口 %d", needs.InputTokens+needs.MaxOutputTokens, capability.ContextWindow)
+	}
+	return ""
+}
+
+// validateModelCapabilities 能力声明的数值校验
+func (p *Provider) validateModelCapabilities() []string {
+	errs := make([]string, 0)
+	models := make([]string, 0, len(p.ModelCapabilities))
+	for model := range p.ModelCapabilities {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		capability := p.ModelCapabilities[model]
+		if strings.TrimSpace(model) == "" {
+			errs = append(errs, "模型能力声明的模型名不能为空")
+			continue
+		}
+		if capability.ContextWindow < 0 || capability.MaxOutputTokens < 0 {
+			errs = append(errs, fmt.Sprintf("模型 '%s' 的上下文窗口与最大输出不能为负数", model))
+			continue
+		}
+		if capability.ContextWindow > 0 && capability.MaxOutputTokens > capability.ContextWindow {
+			errs = append(errs, fmt.Sprintf("模型 '%s' 的最大输出 %d 超过上下文窗口 %d", model, capability.MaxOutputTokens, capability.ContextWindow))
+		}
+	}
+	return errs
+}
+
+// detectRequestCapabilityNeeds 识别 Anthropic Messages / OpenAI Responses / Chat Completions 请求的能力需求
+func detectRequestCapabilityNeeds(body []byte) requestCapabilityNeeds {
+	needs := requestCapabilityNeeds{}
+	if len(body) == 0 || !gjson.ValidBytes(body) {
+		return needs
+	}
+	root := gjson.ParseBytes(body)
+
+	needs.Tools = len(root.Get("tools").Array()) > 0 || len(root.Get("functions").Array()) > 0
+	thinking := root.Get("thinking.type").String()
+	needs.Thinking = (thinking != "" && thinking != "disabled") ||
+		root.Get("reasoning.effort").Exists() || root.Get("reasoning_effort").Exists()
+	for _, path := range []string{"max_tokens", "max_output_tokens", "max_completion_tokens"} {
+		if value := root.Get(path); value.Exists() {
+			needs.MaxOutputTokens = int(value.Int())
+			break
+		}
+	}
+
+	chars := 0
+	walkRequestJSON(root, "", func(key string, value gjson.Result) {
+		switch {
+		case key == "type" && isImageContentType(value.String()):
+			needs.Images = true
+		case key == "cache_control" && value.IsObject():
+			needs.PromptCaching = true
+		case value.Type == gjson.String && !isBinaryPayload(key, value.String()):
+			chars += utf8.RuneCountInString(value.String())
+		}
+	})
+	needs.InputTokens = chars / 4
+	return needs
+}
+
+// providersDeclareCapabilities 是否有供应商声明了模型能力，全部未声明时无需推断请求的能力需求
+func providersDeclareCapabilities(providers []Provider) bool {
+	for i := range providers {
+		if len(providers[i].ModelCapabilities) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// walkRequestJSON 深度优先遍历请求体，对每个键值回调（数组元素沿用父级键名）
+func walkRequestJSON(value gjson.Result, key string, visit func(key string, value gjson.Result)) {
+	visit(key, value)
+	if value.IsObject() {
+		value.ForEach(func(childKey, child gjson.Result) bool {
+			walkRequestJSON(child, childKey.String(), visit)
+			return true
+		})
+	} else if value.IsArray() {
+		value.ForEach(func(_, child gjson.Result) bool {
+			walkRequestJSON(child, key, visit)
+			return true
+		})
+	}
+}
+
+func isImageContentType(contentType string) bool {
+	switch contentType {
+	case "image", "input_image", "image_url":
+		return true
+	}
+	return false
+}
+
+// isBinaryPayload 图片等 base64 数据不计入 token 估算
+func isBinaryPayload(key, value string) bool {
+	return key == "data" || key == "image_url" || key == "url" || strings.HasPrefix(value, "data:")
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func boolPtr(value bool) *bool { return &value }
+
+func TestModelCapabilities_RequestFiltering(t *testing.T) {
+	image := `{"model":"claude-sonnet-4","max_tokens":1024,"messages":[{"role":"user","content":[` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + strings.Repeat("A", 40000) + `"}},` +
+		`{"type":"text","text":"describe","cache_control":{"type":"ephemeral"}}]}],"thinking":{"type":"enabled","budget_tokens":512}}`
+	needs := detectRequestCapabilityNeeds([]byte(image))
+	if !needs.Images || !needs.Thinking || !needs.PromptCaching || needs.Tools || needs.MaxOutputTokens != 1024 || needs.InputTokens > 100 {
+		t.Fatalf("needs = %+v", needs)
+	}
+	responses := `{"model":"gpt-5","input":[{"role":"user","content":[{"type":"input_text","text":"` + strings.Repeat("x", 4000) + `"}]}],"tools":[{"type":"function","name":"f"}],"reasoning":{"effort":"high"}}`
+	needs = detectRequestCapabilityNeeds([]byte(responses))
+	if needs.Images || !needs.Thinking || !needs.Tools || needs.InputTokens < 1000 {
+		t.Fatalf("responses needs = %+v", needs)
+	}
+
+	provider := Provider{
+		Name:         "relay",
+		ModelMapping: map[string]string{"claude-*": "glm-4.6"},
+		ModelCapabilities: map[string]ModelCapability{
+			"glm-*":   {ContextWindow: 128000, SupportsImages: boolPtr(true)},
+			"glm-4.6": {ContextWindow: 200000, MaxOutputTokens: 8192, SupportsImages: boolPtr(false)},
+		},
+	}
+	if reason := provider.CapabilityMismatch("claude-sonnet-4", detectRequestCapabilityNeeds([]byte(image))); reason != "不支持图片输入" {
+		t.Fatalf("image reason = %q", reason)
+	}
+	if reason := provider.CapabilityMismatch("claude-sonnet-4", requestCapabilityNeeds{InputTokens: 300000}); !strings.Contains(reason, "上下文窗口 200000") {
+		t.Fatalf("context reason = %q", reason)
+	}
+	if reason := provider.CapabilityMismatch("claude-sonnet-4", requestCapabilityNeeds{MaxOutputTokens: 32000}); !strings.Contains(reason, "8192") {
+		t.Fatalf("output reason = %q", reason)
+	}
+	if reason := provider.CapabilityMismatch("glm-4.5", requestCapabilityNeeds{Images: true, Tools: true}); reason != "" {
+		t.Fatalf("wildcard capability should allow images and unknown tools, got %q", reason)
+	}
+	if reason := provider.CapabilityMismatch("other", requestCapabilityNeeds{Images: true, InputTokens: 1 << 20}); reason != "" {
+		t.Fatalf("undeclared model should not be filtered, got %q", reason)
+	}
+
+	provider.ModelCapabilities["bad"] = ModelCapability{ContextWindow: 1000, MaxOutputTokens: 2000}
+	if errs := provider.ValidateConfiguration(); len(errs) != 1 || !strings.Contains(errs[0], "bad") {
+		t.Fatalf("validation errors = %v", errs)
+	}
+}
+
+func TestHealthCheck_CapabilityChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]interface{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request json: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case req["thinking"] != nil:
+			// 静默忽略 thinking 参数的上游
+			_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"391"}]}`))
+		case req["system"] != nil:
+			_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":3,"cache_read_input_tokens":2400}}`))
+		case strings.Contains(string(body), `"type":"image"`):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"hi"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := Provider{
+		ID:                 1,
+		Name:               "caps",
+		APIURL:             server.URL,
+		APIKey:             "key",
+		AvailabilityConfig: &AvailabilityConfig{TestModel: "claude-test", CheckCapabilities: true},
+		ModelCapabilities: map[string]ModelCapability{
+			"claude-*": {SupportsImages: boolPtr(true), SupportsThinking: boolPtr(true), SupportsPromptCaching: boolPtr(true), SupportsTools: boolPtr(false)},
+		},
+	}
+
+	hcs := &HealthCheckService{}
+	result := hcs.checkProvider(context.Background(), provider, "claude")
+	if result.Status != HealthStatusValidationError {
+		t.Fatalf("status = %s (%s), want validation_failed", result.Status, result.ErrorMessage)
+	}
+	got := make([]string, 0, len(result.Checks))
+	for _, check := range result.Checks {
+		state := "fail"
+		if check.Passed {
+			state = "pass"
+		}
+		got = append(got, check.Name+"="+state)
+	}
+	if strings.Join(got, ",") != "images=fail,thinking=fail,prompt_caching=pass" {
+		t.Fatalf("checks = %v (%s)", got, result.ErrorMessage)
+	}
+}
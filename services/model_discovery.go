@@ -0,0 +1,662 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	modelDiscoveryTimeout   = 20 * time.Second
+	modelDiscoveryBodyLimit = 4 << 20
+	modelDiscoveryMaxPages  = 20
+)
+
+// 建议类型
+const (
+	ModelSuggestionSupported = "supported" // 上游原生提供该系列，加入白名单即可直通
+	ModelSuggestionMapping   = "mapping"   // 映射到上游的等价模型
+)
+
+// ModelDiscoveryService 调用供应商的模型列表接口，对比白名单并为 Claude Code 模型名推荐通配符映射
+type ModelDiscoveryService struct {
+	providerService *ProviderService
+	geminiService   *GeminiService // 可选：Gemini 供应商
+	mu              sync.Mutex
+}
+
+// DiscoveredModels 某个供应商最近一次发现的模型列表
+type DiscoveredModels struct {
+	Models       []string  `json:"models"`
+	DiscoveredAt time.Time `json:"discoveredAt"`
+}
+
+// ModelMappingSuggestion 推荐的白名单或映射项，由用户确认后应用
+type ModelMappingSuggestion struct {
+	Type    string `json:"type"`              // supported / mapping
+	Pattern string `json:"pattern"`           // Claude Code 请求的模型名模式，如 claude-sonnet-*
+	Target  string `json:"target,omitempty"`  // 映射目标（type=mapping）
+	Current string `json:"current,omitempty"` // 当前已配置的映射目标（与推荐不同时）
+	Reason  string `json:"reason"`
+}
+
+// ModelDiscoveryResult 模型发现结果与差异
+type ModelDiscoveryResult struct {
+	Platform            string                   `json:"platform"`
+	ProviderID          int64                    `json:"providerId"`
+	ProviderName        string                   `json:"providerName"`
+	GeminiProviderID    string                   `json:"geminiProviderId,omitempty"` // Gemini 供应商的原始字符串 ID
+	Models              []string                 `json:"models"`
+	DiscoveredAt        time.Time                `json:"discoveredAt"`
+	NewModels           []string                 `json:"newModels"`           // 上游提供但白名单未包含
+	MissingModels       []string                 `json:"missingModels"`       // 白名单（非通配符）中上游已不提供的模型
+	UnreachableMappings []string                 `json:"unreachableMappings"` // 映射目标不在上游列表中（"来源 -> 目标"）
+	Suggestions         []ModelMappingSuggestion `json:"suggestions"`
+}
+
+// ModelSuggestionSelection 用户确认应用的白名单与映射
+type ModelSuggestionSelection struct {
+	SupportedModels []string          `json:"supportedModels"`
+	ModelMapping    map[string]string `json:"modelMapping"`
+}
+
+// NewModelDiscoveryService 创建模型发现服务
+func NewModelDiscoveryService(ps *ProviderService, gs *GeminiService) *ModelDiscoveryService {
+	return &ModelDiscoveryService{providerService: ps, geminiService: gs}
+}
+
+// DiscoverModels 拉取供应商的模型列表并保存（带时间戳），返回与当前配置的差异和映射建议
+// Gemini 供应商使用字符串 ID，请调用 DiscoverGeminiModels
+func (mds *ModelDiscoveryService) DiscoverModels(platform string, providerID int64) (*ModelDiscoveryResult, error) {
+	provider, err := mds.findProvider(platform, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return mds.discoverModels(platform, provider)
+}
+
+// DiscoverGeminiModels 按 Gemini 供应商的字符串 ID 拉取模型列表
+func (mds *ModelDiscoveryService) DiscoverGeminiModels(providerID string) (*ModelDiscoveryResult, error) {
+	provider, err := mds.findGeminiProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := mds.discoverModels("gemini", provider)
+	if result != nil {
+		result.GeminiProviderID = providerID
+	}
+	return result, err
+}
+
+// GetDiscoveredModels 返回已保存的发现结果（基于当前配置重新计算差异）；从未发现过时返回 nil
+func (mds *ModelDiscoveryService) GetDiscoveredModels(platform string, providerID int64) (*ModelDiscoveryResult, error) {
+	provider, err := mds.findProvider(platform, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return mds.discoveredModels(platform, provider)
+}
+
+// GetDiscoveredGeminiModels 按 Gemini 供应商的字符串 ID 返回已保存的发现结果
+func (mds *ModelDiscoveryService) GetDiscoveredGeminiModels(providerID string) (*ModelDiscoveryResult, error) {
+	provider, err := mds.findGeminiProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := mds.discoveredModels("gemini", provider)
+	if result != nil {
+		result.GeminiProviderID = providerID
+	}
+	return result, err
+}
+
+func (mds *ModelDiscoveryService) discoverModels(platform string, provider Provider) (*ModelDiscoveryResult, error) {
+	if secretVaultLocked() {
+		return nil, errSecretVaultLocked
+	}
+	models, err := fetchProviderModels(platform, provider)
+	if err != nil {
+		return nil, err
+	}
+	discovered := DiscoveredModels{Models: models, DiscoveredAt: time.Now()}
+
+	mds.mu.Lock()
+	defer mds.mu.Unlock()
+	store, err := loadModelDiscoveryStore()
+	if err != nil {
+		return nil, err
+	}
+	store[modelDiscoveryKey(platform, provider.ID)] = discovered
+	if err := saveModelDiscoveryStore(store); err != nil {
+		return nil, err
+	}
+	return buildModelDiscoveryResult(platform, provider, discovered), nil
+}
+
+func (mds *ModelDiscoveryService) discoveredModels(platform string, provider Provider) (*ModelDiscoveryResult, error) {
+	mds.mu.Lock()
+	store, err := loadModelDiscoveryStore()
+	mds.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	discovered, ok := store[modelDiscoveryKey(platform, provider.ID)]
+	if !ok {
+		return nil, nil
+	}
+	return buildModelDiscoveryResult(platform, provider, discovered), nil
+}
+
+// ApplyModelSuggestions 将用户确认的白名单与映射合并进供应商配置（Gemini 供应商没有白名单，不支持）
+func (mds *ModelDiscoveryService) ApplyModelSuggestions(platform string, providerID int64, selection ModelSuggestionSelection) error {
+	if platform == "gemini" {
+		return fmt.Errorf("Gemini 供应商不支持模型白名单与映射")
+	}
+	ps := mds.providerService
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.loadProvidersRaw(platform)
+	if err != nil {
+		return fmt.Errorf("加载供应商失败: %w", err)
+	}
+	index := -1
+	for i := range providers {
+		if providers[i].ID == providerID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("未找到供应商 ID: %d", providerID)
+	}
+
+	provider := &providers[index]
+	supported := make(map[string]bool, len(provider.SupportedModels)+len(selection.SupportedModels))
+	for model, enabled := range provider.SupportedModels {
+		supported[model] = enabled
+	}
+	for _, model := range selection.SupportedModels {
+		if model = strings.TrimSpace(model); model != "" {
+			supported[model] = true
+		}
+	}
+	mapping := make(map[string]string, len(provider.ModelMapping)+len(selection.ModelMapping))
+	for from, to := range provider.ModelMapping {
+		mapping[from] = to
+	}
+	for from, to := range selection.ModelMapping {
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if from == "" || to == "" {
+			continue
+		}
+		mapping[from] = to
+		// 已启用白名单时映射目标必须在白名单中
+		if len(supported) > 0 {
+			supported[to] = true
+		}
+	}
+	if len(supported) > 0 {
+		provider.SupportedModels = supported
+	}
+	if len(mapping) > 0 {
+		provider.ModelMapping = mapping
+	}
+	if err := ps.saveProvidersLocked(platform, providers); err != nil {
+		return fmt.Errorf("保存供应商失败: %w", err)
+	}
+	return nil
+}
+
+func (mds *ModelDiscoveryService) findProvider(platform string, providerID int64) (Provider, error) {
+	if platform == "gemini" {
+		return Provider{}, fmt.Errorf("Gemini 供应商请按字符串 ID 发现模型")
+	}
+	providers, err := mds.providerService.LoadProviders(platform)
+	if err != nil {
+		return Provider{}, fmt.Errorf("加载供应商失败: %w", err)
+	}
+	for _, provider := range providers {
+		if provider.ID == providerID {
+			return provider, nil
+		}
+	}
+	return Provider{}, fmt.Errorf("未找到供应商 ID: %d", providerID)
+}
+
+// findGeminiProvider 按字符串 ID 查找 Gemini 供应商并转换为通用 Provider（ID 为内部哈希，仅用于存储键）
+func (mds *ModelDiscoveryService) findGeminiProvider(providerID string) (Provider, error) {
+	if mds.geminiService == nil {
+		return Provider{}, fmt.Errorf("Gemini 服务不可用")
+	}
+	for _, gp := range mds.geminiService.GetProviders() {
+		if gp.ID == providerID {
+			return geminiAsProvider(gp), nil
+		}
+	}
+	return Provider{}, fmt.Errorf("未找到 Gemini 供应商 ID: %s", providerID)
+}
+
+// fetchProviderModels 调用 /v1/models（Anthropic 按 after_id 分页）或 Gemini models.list（按 pageToken 分页）
+func fetchProviderModels(platform string, provider Provider) ([]string, error) {
+	if strings.TrimSpace(provider.APIURL) == "" || strings.TrimSpace(provider.APIKey) == "" {
+		return nil, fmt.Errorf("供应商 %s 缺少 API 地址或 API Key", provider.Name)
+	}
+	format := healthCheckFormat(platform)
+	endpoint := "/v1/models"
+	if format == "gemini" {
+		endpoint = "/v1beta/models"
+	}
+	client := GetHTTPClientWithTimeout(modelDiscoveryTimeout)
+
+	seen := make(map[string]bool)
+	models := make([]string, 0)
+	cursor := ""
+	for page := 0; page < modelDiscoveryMaxPages; page++ {
+		target, err := url.Parse(joinURL(provider.APIURL, endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("无效的 API 地址: %w", err)
+		}
+		query := target.Query()
+		switch {
+		case format == "gemini":
+			query.Set("pageSize", "1000")
+			if cursor != "" {
+				query.Set("pageToken", cursor)
+			}
+		case cursor != "":
+			query.Set("limit", "1000")
+			query.Set("after_id", cursor)
+		}
+		target.RawQuery = query.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("创建请求失败: %w", err)
+		}
+		setModelDiscoveryHeaders(req, provider, format)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("请求模型列表失败: %w", err)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, modelDiscoveryBodyLimit))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取模型列表失败: %w", err)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("模型列表接口返回 HTTP %d", resp.StatusCode)
+		}
+		if !gjson.ValidBytes(body) {
+			return nil, fmt.Errorf("模型列表不是有效 JSON")
+		}
+
+		pageModels, next := parseModelListPage(format, body)
+		for _, model := range pageModels {
+			if !seen[model] {
+				seen[model] = true
+				models = append(models, model)
+			}
+		}
+		if next == "" || next == cursor {
+			break
+		}
+		cursor = next
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// parseModelListPage 解析一页模型列表，返回模型 ID 与下一页游标
+// 兼容 OpenAI / Anthropic 的 data[].id 与 Gemini 的 models[].name（去掉 models/ 前缀，只保留支持 generateContent 的模型）
+func parseModelListPage(format string, body []byte) ([]string, string) {
+	root := gjson.ParseBytes(body)
+	models := make([]string, 0)
+	for _, item := range root.Get("data").Array() {
+		id := strings.TrimSpace(item.Get("id").String())
+		if id == "" {
+			id = strings.TrimSpace(item.Get("name").String())
+		}
+		if id != "" {
+			models = append(models, id)
+		}
+	}
+	for _, item := range root.Get("models").Array() {
+		if methods := item.Get("supportedGenerationMethods"); methods.Exists() {
+			generates := false
+			for _, method := range methods.Array() {
+				if method.String() == "generateContent" {
+					generates = true
+					break
+				}
+			}
+			if !generates {
+				continue
+			}
+		}
+		name := strings.TrimPrefix(strings.TrimSpace(item.Get("name").String()), "models/")
+		if name != "" {
+			models = append(models, name)
+		}
+	}
+
+	if format == "gemini" {
+		return models, root.Get("nextPageToken").String()
+	}
+	if root.Get("has_more").Bool() {
+		return models, root.Get("last_id").String()
+	}
+	return models, ""
+}
+
+// setModelDiscoveryHeaders 设置认证头（与健康检查一致：claude 默认 x-api-key，gemini 默认 x-goog-api-key，其余 bearer）
+func setModelDiscoveryHeaders(req *http.Request, provider Provider, format string) {
+	req.Header.Set("Accept", "application/json")
+	if ua := strings.TrimSpace(GetDefaultUserAgent()); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	authType := strings.TrimSpace(provider.ConnectivityAuthType)
+	if authType == "" {
+		switch format {
+		case "claude":
+			authType = "x-api-key"
+		case "gemini":
+			authType = "x-goog-api-key"
+		default:
+			authType = "bearer"
+		}
+	}
+	switch strings.ToLower(authType) {
+	case "x-api-key":
+		req.Header.Set("x-api-key", provider.APIKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+provider.APIKey)
+	case "custom":
+		req.Header.Set("Authorization", provider.APIKey)
+	default:
+		req.Header.Set(authType, provider.APIKey)
+	}
+}
+
+// buildModelDiscoveryResult 对比发现结果与当前白名单 / 映射，并生成建议
+func buildModelDiscoveryResult(platform string, provider Provider, discovered DiscoveredModels) *ModelDiscoveryResult {
+	result := &ModelDiscoveryResult{
+		Platform:            platform,
+		ProviderID:          provider.ID,
+		ProviderName:        provider.Name,
+		Models:              discovered.Models,
+		DiscoveredAt:        discovered.DiscoveredAt,
+		NewModels:           []string{},
+		MissingModels:       []string{},
+		UnreachableMappings: []string{},
+		Suggestions:         []ModelMappingSuggestion{},
+	}
+	upstream := make(map[string]bool, len(discovered.Models))
+	for _, model := range discovered.Models {
+		upstream[model] = true
+	}
+
+	for _, model := range discovered.Models {
+		if len(provider.SupportedModels) > 0 && !modelInWhitelist(provider.SupportedModels, model) {
+			result.NewModels = append(result.NewModels, model)
+		}
+	}
+	for model := range provider.SupportedModels {
+		if !strings.Contains(model, "*") && !upstream[model] {
+			result.MissingModels = append(result.MissingModels, model)
+		}
+	}
+	sort.Strings(result.MissingModels)
+	result.UnreachableMappings = unreachableModelMappings(provider, discovered.Models)
+
+	// 仅 Anthropic 格式（claude 与自定义 CLI）会收到 Claude Code 的模型名
+	if healthCheckFormat(platform) == "claude" {
+		result.Suggestions = suggestClaudeModelMappings(provider, discovered.Models)
+	}
+	return result
+}
+
+// modelInWhitelist 模型是否在白名单中（精确或通配符），不考虑映射
+func modelInWhitelist(supported map[string]bool, model string) bool {
+	if supported[model] {
+		return true
+	}
+	for pattern := range supported {
+		if matchWildcard(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// unreachableModelMappings 映射目标（非通配符）不在上游模型列表中的条目
+func unreachableModelMappings(provider Provider, models []string) []string {
+	upstream := make(map[string]bool, len(models))
+	for _, model := range models {
+		upstream[model] = true
+	}
+	unreachable := make([]string, 0)
+	for from, to := range provider.ModelMapping {
+		if !strings.Contains(to, "*") && !upstream[to] {
+			unreachable = append(unreachable, from+" -> "+to)
+		}
+	}
+	sort.Strings(unreachable)
+	return unreachable
+}
+
+// claudeModelFamilies Claude Code 使用的模型系列及其请求名模式；keywords 用于在非 Claude 上游中挑选同档位模型
+var claudeModelFamilies = []struct {
+	family   string
+	patterns []string
+	keywords []string
+}{
+	{family: "opus", patterns: []string{"claude-opus-*"}, keywords: []string{"opus", "max", "ultra", "pro", "plus", "large"}},
+	{family: "sonnet", patterns: []string{"claude-sonnet-*"}, keywords: []string{"sonnet", "coder", "chat", "turbo", "medium"}},
+	{family: "haiku", patterns: []string{"claude-haiku-*", "claude-3-5-haiku-*"}, keywords: []string{"haiku", "flash", "mini", "lite", "air", "small", "nano", "fast"}},
+}
+
+// nonChatModelMarkers 嵌入、语音、图片等非对话模型不参与推荐
+var nonChatModelMarkers = []string{"embed", "whisper", "tts", "audio", "dall-e", "image", "moderation", "rerank"}
+
+// suggestClaudeModelMappings 为 Claude Code 的 opus / sonnet / haiku 请求名推荐白名单或映射
+// 上游原生提供该系列时建议加入白名单直通；否则按档位关键词挑选版本号最新的等价模型
+func suggestClaudeModelMappings(provider Provider, models []string) []ModelMappingSuggestion {
+	chatModels := make([]string, 0, len(models))
+	for _, model := range models {
+		lower := strings.ToLower(model)
+		nonChat := false
+		for _, marker := range nonChatModelMarkers {
+			if strings.Contains(lower, marker) {
+				nonChat = true
+				break
+			}
+		}
+		if !nonChat {
+			chatModels = append(chatModels, model)
+		}
+	}
+	if len(chatModels) == 0 {
+		return []ModelMappingSuggestion{}
+	}
+	// 按自然顺序降序排列：同关键词下版本号较新的模型排在前面（x-10 排在 x-9 之前）
+	sort.SliceStable(chatModels, func(i, j int) bool {
+		return naturalLess(chatModels[j], chatModels[i])
+	})
+
+	picks := make(map[string]string, len(claudeModelFamilies))
+	for _, family := range claudeModelFamilies {
+		picks[family.family] = pickModelByKeywords(chatModels, family.keywords)
+	}
+	// 找不到同档位模型时退回 sonnet 档（再退回列表中的第一个模型）
+	if picks["sonnet"] == "" {
+		picks["sonnet"] = chatModels[0]
+	}
+	for _, family := range []string{"opus", "haiku"} {
+		if picks[family] == "" {
+			picks[family] = picks["sonnet"]
+		}
+	}
+
+	suggestions := make([]ModelMappingSuggestion, 0)
+	for _, family := range claudeModelFamilies {
+		for _, pattern := range family.patterns {
+			native := ""
+			for _, model := range chatModels {
+				if matchWildcard(pattern, model) {
+					native = model
+					break
+				}
+			}
+			if native != "" {
+				reason := fmt.Sprintf("上游原生提供 %s 系列模型（如 %s）", family.family, native)
+				switch effective := provider.GetEffectiveModel(native); {
+				case effective != native:
+					// 被更宽泛的映射截走时，用同名通配映射直通
+					suggestions = append(suggestions, ModelMappingSuggestion{
+						Type:    ModelSuggestionMapping,
+						Pattern: pattern,
+						Target:  pattern,
+						Current: effective,
+						Reason:  reason + "，建议直通",
+					})
+				case !provider.IsModelSupported(native):
+					suggestions = append(suggestions, ModelMappingSuggestion{
+						Type:    ModelSuggestionSupported,
+						Pattern: pattern,
+						Reason:  reason + "，建议加入白名单",
+					})
+				}
+				continue
+			}
+
+			// 用一个示例请求名判断当前配置（含更宽泛的通配符映射）会映射到哪里
+			sample := strings.Replace(pattern, "*", "20250101", 1)
+			current := ""
+			if provider.IsModelSupported(sample) && provider.GetEffectiveModel(sample) != sample {
+				current = provider.GetEffectiveModel(sample)
+			}
+			if current == picks[family.family] {
+				continue
+			}
+			suggestions = append(suggestions, ModelMappingSuggestion{
+				Type:    ModelSuggestionMapping,
+				Pattern: pattern,
+				Target:  picks[family.family],
+				Current: current,
+				Reason:  fmt.Sprintf("上游没有匹配 %s 的模型，推荐 %s 档位的 %s", pattern, family.family, picks[family.family]),
+			})
+		}
+	}
+	return suggestions
+}
+
+// pickModelByKeywords 按关键词优先级挑选第一个名称片段命中的模型（models 已按名称降序）
+// 按 - _ . : / 切分后整段比较，避免 gemini 误命中 mini
+func pickModelByKeywords(models []string, keywords []string) string {
+	for _, keyword := range keywords {
+		for _, model := range models {
+			segments := strings.FieldsFunc(strings.ToLower(model), func(r rune) bool {
+				return strings.ContainsRune("-_.:/ ", r)
+			})
+			for _, segment := range segments {
+				if segment == keyword {
+					return model
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// naturalLess 自然顺序比较：连续数字按数值比较，其余按字节比较；数值相同（如 01 与 1）时退回字符串比较
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isASCIIDigit(a[i]) && isASCIIDigit(b[j]) {
+			startA, startB := i, j
+			for i < len(a) && isASCIIDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isASCIIDigit(b[j]) {
+				j++
+			}
+			numA := strings.TrimLeft(a[startA:i], "0")
+			numB := strings.TrimLeft(b[startB:j], "0")
+			if len(numA) != len(numB) {
+				return len(numA) < len(numB)
+			}
+			if numA != numB {
+				return numA < numB
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func modelDiscoveryKey(platform string, providerID int64) string {
+	return fmt.Sprintf("%s/%d", platform, providerID)
+}
+
+func modelDiscoveryPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "model-discovery.json"), nil
+}
+
+// loadModelDiscoveryStore 读取发现结果（key: platform/providerID）
+func loadModelDiscoveryStore() (map[string]DiscoveredModels, error) {
+	store := make(map[string]DiscoveredModels)
+	path, err := modelDiscoveryPath()
+	if err != nil {
+		return store, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return store, fmt.Errorf("读取模型发现结果失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return store, fmt.Errorf("解析模型发现结果失败: %w", err)
+	}
+	return store, nil
+}
+
+func saveModelDiscoveryStore(store map[string]DiscoveredModels) error {
+	path, err := modelDiscoveryPath()
+	if err != nil {
+		return err
+	}
+	if err := AtomicWriteJSON(path, store); err != nil {
+		return fmt.Errorf("保存模型发现结果失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModelDiscovery_DiscoverSuggestAndApply(t *testing.T) {
+	isolateHomeDir(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("x-api-key") != "sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Anthropic 风格分页
+		if r.URL.Query().Get("after_id") == "" {
+			_, _ = w.Write([]byte(`{"data":[{"id":"glm-4.5"},{"id":"glm-4.5-air"},{"id":"text-embedding-3"}],"has_more":true,"last_id":"text-embedding-3"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[{"id":"glm-4.6"},{"id":"claude-haiku-4-5"}],"has_more":false}`))
+	}))
+	defer server.Close()
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{
+		ID:              1,
+		Name:            "glm",
+		APIURL:          server.URL,
+		APIKey:          "sk-test",
+		SupportedModels: map[string]bool{"glm-4.5": true, "glm-4.0": true},
+		ModelMapping:    map[string]string{"claude-*": "glm-4.5"},
+	}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+	mds := NewModelDiscoveryService(ps, nil)
+
+	if cached, err := mds.GetDiscoveredModels("claude", 1); err != nil || cached != nil {
+		t.Fatalf("cached before discovery = %+v, %v", cached, err)
+	}
+	result, err := mds.DiscoverModels("claude", 1)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if strings.Join(result.Models, ",") != "claude-haiku-4-5,glm-4.5,glm-4.5-air,glm-4.6,text-embedding-3" || result.DiscoveredAt.IsZero() {
+		t.Fatalf("models = %v", result.Models)
+	}
+	if strings.Join(result.NewModels, ",") != "claude-haiku-4-5,glm-4.5-air,glm-4.6,text-embedding-3" ||
+		strings.Join(result.MissingModels, ",") != "glm-4.0" || len(result.UnreachableMappings) != 0 {
+		t.Fatalf("diff = %+v", result)
+	}
+
+	suggestions := make([]string, 0)
+	for _, s := range result.Suggestions {
+		suggestions = append(suggestions, s.Type+":"+s.Pattern+"->"+s.Target+"("+s.Current+")")
+	}
+	want := "mapping:claude-opus-*->glm-4.6(glm-4.5),mapping:claude-sonnet-*->glm-4.6(glm-4.5),mapping:claude-haiku-*->claude-haiku-*(glm-4.5),mapping:claude-3-5-haiku-*->claude-haiku-4-5(glm-4.5)"
+	if strings.Join(suggestions, ",") != want {
+		t.Fatalf("suggestions = %v", suggestions)
+	}
+
+	if err := mds.ApplyModelSuggestions("claude", 1, ModelSuggestionSelection{
+		SupportedModels: []string{"claude-haiku-*"},
+		ModelMapping:    map[string]string{"claude-sonnet-*": "glm-4.6"},
+	}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	providers, _ := ps.LoadProviders("claude")
+	p := providers[0]
+	if !p.SupportedModels["glm-4.6"] || !p.SupportedModels["claude-haiku-*"] || p.ModelMapping["claude-sonnet-*"] != "glm-4.6" {
+		t.Fatalf("provider after apply = %+v", p)
+	}
+	// 更具体的通配映射优先于 claude-*
+	if got := p.GetEffectiveModel("claude-sonnet-4-5"); got != "glm-4.6" {
+		t.Fatalf("effective model = %q", got)
+	}
+
+	// 已保存的结果按当前配置重新计算差异
+	cached, err := mds.GetDiscoveredModels("claude", 1)
+	if err != nil || cached == nil || strings.Contains(strings.Join(cached.NewModels, ","), "glm-4.6") {
+		t.Fatalf("cached = %+v, %v", cached, err)
+	}
+}
+
+func TestModelDiscovery_ParseGeminiModelList(t *testing.T) {
+	body := `{"models":[
+		{"name":"models/gemini-2.5-pro","supportedGenerationMethods":["generateContent","countTokens"]},
+		{"name":"models/text-embedding-004","supportedGenerationMethods":["embedContent"]}
+	],"nextPageToken":"p2"}`
+	models, next := parseModelListPage("gemini", []byte(body))
+	if strings.Join(models, ",") != "gemini-2.5-pro" || next != "p2" {
+		t.Fatalf("models = %v, next = %q", models, next)
+	}
+
+	// gemini 不应被 haiku 档的 mini 关键词误命中
+	if pick := pickModelByKeywords([]string{"gemini-2.5-pro"}, []string{"haiku", "mini"}); pick != "" {
+		t.Fatalf("pick = %q", pick)
+	}
+}
+
+func TestModelDiscovery_GeminiByStringIDAndNaturalOrder(t *testing.T) {
+	isolateHomeDir(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"models":[{"name":"models/gemini-2.5-pro"},{"name":"models/gemini-2.5-flash"}]}`))
+	}))
+	defer server.Close()
+
+	gs := NewGeminiService("127.0.0.1:18100")
+	if err := gs.AddProvider(GeminiProvider{ID: "team-gemini", Name: "Team", BaseURL: server.URL, APIKey: "gm-key"}); err != nil {
+		t.Fatalf("add gemini provider: %v", err)
+	}
+	mds := NewModelDiscoveryService(NewProviderService(), gs)
+
+	result, err := mds.DiscoverGeminiModels("team-gemini")
+	if err != nil {
+		t.Fatalf("discover gemini: %v", err)
+	}
+	if result.GeminiProviderID != "team-gemini" || strings.Join(result.Models, ",") != "gemini-2.5-flash,gemini-2.5-pro" {
+		t.Fatalf("result = %+v", result)
+	}
+	if cached, err := mds.GetDiscoveredGeminiModels("team-gemini"); err != nil || cached == nil || len(cached.Models) != 2 {
+		t.Fatalf("cached gemini = %+v, %v", cached, err)
+	}
+	if _, err := mds.DiscoverModels("gemini", geminiProviderID("team-gemini")); err == nil {
+		t.Fatal("numeric gemini IDs should be rejected")
+	}
+
+	// 版本号按数值比较：x-10 比 x-9 新
+	suggestions := suggestClaudeModelMappings(Provider{}, []string{"relay-9", "relay-10", "relay-2"})
+	if len(suggestions) == 0 || suggestions[0].Target != "relay-10" {
+		t.Fatalf("suggestions = %+v, want relay-10 first", suggestions)
+	}
+	if !naturalLess("glm-4.5", "glm-4.5-air") || !naturalLess("x-9", "x-10") || naturalLess("x-10", "x-9") {
+		t.Fatal("naturalLess ordering mismatch")
+	}
+}
@@ -197,3 +197,66 @@ func (ns *NotificationService) emitBlacklistEvent(platform, providerName string,
 		"timestamp":       time.Now().UnixMilli(),
 	})
 }
+
+// NotifyBudgetAlert 发送预算预警 / 超限通知
+// 前端事件始终发送，系统通知受通知开关控制
+func (ns *NotificationService) NotifyBudgetAlert(alert BudgetAlert) {
+	ns.emitBudgetEvent(alert)
+	if !ns.isEnabled() {
+		return
+	}
+
+	go func() {
+		title := "Code Switch"
+		name := alert.RuleName
+		if name == "" {
+			name = alert.RuleID
+		}
+		body := fmt.Sprintf("预算 %s 已用 %.0f%%（$%.2f / $%.2f）", name, alert.Percent, alert.SpentUSD, alert.LimitUSD)
+		if alert.State == BudgetStateExceeded {
+			body = fmt.Sprintf("预算 %s 已超出上限（$%.2f / $%.2f）", name, alert.SpentUSD, alert.LimitUSD)
+		}
+
+		if err := beeep.Notify(title, body, ns.iconPath); err != nil {
+			log.Printf("[Notification] 发送预算通知失败: %v", err)
+		} else {
+			log.Printf("[Notification] 已发送预算通知: %s (%s)", name, alert.State)
+		}
+	}()
+}
+
+// emitBudgetEvent 发送预算事件到前端
+func (ns *NotificationService) emitBudgetEvent(alert BudgetAlert) {
+	if ns.app == nil {
+		return
+	}
+	ns.app.Event.Emit("budget:alert", map[string]interface{}{
+		"ruleId":    alert.RuleID,
+		"ruleName":  alert.RuleName,
+		"scope":     alert.Scope,
+		"platform":  alert.Platform,
+		"provider":  alert.Provider,
+		"period":    alert.Period,
+		"state":     alert.State,
+		"action":    alert.Action,
+		"spentUsd":  alert.SpentUSD,
+		"limitUsd":  alert.LimitUSD,
+		"percent":   alert.Percent,
+		"timestamp": time.Now().UnixMilli(),
+	})
+}
+
+// NotifyCircuitStateChanged 发送熔断状态切换事件到前端（closed / open / half_open），model 为空表示整个 provider
+func (ns *NotificationService) NotifyCircuitStateChanged(platform, providerName, model, from, to string) {
+	if ns.app == nil {
+		return
+	}
+	ns.app.Event.Emit("provider:circuit", map[string]interface{}{
+		"platform":     platform,
+		"providerName": providerName,
+		"model":        model,
+		"from":         from,
+		"to":           to,
+		"timestamp":    time.Now().UnixMilli(),
+	})
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// 被动健康评分：基于真实转发结果（无额外 token 消耗），仅保存在内存中
+const (
+	passiveHealthWindow     = 15 * time.Minute // 统计窗口
+	passiveHealthMaxSamples = 500              // 每个 provider 最多保留的样本数
+	passiveHealthMinSamples = 5                // 样本不足时不给出状态
+)
+
+// PassiveOutcome 一次真实转发的结果（客户端中断不应上报）
+type PassiveOutcome struct {
+	Platform          string
+	ProviderName      string
+	Success           bool
+	Latency           time.Duration // 整个请求耗时
+	FirstTokenLatency time.Duration // 流式首包耗时，0 表示未知
+	ZeroTokens        bool          // 2xx 但 output_tokens=0
+	At                time.Time
+}
+
+// PassiveHealthRecorder 转发结果上报函数（由 HealthCheckService.RecordPassiveOutcome 实现）
+type PassiveHealthRecorder func(outcome PassiveOutcome)
+
+// PassiveHealthScore 被动健康评分
+type PassiveHealthScore struct {
+	Platform        string     `json:"platform"`
+	ProviderName    string     `json:"providerName"`
+	Samples         int        `json:"samples"`
+	SuccessRate     float64    `json:"successRate"`   // 百分比
+	P95LatencyMs    int        `json:"p95LatencyMs"`  // 请求耗时 p95
+	AvgTTFTMs       int        `json:"avgTtftMs"`     // 流式首包平均耗时（无流式样本时为 0）
+	ZeroTokenRate   float64    `json:"zeroTokenRate"` // 百分比
+	Score           float64    `json:"score"`         // 0-100
+	Status          string     `json:"status"`        // operational/degraded/failed，样本不足时为空
+	LastSuccessAt   *time.Time `json:"lastSuccessAt,omitempty"`
+	WindowStartedAt time.Time  `json:"windowStartedAt"`
+}
+
+// RecordPassiveOutcome 记录一次真实转发结果
+func (hcs *HealthCheckService) RecordPassiveOutcome(outcome PassiveOutcome) {
+	if hcs == nil || outcome.ProviderName == "" {
+		return
+	}
+	if outcome.At.IsZero() {
+		outcome.At = time.Now()
+	}
+	key := outcome.Platform + ":" + outcome.ProviderName
+
+	hcs.passiveMu.Lock()
+	defer hcs.passiveMu.Unlock()
+	if hcs.passiveSamples == nil {
+		hcs.passiveSamples = make(map[string][]PassiveOutcome)
+	}
+	samples := prunePassiveSamples(hcs.passiveSamples[key], outcome.At)
+	samples = append(samples, outcome)
+	if len(samples) > passiveHealthMaxSamples {
+		samples = samples[len(samples)-passiveHealthMaxSamples:]
+	}
+	hcs.passiveSamples[key] = samples
+}
+
+// GetPassiveHealth 获取单个 provider 的被动健康评分
+func (hcs *HealthCheckService) GetPassiveHealth(platform, providerName string) *PassiveHealthScore {
+	now := time.Now()
+	hcs.passiveMu.Lock()
+	samples := prunePassiveSamples(hcs.passiveSamples[platform+":"+providerName], now)
+	if hcs.passiveSamples != nil {
+		hcs.passiveSamples[platform+":"+providerName] = samples
+	}
+	snapshot := append([]PassiveOutcome(nil), samples...)
+	hcs.passiveMu.Unlock()
+
+	score := summarizePassiveHealth(snapshot, hcs.operationalThresholdMs())
+	score.Platform = platform
+	score.ProviderName = providerName
+	score.WindowStartedAt = now.Add(-passiveHealthWindow)
+	return &score
+}
+
+// passiveProbeEndpoint 由真实流量合成的检测记录的 endpoint 标记
+const passiveProbeEndpoint = "passive"
+
+// passiveProbeResult 近期有成功的真实流量时，用被动评分合成一条检测结果代替主动探测
+// （availability_passive_skip_seconds，0 表示不跳过）；返回 nil 表示仍需主动探测
+func (hcs *HealthCheckService) passiveProbeResult(platform string, provider *Provider) *HealthCheckResult {
+	if hcs.settingsService == nil {
+		return nil
+	}
+	skipSeconds := hcs.settingsService.GetIntSetting("availability_passive_skip_seconds")
+	if skipSeconds <= 0 {
+		return nil
+	}
+	result := passiveHealthResult(provider, platform, hcs.GetPassiveHealth(platform, provider.Name), time.Duration(skipSeconds)*time.Second, time.Now())
+	if result != nil {
+		log.Printf("[HealthCheck] %s/%s 最近 %ds 内有成功的真实请求，跳过主动探测", platform, provider.Name, skipSeconds)
+	}
+	return result
+}
+
+// passiveHealthResult 被动评分在 skipWindow 内有成功请求且未判定故障时，合成对应的检测结果
+func passiveHealthResult(provider *Provider, platform string, score *PassiveHealthScore, skipWindow time.Duration, now time.Time) *HealthCheckResult {
+	if score == nil || score.LastSuccessAt == nil || score.Status == HealthStatusFailed {
+		return nil
+	}
+	if now.Sub(*score.LastSuccessAt) > skipWindow {
+		return nil
+	}
+	status := score.Status
+	if status == "" {
+		status = HealthStatusOperational
+	}
+	return &HealthCheckResult{
+		ProviderID:   provider.ID,
+		ProviderName: provider.Name,
+		Platform:     platform,
+		Endpoint:     passiveProbeEndpoint,
+		Status:       status,
+		LatencyMs:    score.P95LatencyMs,
+		CheckedAt:    now,
+	}
+}
+
+// mergePassiveTimeline 把被动评分合并进时间线：没有主动检测记录时用被动状态作为最新状态，
+// 真实流量表现比最近一次主动检测更差时以被动状态为准
+func mergePassiveTimeline(timeline *ProviderTimeline, passive *PassiveHealthScore, now time.Time) {
+	if passive == nil || passive.Samples == 0 {
+		return
+	}
+	timeline.Passive = passive
+	if passive.Status == "" {
+		return
+	}
+
+	reason := fmt.Sprintf("真实流量成功率 %.1f%%（%d 次请求）", passive.SuccessRate, passive.Samples)
+	if timeline.Latest == nil {
+		timeline.Latest = &HealthCheckResult{
+			ProviderID:   timeline.ProviderID,
+			ProviderName: timeline.ProviderName,
+			Platform:     timeline.Platform,
+			Endpoint:     passiveProbeEndpoint,
+			Status:       passive.Status,
+			LatencyMs:    passive.P95LatencyMs,
+			CheckedAt:    now,
+		}
+		if passive.Status != HealthStatusOperational {
+			timeline.Latest.ErrorMessage = reason
+		}
+		timeline.Uptime = passive.SuccessRate
+		timeline.AvgLatencyMs = passive.P95LatencyMs
+		return
+	}
+	if healthStatusSeverity(passive.Status) > healthStatusSeverity(timeline.Latest.Status) {
+		latest := *timeline.Latest
+		latest.Status = passive.Status
+		latest.ErrorMessage = reason
+		timeline.Latest = &latest
+	}
+}
+
+// healthStatusSeverity 状态严重程度：正常 < 延迟 < 故障
+func healthStatusSeverity(status string) int {
+	switch status {
+	case HealthStatusOperational:
+		return 0
+	case HealthStatusDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// operationalThresholdMs 正常/延迟的分界阈值（与主动检测一致）
+func (hcs *HealthCheckService) operationalThresholdMs() int {
+	if hcs.settingsService != nil {
+		if threshold := hcs.settingsService.GetIntSetting("availability_operational_threshold_ms"); threshold > 0 {
+			return threshold
+		}
+	}
+	return DefaultOperationalThresholdMs
+}
+
+func prunePassiveSamples(samples []PassiveOutcome, now time.Time) []PassiveOutcome {
+	cutoff := now.Add(-passiveHealthWindow)
+	idx := 0
+	for idx < len(samples) && samples[idx].At.Before(cutoff) {
+		idx++
+	}
+	if idx == 0 {
+		return samples
+	}
+	return append(samples[:0], samples[idx:]...)
+}
+
+// summarizePassiveHealth 计算评分：成功率为基础，零 token 与 p95 超阈值各自扣分
+func summarizePassiveHealth(samples []PassiveOutcome, operationalThresholdMs int) PassiveHealthScore {
+	score := PassiveHealthScore{Samples: len(samples)}
+	if len(samples) == 0 {
+		return score
+	}
+
+	var successCount, zeroCount, ttftCount int
+	var ttftTotal time.Duration
+	latencies := make([]int, 0, len(samples))
+	for i := range samples {
+		sample := &samples[i]
+		if sample.Success {
+			successCount++
+			at := sample.At
+			score.LastSuccessAt = &at
+		}
+		if sample.ZeroTokens {
+			zeroCount++
+		}
+		if sample.FirstTokenLatency > 0 {
+			ttftCount++
+			ttftTotal += sample.FirstTokenLatency
+		}
+		latencies = append(latencies, int(sample.Latency.Milliseconds()))
+	}
+	sort.Ints(latencies)
+
+	score.SuccessRate = float64(successCount) * 100 / float64(len(samples))
+	score.ZeroTokenRate = float64(zeroCount) * 100 / float64(len(samples))
+	score.P95LatencyMs = latencies[(len(latencies)*95+99)/100-1]
+	if ttftCount > 0 {
+		score.AvgTTFTMs = int((ttftTotal / time.Duration(ttftCount)).Milliseconds())
+	}
+
+	score.Score = score.SuccessRate - score.ZeroTokenRate/2
+	if operationalThresholdMs > 0 && score.P95LatencyMs > operationalThresholdMs {
+		score.Score -= 10
+	}
+	if score.Score < 0 {
+		score.Score = 0
+	}
+
+	if len(samples) < passiveHealthMinSamples {
+		return score
+	}
+	switch {
+	case score.SuccessRate >= 95 && (operationalThresholdMs <= 0 || score.P95LatencyMs <= operationalThresholdMs):
+		score.Status = HealthStatusOperational
+	case score.SuccessRate >= 80:
+		score.Status = HealthStatusDegraded
+	default:
+		score.Status = HealthStatusFailed
+	}
+	return score
+}
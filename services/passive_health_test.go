@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizePassiveHealth(t *testing.T) {
+	now := time.Now()
+	samples := make([]PassiveOutcome, 0, 20)
+	for i := 0; i < 20; i++ {
+		samples = append(samples, PassiveOutcome{
+			Success:           i != 0,
+			Latency:           time.Duration(i+1) * 100 * time.Millisecond,
+			FirstTokenLatency: 50 * time.Millisecond,
+			ZeroTokens:        i == 0,
+			At:                now,
+		})
+	}
+
+	score := summarizePassiveHealth(samples, DefaultOperationalThresholdMs)
+	if score.SuccessRate != 95 {
+		t.Fatalf("SuccessRate = %v, want 95", score.SuccessRate)
+	}
+	if score.ZeroTokenRate != 5 {
+		t.Fatalf("ZeroTokenRate = %v, want 5", score.ZeroTokenRate)
+	}
+	if score.P95LatencyMs != 1900 {
+		t.Fatalf("P95LatencyMs = %d, want 1900", score.P95LatencyMs)
+	}
+	if score.AvgTTFTMs != 50 {
+		t.Fatalf("AvgTTFTMs = %d, want 50", score.AvgTTFTMs)
+	}
+	if score.Status != HealthStatusOperational {
+		t.Fatalf("Status = %s, want operational", score.Status)
+	}
+
+	if few := summarizePassiveHealth(samples[:2], DefaultOperationalThresholdMs); few.Status != "" {
+		t.Fatalf("status with too few samples = %s, want empty", few.Status)
+	}
+}
+
+func TestPassiveHealthWindow(t *testing.T) {
+	hcs := &HealthCheckService{}
+	hcs.RecordPassiveOutcome(PassiveOutcome{Platform: "claude", ProviderName: "p", Success: true, At: time.Now().Add(-passiveHealthWindow - time.Minute)})
+	hcs.RecordPassiveOutcome(PassiveOutcome{Platform: "claude", ProviderName: "p", Success: false})
+
+	score := hcs.GetPassiveHealth("claude", "p")
+	if score.Samples != 1 {
+		t.Fatalf("Samples = %d, want 1 (expired sample pruned)", score.Samples)
+	}
+	if score.LastSuccessAt != nil {
+		t.Fatal("LastSuccessAt should be nil after the successful sample expired")
+	}
+}
+
+func TestPassiveHealthResultAndTimelineMerge(t *testing.T) {
+	now := time.Now()
+	provider := &Provider{ID: 7, Name: "p"}
+	recent := now.Add(-10 * time.Second)
+	score := &PassiveHealthScore{Samples: 10, SuccessRate: 100, P95LatencyMs: 800, Status: HealthStatusOperational, LastSuccessAt: &recent}
+
+	result := passiveHealthResult(provider, "claude", score, time.Minute, now)
+	if result == nil || result.Status != HealthStatusOperational || result.Endpoint != passiveProbeEndpoint || result.LatencyMs != 800 || result.ProviderID != 7 {
+		t.Fatalf("synthetic result = %+v, want operational passive result", result)
+	}
+	if stale := passiveHealthResult(provider, "claude", score, 5*time.Second, now); stale != nil {
+		t.Fatalf("success outside the skip window should not replace the probe: %+v", stale)
+	}
+
+	// 没有主动检测记录时以被动状态作为最新状态
+	timeline := ProviderTimeline{ProviderID: 7, ProviderName: "p", Platform: "claude"}
+	mergePassiveTimeline(&timeline, score, now)
+	if timeline.Latest == nil || timeline.Latest.Status != HealthStatusOperational || timeline.Uptime != 100 {
+		t.Fatalf("timeline = %+v, want passive latest with 100%% uptime", timeline)
+	}
+
+	// 真实流量比主动检测更差时以被动状态为准，且不修改历史记录本身
+	active := &HealthCheckResult{Status: HealthStatusOperational, CheckedAt: now}
+	timeline = ProviderTimeline{Latest: active, Items: []HealthCheckResult{*active}}
+	failing := &PassiveHealthScore{Samples: 10, SuccessRate: 50, Status: HealthStatusFailed}
+	mergePassiveTimeline(&timeline, failing, now)
+	if timeline.Latest.Status != HealthStatusFailed || active.Status != HealthStatusOperational || timeline.Passive != failing {
+		t.Fatalf("timeline latest = %+v, want failed overlay without mutating history", timeline.Latest)
+	}
+}
@@ -0,0 +1,567 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 供应商目录：团队维护的预设列表（本地 JSON 文件或 HTTP 地址），与内置预设合并后用于“从预设创建”。
+// 目录拉取后缓存在 ~/.code-switch/catalog.json，离线时仍可使用；刷新无需升级应用。
+// 同一平台下 ID 相同的条目以目录为准覆盖内置预设。
+const (
+	providerCatalogFormat   = "code-switch-catalog"
+	providerCatalogVersion  = 1
+	providerCatalogTimeout  = 15 * time.Second
+	maxProviderCatalogBytes = 2 << 20
+	// providerCatalogStaleAfter 启动时缓存超过该时长则自动刷新
+	providerCatalogStaleAfter = 24 * time.Hour
+
+	CatalogSourceBuiltin = "builtin"
+	CatalogSourceRemote  = "catalog"
+)
+
+// providerCatalogPlatforms 目录条目可用的平台；custom 适用于所有自定义 CLI 工具
+var providerCatalogPlatforms = map[string]bool{"claude": true, "codex": true, "gemini": true, "custom": true}
+
+// ProviderCatalog 目录文件格式
+type ProviderCatalog struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	Name      string          `json:"name,omitempty"`
+	UpdatedAt string          `json:"updatedAt,omitempty"`
+	Presets   []CatalogPreset `json:"presets"`
+}
+
+// CatalogPreset 目录中的供应商预设
+type CatalogPreset struct {
+	ID                string                     `json:"id"`
+	Platform          string                     `json:"platform"` // claude / codex / gemini / custom
+	Name              string                     `json:"name"`
+	Description       string                     `json:"description,omitempty"`
+	Category          string                     `json:"category,omitempty"` // official, third_party, custom
+	WebsiteURL        string                     `json:"websiteUrl,omitempty"`
+	APIKeyURL         string                     `json:"apiKeyUrl,omitempty"`
+	APIURL            string                     `json:"apiUrl,omitempty"`
+	APIEndpoint       string                     `json:"apiEndpoint,omitempty"`
+	AuthType          string                     `json:"authType,omitempty"` // bearer / x-api-key / 自定义 Header 名
+	Model             string                     `json:"model,omitempty"`    // Gemini 默认模型
+	SupportedModels   map[string]bool            `json:"supportedModels,omitempty"`
+	ModelMapping      map[string]string          `json:"modelMapping,omitempty"`
+	ModelCapabilities map[string]ModelCapability `json:"modelCapabilities,omitempty"`
+	PricingMultiplier float64                    `json:"pricingMultiplier,omitempty"` // 官方价倍率，0 表示不设置
+	ModelPrices       map[string]ModelPrice      `json:"modelPrices,omitempty"`       // 显式单价（每百万 tokens）
+	FlatRate          bool                       `json:"flatRate,omitempty"`
+	EnvConfig         map[string]string          `json:"envConfig,omitempty"` // Gemini .env 配置
+	Source            string                     `json:"source"`              // builtin / catalog（仅用于展示）
+}
+
+// ProviderCatalogStatus 目录状态
+type ProviderCatalogStatus struct {
+	Source      string    `json:"source"` // 空表示仅使用内置预设
+	Name        string    `json:"name,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	PresetCount int       `json:"presetCount"`
+	Warnings    []string  `json:"warnings"` // 被跳过的无效条目
+}
+
+// providerCatalogState 本地缓存（~/.code-switch/catalog.json）
+type providerCatalogState struct {
+	Source    string           `json:"source"`
+	FetchedAt time.Time        `json:"fetchedAt"`
+	Catalog   *ProviderCatalog `json:"catalog,omitempty"`
+	Warnings  []string         `json:"warnings,omitempty"`
+}
+
+// ProviderCatalogService 供应商目录服务
+type ProviderCatalogService struct {
+	providerService *ProviderService
+	geminiService   *GeminiService
+	logService      *LogService
+	httpClient      *http.Client // 下载远程目录使用的客户端，为空时使用全局代理配置
+
+	mu    sync.RWMutex
+	state providerCatalogState
+}
+
+// NewProviderCatalogService 创建供应商目录服务，加载本地缓存
+func NewProviderCatalogService(providerService *ProviderService, geminiService *GeminiService, logService *LogService) *ProviderCatalogService {
+	pcs := &ProviderCatalogService{
+		providerService: providerService,
+		geminiService:   geminiService,
+		logService:      logService,
+	}
+	if state, err := loadProviderCatalogState(); err != nil {
+		log.Printf("[Catalog] 读取目录缓存失败: %v", err)
+	} else {
+		pcs.state = state
+	}
+	pcs.syncGeminiPresets()
+	return pcs
+}
+
+func (pcs *ProviderCatalogService) Start() error { return nil }
+func (pcs *ProviderCatalogService) Stop() error  { return nil }
+
+// GetCatalogStatus 返回当前目录来源与缓存情况
+func (pcs *ProviderCatalogService) GetCatalogStatus() ProviderCatalogStatus {
+	pcs.mu.RLock()
+	defer pcs.mu.RUnlock()
+	return pcs.statusLocked()
+}
+
+// SetCatalogSource 设置目录来源（文件路径、https 地址或本机 http 地址）并立即拉取；传空字符串恢复为仅内置预设
+func (pcs *ProviderCatalogService) SetCatalogSource(source string) (ProviderCatalogStatus, error) {
+	source = strings.TrimSpace(source)
+	state := providerCatalogState{Source: source}
+	if source != "" {
+		catalog, warnings, err := pcs.fetchCatalog(source)
+		if err != nil {
+			return pcs.GetCatalogStatus(), err
+		}
+		state.Catalog, state.Warnings, state.FetchedAt = catalog, warnings, time.Now()
+	}
+	if err := pcs.saveState(state); err != nil {
+		return pcs.GetCatalogStatus(), err
+	}
+	return pcs.GetCatalogStatus(), nil
+}
+
+// RefreshCatalog 从已配置的来源重新拉取目录；失败时保留旧缓存
+func (pcs *ProviderCatalogService) RefreshCatalog() (ProviderCatalogStatus, error) {
+	pcs.mu.RLock()
+	source := pcs.state.Source
+	pcs.mu.RUnlock()
+	if source == "" {
+		return pcs.GetCatalogStatus(), fmt.Errorf("未配置供应商目录来源")
+	}
+	return pcs.SetCatalogSource(source)
+}
+
+// RefreshIfStale 缓存过期时后台刷新（启动时调用）
+func (pcs *ProviderCatalogService) RefreshIfStale() {
+	pcs.mu.RLock()
+	source, fetchedAt := pcs.state.Source, pcs.state.FetchedAt
+	pcs.mu.RUnlock()
+	if source == "" || time.Since(fetchedAt) < providerCatalogStaleAfter {
+		return
+	}
+	if _, err := pcs.RefreshCatalog(); err != nil {
+		log.Printf("[Catalog] 刷新供应商目录失败（继续使用缓存）: %v", err)
+	}
+}
+
+// ListCatalogPresets 列出指定平台可用的预设；kind 为 custom:{toolId} 时返回 custom 平台的预设
+func (pcs *ProviderCatalogService) ListCatalogPresets(kind string) ([]CatalogPreset, error) {
+	platform, err := catalogPlatform(kind)
+	if err != nil {
+		return nil, err
+	}
+	presets := make([]CatalogPreset, 0)
+	for _, preset := range pcs.allPresets() {
+		if preset.Platform == platform {
+			presets = append(presets, preset)
+		}
+	}
+	return presets, nil
+}
+
+// CreateProviderFromCatalog 按预设创建供应商（默认禁用），并写入预设携带的价格覆盖；返回新供应商 ID
+func (pcs *ProviderCatalogService) CreateProviderFromCatalog(kind, presetID, name, apiKey string) (string, error) {
+	platform, err := catalogPlatform(kind)
+	if err != nil {
+		return "", err
+	}
+	preset, ok := pcs.findPreset(platform, presetID)
+	if !ok {
+		return "", fmt.Errorf("未找到预设 '%s'", presetID)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = preset.Name
+	}
+
+	var id string
+	if platform == "gemini" {
+		if pcs.geminiService == nil {
+			return "", fmt.Errorf("Gemini 服务未初始化")
+		}
+		// 直接使用目录中的预设（按 ID 匹配），不按名称回查，避免命中同名的内置预设
+		provider, err := pcs.geminiService.createProviderFromPreset(presetGeminiPreset(preset), name, apiKey)
+		if err != nil {
+			return "", err
+		}
+		id, name = provider.ID, provider.Name
+	} else {
+		providerID, err := pcs.createProvider(kind, preset, name, apiKey)
+		if err != nil {
+			return "", err
+		}
+		id = strconv.FormatInt(providerID, 10)
+	}
+
+	if err := pcs.applyPresetPricing(strings.TrimSpace(kind), name, preset); err != nil {
+		log.Printf("[Catalog] 写入 %s 的价格覆盖失败: %v", name, err)
+	}
+	log.Printf("[Catalog] 已从预设 %s 创建供应商 %s (%s)", preset.ID, name, kind)
+	return id, nil
+}
+
+func (pcs *ProviderCatalogService) createProvider(kind string, preset CatalogPreset, name, apiKey string) (int64, error) {
+	if pcs.providerService == nil {
+		return 0, fmt.Errorf("供应商服务未初始化")
+	}
+	providers, err := pcs.providerService.LoadProviders(kind)
+	if err != nil {
+		return 0, fmt.Errorf("加载供应商列表失败: %w", err)
+	}
+	if _, exists := findProviderByName(providers, name); exists {
+		return 0, fmt.Errorf("供应商名称已存在: %s", name)
+	}
+	accent, tint := defaultVisual(kind)
+	provider := presetProvider(preset)
+	provider.ID = nextProviderID(providers)
+	provider.Name = name
+	provider.APIKey = apiKey
+	provider.Accent, provider.Tint = accent, tint
+	providers = append(providers, provider)
+	if err := pcs.providerService.SaveProviders(kind, providers); err != nil {
+		return 0, fmt.Errorf("保存供应商失败: %w", err)
+	}
+	return provider.ID, nil
+}
+
+// applyPresetPricing 将预设的倍率/单价写入计价配置（同名覆盖替换）
+func (pcs *ProviderCatalogService) applyPresetPricing(platform, name string, preset CatalogPreset) error {
+	if pcs.logService == nil || (preset.PricingMultiplier <= 0 && len(preset.ModelPrices) == 0) {
+		return nil
+	}
+	config, err := pcs.logService.GetPricingConfig()
+	if err != nil {
+		return err
+	}
+	override := ProviderPricingOverride{Platform: platform, Provider: name, Multiplier: preset.PricingMultiplier, Models: preset.ModelPrices}
+	replaced := false
+	for i := range config.Providers {
+		if strings.EqualFold(config.Providers[i].Platform, platform) && config.Providers[i].Provider == name {
+			config.Providers[i] = override
+			replaced = true
+		}
+	}
+	if !replaced {
+		config.Providers = append(config.Providers, override)
+	}
+	return pcs.logService.SavePricingConfig(config)
+}
+
+// allPresets 内置预设与目录合并（目录中同平台同 ID 的条目覆盖内置）
+func (pcs *ProviderCatalogService) allPresets() []CatalogPreset {
+	presets := builtinCatalogPresets()
+	pcs.mu.RLock()
+	catalog := pcs.state.Catalog
+	pcs.mu.RUnlock()
+	if catalog == nil {
+		return presets
+	}
+	index := make(map[string]int, len(presets))
+	for i, preset := range presets {
+		index[preset.Platform+"/"+preset.ID] = i
+	}
+	for _, preset := range catalog.Presets {
+		preset.Source = CatalogSourceRemote
+		if i, ok := index[preset.Platform+"/"+preset.ID]; ok {
+			presets[i] = preset
+			continue
+		}
+		presets = append(presets, preset)
+	}
+	return presets
+}
+
+func (pcs *ProviderCatalogService) findPreset(platform, id string) (CatalogPreset, bool) {
+	for _, preset := range pcs.allPresets() {
+		if preset.Platform == platform && preset.ID == id {
+			return preset, true
+		}
+	}
+	return CatalogPreset{}, false
+}
+
+func (pcs *ProviderCatalogService) saveState(state providerCatalogState) error {
+	path, err := providerCatalogStatePath()
+	if err != nil {
+		return err
+	}
+	if state.Source == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("清除供应商目录缓存失败: %w", err)
+		}
+	} else if err := AtomicWriteJSON(path, state); err != nil {
+		return fmt.Errorf("保存供应商目录缓存失败: %w", err)
+	}
+	pcs.mu.Lock()
+	pcs.state = state
+	pcs.mu.Unlock()
+	pcs.syncGeminiPresets()
+	return nil
+}
+
+// syncGeminiPresets 把合并后的 Gemini 预设同步给 GeminiService，沿用其原有的预设创建流程
+func (pcs *ProviderCatalogService) syncGeminiPresets() {
+	if pcs.geminiService == nil {
+		return
+	}
+	presets := make([]GeminiPreset, 0)
+	for _, preset := range pcs.allPresets() {
+		if preset.Platform == "gemini" {
+			presets = append(presets, presetGeminiPreset(preset))
+		}
+	}
+	pcs.geminiService.setPresets(presets)
+}
+
+func (pcs *ProviderCatalogService) statusLocked() ProviderCatalogStatus {
+	status := ProviderCatalogStatus{
+		Source:    pcs.state.Source,
+		FetchedAt: pcs.state.FetchedAt,
+		Warnings:  append([]string{}, pcs.state.Warnings...),
+	}
+	if pcs.state.Catalog != nil {
+		status.Name = pcs.state.Catalog.Name
+		status.PresetCount = len(pcs.state.Catalog.Presets)
+	}
+	return status
+}
+
+// builtinCatalogPresets 内置预设（目前只有 Gemini 预设，由 getGeminiPresets 转换）
+func builtinCatalogPresets() []CatalogPreset {
+	builtin := getGeminiPresets()
+	presets := make([]CatalogPreset, 0, len(builtin))
+	for _, preset := range builtin {
+		id := preset.PartnerPromotionKey
+		if id == "" {
+			id = preset.Category
+		}
+		presets = append(presets, CatalogPreset{
+			ID:          id,
+			Platform:    "gemini",
+			Name:        preset.Name,
+			Description: preset.Description,
+			Category:    preset.Category,
+			WebsiteURL:  preset.WebsiteURL,
+			APIKeyURL:   preset.APIKeyURL,
+			APIURL:      preset.BaseURL,
+			Model:       preset.Model,
+			EnvConfig:   preset.EnvConfig,
+			Source:      CatalogSourceBuiltin,
+		})
+	}
+	return presets
+}
+
+// presetProvider 由预设构建 claude/codex/custom 供应商（默认禁用）
+func presetProvider(preset CatalogPreset) Provider {
+	return Provider{
+		Name:                 preset.Name,
+		APIURL:               preset.APIURL,
+		Site:                 preset.WebsiteURL,
+		APIEndpoint:          preset.APIEndpoint,
+		SupportedModels:      preset.SupportedModels,
+		ModelMapping:         preset.ModelMapping,
+		ModelCapabilities:    preset.ModelCapabilities,
+		ConnectivityAuthType: preset.AuthType,
+		FlatRate:             preset.FlatRate,
+		Enabled:              false,
+		Level:                1,
+	}
+}
+
+func presetGeminiPreset(preset CatalogPreset) GeminiPreset {
+	env := make(map[string]string, len(preset.EnvConfig)+2)
+	for key, value := range preset.EnvConfig {
+		env[key] = value
+	}
+	if preset.EnvConfig == nil && preset.APIURL != "" {
+		env["GOOGLE_GEMINI_BASE_URL"] = preset.APIURL
+		if preset.Model != "" {
+			env["GEMINI_MODEL"] = preset.Model
+		}
+	}
+	category := preset.Category
+	if category == "" {
+		category = "third_party"
+	}
+	return GeminiPreset{
+		Name:                preset.Name,
+		WebsiteURL:          preset.WebsiteURL,
+		APIKeyURL:           preset.APIKeyURL,
+		BaseURL:             preset.APIURL,
+		Model:               preset.Model,
+		Description:         preset.Description,
+		Category:            category,
+		PartnerPromotionKey: preset.ID,
+		EnvConfig:           env,
+	}
+}
+
+// fetchCatalog 读取并校验目录；无效条目跳过并记录原因
+// 远程目录决定新建供应商的 API 地址，只接受 HTTPS（本机地址除外，便于用本地 HTTP 服务托管目录），避免明文下载被篡改
+func (pcs *ProviderCatalogService) fetchCatalog(source string) (*ProviderCatalog, []string, error) {
+	var data []byte
+	lower := strings.ToLower(source)
+	if strings.HasPrefix(lower, "http://") && !isLoopbackURL(source) {
+		return nil, nil, fmt.Errorf("供应商目录地址必须使用 HTTPS（本机地址除外）: %s", source)
+	}
+	if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") {
+		client := pcs.httpClient
+		if client == nil {
+			client = GetHTTPClientWithTimeout(providerCatalogTimeout)
+		}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("下载供应商目录失败: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("下载供应商目录失败: HTTP %d", resp.StatusCode)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, maxProviderCatalogBytes+1)); err != nil {
+			return nil, nil, fmt.Errorf("读取供应商目录失败: %w", err)
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, nil, fmt.Errorf("读取供应商目录失败: %w", err)
+		}
+	}
+	if len(data) > maxProviderCatalogBytes {
+		return nil, nil, fmt.Errorf("供应商目录超过 %d MB", maxProviderCatalogBytes>>20)
+	}
+	return parseProviderCatalog(data)
+}
+
+// isLoopbackURL 地址是否指向本机（localhost、127.0.0.0/8、::1）
+func isLoopbackURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func parseProviderCatalog(data []byte) (*ProviderCatalog, []string, error) {
+	var catalog ProviderCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, nil, fmt.Errorf("解析供应商目录失败: %w", err)
+	}
+	if catalog.Format != providerCatalogFormat {
+		return nil, nil, fmt.Errorf("不是 code-switch 供应商目录")
+	}
+	if catalog.Version > providerCatalogVersion {
+		return nil, nil, fmt.Errorf("供应商目录版本 %d 过新，请先升级应用", catalog.Version)
+	}
+
+	warnings := make([]string, 0)
+	seen := make(map[string]bool, len(catalog.Presets))
+	presets := make([]CatalogPreset, 0, len(catalog.Presets))
+	for i, preset := range catalog.Presets {
+		preset.ID = strings.TrimSpace(preset.ID)
+		preset.Platform = strings.ToLower(strings.TrimSpace(preset.Platform))
+		preset.Name = strings.TrimSpace(preset.Name)
+		if err := validateCatalogPreset(preset); err != nil {
+			warnings = append(warnings, fmt.Sprintf("第 %d 项 %s: %v", i+1, preset.ID, err))
+			continue
+		}
+		key := preset.Platform + "/" + preset.ID
+		if seen[key] {
+			warnings = append(warnings, fmt.Sprintf("第 %d 项 %s: ID 重复", i+1, preset.ID))
+			continue
+		}
+		seen[key] = true
+		presets = append(presets, preset)
+	}
+	sort.SliceStable(presets, func(i, j int) bool { return presets[i].Platform < presets[j].Platform })
+	catalog.Presets = presets
+	return &catalog, warnings, nil
+}
+
+func validateCatalogPreset(preset CatalogPreset) error {
+	if preset.ID == "" || preset.Name == "" {
+		return fmt.Errorf("id 和 name 不能为空")
+	}
+	if !providerCatalogPlatforms[preset.Platform] {
+		return fmt.Errorf("不支持的平台: %s", preset.Platform)
+	}
+	for field, value := range map[string]string{"apiUrl": preset.APIURL, "websiteUrl": preset.WebsiteURL, "apiKeyUrl": preset.APIKeyURL} {
+		if value != "" {
+			if err := validateHTTPURL(value, field); err != nil {
+				return err
+			}
+		}
+	}
+	if preset.PricingMultiplier < 0 {
+		return fmt.Errorf("价格倍率不能为负数")
+	}
+	if preset.Platform != "gemini" {
+		provider := presetProvider(preset)
+		if errs := provider.ValidateConfiguration(); len(errs) > 0 {
+			return fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// catalogPlatform 供应商类型对应的目录平台
+func catalogPlatform(kind string) (string, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if strings.HasPrefix(kind, "custom:") {
+		return "custom", nil
+	}
+	if kind == "custom" || !providerCatalogPlatforms[kind] {
+		return "", fmt.Errorf("不支持的供应商类型: %s", kind)
+	}
+	return kind, nil
+}
+
+func providerCatalogStatePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".code-switch", "catalog.json"), nil
+}
+
+func loadProviderCatalogState() (providerCatalogState, error) {
+	var state providerCatalogState
+	path, err := providerCatalogStatePath()
+	if err != nil {
+		return state, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("解析供应商目录缓存失败: %w", err)
+	}
+	return state, nil
+}
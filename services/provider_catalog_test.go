@@ -0,0 +1,138 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProviderCatalog = `{
+  "format": "code-switch-catalog",
+  "version": 1,
+  "name": "team",
+  "presets": [
+    {"id": "team-relay", "platform": "claude", "name": "Team Relay", "apiUrl": "https://relay.example.com",
+     "authType": "bearer", "supportedModels": {"glm-4.6": true}, "modelMapping": {"claude-*": "glm-4.6"}, "pricingMultiplier": 0.3},
+    {"id": "broken", "platform": "codex", "name": "Broken", "supportedModels": {"a": true}, "modelMapping": {"x": "b"}},
+    {"id": "packycode", "platform": "gemini", "name": "Packy Team", "apiUrl": "https://gemini.example.com", "model": "gemini-2.5-pro"},
+    {"id": "shared", "platform": "custom", "name": "Shared", "apiUrl": "https://shared.example.com"}
+  ]
+}`
+
+func TestProviderCatalog_RemoteSourceAndCreate(t *testing.T) {
+	isolateHomeDir(t)
+
+	body := testProviderCatalog
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	ps := NewProviderService()
+	gs := NewGeminiService("127.0.0.1:18100")
+	ls := NewLogService(nil)
+	pcs := NewProviderCatalogService(ps, gs, ls)
+	pcs.httpClient = server.Client()
+
+	// 非本机的明文地址被拒绝，本机 HTTP 服务可以直接托管目录
+	if _, err := pcs.SetCatalogSource("http://catalog.example.com/catalog.json"); err == nil || !strings.Contains(err.Error(), "HTTPS") {
+		t.Fatalf("plain http source should be rejected, got %v", err)
+	}
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer local.Close()
+	if status, err := pcs.SetCatalogSource(local.URL); err != nil || status.PresetCount != 3 {
+		t.Fatalf("loopback http source = %+v, %v", status, err)
+	}
+	if !isLoopbackURL("http://localhost:8080/c.json") || !isLoopbackURL("http://[::1]/c.json") || isLoopbackURL("http://10.0.0.1/c.json") {
+		t.Fatal("isLoopbackURL misclassified hosts")
+	}
+	status, err := pcs.SetCatalogSource(server.URL)
+	if err != nil {
+		t.Fatalf("set source: %v", err)
+	}
+	if status.Name != "team" || status.PresetCount != 3 || len(status.Warnings) != 1 || !strings.Contains(status.Warnings[0], "broken") {
+		t.Fatalf("status = %+v", status)
+	}
+
+	// 目录中同 ID 的 Gemini 预设覆盖内置，并同步到 GeminiService
+	names := make([]string, 0)
+	for _, preset := range gs.GetPresets() {
+		names = append(names, preset.Name)
+	}
+	if strings.Join(names, ",") != "Google Official,Packy Team,自定义" {
+		t.Fatalf("gemini presets = %v", names)
+	}
+	custom, err := pcs.ListCatalogPresets("custom:my-tool")
+	if err != nil || len(custom) != 1 || custom[0].Source != CatalogSourceRemote {
+		t.Fatalf("custom presets = %+v, %v", custom, err)
+	}
+
+	id, err := pcs.CreateProviderFromCatalog("claude", "team-relay", "", "sk-team")
+	if err != nil || id != "1" {
+		t.Fatalf("create = %q, %v", id, err)
+	}
+	providers, _ := ps.LoadProviders("claude")
+	if len(providers) != 1 || providers[0].Name != "Team Relay" || providers[0].ConnectivityAuthType != "bearer" ||
+		providers[0].ModelMapping["claude-*"] != "glm-4.6" || providers[0].Enabled {
+		t.Fatalf("providers = %+v", providers)
+	}
+	if _, err := pcs.CreateProviderFromCatalog("claude", "team-relay", "", "sk-team"); err == nil {
+		t.Fatal("creating a duplicate name should fail")
+	}
+
+	// Gemini 预设按目录 ID 创建并使用传入的名称
+	geminiID, err := pcs.CreateProviderFromCatalog("gemini", "packycode", "My Gemini", "gm-key")
+	if err != nil {
+		t.Fatalf("create gemini: %v", err)
+	}
+	var created *GeminiProvider
+	for _, provider := range gs.GetProviders() {
+		if provider.ID == geminiID {
+			created = &provider
+		}
+	}
+	if created == nil || created.Name != "My Gemini" || created.BaseURL != "https://gemini.example.com" || created.Model != "gemini-2.5-pro" {
+		t.Fatalf("gemini provider = %+v", created)
+	}
+	if _, err := pcs.CreateProviderFromCatalog("gemini", "packycode", "My Gemini", "gm-key"); err == nil {
+		t.Fatal("creating a duplicate gemini name should fail")
+	}
+
+	pricing, _ := ls.GetPricingConfig()
+	if len(pricing.Providers) != 1 || pricing.Providers[0].Provider != "Team Relay" || pricing.Providers[0].Multiplier != 0.3 {
+		t.Fatalf("pricing = %+v", pricing.Providers)
+	}
+
+	// 来源不可用时刷新失败但保留缓存；重启后从缓存恢复
+	body = "not json"
+	if _, err := pcs.RefreshCatalog(); err == nil {
+		t.Fatal("refresh with an invalid catalog should fail")
+	}
+	restarted := NewProviderCatalogService(ps, nil, nil)
+	if presets, _ := restarted.ListCatalogPresets("claude"); len(presets) != 1 {
+		t.Fatalf("cached presets = %+v", presets)
+	}
+
+	// 本地文件来源；清空来源后只剩内置预设
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(path, []byte(testProviderCatalog), 0o600); err != nil {
+		t.Fatalf("write catalog: %v", err)
+	}
+	if _, err := pcs.SetCatalogSource(path); err != nil {
+		t.Fatalf("file source: %v", err)
+	}
+	if _, err := pcs.SetCatalogSource(""); err != nil {
+		t.Fatalf("clear source: %v", err)
+	}
+	if presets, _ := pcs.ListCatalogPresets("claude"); len(presets) != 0 {
+		t.Fatalf("claude presets after clearing = %+v", presets)
+	}
+	if len(gs.GetPresets()) != len(getGeminiPresets()) {
+		t.Fatalf("gemini presets should fall back to builtin: %+v", gs.GetPresets())
+	}
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// provider_events：provider 状态变化的追加式审计日志（只插入，不更新）
+const providerEventsTable = "provider_events"
+
+// 事件类型
+const (
+	ProviderEventFailure       = "failure"            // 请求/检测失败（含原因）
+	ProviderEventBlacklisted   = "blacklisted"        // 被拉黑（含等级与时长）
+	ProviderEventLevelChanged  = "level_changed"      // 等级自然降级
+	ProviderEventForgiven      = "forgiven"           // 触发宽恕，等级清零
+	ProviderEventRecovered     = "recovered"          // 拉黑到期自动恢复
+	ProviderEventCircuitClosed = "circuit_closed"     // 半开试探成功，恢复全量流量
+	ProviderEventManualUnblock = "manual_unblock"     // 手动解除拉黑
+	ProviderEventManualReset   = "manual_reset_level" // 手动清零等级
+	ProviderEventHealthChanged = "health_changed"     // 健康检查状态变化
+	ProviderEventConfigChanged = "config_changed"     // provider 配置新增/修改/删除
+)
+
+const (
+	defaultProviderEventLimit = 500
+	maxProviderEventLimit     = 5000
+)
+
+// ProviderEvent 单条 provider 事件
+type ProviderEvent struct {
+	ID              int64     `json:"id"`
+	Platform        string    `json:"platform"`
+	ProviderName    string    `json:"providerName"`
+	Model           string    `json:"model"` // 为空表示整个 provider
+	EventType       string    `json:"eventType"`
+	Reason          string    `json:"reason"`
+	FromLevel       int       `json:"fromLevel"`
+	ToLevel         int       `json:"toLevel"`
+	DurationMinutes int       `json:"durationMinutes"` // 拉黑时长（仅 blacklisted 事件）
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// ProviderEventQuery 时间线查询条件（Start/End 格式同 UsageQuery，默认最近 24 小时）
+type ProviderEventQuery struct {
+	Platform   string   `json:"platform"`
+	Provider   string   `json:"provider"` // 为空返回平台下全部 provider
+	Model      string   `json:"model"`
+	Start      string   `json:"start"`
+	End        string   `json:"end"`
+	EventTypes []string `json:"eventTypes"`
+	Limit      int      `json:"limit"`
+}
+
+func ensureProviderEventsTable() error {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return err
+	}
+	const createSQL = `CREATE TABLE IF NOT EXISTS provider_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		platform TEXT NOT NULL,
+		provider_name TEXT NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		event_type TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		from_level INTEGER DEFAULT 0,
+		to_level INTEGER DEFAULT 0,
+		duration_minutes INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL
+	)`
+	if _, err := db.Exec(createSQL); err != nil {
+		return fmt.Errorf("创建 provider_events 表失败: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_provider_events_provider ON provider_events(platform, provider_name, created_at)`); err != nil {
+		return fmt.Errorf("创建 provider_events 索引失败: %w", err)
+	}
+	return nil
+}
+
+// recordProviderEvent 追加一条事件；写入失败只打日志，不影响主流程
+func recordProviderEvent(event ProviderEvent) {
+	if GlobalDBQueue == nil {
+		return
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	err := GlobalDBQueue.Exec(`
+		INSERT INTO provider_events
+			(platform, provider_name, model, event_type, reason, from_level, to_level, duration_minutes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.Platform, event.ProviderName, event.Model, event.EventType, event.Reason,
+		event.FromLevel, event.ToLevel, event.DurationMinutes, storageTimestamp(event.CreatedAt))
+	if err != nil {
+		log.Printf("⚠️  记录 provider 事件失败: %v", err)
+	}
+}
+
+// GetProviderEvents 查询 provider 事件时间线（按时间正序）
+func (bs *BlacklistService) GetProviderEvents(query ProviderEventQuery) ([]ProviderEvent, error) {
+	return queryProviderEvents(query)
+}
+
+// GetProviderTimeline 查询 provider 事件时间线（与 BlacklistService.GetProviderEvents 相同，便于日志页面直接调用）
+func (ls *LogService) GetProviderTimeline(query ProviderEventQuery) ([]ProviderEvent, error) {
+	return queryProviderEvents(query)
+}
+
+func queryProviderEvents(query ProviderEventQuery) ([]ProviderEvent, error) {
+	start, end, err := parseUsageRange(query.Start, query.End)
+	if err != nil {
+		return nil, err
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultProviderEventLimit
+	}
+	if limit > maxProviderEventLimit {
+		limit = maxProviderEventLimit
+	}
+
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	conditions := []string{"created_at >= ?", "created_at < ?"}
+	args := []interface{}{storageTimestamp(start), storageTimestamp(end)}
+	if platform := strings.TrimSpace(query.Platform); platform != "" {
+		conditions = append(conditions, "platform = ?")
+		args = append(args, platform)
+	}
+	if provider := strings.TrimSpace(query.Provider); provider != "" {
+		conditions = append(conditions, "provider_name = ?")
+		args = append(args, provider)
+	}
+	if model := strings.TrimSpace(query.Model); model != "" {
+		conditions = append(conditions, "model = ?")
+		args = append(args, model)
+	}
+	if len(query.EventTypes) > 0 {
+		placeholders := make([]string, 0, len(query.EventTypes))
+		for _, eventType := range query.EventTypes {
+			placeholders = append(placeholders, "?")
+			args = append(args, strings.TrimSpace(eventType))
+		}
+		conditions = append(conditions, "event_type IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(`
+		SELECT id, platform, provider_name, model, event_type, reason, from_level, to_level, duration_minutes, created_at
+		FROM provider_events
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at ASC, id ASC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return []ProviderEvent{}, nil
+		}
+		return nil, fmt.Errorf("查询 provider 事件失败: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]ProviderEvent, 0)
+	for rows.Next() {
+		var event ProviderEvent
+		var createdAt string
+		if err := rows.Scan(&event.ID, &event.Platform, &event.ProviderName, &event.Model, &event.EventType,
+			&event.Reason, &event.FromLevel, &event.ToLevel, &event.DurationMinutes, &createdAt); err != nil {
+			return nil, fmt.Errorf("读取 provider 事件失败: %w", err)
+		}
+		if parsed, err := time.ParseInLocation(timeLayout, createdAt, time.UTC); err == nil {
+			event.CreatedAt = parsed.In(time.Local)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// recordProviderConfigChanges 比较保存前后的 provider（按 name 匹配），记录新增/修改/删除事件
+// 只记录变化的字段名，不记录字段值，避免 API Key 等敏感信息进入审计日志
+func recordProviderConfigChanges(platform string, before map[string]interface{}, after map[string]interface{}) {
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldValue, hadOld := before[name]
+		newValue, hasNew := after[name]
+		var reason string
+		switch {
+		case !hadOld:
+			reason = "新增 provider"
+		case !hasNew:
+			reason = "删除 provider"
+		default:
+			changed := changedConfigFields(oldValue, newValue)
+			if len(changed) == 0 {
+				continue
+			}
+			reason = "修改字段: " + strings.Join(changed, ", ")
+		}
+		recordProviderEvent(ProviderEvent{
+			Platform:     platform,
+			ProviderName: name,
+			EventType:    ProviderEventConfigChanged,
+			Reason:       reason,
+		})
+	}
+}
+
+// changedConfigFields 返回两个配置对象中 JSON 字段值不同的字段名
+func changedConfigFields(oldValue interface{}, newValue interface{}) []string {
+	oldFields := configFieldMap(oldValue)
+	newFields := configFieldMap(newValue)
+	// uid 由程序分配，首次补齐时不算配置修改
+	delete(oldFields, "uid")
+	delete(newFields, "uid")
+	changed := make([]string, 0)
+	for key, value := range newFields {
+		if !reflect.DeepEqual(oldFields[key], value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range oldFields {
+		if _, ok := newFields[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func configFieldMap(value interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
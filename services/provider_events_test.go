@@ -0,0 +1,75 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChangedConfigFields(t *testing.T) {
+	before := Provider{ID: 1, Name: "a", APIURL: "https://a", APIKey: "k1", Enabled: true}
+	after := before
+	after.APIKey = "k2"
+	after.Enabled = false
+
+	got := changedConfigFields(before, after)
+	want := []string{"apiKey", "enabled"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changedConfigFields = %v, want %v", got, want)
+	}
+	if got := changedConfigFields(before, before); len(got) != 0 {
+		t.Fatalf("unchanged provider reported %v", got)
+	}
+}
+
+func TestTruncateEventReason(t *testing.T) {
+	if got := truncateEventReason("  timeout  "); got != "timeout" {
+		t.Fatalf("truncateEventReason = %q", got)
+	}
+	long := strings.Repeat("错", 600)
+	got := truncateEventReason(long)
+	if n := len([]rune(got)); n != 503 {
+		t.Fatalf("truncated rune length = %d, want 503", n)
+	}
+}
+
+func TestRecordFailureEventsAfterDedup(t *testing.T) {
+	useTestDatabase(t)
+	settings := NewSettingsService()
+	bs := NewBlacklistService(settings, nil)
+	failureEvents := func(provider string) []ProviderEvent {
+		t.Helper()
+		events, err := bs.GetProviderEvents(ProviderEventQuery{Platform: "claude", Provider: provider, EventTypes: []string{ProviderEventFailure}})
+		if err != nil {
+			t.Fatalf("get provider events: %v", err)
+		}
+		return events
+	}
+
+	// 等级拉黑模式：去重窗口内的重复失败不写事件，写入的事件带上失败原因
+	if err := settings.SetLevelBlacklistEnabled(true); err != nil {
+		t.Fatalf("enable level blacklist: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := bs.RecordFailure("claude", "level", "upstream timeout"); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+	}
+	events := failureEvents("level")
+	if len(events) != 1 || events[0].Reason != "upstream timeout" {
+		t.Fatalf("level mode failure events = %+v, want one with reason", events)
+	}
+
+	// 固定拉黑模式：拉黑后的失败不再计数，也不写事件
+	if err := settings.SetLevelBlacklistEnabled(false); err != nil {
+		t.Fatalf("disable level blacklist: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := bs.RecordFailure("claude", "fixed", "HTTP 502"); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+	}
+	if events := failureEvents("fixed"); len(events) != 3 {
+		t.Fatalf("fixed mode failure events = %d, want 3 (4th failure hit the blacklist)", len(events))
+	}
+}
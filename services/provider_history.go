@@ -0,0 +1,417 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 供应商配置版本历史：每次 SaveProviders 成功后把写入磁盘的内容保存为快照
+// 存放在 ~/.code-switch/history/{kind}/{id}.json；API Key 只保存摘要，回滚时按摘要匹配当前配置中的密钥
+const (
+	maxProviderSnapshots     = 50
+	providerSnapshotIDLayout = "20060102-150405.000000000"
+)
+
+// ProviderSnapshotInfo 快照概要
+type ProviderSnapshotInfo struct {
+	ID            string    `json:"id"`
+	Kind          string    `json:"kind"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ProviderCount int       `json:"providerCount"`
+	Size          int64     `json:"size"`
+}
+
+// ProviderSnapshotDiff 两个版本之间的结构化差异（按 provider ID 匹配）
+type ProviderSnapshotDiff struct {
+	Kind    string                `json:"kind"`
+	From    string                `json:"from"`
+	To      string                `json:"to"` // 空表示当前配置
+	Added   []ProviderDiffEntry   `json:"added"`
+	Removed []ProviderDiffEntry   `json:"removed"`
+	Changed []ProviderFieldChange `json:"changed"`
+}
+
+// ProviderDiffEntry 新增或删除的 provider
+type ProviderDiffEntry struct {
+	ProviderID int64  `json:"providerId"`
+	Name       string `json:"name"`
+}
+
+// ProviderFieldChange 单个字段的变化（API Key 已脱敏）
+type ProviderFieldChange struct {
+	ProviderID int64       `json:"providerId"`
+	Name       string      `json:"name"`
+	Field      string      `json:"field"`
+	Before     interface{} `json:"before"`
+	After      interface{} `json:"after"`
+}
+
+// providerSensitiveFields diff 中需要脱敏的字段
+var providerSensitiveFields = map[string]bool{"apiKey": true}
+
+// ListProviderSnapshots 列出指定类型的历史快照（新在前）
+func (ps *ProviderService) ListProviderSnapshots(kind string) ([]ProviderSnapshotInfo, error) {
+	dir, err := providerHistoryDir(kind)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := listProviderSnapshotIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ProviderSnapshotInfo, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, ids[i]+".json")
+		info := ProviderSnapshotInfo{ID: ids[i], Kind: kind}
+		if createdAt, err := time.ParseInLocation(providerSnapshotIDLayout, ids[i], time.UTC); err == nil {
+			info.CreatedAt = createdAt.Local()
+		}
+		if stat, err := os.Stat(path); err == nil {
+			info.Size = stat.Size()
+		}
+		if providers, err := readProviderSnapshot(path); err == nil {
+			info.ProviderCount = len(providers)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// DiffProviderSnapshots 比较两个快照；toID 为空时与当前配置比较
+func (ps *ProviderService) DiffProviderSnapshots(kind, fromID, toID string) (*ProviderSnapshotDiff, error) {
+	from, err := loadProviderSnapshotByID(kind, fromID)
+	if err != nil {
+		return nil, err
+	}
+	var to []Provider
+	if strings.TrimSpace(toID) == "" {
+		// 当前配置按快照的方式处理 API Key，避免摘要与明文被误判为变化
+		path, pathErr := providerFilePath(kind)
+		if pathErr != nil {
+			return nil, pathErr
+		}
+		data, readErr := os.ReadFile(path)
+		if readErr != nil && !os.IsNotExist(readErr) {
+			return nil, readErr
+		}
+		if data, err = scrubSnapshotSecrets(data); err == nil {
+			to, err = parseProviderSnapshot(data)
+		}
+	} else {
+		to, err = loadProviderSnapshotByID(kind, toID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffProviderLists(from, to)
+	diff.Kind = kind
+	diff.From = fromID
+	diff.To = toID
+	return diff, nil
+}
+
+// RollbackProviderSnapshot 将配置恢复到指定快照
+// 走 saveProvidersLocked：同样受“name 不可修改”规则约束，且回滚本身也会生成新快照
+// 快照中的 API Key 必须能在当前配置中找到（按摘要匹配），否则拒绝回滚而不是写入空 Key
+func (ps *ProviderService) RollbackProviderSnapshot(kind, snapshotID string) error {
+	if secretVaultLocked() {
+		return errSecretVaultLocked
+	}
+	providers, err := loadProviderSnapshotByID(kind, snapshotID)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	current, err := ps.loadProvidersRaw(kind)
+	if err != nil {
+		return fmt.Errorf("加载当前配置失败: %w", err)
+	}
+	if err := restoreSnapshotSecrets(providers, current); err != nil {
+		return fmt.Errorf("回滚失败: %w", err)
+	}
+	if err := ps.saveProvidersLocked(kind, providers); err != nil {
+		return fmt.Errorf("回滚失败: %w", err)
+	}
+	log.Printf("[ProviderService] 已回滚 %s 配置到快照 %s", kind, snapshotID)
+	return nil
+}
+
+// restoreSnapshotSecrets 把快照中的 API Key 摘要（或旧快照中的明文、密钥库引用）还原为当前可用的明文
+func restoreSnapshotSecrets(providers, current []Provider) error {
+	byDigest := make(map[string]string, len(current))
+	for _, p := range current {
+		if p.APIKey != "" {
+			byDigest[secretDigest(p.APIKey)] = p.APIKey
+		}
+	}
+	openProviderSecrets(providers)
+
+	missing := make([]string, 0)
+	for i := range providers {
+		key := providers[i].APIKey
+		if _, isRef := parseSecretRef(key); isRef {
+			missing = append(missing, providers[i].Name)
+			continue
+		}
+		if strings.HasPrefix(key, secretDigestPrefix) {
+			value, ok := byDigest[key]
+			if !ok {
+				missing = append(missing, providers[i].Name)
+				continue
+			}
+			providers[i].APIKey = value
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("以下供应商在快照中的 API Key 已被更换或删除，无法恢复: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// scrubSnapshotSecrets 把配置内容中的 API Key（明文或可解析的密钥库引用）替换为摘要
+func scrubSnapshotSecrets(data []byte) ([]byte, error) {
+	providers, err := parseProviderSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	openProviderSecrets(providers)
+	for i := range providers {
+		if _, isRef := parseSecretRef(providers[i].APIKey); isRef {
+			continue // 密钥库锁定时无法解析，保留引用（不含密钥）
+		}
+		providers[i].APIKey = secretDigest(providers[i].APIKey)
+	}
+	return json.MarshalIndent(providerEnvelope{Providers: providers}, "", "  ")
+}
+
+// scrubProviderHistory 重写已有快照，清除其中的明文 API Key（启用密钥库时调用）
+func scrubProviderHistory(kind string) error {
+	dir, err := providerHistoryDir(kind)
+	if err != nil {
+		return err
+	}
+	ids, err := listProviderSnapshotIDs(dir)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		path := filepath.Join(dir, id+".json")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		scrubbed, err := scrubSnapshotSecrets(data)
+		if err != nil {
+			// 无法解析的快照可能含有明文，直接删除
+			log.Printf("[ProviderService] 删除无法解析的历史快照 %s: %v", path, err)
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		if bytes.Equal(data, scrubbed) {
+			continue
+		}
+		if err := AtomicWriteBytes(path, scrubbed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordProviderSnapshot 保存一次写入的内容；首次保存前先为原文件留一份基线，内容与最新快照相同时跳过
+func recordProviderSnapshot(kind string, previous, data []byte) {
+	data, err := scrubSnapshotSecrets(data)
+	if err != nil {
+		log.Printf("[ProviderService] 处理历史快照失败: %v", err)
+		return
+	}
+	if len(previous) > 0 {
+		if previous, err = scrubSnapshotSecrets(previous); err != nil {
+			previous = nil
+		}
+	}
+	dir, err := providerHistoryDir(kind)
+	if err != nil {
+		log.Printf("[ProviderService] 获取历史目录失败: %v", err)
+		return
+	}
+	ids, err := listProviderSnapshotIDs(dir)
+	if err != nil {
+		log.Printf("[ProviderService] 读取历史快照失败: %v", err)
+		return
+	}
+
+	var latest []byte
+	if len(ids) > 0 {
+		latest, _ = os.ReadFile(filepath.Join(dir, ids[len(ids)-1]+".json"))
+	} else if len(previous) > 0 && !bytes.Equal(previous, data) {
+		if id, err := writeProviderSnapshot(dir, previous); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if latest != nil && bytes.Equal(latest, data) {
+		return
+	}
+	id, err := writeProviderSnapshot(dir, data)
+	if err != nil {
+		log.Printf("[ProviderService] 保存历史快照失败: %v", err)
+		return
+	}
+	ids = append(ids, id)
+
+	for len(ids) > maxProviderSnapshots {
+		_ = os.Remove(filepath.Join(dir, ids[0]+".json"))
+		ids = ids[1:]
+	}
+}
+
+func writeProviderSnapshot(dir string, data []byte) (string, error) {
+	id := time.Now().UTC().Format(providerSnapshotIDLayout)
+	if err := AtomicWriteBytes(filepath.Join(dir, id+".json"), data); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// providerHistoryDir 快照目录（custom:{toolId} 中的冒号替换为横线，兼容 Windows）
+func providerHistoryDir(kind string) (string, error) {
+	if _, err := providerFilePath(kind); err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.ReplaceAll(secretStoreKind(kind), ":", "-")
+	return filepath.Join(home, ".code-switch", "history", name), nil
+}
+
+// listProviderSnapshotIDs 返回按时间升序排列的快照 ID
+func listProviderSnapshotIDs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func loadProviderSnapshotByID(kind, id string) ([]Provider, error) {
+	id = strings.TrimSpace(id)
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return nil, fmt.Errorf("快照 ID 无效: %s", id)
+	}
+	dir, err := providerHistoryDir(kind)
+	if err != nil {
+		return nil, err
+	}
+	providers, err := readProviderSnapshot(filepath.Join(dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("快照不存在: %s", id)
+		}
+		return nil, fmt.Errorf("读取快照失败: %w", err)
+	}
+	return providers, nil
+}
+
+func readProviderSnapshot(path string) ([]Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseProviderSnapshot(data)
+}
+
+func parseProviderSnapshot(data []byte) ([]Provider, error) {
+	var envelope providerEnvelope
+	if len(data) == 0 {
+		return []Provider{}, nil
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Providers == nil {
+		envelope.Providers = []Provider{}
+	}
+	return envelope.Providers, nil
+}
+
+// diffProviderLists 按 provider ID 比较两组配置
+func diffProviderLists(from, to []Provider) *ProviderSnapshotDiff {
+	diff := &ProviderSnapshotDiff{
+		Added:   []ProviderDiffEntry{},
+		Removed: []ProviderDiffEntry{},
+		Changed: []ProviderFieldChange{},
+	}
+	fromByID := make(map[int64]Provider, len(from))
+	for _, p := range from {
+		fromByID[p.ID] = p
+	}
+	toByID := make(map[int64]Provider, len(to))
+	for _, p := range to {
+		toByID[p.ID] = p
+		if _, ok := fromByID[p.ID]; !ok {
+			diff.Added = append(diff.Added, ProviderDiffEntry{ProviderID: p.ID, Name: p.Name})
+		}
+	}
+	for _, p := range from {
+		next, ok := toByID[p.ID]
+		if !ok {
+			diff.Removed = append(diff.Removed, ProviderDiffEntry{ProviderID: p.ID, Name: p.Name})
+			continue
+		}
+		before := configFieldMap(p)
+		after := configFieldMap(next)
+		for _, field := range changedConfigFields(p, next) {
+			change := ProviderFieldChange{
+				ProviderID: p.ID,
+				Name:       next.Name,
+				Field:      field,
+				Before:     before[field],
+				After:      after[field],
+			}
+			if providerSensitiveFields[field] {
+				change.Before = maskSnapshotSecret(change.Before)
+				change.After = maskSnapshotSecret(change.After)
+			}
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	return diff
+}
+
+// maskSnapshotSecret 脱敏 API Key；密钥库引用本身不含密钥，原样展示
+func maskSnapshotSecret(value interface{}) interface{} {
+	text, ok := value.(string)
+	if !ok || text == "" {
+		return value
+	}
+	if _, isRef := parseSecretRef(text); isRef {
+		return text
+	}
+	return maskAPIKey(text)
+}
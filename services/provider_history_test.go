@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProviderHistory_SnapshotDiffAndRollback(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	v1 := []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://relay.example.com", APIKey: "sk-relay-000000000001", Enabled: true},
+		{ID: 2, Name: "backup", APIURL: "https://backup.example.com", APIKey: "sk-backup-00000000002"},
+	}
+	if err := ps.SaveProviders("claude", v1); err != nil {
+		t.Fatalf("save v1: %v", err)
+	}
+	// 内容未变化的保存不产生新快照
+	if err := ps.SaveProviders("claude", v1); err != nil {
+		t.Fatalf("save v1 again: %v", err)
+	}
+	v2 := []Provider{
+		{ID: 1, Name: "relay", APIURL: "https://relay2.example.com", APIKey: "sk-relay-000000000009", Enabled: true},
+		{ID: 3, Name: "fresh", APIURL: "https://fresh.example.com"},
+	}
+	if err := ps.SaveProviders("claude", v2); err != nil {
+		t.Fatalf("save v2: %v", err)
+	}
+
+	snapshots, err := ps.ListProviderSnapshots("claude")
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("ListProviderSnapshots = %+v, %v", snapshots, err)
+	}
+	latest, first := snapshots[0], snapshots[1]
+	if latest.ID <= first.ID || first.ProviderCount != 2 || latest.ProviderCount != 2 {
+		t.Fatalf("snapshots not newest-first: %+v", snapshots)
+	}
+
+	diff, err := ps.DiffProviderSnapshots("claude", first.ID, latest.ID)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ProviderID != 3 || len(diff.Removed) != 1 || diff.Removed[0].Name != "backup" {
+		t.Fatalf("added/removed = %+v / %+v", diff.Added, diff.Removed)
+	}
+	fields := map[string]ProviderFieldChange{}
+	for _, change := range diff.Changed {
+		fields[change.Field] = change
+	}
+	if _, ok := fields["apiUrl"]; !ok || len(fields) != 2 {
+		t.Fatalf("changed = %+v", diff.Changed)
+	}
+	if key := fields["apiKey"]; key.Before == key.After || strings.Contains(fmt.Sprint(key.Before, key.After), "sk-relay") {
+		t.Fatalf("apiKey change should be masked: %+v", key)
+	}
+	for _, snapshot := range snapshots {
+		raw, _ := os.ReadFile(filepath.Join(mustProviderHistoryDir(t, "claude"), snapshot.ID+".json"))
+		if strings.Contains(string(raw), "sk-") {
+			t.Fatalf("snapshot %s holds a plaintext key: %s", snapshot.ID, raw)
+		}
+	}
+
+	// 与当前配置比较：没有差异
+	current, err := ps.DiffProviderSnapshots("claude", latest.ID, "")
+	if err != nil || len(current.Added)+len(current.Removed)+len(current.Changed) != 0 {
+		t.Fatalf("diff against current = %+v, %v", current, err)
+	}
+
+	// 快照中的 Key 已被更换或删除：拒绝回滚，不写入空 Key
+	err = ps.RollbackProviderSnapshot("claude", first.ID)
+	if err == nil || !strings.Contains(err.Error(), "relay, backup") {
+		t.Fatalf("rollback with rotated keys should fail, got %v", err)
+	}
+	if providers, _ := ps.LoadProviders("claude"); providers[0].APIKey != "sk-relay-000000000009" {
+		t.Fatalf("failed rollback must not touch the config: %+v", providers)
+	}
+
+	// 当前配置中仍能找到这些 Key 时（与 ID 无关）按摘要恢复
+	v3 := append(v2, Provider{ID: 4, Name: "keys", APIURL: "https://keys.example.com", APIKey: "sk-relay-000000000001"},
+		Provider{ID: 5, Name: "keys2", APIURL: "https://keys.example.com", APIKey: "sk-backup-00000000002"})
+	if err := ps.SaveProviders("claude", v3); err != nil {
+		t.Fatalf("save v3: %v", err)
+	}
+	if err := ps.RollbackProviderSnapshot("claude", first.ID); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	providers, err := ps.LoadProviders("claude")
+	if err != nil || len(providers) != 2 || providers[1].Name != "backup" || providers[0].APIKey != "sk-relay-000000000001" || providers[1].APIKey != "sk-backup-00000000002" {
+		t.Fatalf("after rollback = %+v, %v", providers, err)
+	}
+	if snapshots, _ := ps.ListProviderSnapshots("claude"); len(snapshots) != 4 {
+		t.Fatalf("rollback should record a new snapshot, got %d", len(snapshots))
+	}
+}
+
+func TestProviderHistory_VaultEnableScrubsLegacySnapshots(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("codex", []Provider{{ID: 1, Name: "relay", APIURL: "https://a.example.com", APIKey: "sk-codex-000000000001"}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	// 模拟旧版本写入的明文快照
+	dir := mustProviderHistoryDir(t, "codex")
+	legacy := `{"providers":[{"id":1,"name":"relay","apiUrl":"https://a.example.com","apiKey":"sk-codex-000000000001"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "20200101-000000.000000000.json"), []byte(legacy), 0o600); err != nil {
+		t.Fatalf("write legacy snapshot: %v", err)
+	}
+
+	if _, err := NewSecretVaultService(ps, nil, nil).Enable(""); err != nil {
+		t.Fatalf("enable vault: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		raw, _ := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if strings.Contains(string(raw), "sk-codex") {
+			t.Fatalf("snapshot %s still holds a plaintext key: %s", entry.Name(), raw)
+		}
+	}
+	if err := ps.RollbackProviderSnapshot("codex", "20200101-000000.000000000"); err != nil {
+		t.Fatalf("rollback to scrubbed snapshot: %v", err)
+	}
+	if providers, _ := ps.LoadProviders("codex"); providers[0].APIKey != "sk-codex-000000000001" {
+		t.Fatalf("providers after rollback = %+v", providers)
+	}
+}
+
+func mustProviderHistoryDir(t *testing.T, kind string) string {
+	t.Helper()
+	dir, err := providerHistoryDir(kind)
+	if err != nil {
+		t.Fatalf("providerHistoryDir: %v", err)
+	}
+	return dir
+}
+
+func TestProviderHistory_RollbackRespectsImmutableName(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("codex", []Provider{{ID: 1, Name: "old-name", APIURL: "https://a.example.com"}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	snapshots, _ := ps.ListProviderSnapshots("codex")
+	if len(snapshots) != 1 {
+		t.Fatalf("snapshots = %+v", snapshots)
+	}
+	// 删除后以相同 ID 新建不同名称的 provider
+	if err := ps.SaveProviders("codex", []Provider{}); err != nil {
+		t.Fatalf("save empty: %v", err)
+	}
+	if err := ps.SaveProviders("codex", []Provider{{ID: 1, Name: "new-name", APIURL: "https://a.example.com"}}); err != nil {
+		t.Fatalf("save new name: %v", err)
+	}
+
+	if err := ps.RollbackProviderSnapshot("codex", snapshots[0].ID); err == nil || !strings.Contains(err.Error(), "name 不可修改") {
+		t.Fatalf("rollback across a rename should fail, got %v", err)
+	}
+	for _, id := range []string{"", "../codex", `..\codex`, "missing"} {
+		if err := ps.RollbackProviderSnapshot("codex", id); err == nil {
+			t.Fatalf("rollback to %q should fail", id)
+		}
+	}
+}
+
+func TestProviderHistory_PrunesOldSnapshots(t *testing.T) {
+	isolateHomeDir(t)
+	dir, err := providerHistoryDir("custom:tool-a")
+	if err != nil {
+		t.Fatalf("providerHistoryDir: %v", err)
+	}
+	if filepath.Base(dir) != "custom-tool-a" {
+		t.Fatalf("history dir = %s", dir)
+	}
+	for i := 0; i < maxProviderSnapshots+5; i++ {
+		recordProviderSnapshot("custom:tool-a", nil, []byte(fmt.Sprintf(`{"providers":[{"id":%d}]}`, i+1)))
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != maxProviderSnapshots {
+		t.Fatalf("snapshot count = %d, want %d", len(entries), maxProviderSnapshots)
+	}
+}
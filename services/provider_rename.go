@@ -0,0 +1,472 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProviderRenameService 供应商安全改名
+// 黑名单、请求日志、健康检查历史等均以 name 关联 provider，saveProvidersLocked 因此禁止改名；
+// 这里在一个数据库事务内同时迁移配置文件与所有按 name 关联的记录，再同步各服务的内存状态。
+// provider 另有改名不变的 UID，供今后把这些表改为按 UID 关联
+type ProviderRenameService struct {
+	providerService  *ProviderService
+	geminiService    *GeminiService
+	blacklistService *BlacklistService
+	healthCheck      *HealthCheckService
+	relay            *ProviderRelayService
+	budgetService    *BudgetService
+	logService       *LogService
+}
+
+// ProviderRenameResult 改名结果（各表迁移的行数）
+type ProviderRenameResult struct {
+	Platform     string           `json:"platform"`
+	ProviderID   int64            `json:"providerId"`
+	ProviderUID  string           `json:"providerUid"`
+	OldName      string           `json:"oldName"`
+	NewName      string           `json:"newName"`
+	MigratedRows map[string]int64 `json:"migratedRows"`
+}
+
+func NewProviderRenameService(
+	providerService *ProviderService,
+	geminiService *GeminiService,
+	blacklistService *BlacklistService,
+	healthCheck *HealthCheckService,
+	relay *ProviderRelayService,
+	budgetService *BudgetService,
+	logService *LogService,
+) *ProviderRenameService {
+	return &ProviderRenameService{
+		providerService:  providerService,
+		geminiService:    geminiService,
+		blacklistService: blacklistService,
+		healthCheck:      healthCheck,
+		relay:            relay,
+		budgetService:    budgetService,
+		logService:       logService,
+	}
+}
+
+// RenameProvider 修改 provider 名称，并迁移黑名单、请求日志、汇总、健康检查历史与事件记录
+func (rs *ProviderRenameService) RenameProvider(kind string, providerID int64, newName string) (*ProviderRenameResult, error) {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return nil, fmt.Errorf("新名称不能为空")
+	}
+	if _, err := providerFilePath(kind); err != nil {
+		return nil, err
+	}
+	if GlobalDBQueue == nil {
+		return nil, fmt.Errorf("数据库写入队列未初始化")
+	}
+	platform := secretStoreKind(kind)
+
+	ps := rs.providerService
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	providers, err := ps.loadProvidersRaw(kind)
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, p := range providers {
+		if p.ID == providerID {
+			index = i
+			continue
+		}
+		if strings.EqualFold(p.Name, newName) {
+			return nil, fmt.Errorf("名称 %s 已被 provider id %d 使用", newName, p.ID)
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("未找到 provider id %d", providerID)
+	}
+	oldName := providers[index].Name
+	if providers[index].UID == "" {
+		providers[index].UID = legacyProviderUID(kind, strconv.FormatInt(providerID, 10), oldName)
+	}
+	result := &ProviderRenameResult{
+		Platform:     platform,
+		ProviderID:   providerID,
+		ProviderUID:  providers[index].UID,
+		OldName:      oldName,
+		NewName:      newName,
+		MigratedRows: map[string]int64{},
+	}
+	if oldName == newName {
+		return result, nil
+	}
+
+	renamed := make([]Provider, len(providers))
+	copy(renamed, providers)
+	renamed[index].Name = newName
+
+	path, _ := providerFilePath(kind)
+	previous, _ := os.ReadFile(path)
+	var written []byte
+	err = migrateProviderName(platform, oldName, newName, result.MigratedRows, func() error {
+		data, err := ps.writeProvidersFile(kind, renamed)
+		if err != nil {
+			return err
+		}
+		written = data
+		return nil
+	}, func() error {
+		if len(previous) == 0 {
+			return nil
+		}
+		return AtomicWriteBytes(path, previous)
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordProviderSnapshot(kind, previous, written)
+	rs.finishRename(result)
+	return result, nil
+}
+
+// RenameGeminiProvider 修改 Gemini provider 名称（Gemini 供应商以字符串 ID 标识），迁移内容同 RenameProvider
+func (rs *ProviderRenameService) RenameGeminiProvider(id string, newName string) (*ProviderRenameResult, error) {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return nil, fmt.Errorf("新名称不能为空")
+	}
+	if rs.geminiService == nil {
+		return nil, fmt.Errorf("Gemini 服务未初始化")
+	}
+	if GlobalDBQueue == nil {
+		return nil, fmt.Errorf("数据库写入队列未初始化")
+	}
+
+	gs := rs.geminiService
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	index := -1
+	for i, p := range gs.providers {
+		if p.ID == id {
+			index = i
+			continue
+		}
+		if strings.EqualFold(p.Name, newName) {
+			return nil, fmt.Errorf("名称 %s 已被 provider id %s 使用", newName, p.ID)
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("未找到 ID 为 '%s' 的供应商", id)
+	}
+	oldName := gs.providers[index].Name
+	if gs.providers[index].UID == "" {
+		gs.providers[index].UID = legacyProviderUID("gemini", id, oldName)
+	}
+	result := &ProviderRenameResult{
+		Platform:     "gemini",
+		ProviderID:   geminiProviderID(id),
+		ProviderUID:  gs.providers[index].UID,
+		OldName:      oldName,
+		NewName:      newName,
+		MigratedRows: map[string]int64{},
+	}
+	if oldName == newName {
+		return result, nil
+	}
+
+	err := migrateProviderName("gemini", oldName, newName, result.MigratedRows, func() error {
+		gs.providers[index].Name = newName
+		if err := gs.saveProviders(); err != nil {
+			gs.providers[index].Name = oldName
+			return err
+		}
+		return nil
+	}, func() error {
+		gs.providers[index].Name = oldName
+		return gs.saveProviders()
+	})
+	if err != nil {
+		return nil, err
+	}
+	rs.finishRename(result)
+	return result, nil
+}
+
+// migrateProviderName 先等日志队列中已排队的写入落库（否则旧名称的日志可能在迁移之后才写入），
+// 再在一个事务内迁移数据库记录并写入配置；配置在事务内最后写入，事务最终回滚时用 restoreConfig 恢复
+func migrateProviderName(platform, oldName, newName string, migrated map[string]int64, writeConfig func() error, restoreConfig func() error) error {
+	if GlobalDBQueueLogs != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := GlobalDBQueueLogs.Flush(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("等待请求日志写入失败: %w", err)
+		}
+	}
+
+	// 等待事务真正结束再决定是否恢复配置：带超时的 ExecTx 返回后事务仍可能提交，
+	// 此时恢复配置会让配置与已迁移的数据库记录不一致；wrote 在收到事务结果后读取，不存在并发访问
+	wrote := false
+	err := GlobalDBQueue.ExecTxWait(func(tx *sql.Tx) error {
+		if err := migrateProviderNameRows(tx, platform, oldName, newName, migrated); err != nil {
+			return err
+		}
+		if err := writeConfig(); err != nil {
+			return err
+		}
+		wrote = true
+		return nil
+	})
+	if err != nil {
+		if wrote {
+			if restoreErr := restoreConfig(); restoreErr != nil {
+				log.Printf("[ProviderRename] 恢复配置文件失败: %v", restoreErr)
+			}
+		}
+		return fmt.Errorf("改名失败: %w", err)
+	}
+	return nil
+}
+
+// finishRename 同步内存状态并记录改名事件
+func (rs *ProviderRenameService) finishRename(result *ProviderRenameResult) {
+	rs.renameRuntimeState(result.Platform, result.ProviderID, result.OldName, result.NewName)
+	recordProviderEvent(ProviderEvent{
+		Platform:     result.Platform,
+		ProviderName: result.NewName,
+		EventType:    ProviderEventConfigChanged,
+		Reason:       fmt.Sprintf("改名: %s → %s", result.OldName, result.NewName),
+	})
+	log.Printf("[ProviderRename] %s provider %d 已由 %s 改名为 %s，迁移记录: %v",
+		result.Platform, result.ProviderID, result.OldName, result.NewName, result.MigratedRows)
+}
+
+// newProviderUID 为新建的 provider 生成随机 UID（UUID v4 格式）
+func newProviderUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return legacyProviderUID("random", strconv.FormatInt(time.Now().UnixNano(), 10), "")
+	}
+	return formatProviderUID(b, 4)
+}
+
+// legacyProviderUID 为尚无 UID 的已有 provider 派生 UID：同一配置在不同机器上得到相同结果，
+// 避免配置同步把各自补齐的 UID 当作冲突
+func legacyProviderUID(kind, id, name string) string {
+	sum := sha256.Sum256([]byte(secretStoreKind(kind) + "\x00" + id + "\x00" + name))
+	var b [16]byte
+	copy(b[:], sum[:16])
+	return formatProviderUID(b, 5)
+}
+
+func formatProviderUID(b [16]byte, version byte) string {
+	b[6] = (b[6] & 0x0f) | version<<4
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// migrateProviderNameRows 在事务内迁移所有以 provider name 关联的表，表不存在时跳过
+func migrateProviderNameRows(tx *sql.Tx, platform, oldName, newName string, migrated map[string]int64) error {
+	steps := []struct {
+		table string
+		query string
+		args  []interface{}
+		count bool // 是否计入迁移行数
+	}{
+		// 新名称下的残留黑名单记录（来自已删除的同名 provider）会与 UNIQUE 约束冲突，先清理
+		{"provider_blacklist", `DELETE FROM provider_blacklist WHERE platform = ? AND provider_name = ?`, []interface{}{platform, newName}, false},
+		{"provider_blacklist", `UPDATE provider_blacklist SET provider_name = ? WHERE platform = ? AND provider_name = ?`, []interface{}{newName, platform, oldName}, true},
+		{"request_log", `UPDATE request_log SET provider = ? WHERE platform = ? AND provider = ?`, []interface{}{newName, platform, oldName}, true},
+		// 汇总表主键含 provider：与新名称下已有的行合并累加后删除旧行
+		{requestLogRollupTable, requestLogRollupRenameSQL(), []interface{}{newName, platform, oldName}, true},
+		{requestLogRollupTable, fmt.Sprintf(`DELETE FROM %s WHERE platform = ? AND provider = ?`, requestLogRollupTable), []interface{}{platform, oldName}, false},
+		{"health_check_history", `UPDATE health_check_history SET provider_name = ? WHERE platform = ? AND provider_name = ?`, []interface{}{newName, platform, oldName}, true},
+		{providerEventsTable, `UPDATE provider_events SET provider_name = ? WHERE platform = ? AND provider_name = ?`, []interface{}{newName, platform, oldName}, true},
+	}
+	for _, step := range steps {
+		res, err := tx.Exec(step.query, step.args...)
+		if err != nil {
+			if isNoSuchTableErr(err) {
+				continue
+			}
+			return fmt.Errorf("迁移 %s 失败: %w", step.table, err)
+		}
+		if step.count {
+			if affected, err := res.RowsAffected(); err == nil {
+				migrated[step.table] = affected
+			}
+		}
+	}
+	return nil
+}
+
+// requestLogRollupRenameSQL 把旧名称的汇总行复制到新名称（冲突时累加）
+func requestLogRollupRenameSQL() string {
+	columns := append([]string{"bucket_hour", "platform", "provider", "model", "http_code", "is_stream"}, requestLogRollupValueColumns...)
+	columns = append(columns, "duration_max")
+	selects := append([]string{}, columns...)
+	selects[2] = "?"
+	return fmt.Sprintf(`INSERT INTO %s (%s)
+		SELECT %s FROM %s WHERE platform = ? AND provider = ?
+		ON CONFLICT(bucket_hour, platform, provider, model, http_code, is_stream) DO UPDATE SET %s`,
+		requestLogRollupTable,
+		strings.Join(columns, ", "),
+		strings.Join(selects, ", "),
+		requestLogRollupTable,
+		requestLogRollupMergeClause(),
+	)
+}
+
+// renameRuntimeState 同步各服务中以 name 为 key 的内存状态与配置
+func (rs *ProviderRenameService) renameRuntimeState(platform string, providerID int64, oldName, newName string) {
+	if rs.blacklistService != nil {
+		rs.blacklistService.renameProvider(platform, oldName, newName)
+	}
+	if rs.healthCheck != nil {
+		rs.healthCheck.renameProvider(platform, providerID, oldName, newName)
+	}
+	if rs.relay != nil {
+		rs.relay.renameLastUsed(platform, oldName, newName)
+	}
+	if rs.budgetService != nil {
+		if err := rs.budgetService.renameProvider(platform, oldName, newName); err != nil {
+			log.Printf("[ProviderRename] 更新预算规则失败: %v", err)
+		}
+	}
+	if rs.logService != nil {
+		if err := rs.logService.renamePricingProvider(platform, oldName, newName); err != nil {
+			log.Printf("[ProviderRename] 更新计价配置失败: %v", err)
+		}
+	}
+}
+
+// renameProviderStateKeys 迁移 "platform:name" 与 "platform:name:model" 形式的内存状态键
+func renameProviderStateKeys[T any](m map[string]T, platform, oldName, newName string) {
+	oldKey := platform + ":" + oldName
+	moved := make(map[string]T)
+	for key, value := range m {
+		if key != oldKey && !strings.HasPrefix(key, oldKey+":") {
+			continue
+		}
+		moved[platform+":"+newName+strings.TrimPrefix(key, oldKey)] = value
+		delete(m, key)
+	}
+	for key, value := range moved {
+		m[key] = value
+	}
+}
+
+// renameProvider 迁移滑动窗口统计；半开试探名额是瞬时状态，直接丢弃，按新名称重新计数
+func (bs *BlacklistService) renameProvider(platform, oldName, newName string) {
+	bs.rateMu.Lock()
+	renameProviderStateKeys(bs.rateWindows, platform, oldName, newName)
+	bs.rateMu.Unlock()
+
+	oldKey := platform + ":" + oldName
+	bs.circuitMu.Lock()
+	for key := range bs.halfOpenTrials {
+		if key == oldKey || strings.HasPrefix(key, oldKey+":") {
+			delete(bs.halfOpenTrials, key)
+		}
+	}
+	bs.circuitMu.Unlock()
+}
+
+// renameProvider 迁移失败计数、巡检调度、被动评分样本与最新检测结果
+func (hcs *HealthCheckService) renameProvider(platform string, providerID int64, oldName, newName string) {
+	hcs.mu.Lock()
+	renameProviderStateKeys(hcs.failCounters, platform, oldName, newName)
+	if counter := hcs.failCounters[platform+":"+newName]; counter != nil {
+		counter.ProviderName = newName
+	}
+	if result := hcs.latestResults[platform][providerID]; result != nil {
+		result.ProviderName = newName
+	}
+	hcs.mu.Unlock()
+
+	hcs.scheduleMu.Lock()
+	renameProviderStateKeys(hcs.schedules, platform, oldName, newName)
+	hcs.scheduleMu.Unlock()
+
+	hcs.passiveMu.Lock()
+	renameProviderStateKeys(hcs.passiveSamples, platform, oldName, newName)
+	for i := range hcs.passiveSamples[platform+":"+newName] {
+		hcs.passiveSamples[platform+":"+newName][i].ProviderName = newName
+	}
+	hcs.passiveMu.Unlock()
+}
+
+// renameLastUsed 更新最后使用的供应商名称
+func (prs *ProviderRelayService) renameLastUsed(platform, oldName, newName string) {
+	prs.lastUsedMu.Lock()
+	defer prs.lastUsedMu.Unlock()
+	if last := prs.lastUsed[platform]; last != nil && last.ProviderName == oldName {
+		last.ProviderName = newName
+	}
+}
+
+// renameProvider 更新 provider 级预算规则，并把当前周期的消费累计迁移到新名称
+func (bs *BudgetService) renameProvider(platform, oldName, newName string) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	for _, window := range bs.windows {
+		oldKey := budgetSpendKey{Platform: platform, Provider: oldName}
+		if spend, ok := window.Spend[oldKey]; ok {
+			window.Spend[budgetSpendKey{Platform: platform, Provider: newName}] += spend
+			delete(window.Spend, oldKey)
+		}
+	}
+
+	config, err := bs.loadConfigLocked()
+	if err != nil {
+		return err
+	}
+	updated := cloneBudgetConfig(config)
+	changed := false
+	for i, rule := range updated.Rules {
+		if rule.Scope == BudgetScopeProvider && strings.EqualFold(rule.Platform, platform) && strings.EqualFold(rule.Provider, oldName) {
+			updated.Rules[i].Provider = newName
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	configPath, err := GetBudgetConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := AtomicWriteJSON(configPath, updated); err != nil {
+		return fmt.Errorf("保存预算配置失败: %w", err)
+	}
+	bs.config = &updated
+	return nil
+}
+
+// renamePricingProvider 更新 provider 级计价覆盖
+func (ls *LogService) renamePricingProvider(platform, oldName, newName string) error {
+	config, err := ls.GetPricingConfig()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i, override := range config.Providers {
+		if pricingProviderKey(override.Platform, override.Provider) == pricingProviderKey(platform, oldName) {
+			config.Providers[i].Provider = newName
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return ls.SavePricingConfig(config)
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRenameProviderStateKeys(t *testing.T) {
+	m := map[string]int{
+		"claude:old":       1,
+		"claude:old:gpt-5": 2,
+		"claude:older":     3,
+		"codex:old":        4,
+	}
+	// 新名称以旧名称开头时也不能被重复迁移
+	renameProviderStateKeys(m, "claude", "old", "old:v2")
+	want := map[string]int{
+		"claude:old:v2":       1,
+		"claude:old:v2:gpt-5": 2,
+		"claude:older":        3,
+		"codex:old":           4,
+	}
+	if len(m) != len(want) {
+		t.Fatalf("keys = %v", m)
+	}
+	for key, value := range want {
+		if m[key] != value {
+			t.Fatalf("m[%q] = %d, want %d (all: %v)", key, m[key], value, m)
+		}
+	}
+}
+
+func TestProviderRename_RuntimeState(t *testing.T) {
+	isolateHomeDir(t)
+
+	bs := NewBlacklistService(nil, nil)
+	bs.rateWindows["claude:old"] = &rateWindow{TripReason: "error rate"}
+	bs.halfOpenTrials["claude:old"] = &halfOpenTrial{InFlight: 1}
+
+	hcs := NewHealthCheckService(nil, nil, nil)
+	hcs.failCounters["claude:old"] = &AvailabilityFailureCounter{Platform: "claude", ProviderName: "old"}
+	hcs.latestResults["claude"][7] = &HealthCheckResult{ProviderID: 7, ProviderName: "old"}
+	hcs.passiveSamples["claude:old"] = []PassiveOutcome{{Platform: "claude", ProviderName: "old"}}
+
+	relay := NewProviderRelayService(nil, nil, nil, nil, "127.0.0.1:0")
+	relay.lastUsed["claude"] = &LastUsedProvider{Platform: "claude", ProviderName: "old"}
+
+	budget := NewBudgetService(nil)
+	if err := budget.SaveBudgetConfig(BudgetConfig{Rules: []BudgetRule{
+		{ID: "r1", Scope: BudgetScopeProvider, Platform: "claude", Provider: "OLD", Period: BudgetPeriodDaily, LimitUSD: 5},
+		{ID: "r2", Scope: BudgetScopeProvider, Platform: "codex", Provider: "old", Period: BudgetPeriodDaily, LimitUSD: 5},
+	}}); err != nil {
+		t.Fatalf("save budget: %v", err)
+	}
+	budget.windows[BudgetPeriodDaily] = &budgetSpendWindow{Loaded: true, Spend: map[budgetSpendKey]float64{
+		{Platform: "claude", Provider: "old"}: 1.5,
+		{Platform: "claude", Provider: "new"}: 0.5,
+	}}
+
+	rs := NewProviderRenameService(nil, nil, bs, hcs, relay, budget, nil)
+	rs.renameRuntimeState("claude", 7, "old", "new")
+
+	if bs.rateWindows["claude:new"] == nil || bs.rateWindows["claude:old"] != nil || len(bs.halfOpenTrials) != 0 {
+		t.Fatalf("blacklist state = %v / %v", bs.rateWindows, bs.halfOpenTrials)
+	}
+	if counter := hcs.failCounters["claude:new"]; counter == nil || counter.ProviderName != "new" {
+		t.Fatalf("fail counters = %v", hcs.failCounters)
+	}
+	if hcs.latestResults["claude"][7].ProviderName != "new" || hcs.passiveSamples["claude:new"][0].ProviderName != "new" {
+		t.Fatal("health state not renamed")
+	}
+	if relay.lastUsed["claude"].ProviderName != "new" {
+		t.Fatalf("last used = %+v", relay.lastUsed["claude"])
+	}
+	if spend := budget.windows[BudgetPeriodDaily].Spend[budgetSpendKey{Platform: "claude", Provider: "new"}]; spend != 2 {
+		t.Fatalf("budget spend = %v", spend)
+	}
+	config, _ := budget.GetBudgetConfig()
+	if config.Rules[0].Provider != "new" || config.Rules[1].Provider != "old" {
+		t.Fatalf("budget rules = %+v", config.Rules)
+	}
+}
+
+func TestProviderRename_MigratesDatabaseRows(t *testing.T) {
+	db := useTestDatabase(t)
+	if err := NewHealthCheckService(nil, nil, nil).ensureTable(); err != nil {
+		t.Fatalf("ensure health table: %v", err)
+	}
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "old"}, {ID: 2, Name: "other"}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+	providers, _ := ps.LoadProviders("claude")
+	uid := providers[0].UID
+	if uid == "" || uid == providers[1].UID {
+		t.Fatalf("providers should get distinct UIDs: %+v", providers)
+	}
+
+	for i := 0; i < 2; i++ {
+		writeTestRequestLog(t, ReqeustLog{Platform: "claude", Provider: "old", Model: "m", HttpCode: 200, InputTokens: 10})
+	}
+	writeTestRequestLog(t, ReqeustLog{Platform: "codex", Provider: "old", Model: "m", HttpCode: 200})
+	for _, stmt := range []string{
+		`INSERT INTO provider_blacklist (platform, provider_name, model) VALUES ('claude', 'old', '')`,
+		// 已删除的同名 provider 残留的黑名单记录
+		`INSERT INTO provider_blacklist (platform, provider_name, model) VALUES ('claude', 'new', '')`,
+		`INSERT INTO health_check_history (provider_id, provider_name, platform, status) VALUES (1, 'old', 'claude', 'operational')`,
+		`INSERT INTO provider_events (platform, provider_name, event_type, created_at) VALUES ('claude', 'old', 'blacklisted', '2026-01-01 00:00:00')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+
+	rs := NewProviderRenameService(ps, nil, nil, nil, nil, nil, nil)
+	if _, err := rs.RenameProvider("claude", 1, "OTHER"); err == nil {
+		t.Fatal("rename onto an existing name should fail")
+	}
+	result, err := rs.RenameProvider("claude", 1, "new")
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if result.ProviderUID != uid || result.MigratedRows["request_log"] != 2 || result.MigratedRows["provider_blacklist"] != 1 ||
+		result.MigratedRows["health_check_history"] != 1 || result.MigratedRows[providerEventsTable] != 2 { // 新增事件 + 预置事件
+		t.Fatalf("result = %+v", result)
+	}
+
+	count := func(query string, args ...interface{}) int {
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+	if n := count(`SELECT COUNT(*) FROM request_log WHERE platform = 'claude' AND provider = 'new'`); n != 2 {
+		t.Fatalf("claude request_log rows under new name = %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM request_log WHERE platform = 'codex' AND provider = 'old'`); n != 1 {
+		t.Fatalf("other platforms must not be touched, codex rows = %d", n)
+	}
+	if n := count(`SELECT COALESCE(SUM(total_requests), 0) FROM ` + requestLogRollupTable + ` WHERE platform = 'claude' AND provider = 'new'`); n != 2 {
+		t.Fatalf("rollup requests under new name = %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM ` + requestLogRollupTable + ` WHERE platform = 'claude' AND provider = 'old'`); n != 0 {
+		t.Fatalf("rollup rows left under old name = %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM provider_blacklist WHERE platform = 'claude'`); n != 1 {
+		t.Fatalf("blacklist rows = %d, want only the migrated one", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM health_check_history WHERE provider_name = 'new'`); n != 1 {
+		t.Fatalf("health history rows = %d", n)
+	}
+
+	// 改名后 UID 不变；前端保存时不带 uid 也会沿用
+	providers, _ = ps.LoadProviders("claude")
+	if providers[0].Name != "new" || providers[0].UID != uid {
+		t.Fatalf("providers after rename = %+v", providers)
+	}
+	providers[0].UID = ""
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatalf("save without uid: %v", err)
+	}
+	if providers, _ = ps.LoadProviders("claude"); providers[0].UID != uid {
+		t.Fatalf("uid should survive a save without it, got %q", providers[0].UID)
+	}
+}
+
+func TestProviderRename_Gemini(t *testing.T) {
+	db := useTestDatabase(t)
+
+	gs := NewGeminiService("127.0.0.1:0")
+	if err := gs.AddProvider(GeminiProvider{ID: "g1", Name: "old", BaseURL: "https://g.example.com"}); err != nil {
+		t.Fatalf("add gemini provider: %v", err)
+	}
+	renamedGP := gs.GetProviders()[0]
+	renamedGP.Name = "new"
+	if err := gs.UpdateProvider(renamedGP); err == nil || !strings.Contains(err.Error(), "改名") {
+		t.Fatalf("update should refuse a rename, got %v", err)
+	}
+	writeTestRequestLog(t, ReqeustLog{Platform: "gemini", Provider: "old", Model: "gemini-2.5-pro", HttpCode: 200})
+
+	hcs := NewHealthCheckService(nil, nil, nil)
+	hcs.latestResults["gemini"][geminiProviderID("g1")] = &HealthCheckResult{ProviderName: "old"}
+	rs := NewProviderRenameService(nil, gs, nil, hcs, nil, nil, nil)
+	result, err := rs.RenameGeminiProvider("g1", "new")
+	if err != nil {
+		t.Fatalf("rename gemini: %v", err)
+	}
+	if result.ProviderID != geminiProviderID("g1") || result.MigratedRows["request_log"] != 1 || result.ProviderUID == "" {
+		t.Fatalf("result = %+v", result)
+	}
+	if hcs.latestResults["gemini"][result.ProviderID].ProviderName != "new" {
+		t.Fatal("gemini health state not renamed")
+	}
+
+	var provider string
+	if err := db.QueryRow(`SELECT provider FROM request_log WHERE platform = 'gemini'`).Scan(&provider); err != nil || provider != "new" {
+		t.Fatalf("gemini request_log provider = %q, %v", provider, err)
+	}
+	reloaded := NewGeminiService("127.0.0.1:0").GetProviders()
+	if len(reloaded) != 1 || reloaded[0].Name != "new" || reloaded[0].UID != result.ProviderUID {
+		t.Fatalf("gemini providers on disk = %+v", reloaded)
+	}
+}
+
+func TestMigrateProviderName_RollbackKeepsConfig(t *testing.T) {
+	db := useTestDatabase(t)
+	if _, err := db.Exec(`INSERT INTO provider_blacklist (platform, provider_name, model) VALUES ('claude', 'old', '')`); err != nil {
+		t.Fatalf("seed blacklist: %v", err)
+	}
+
+	restored := 0
+	err := migrateProviderName("claude", "old", "new", map[string]int64{},
+		func() error { return fmt.Errorf("disk full") },
+		func() error { restored++; return nil })
+	if err == nil {
+		t.Fatal("expected the rename to fail when writing the config fails")
+	}
+	if restored != 0 {
+		t.Fatalf("config was never written, restore calls = %d", restored)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM provider_blacklist WHERE provider_name = 'old'`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("rows should be rolled back, old rows = %d, err = %v", n, err)
+	}
+}
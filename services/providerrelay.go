@@ -31,10 +31,15 @@ type LastUsedProvider struct {
 type ProviderRelayService struct {
 	providerService     *ProviderService
 	geminiService       *GeminiService
+	passiveHealth       PassiveHealthRecorder // 可选：真实转发结果上报给可用性监控
+	statusHealth        *HealthCheckService   // 可选：状态页数据源
+	statusSettings      *AppSettingsService   // 可选：状态页开关与访问令牌
 	blacklistService    *BlacklistService
 	notificationService *NotificationService
+	budgetService       *BudgetService
 	concurrencyManager  *ProviderConcurrencyManager
 	server              *http.Server
+	serverMu            sync.Mutex // 保护 server（解锁回调可能与应用启动并发调用 Start）
 	addr                string
 	lastUsed            map[string]*LastUsedProvider // 各平台最后使用的供应商
 	lastUsedMu          sync.RWMutex                 // 保护 lastUsed 的锁
@@ -118,6 +123,11 @@ func NewProviderRelayService(providerService *ProviderService, geminiService *Ge
 	}
 }
 
+// SetBudgetService 设置预算服务（用于消费上限拦截与消费累计）
+func (prs *ProviderRelayService) SetBudgetService(budgetService *BudgetService) {
+	prs.budgetService = budgetService
+}
+
 // setLastUsedProvider 记录最后使用的供应商
 // @author sm
 func (prs *ProviderRelayService) setLastUsedProvider(platform, providerName string) {
@@ -151,6 +161,16 @@ func (prs *ProviderRelayService) GetAllLastUsedProviders() map[string]*LastUsedP
 }
 
 func (prs *ProviderRelayService) Start() error {
+	// 密钥库锁定时配置中的 API Key 仍是引用，拒绝启动（解锁后由 SecretVaultService 回调再次启动）
+	if secretVaultLocked() {
+		return errSecretVaultLocked
+	}
+	prs.serverMu.Lock()
+	defer prs.serverMu.Unlock()
+	if prs.server != nil {
+		return nil
+	}
+
 	// 启动前验证配置
 	if warnings := prs.validateConfig(); len(warnings) > 0 {
 		fmt.Println("======== Provider 配置验证警告 ========")
@@ -163,15 +183,16 @@ func (prs *ProviderRelayService) Start() error {
 	router := gin.Default()
 	prs.registerRoutes(router)
 
-	prs.server = &http.Server{
+	server := &http.Server{
 		Addr:    prs.addr,
 		Handler: router,
 	}
+	prs.server = server
 
 	fmt.Printf("provider relay server listening on %s\n", prs.addr)
 
 	go func() {
-		if err := prs.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("provider relay server error: %v\n", err)
 		}
 	}()
@@ -182,6 +203,10 @@ func (prs *ProviderRelayService) Start() error {
 // 返回警告列表（非阻塞性错误）
 func (prs *ProviderRelayService) validateConfig() []string {
 	warnings := make([]string, 0)
+	discovered, err := loadModelDiscoveryStore()
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
 
 	for _, kind := range []string{"claude", "codex"} {
 		providers, err := prs.providerService.LoadProviders(kind)
@@ -208,10 +233,19 @@ func (prs *ProviderRelayService) validateConfig() []string {
 			if (p.SupportedModels == nil || len(p.SupportedModels) == 0) &&
 				(p.ModelMapping == nil || len(p.ModelMapping) == 0) {
 				warnings = append(warnings, fmt.Sprintf(
-					"[%s/%s] 未配置 supportedModels 或 modelMapping，将假设支持所有模型（可能导致降级失败）",
+					"[%s/%s] 未配置 supportedModels 或 modelMapping，将假设支持所有模型（可能导致降级失败），可通过发现模型自动生成",
 					kind, p.Name))
 			}
 
+			// 已发现过模型列表时，检查映射目标在上游是否仍然存在
+			if result, ok := discovered[modelDiscoveryKey(kind, p.ID)]; ok {
+				for _, mapping := range unreachableModelMappings(p, result.Models) {
+					warnings = append(warnings, fmt.Sprintf(
+						"[%s/%s] 映射 %s 的目标不在 %s 发现的模型列表中",
+						kind, p.Name, mapping, result.DiscoveredAt.Format("2006-01-02 15:04")))
+				}
+			}
+
 			// 检查是否只配置了映射但没有白名单
 			if len(p.ModelMapping) > 0 && len(p.SupportedModels) == 0 {
 				warnings = append(warnings, fmt.Sprintf(
@@ -229,19 +263,36 @@ func (prs *ProviderRelayService) validateConfig() []string {
 }
 
 func (prs *ProviderRelayService) Stop() error {
-	if prs.server == nil {
+	prs.serverMu.Lock()
+	server := prs.server
+	prs.server = nil
+	prs.serverMu.Unlock()
+	if server == nil {
 		return nil
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return prs.server.Shutdown(ctx)
+	return server.Shutdown(ctx)
 }
 
 func (prs *ProviderRelayService) Addr() string {
 	return prs.addr
 }
 
+// SetPassiveHealthRecorder 注入被动健康评分上报（由可用性监控提供）
+func (prs *ProviderRelayService) SetPassiveHealthRecorder(recorder PassiveHealthRecorder) {
+	prs.passiveHealth = recorder
+}
+
+func (prs *ProviderRelayService) recordPassiveOutcome(outcome PassiveOutcome) {
+	if prs.passiveHealth != nil {
+		prs.passiveHealth(outcome)
+	}
+}
+
 func (prs *ProviderRelayService) registerRoutes(router gin.IRouter) {
+	router.Use(secretVaultGuard())
+
 	router.POST("/v1/messages", prs.proxyHandler("claude", "/v1/messages"))
 	router.POST("/:providerName/v1/messages", prs.proxyHandler("claude", "/v1/messages"))
 
@@ -276,6 +327,10 @@ func (prs *ProviderRelayService) registerRoutes(router gin.IRouter) {
 
 	// 自定义 CLI 工具的 /v1/models 端点
 	router.GET("/custom/:toolId/v1/models", prs.customModelsHandler())
+
+	// 只读状态页（默认关闭，见 status_page.go）
+	router.GET("/status", prs.statusPageHandler(false))
+	router.GET("/status.json", prs.statusPageHandler(true))
 }
 
 func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.HandlerFunc {
@@ -314,6 +369,11 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
 			return
 		}
+		// 仅在有供应商声明模型能力时才遍历请求体推断能力需求
+		var capabilityNeeds requestCapabilityNeeds
+		if providersDeclareCapabilities(providers) {
+			capabilityNeeds = detectRequestCapabilityNeeds(bodyBytes)
+		}
 
 		providerName := strings.TrimSpace(c.Param("providerName"))
 		if providerName != "" {
@@ -351,7 +411,11 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("provider '%s' does not support model '%s'", provider.Name, requestedModel)})
 				return
 			}
-			if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
+			if reason := provider.CapabilityMismatch(requestedModel, capabilityNeeds); reason != "" {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("provider '%s' cannot handle this request: %s", provider.Name, reason)})
+				return
+			}
+			if isBlacklisted, until := prs.blacklistService.IsModelBlacklisted(kind, provider.Name, provider.GetEffectiveModel(requestedModel)); isBlacklisted {
 				c.JSON(http.StatusForbidden, gin.H{
 					"error":       fmt.Sprintf("provider '%s' is blacklisted", provider.Name),
 					"blacklisted": true,
@@ -359,6 +423,10 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				})
 				return
 			}
+			if allowed, reason := prs.budgetService.CheckProvider(kind, provider.Name, provider.FlatRate); !allowed {
+				c.JSON(http.StatusPaymentRequired, gin.H{"error": reason, "budget_exceeded": true})
+				return
+			}
 
 			effectiveModel := provider.GetEffectiveModel(requestedModel)
 			currentBodyBytes := bodyBytes
@@ -377,10 +445,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			if !isResponsesCompactVariantEndpoint(endpoint) {
 				effectiveEndpoint = provider.GetEffectiveEndpoint(endpoint)
 			}
-			release, acquired := prs.concurrencyManager.TryAcquire(
-				providerConcurrencyKey(kind, provider.Name),
-				provider.MaxConcurrentRequests,
-			)
+			release, acquired := prs.acquireProviderSlot(kind, provider.Name, effectiveModel, provider.MaxConcurrentRequests)
 			if !acquired {
 				c.JSON(http.StatusTooManyRequests, gin.H{"error": "provider is busy"})
 				return
@@ -389,7 +454,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			ok, forwardErr, responseWritten := prs.forwardRequest(c, kind, provider, effectiveEndpoint, query, clientHeaders, currentBodyBytes, isStream, effectiveModel)
 			release()
 			if ok {
-				if err := prs.blacklistService.RecordSuccess(kind, provider.Name); err != nil {
+				if err := prs.blacklistService.RecordModelSuccess(kind, provider.Name, effectiveModel); err != nil {
 					fmt.Printf("[WARN] 清零失败计数失败: %v\n", err)
 				}
 				prs.setLastUsedProvider(kind, provider.Name)
@@ -399,7 +464,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			if errors.Is(forwardErr, errClientAbort) {
 				return
 			}
-			if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
+			if err := prs.blacklistService.RecordModelFailure(kind, provider.Name, effectiveModel, forwardErr); err != nil {
 				fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
 			}
 			if responseWritten {
@@ -419,6 +484,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 		active := make([]Provider, 0, len(providers))
 		skippedCount := 0
+		budgetReason := ""
 		for _, provider := range providers {
 			// 基础过滤：enabled、URL、APIKey
 			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
@@ -439,17 +505,36 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				continue
 			}
 
+			// 能力过滤：声明的模型能力无法满足请求（图片、工具、上下文长度等）
+			if reason := provider.CapabilityMismatch(requestedModel, capabilityNeeds); reason != "" {
+				fmt.Printf("[INFO] Provider %s %s，已跳过\n", provider.Name, reason)
+				skippedCount++
+				continue
+			}
+
 			// 黑名单检查：跳过已拉黑的 provider
-			if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
+			if isBlacklisted, until := prs.blacklistService.IsModelBlacklisted(kind, provider.Name, provider.GetEffectiveModel(requestedModel)); isBlacklisted {
 				fmt.Printf("⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
 				skippedCount++
 				continue
 			}
 
+			// 预算检查：超出消费上限的 provider 不再转发
+			if allowed, reason := prs.budgetService.CheckProvider(kind, provider.Name, provider.FlatRate); !allowed {
+				fmt.Printf("💰 Provider %s 已跳过: %s\n", provider.Name, reason)
+				budgetReason = reason
+				skippedCount++
+				continue
+			}
+
 			active = append(active, provider)
 		}
 
 		if len(active) == 0 {
+			if budgetReason != "" {
+				c.JSON(http.StatusPaymentRequired, gin.H{"error": budgetReason, "budget_exceeded": true})
+				return
+			}
 			if requestedModel != "" {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount),
@@ -516,7 +601,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 				for _, provider := range providersInLevel {
 					// 检查是否已被拉黑（跳过已拉黑的 provider）
-					if blacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
+					if blacklisted, until := prs.blacklistService.IsModelBlacklisted(kind, provider.Name, provider.GetEffectiveModel(requestedModel)); blacklisted {
 						fmt.Printf("[INFO] ⏭️ 跳过已拉黑的 Provider: %s (解禁时间: %v)\n", provider.Name, until)
 						continue
 					}
@@ -546,7 +631,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 					var lastAttemptErr error
 					for attempt := 0; attempt < maxRetryPerProvider; attempt++ {
 						// 再次检查是否已被拉黑（重试过程中可能被拉黑）
-						if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
+						if blacklisted, _ := prs.blacklistService.IsModelBlacklisted(kind, provider.Name, provider.GetEffectiveModel(requestedModel)); blacklisted {
 							fmt.Printf("[INFO] 🚫 Provider %s 已被拉黑，切换到下一个\n", provider.Name)
 							break
 						}
@@ -554,10 +639,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 						fmt.Printf("[INFO] [拉黑模式] Provider: %s (Level %d) | 重试 %d/%d | Model: %s\n",
 							provider.Name, level, attempt+1, maxRetryPerProvider, effectiveModel)
 
-						release, acquired := prs.concurrencyManager.TryAcquire(
-							providerConcurrencyKey(kind, provider.Name),
-							provider.MaxConcurrentRequests,
-						)
+						release, acquired := prs.acquireProviderSlot(kind, provider.Name, effectiveModel, provider.MaxConcurrentRequests)
 						if !acquired {
 							busySkipped++
 							fmt.Printf("[INFO] ⏭️ Provider %s 达到并发上限(%d)，跳过到下一个\n", provider.Name, provider.MaxConcurrentRequests)
@@ -576,7 +658,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 						if ok {
 							fmt.Printf("[INFO] ✓ 成功: %s | 重试 %d 次 | 耗时: %.2fs\n",
 								provider.Name, attempt+1, duration.Seconds())
-							if err := prs.blacklistService.RecordSuccess(kind, provider.Name); err != nil {
+							if err := prs.blacklistService.RecordModelSuccess(kind, provider.Name, effectiveModel); err != nil {
 								fmt.Printf("[WARN] 清零失败计数失败: %v\n", err)
 							}
 							prs.setLastUsedProvider(kind, provider.Name)
@@ -600,8 +682,8 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 						if responseWritten {
 							fmt.Printf("[WARN] 响应已写入客户端，停止重试与降级\n")
-							if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
-								fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+							if recordErr := prs.blacklistService.RecordModelFailure(kind, provider.Name, effectiveModel, err); recordErr != nil {
+								fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", recordErr)
 							}
 							return
 						}
@@ -621,7 +703,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 					if attemptedCount > 0 {
 						lastError = lastAttemptErr
 						lastProvider = provider.Name
-						if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
+						if err := prs.blacklistService.RecordModelFailure(kind, provider.Name, effectiveModel, lastAttemptErr); err != nil {
 							fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
 						}
 					}
@@ -694,10 +776,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				if !isResponsesCompactVariantEndpoint(endpoint) {
 					effectiveEndpoint = provider.GetEffectiveEndpoint(endpoint)
 				}
-				release, acquired := prs.concurrencyManager.TryAcquire(
-					providerConcurrencyKey(kind, provider.Name),
-					provider.MaxConcurrentRequests,
-				)
+				release, acquired := prs.acquireProviderSlot(kind, provider.Name, effectiveModel, provider.MaxConcurrentRequests)
 				if !acquired {
 					busySkipped++
 					fmt.Printf("[INFO]   ⏭️ Provider %s 达到并发上限(%d)，跳过\n", provider.Name, provider.MaxConcurrentRequests)
@@ -715,7 +794,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 					fmt.Printf("[INFO]   ✓ Level %d 成功: %s | 耗时: %.2fs\n", level, provider.Name, duration.Seconds())
 
 					// 成功：清零连续失败计数
-					if err := prs.blacklistService.RecordSuccess(kind, provider.Name); err != nil {
+					if err := prs.blacklistService.RecordModelSuccess(kind, provider.Name, effectiveModel); err != nil {
 						fmt.Printf("[WARN] 清零失败计数失败: %v\n", err)
 					}
 
@@ -740,8 +819,8 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				// 客户端中断不计入失败次数
 				if errors.Is(err, errClientAbort) {
 					fmt.Printf("[INFO] 客户端中断，跳过失败计数: %s\n", provider.Name)
-				} else if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
-					fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
+				} else if recordErr := prs.blacklistService.RecordModelFailure(kind, provider.Name, effectiveModel, err); recordErr != nil {
+					fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", recordErr)
 				}
 
 				if responseWritten {
@@ -804,6 +883,24 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 	}
 }
 
+// acquireProviderSlot 占用 provider 的并发名额；半开熔断时同时占用一个试探名额，任一名额已满返回 false
+func (prs *ProviderRelayService) acquireProviderSlot(kind string, providerName string, model string, maxConcurrent int) (func(), bool) {
+	release, acquired := prs.concurrencyManager.TryAcquire(providerConcurrencyKey(kind, providerName), maxConcurrent)
+	if !acquired {
+		return nil, false
+	}
+	endTrial, acquired := prs.blacklistService.BeginTrial(kind, providerName, model)
+	if !acquired {
+		release()
+		fmt.Printf("[INFO] Provider %s 半开试探名额已满\n", providerName)
+		return nil, false
+	}
+	return func() {
+		endTrial()
+		release()
+	}, true
+}
+
 func (prs *ProviderRelayService) forwardRequest(
 	c *gin.Context,
 	kind string,
@@ -814,7 +911,28 @@ func (prs *ProviderRelayService) forwardRequest(
 	bodyBytes []byte,
 	isStream bool,
 	model string,
-) (bool, error, bool) {
+) (success bool, forwardErr error, responseWritten bool) {
+	// 记录本次尝试结果到滑动窗口与被动健康评分（客户端中断不计入）
+	attemptStart := time.Now()
+	var responseLatency, firstTokenLatency time.Duration
+	defer func() {
+		if errors.Is(forwardErr, errClientAbort) {
+			return
+		}
+		if responseLatency == 0 {
+			responseLatency = time.Since(attemptStart)
+		}
+		prs.blacklistService.RecordOutcome(kind, provider.Name, model, success, responseLatency)
+		prs.recordPassiveOutcome(PassiveOutcome{
+			Platform:          kind,
+			ProviderName:      provider.Name,
+			Success:           success,
+			Latency:           time.Since(attemptStart),
+			FirstTokenLatency: firstTokenLatency,
+			ZeroTokens:        errors.Is(forwardErr, errTokenZero),
+		})
+	}()
+
 	targetURL := joinURL(provider.APIURL, endpoint)
 	headers := cloneMap(clientHeaders)
 
@@ -882,17 +1000,20 @@ func (prs *ProviderRelayService) forwardRequest(
 			return
 		}
 
+		rollupDelta := newRequestLogRollupDelta(requestLog)
+		prs.budgetService.recordRequestSpend(rollupDelta)
+
 		// 【修复】判空保护：避免队列未初始化时 panic
 		if GlobalDBQueueLogs == nil {
 			fmt.Printf("⚠️  写入 request_log 失败: 队列未初始化\n")
 			return
 		}
 
-		// 使用批量队列写入 request_log（高频同构操作，批量提交）
+		// 使用批量队列写入 request_log（高频同构操作，批量提交），同时携带汇总增量
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err := GlobalDBQueueLogs.ExecBatchCtx(ctx, `
+		err := GlobalDBQueueLogs.ExecBatchMetaCtx(ctx, rollupDelta, `
 			INSERT INTO request_log (
 				platform, model, provider, http_code,
 				input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
@@ -925,6 +1046,7 @@ func (prs *ProviderRelayService) forwardRequest(
 	}()
 
 	resp, err := executeUpstreamRequest(targetURL, headers, query, bodyBytes)
+	responseLatency = time.Since(attemptStart)
 
 	// 无论成功失败，先尝试记录 HttpCode
 	if resp != nil {
@@ -969,6 +1091,7 @@ func (prs *ProviderRelayService) forwardRequest(
 		}
 
 		resp, err = executeUpstreamRequest(targetURL, retryHeaders, query, retryBody)
+		responseLatency = time.Since(attemptStart)
 		requestLog.HttpCode = 0
 		if resp != nil {
 			requestLog.HttpCode = resp.StatusCode()
@@ -1077,7 +1200,13 @@ func (prs *ProviderRelayService) forwardRequest(
 		if kind == "codex" && responseChainPlan.Active && responseChainPlan.SessionKey != "" {
 			c.Writer.Header().Set(codexResponseChainSessionHeader, responseChainPlan.SessionKey)
 		}
-		_, copyErr := resp.ToHttpResponseWriter(c.Writer, ReqeustLogHook(c, kind, requestLog, chainCapture))
+		logHook := ReqeustLogHook(c, kind, requestLog, chainCapture)
+		_, copyErr := resp.ToHttpResponseWriter(c.Writer, func(data []byte) (bool, []byte) {
+			if firstTokenLatency == 0 {
+				firstTokenLatency = time.Since(attemptStart)
+			}
+			return logHook(data)
+		})
 		if copyErr != nil {
 			fmt.Printf("[WARN] 复制响应到客户端失败（不影响provider成功判定）: %v\n", copyErr)
 			return true, nil, true
@@ -1253,6 +1382,9 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 	if err := ensureRequestLogColumn(db, "codex_prompt_cache_fingerprint", "TEXT DEFAULT ''"); err != nil {
 		return err
 	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_request_log_created_at ON request_log(created_at)`); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -1672,6 +1804,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 
 		// 1. 过滤可用的 providers（启用 + BaseURL 配置 + 未被拉黑）
 		var activeProviders []GeminiProvider
+		budgetReason := ""
 		for _, p := range providers {
 			if !p.Enabled || p.BaseURL == "" {
 				continue
@@ -1681,6 +1814,12 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 				fmt.Printf("[Gemini] ⛔ Provider %s 已拉黑，过期时间: %v\n", p.Name, until.Format("15:04:05"))
 				continue
 			}
+			// 预算检查
+			if allowed, reason := prs.budgetService.CheckProvider("gemini", p.Name, p.FlatRate); !allowed {
+				fmt.Printf("[Gemini] 💰 Provider %s 已跳过: %s\n", p.Name, reason)
+				budgetReason = reason
+				continue
+			}
 			// Level 默认值处理
 			if p.Level <= 0 {
 				p.Level = 1
@@ -1689,6 +1828,10 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		}
 
 		if len(activeProviders) == 0 {
+			if budgetReason != "" {
+				c.JSON(http.StatusPaymentRequired, gin.H{"error": budgetReason, "budget_exceeded": true})
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "no active gemini provider (all disabled or blacklisted)"})
 			return
 		}
@@ -1720,12 +1863,14 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		// 保存日志的 defer
 		defer func() {
 			requestLog.DurationSec = time.Since(start).Seconds()
+			rollupDelta := newRequestLogRollupDelta(requestLog)
+			prs.budgetService.recordRequestSpend(rollupDelta)
 			if GlobalDBQueueLogs == nil {
 				return
 			}
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
-			_ = GlobalDBQueueLogs.ExecBatchCtx(ctx, `
+			_ = GlobalDBQueueLogs.ExecBatchMetaCtx(ctx, rollupDelta, `
 				INSERT INTO request_log (
 					platform, model, provider, http_code,
 					input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
@@ -1789,10 +1934,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 						fmt.Printf("[Gemini] [拉黑模式] Provider: %s (Level %d) | 重试 %d/%d\n",
 							provider.Name, level, attempt+1, maxRetryPerProvider)
 
-						release, acquired := prs.concurrencyManager.TryAcquire(
-							providerConcurrencyKey("gemini", provider.Name),
-							provider.MaxConcurrentRequests,
-						)
+						release, acquired := prs.acquireProviderSlot("gemini", provider.Name, "", provider.MaxConcurrentRequests)
 						if !acquired {
 							busySkipped++
 							fmt.Printf("[Gemini] ⏭️ Provider %s 达到并发上限(%d)，跳过到下一个\n", provider.Name, provider.MaxConcurrentRequests)
@@ -1815,7 +1957,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 						// 【关键修复】如果响应已写入客户端，不能重试或降级，直接返回
 						if responseWritten {
 							fmt.Printf("[Gemini] ⚠️ 响应已部分写入，无法重试: %s | 错误: %s\n", provider.Name, errMsg)
-							_ = prs.blacklistService.RecordFailure("gemini", provider.Name)
+							_ = prs.blacklistService.RecordFailure("gemini", provider.Name, errMsg)
 							return
 						}
 
@@ -1840,7 +1982,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 					if attemptedCount > 0 {
 						lastError = lastAttemptErrMsg
 						lastProvider = provider.Name
-						_ = prs.blacklistService.RecordFailure("gemini", provider.Name)
+						_ = prs.blacklistService.RecordFailure("gemini", provider.Name, lastAttemptErrMsg)
 					}
 				}
 			}
@@ -1886,10 +2028,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 				requestLog.Provider = provider.Name
 				requestLog.Model = provider.Model
 
-				release, acquired := prs.concurrencyManager.TryAcquire(
-					providerConcurrencyKey("gemini", provider.Name),
-					provider.MaxConcurrentRequests,
-				)
+				release, acquired := prs.acquireProviderSlot("gemini", provider.Name, "", provider.MaxConcurrentRequests)
 				if !acquired {
 					busySkipped++
 					fmt.Printf("[Gemini]   ⏭️ Provider %s 达到并发上限(%d)，跳过\n", provider.Name, provider.MaxConcurrentRequests)
@@ -1910,13 +2049,13 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 				// 【关键修复】如果响应已写入客户端，不能降级到其他 provider，直接返回
 				if responseWritten {
 					fmt.Printf("[Gemini] ⚠️ 响应已部分写入，无法降级: %s | 错误: %s\n", provider.Name, errMsg)
-					_ = prs.blacklistService.RecordFailure("gemini", provider.Name)
+					_ = prs.blacklistService.RecordFailure("gemini", provider.Name, errMsg)
 					return
 				}
 
 				// 失败，记录并继续
 				lastError = errMsg
-				_ = prs.blacklistService.RecordFailure("gemini", provider.Name)
+				_ = prs.blacklistService.RecordFailure("gemini", provider.Name, errMsg)
 			}
 
 			fmt.Printf("[Gemini] Level %d 的所有 %d 个 provider 均失败，尝试下一 Level\n", level, len(providersInLevel))
@@ -1983,6 +2122,25 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 ) (success bool, errMsg string, responseWritten bool) {
 	providerStart := time.Now()
 
+	// 记录本次尝试结果到滑动窗口（客户端中断不计入）
+	var responseLatency time.Duration
+	defer func() {
+		if c.Request != nil && c.Request.Context().Err() != nil {
+			return
+		}
+		if responseLatency == 0 {
+			responseLatency = time.Since(providerStart)
+		}
+		prs.blacklistService.RecordOutcome("gemini", provider.Name, "", success, responseLatency)
+		prs.recordPassiveOutcome(PassiveOutcome{
+			Platform:     "gemini",
+			ProviderName: provider.Name,
+			Success:      success,
+			Latency:      time.Since(providerStart),
+			ZeroTokens:   errMsg == errTokenZero.Error(),
+		})
+	}()
+
 	// 构建目标 URL
 	targetURL := strings.TrimSuffix(provider.BaseURL, "/") + endpoint
 
@@ -2023,7 +2181,8 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 	// 发送请求
 	client := &http.Client{Timeout: 300 * time.Second}
 	resp, err := client.Do(req)
-	providerDuration := time.Since(providerStart).Seconds()
+	responseLatency = time.Since(providerStart)
+	providerDuration := responseLatency.Seconds()
 
 	if err != nil {
 		fmt.Printf("[Gemini]   ✗ 失败: %s | 错误: %v | 耗时: %.2fs\n", provider.Name, err, providerDuration)
@@ -2144,10 +2303,16 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to load providers for %s: %v", kind, err)})
 			return
 		}
+		// 仅在有供应商声明模型能力时才遍历请求体推断能力需求
+		var capabilityNeeds requestCapabilityNeeds
+		if providersDeclareCapabilities(providers) {
+			capabilityNeeds = detectRequestCapabilityNeeds(bodyBytes)
+		}
 
 		// 过滤可用的 providers
 		active := make([]Provider, 0, len(providers))
 		skippedCount := 0
+		budgetReason := ""
 		for _, provider := range providers {
 			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
 				continue
@@ -2165,17 +2330,35 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 				continue
 			}
 
+			if reason := provider.CapabilityMismatch(requestedModel, capabilityNeeds); reason != "" {
+				fmt.Printf("[CustomCLI][INFO] Provider %s %s，已跳过\n", provider.Name, reason)
+				skippedCount++
+				continue
+			}
+
 			// 黑名单检查
-			if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
+			if isBlacklisted, until := prs.blacklistService.IsModelBlacklisted(kind, provider.Name, provider.GetEffectiveModel(requestedModel)); isBlacklisted {
 				fmt.Printf("[CustomCLI] ⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
 				skippedCount++
 				continue
 			}
 
+			// 预算检查
+			if allowed, reason := prs.budgetService.CheckProvider(kind, provider.Name, provider.FlatRate); !allowed {
+				fmt.Printf("[CustomCLI] 💰 Provider %s 已跳过: %s\n", provider.Name, reason)
+				budgetReason = reason
+				skippedCount++
+				continue
+			}
+
 			active = append(active, provider)
 		}
 
 		if len(active) == 0 {
+			if budgetReason != "" {
+				c.JSON(http.StatusPaymentRequired, gin.H{"error": budgetReason, "budget_exceeded": true})
+				return
+			}
 			if requestedModel != "" {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount),
@@ -2240,7 +2423,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 				for _, provider := range providersInLevel {
 					// 检查是否已被拉黑（跳过已拉黑的 provider）
-					if blacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
+					if blacklisted, until := prs.blacklistService.IsModelBlacklisted(kind, provider.Name, provider.GetEffectiveModel(requestedModel)); blacklisted {
 						fmt.Printf("[CustomCLI][INFO] ⏭️ 跳过已拉黑的 Provider: %s (解禁时间: %v)\n", provider.Name, until)
 						continue
 					}
@@ -2270,7 +2453,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 					var lastAttemptErr error
 					for attempt := 0; attempt < maxRetryPerProvider; attempt++ {
 						// 再次检查是否已被拉黑（重试过程中可能被拉黑）
-						if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
+						if blacklisted, _ := prs.blacklistService.IsModelBlacklisted(kind, provider.Name, provider.GetEffectiveModel(requestedModel)); blacklisted {
 							fmt.Printf("[CustomCLI][INFO] 🚫 Provider %s 已被拉黑，切换到下一个\n", provider.Name)
 							break
 						}
@@ -2278,10 +2461,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 						fmt.Printf("[CustomCLI][INFO] [拉黑模式] Provider: %s (Level %d) | 重试 %d/%d | Model: %s\n",
 							provider.Name, level, attempt+1, maxRetryPerProvider, effectiveModel)
 
-						release, acquired := prs.concurrencyManager.TryAcquire(
-							providerConcurrencyKey(kind, provider.Name),
-							provider.MaxConcurrentRequests,
-						)
+						release, acquired := prs.acquireProviderSlot(kind, provider.Name, effectiveModel, provider.MaxConcurrentRequests)
 						if !acquired {
 							busySkipped++
 							fmt.Printf("[CustomCLI][INFO] ⏭️ Provider %s 达到并发上限(%d)，跳过到下一个\n", provider.Name, provider.MaxConcurrentRequests)
@@ -2300,7 +2480,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 						if ok {
 							fmt.Printf("[CustomCLI][INFO] ✓ 成功: %s | 重试 %d 次 | 耗时: %.2fs\n",
 								provider.Name, attempt+1, duration.Seconds())
-							if err := prs.blacklistService.RecordSuccess(kind, provider.Name); err != nil {
+							if err := prs.blacklistService.RecordModelSuccess(kind, provider.Name, effectiveModel); err != nil {
 								fmt.Printf("[CustomCLI][WARN] 清零失败计数失败: %v\n", err)
 							}
 							prs.setLastUsedProvider(kind, provider.Name)
@@ -2324,8 +2504,8 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 						if responseWritten {
 							fmt.Printf("[CustomCLI][WARN] 响应已写入客户端，停止重试与降级\n")
-							if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
-								fmt.Printf("[CustomCLI][ERROR] 记录失败到黑名单失败: %v\n", err)
+							if recordErr := prs.blacklistService.RecordModelFailure(kind, provider.Name, effectiveModel, err); recordErr != nil {
+								fmt.Printf("[CustomCLI][ERROR] 记录失败到黑名单失败: %v\n", recordErr)
 							}
 							return
 						}
@@ -2345,7 +2525,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 					if attemptedCount > 0 {
 						lastError = lastAttemptErr
 						lastProvider = provider.Name
-						if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
+						if err := prs.blacklistService.RecordModelFailure(kind, provider.Name, effectiveModel, lastAttemptErr); err != nil {
 							fmt.Printf("[CustomCLI][ERROR] 记录失败到黑名单失败: %v\n", err)
 						}
 					}
@@ -2412,10 +2592,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 					effectiveEndpoint = provider.GetEffectiveEndpoint(endpoint)
 				}
 
-				release, acquired := prs.concurrencyManager.TryAcquire(
-					providerConcurrencyKey(kind, provider.Name),
-					provider.MaxConcurrentRequests,
-				)
+				release, acquired := prs.acquireProviderSlot(kind, provider.Name, effectiveModel, provider.MaxConcurrentRequests)
 				if !acquired {
 					busySkipped++
 					fmt.Printf("[CustomCLI][INFO]   ⏭️ Provider %s 达到并发上限(%d)，跳过\n", provider.Name, provider.MaxConcurrentRequests)
@@ -2431,7 +2608,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 				if ok {
 					fmt.Printf("[CustomCLI][INFO]   ✓ Level %d 成功: %s | 耗时: %.2fs\n", level, provider.Name, duration.Seconds())
-					if err := prs.blacklistService.RecordSuccess(kind, provider.Name); err != nil {
+					if err := prs.blacklistService.RecordModelSuccess(kind, provider.Name, effectiveModel); err != nil {
 						fmt.Printf("[CustomCLI][WARN] 清零失败计数失败: %v\n", err)
 					}
 					prs.setLastUsedProvider(kind, provider.Name)
@@ -2451,8 +2628,8 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 				if errors.Is(err, errClientAbort) {
 					fmt.Printf("[CustomCLI][INFO] 客户端中断，跳过失败计数: %s\n", provider.Name)
-				} else if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
-					fmt.Printf("[CustomCLI][ERROR] 记录失败到黑名单失败: %v\n", err)
+				} else if recordErr := prs.blacklistService.RecordModelFailure(kind, provider.Name, effectiveModel, err); recordErr != nil {
+					fmt.Printf("[CustomCLI][ERROR] 记录失败到黑名单失败: %v\n", recordErr)
 				}
 
 				if responseWritten {
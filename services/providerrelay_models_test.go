@@ -43,6 +43,36 @@ func isolateHomeDir(t *testing.T) {
 	if err := InitHTTPClient(ProxyConfig{UseProxy: false}); err != nil {
 		t.Fatalf("初始化测试 HTTP 客户端失败: %v", err)
 	}
+
+	// 切换 HOME 后丢弃内存中的密钥库，测试结束时同样清理，避免跨测试复用
+	resetSecretVaultCache()
+	t.Cleanup(resetSecretVaultCache)
+}
+
+func TestProviderGetEffectiveModel_MostSpecificWildcardWithoutAllocations(t *testing.T) {
+	provider := Provider{ModelMapping: map[string]string{
+		"claude-*":          "generic",
+		"claude-sonnet-*":   "sonnet",
+		"claude-sonnet-4-*": "sonnet-4",
+		"claude-opus-4":     "opus-exact",
+	}}
+	cases := map[string]string{
+		"claude-sonnet-4-5": "sonnet-4",
+		"claude-sonnet-3":   "sonnet",
+		"claude-haiku-4":    "generic",
+		"claude-opus-4":     "opus-exact",
+		"gpt-5":             "gpt-5",
+	}
+	for requested, want := range cases {
+		if got := provider.GetEffectiveModel(requested); got != want {
+			t.Fatalf("GetEffectiveModel(%q) = %q, want %q", requested, got, want)
+		}
+	}
+
+	// 每个请求都会调用：通配符匹配不应再为排序分配内存
+	if allocs := testing.AllocsPerRun(100, func() { _, _ = mostSpecificWildcard(provider.ModelMapping, "claude-sonnet-4-5") }); allocs != 0 {
+		t.Fatalf("mostSpecificWildcard allocations = %v, want 0", allocs)
+	}
 }
 
 func TestResponsesCompactRoute(t *testing.T) {
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -16,10 +17,28 @@ type AvailabilityConfig struct {
 	TestModel    string `json:"testModel,omitempty"`    // 覆盖默认测试模型
 	TestEndpoint string `json:"testEndpoint,omitempty"` // 覆盖默认测试端点
 	Timeout      int    `json:"timeout,omitempty"`      // 覆盖默认超时（毫秒）
+
+	// 检测档案：在状态码/延迟之外额外校验，任一失败记为 validation_failed
+	CheckStream    bool   `json:"checkStream,omitempty"`    // 额外发起流式请求，校验 SSE 结束事件
+	CheckToolUse   bool   `json:"checkToolUse,omitempty"`   // 工具调用往返（调用工具 + 回传结果）
+	ExpectContains string `json:"expectContains,omitempty"` // 回复必须包含的子串
+	RequireUsage   bool   `json:"requireUsage,omitempty"`   // 响应必须包含 token 用量
+	TestPrompt     string `json:"testPrompt,omitempty"`     // 覆盖内容校验的提示词（默认要求原样回复 expectContains）
+
+	// 按测试模型的 modelCapabilities 声明逐项验证（工具调用 / 图片 / thinking / prompt caching）
+	CheckCapabilities bool `json:"checkCapabilities,omitempty"`
+
+	// 自适应巡检：0 表示使用默认值
+	IntervalSeconds      int    `json:"intervalSeconds,omitempty"`      // 正常检测间隔（默认全局轮询间隔）
+	RecoveryCheckSeconds int    `json:"recoveryCheckSeconds,omitempty"` // 首次失败后的快速复检间隔（默认 15 秒）
+	MaxBackoffSeconds    int    `json:"maxBackoffSeconds,omitempty"`    // 持续失败时指数退避的上限（默认 30 分钟）
+	JitterPercent        *int   `json:"jitterPercent,omitempty"`        // 间隔随机抖动 ±%（未设置为 10，0 关闭，最大 50）
+	QuietHours           string `json:"quietHours,omitempty"`           // 静默时段 HH:MM-HH:MM（本地时间，可跨零点），期间不做主动检测
 }
 
 type Provider struct {
-	ID      int64  `json:"id"` // 修复：使用 int64 支持大 ID 值
+	ID      int64  `json:"id"`            // 修复：使用 int64 支持大 ID 值
+	UID     string `json:"uid,omitempty"` // 稳定标识：保存时自动分配，改名后保持不变
 	Name    string `json:"name"`
 	APIURL  string `json:"apiUrl"`
 	APIKey  string `json:"apiKey"`
@@ -42,6 +61,10 @@ type Provider struct {
 	// 支持精确匹配和通配符（如 "claude-*" -> "anthropic/claude-*"）
 	ModelMapping map[string]string `json:"modelMapping,omitempty"`
 
+	// 模型能力声明 - 模型名（映射后的内部模型名或请求模型名，支持通配符）-> 能力
+	// 转发前据此跳过无法处理请求的 provider（如图片输入、超长上下文）
+	ModelCapabilities map[string]ModelCapability `json:"modelCapabilities,omitempty"`
+
 	// 优先级分组 - 数字越小优先级越高（1-10，默认 1）
 	// 使用 omitempty 确保零值不序列化，向后兼容
 	Level int `json:"level,omitempty"`
@@ -56,6 +79,9 @@ type Provider struct {
 	// 默认关闭；第一轮请求始终不会注入 previous_response_id。
 	CodexResponseChainEnabled bool `json:"codexResponseChainEnabled,omitempty"`
 
+	// 免费 / 包月标记：预算超限且动作为 flat_rate_only 时，仅允许此类 provider 继续转发
+	FlatRate bool `json:"flatRate,omitempty"`
+
 	// ========== 可用性监控字段（新增 v0.5.0） ==========
 
 	// 可用性监控开关 - 在可用性页面配置
@@ -169,14 +195,14 @@ func (ps *ProviderService) loadProvidersRaw(kind string) ([]Provider, error) {
 	if err := json.Unmarshal(data, &envelope); err != nil {
 		return nil, err
 	}
+	openProviderSecrets(envelope.Providers)
 
 	return envelope.Providers, nil
 }
 
 // saveProvidersLocked 内部保存方法，调用方必须已持有锁
 func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider) error {
-	path, err := providerFilePath(kind)
-	if err != nil {
+	if _, err := providerFilePath(kind); err != nil {
 		return err
 	}
 
@@ -187,8 +213,10 @@ func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider
 		return err
 	}
 	nameByID := make(map[int64]string, len(existingProviders))
+	uidByID := make(map[int64]string, len(existingProviders))
 	for _, p := range existingProviders {
 		nameByID[p.ID] = p.Name
+		uidByID[p.ID] = p.UID
 	}
 
 	// 验证每个 provider 的配置，并清除旧字段
@@ -210,6 +238,18 @@ func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider
 
 		// 清除旧连通性字段，确保保存时不再写入
 		p.clearLegacyFields()
+
+		// 沿用已有 UID（前端保存时不一定携带），旧配置按 id/name 派生，新建的随机生成
+		if p.UID == "" {
+			p.UID = uidByID[p.ID]
+		}
+		if p.UID == "" {
+			if _, ok := nameByID[p.ID]; ok {
+				p.UID = legacyProviderUID(kind, strconv.FormatInt(p.ID, 10), p.Name)
+			} else {
+				p.UID = newProviderUID()
+			}
+		}
 	}
 
 	// 如果有验证错误，返回汇总错误
@@ -217,16 +257,59 @@ func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider
 		return fmt.Errorf("配置验证失败：\n  - %s", strings.Join(validationErrors, "\n  - "))
 	}
 
-	data, err := json.MarshalIndent(providerEnvelope{Providers: providers}, "", "  ")
+	path, _ := providerFilePath(kind)
+	previous, _ := os.ReadFile(path)
+	if len(previous) > 0 {
+		// 写入前处理旧内容：写入会覆盖密钥库中的旧 Key，之后引用只能解析到新值
+		if previous, err = scrubSnapshotSecrets(previous); err != nil {
+			previous = nil
+		}
+	}
+	data, err := ps.writeProvidersFile(kind, providers)
 	if err != nil {
 		return err
 	}
+	recordProviderSnapshot(kind, previous, data)
 
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, data, 0o644); err != nil {
-		return err
+	before := make(map[string]interface{}, len(existingProviders))
+	for _, p := range existingProviders {
+		before[p.Name] = p
+	}
+	after := make(map[string]interface{}, len(providers))
+	for _, p := range providers {
+		after[p.Name] = p
 	}
-	return os.Rename(tmp, path)
+	recordProviderConfigChanges(kind, before, after)
+	return nil
+}
+
+// writeProvidersFile 写入配置文件（启用密钥库时 API Key 以引用形式保存），调用方必须已持有锁；
+// 返回实际写入的内容
+func (ps *ProviderService) writeProvidersFile(kind string, providers []Provider) ([]byte, error) {
+	path, err := providerFilePath(kind)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := sealProviderSecrets(kind, providers)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(providerEnvelope{Providers: stored}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := AtomicWriteBytes(path, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// rewriteProviders 不做校验地重写配置文件（密钥库启用/停用时迁移使用）
+func (ps *ProviderService) rewriteProviders(kind string, providers []Provider) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	_, err := ps.writeProvidersFile(kind, providers)
+	return err
 }
 
 func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
@@ -251,6 +334,7 @@ func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
 	if err := json.Unmarshal(data, &envelope); err != nil {
 		return nil, err
 	}
+	openProviderSecrets(envelope.Providers)
 
 	// 执行字段迁移：将旧字段值迁移到新字段
 	migrated := false
@@ -303,6 +387,7 @@ func (ps *ProviderService) loadProvidersNoLock(kind string) ([]Provider, error)
 	if err := json.Unmarshal(data, &envelope); err != nil {
 		return nil, err
 	}
+	openProviderSecrets(envelope.Providers)
 
 	// 执行字段迁移（但不保存，避免在持锁时再次加锁）
 	migrated := false
@@ -414,6 +499,7 @@ func (ps *ProviderService) DuplicateProvider(kind string, sourceID int64) (*Prov
 		MaxConcurrentRequests:     source.MaxConcurrentRequests,
 		CodexPromptCacheEnabled:   source.CodexPromptCacheEnabled,
 		CodexResponseChainEnabled: source.CodexResponseChainEnabled,
+		FlatRate:                  source.FlatRate,
 		// 可用性监控配置
 		AvailabilityMonitorEnabled: source.AvailabilityMonitorEnabled,
 		ConnectivityAutoBlacklist:  false, // 副本默认关闭自动拉黑
@@ -443,6 +529,13 @@ func (ps *ProviderService) DuplicateProvider(kind string, sourceID int64) (*Prov
 		}
 	}
 
+	if source.ModelCapabilities != nil {
+		cloned.ModelCapabilities = make(map[string]ModelCapability, len(source.ModelCapabilities))
+		for k, v := range source.ModelCapabilities {
+			cloned.ModelCapabilities[k] = v
+		}
+	}
+
 	// 7. 添加到列表并保存（使用内部方法避免死锁）
 	providers = append(providers, *cloned)
 	if err := ps.saveProvidersLocked(kind, providers); err != nil {
@@ -506,11 +599,9 @@ func (p *Provider) GetEffectiveModel(requestedModel string) string {
 		return mappedModel
 	}
 
-	// 查找通配符映射
-	for pattern, replacement := range p.ModelMapping {
-		if matchWildcard(pattern, requestedModel) {
-			return applyWildcardMapping(pattern, replacement, requestedModel)
-		}
+	// 查找通配符映射（多个模式命中时更具体的优先，如 claude-sonnet-* 优先于 claude-*）
+	if pattern, ok := mostSpecificWildcard(p.ModelMapping, requestedModel); ok {
+		return applyWildcardMapping(pattern, p.ModelMapping[pattern], requestedModel)
 	}
 
 	// 无映射，返回原模型名
@@ -577,6 +668,9 @@ func (p *Provider) ValidateConfiguration() []string {
 		}
 	}
 
+	// 规则 2：模型能力声明的数值必须合理
+	errors = append(errors, p.validateModelCapabilities()...)
+
 	// 允许仅配置 modelMapping（无 supportedModels 时不阻塞保存）
 	// 用户可能只想映射模型名，不需要白名单过滤
 
@@ -586,6 +680,21 @@ func (p *Provider) ValidateConfiguration() []string {
 	return errors
 }
 
+// mostSpecificWildcard 单次遍历找出匹配 text 的最具体通配符模式：长度越长越具体，同长按字典序保证结果稳定
+// 每个请求都会调用，不做排序也不分配内存
+func mostSpecificWildcard[V any](patterns map[string]V, text string) (string, bool) {
+	best, found := "", false
+	for pattern := range patterns {
+		if !strings.Contains(pattern, "*") || !matchWildcard(pattern, text) {
+			continue
+		}
+		if !found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, found = pattern, true
+		}
+	}
+	return best, found
+}
+
 // matchWildcard 通配符匹配函数
 // 支持 * 通配符，如 "claude-*" 匹配 "claude-sonnet-4"
 func matchWildcard(pattern, text string) bool {
@@ -594,11 +703,10 @@ func matchWildcard(pattern, text string) bool {
 		return pattern == text
 	}
 
-	// 简化实现：只支持单个 * 通配符
-	parts := strings.Split(pattern, "*")
-	if len(parts) == 2 {
+	// 简化实现：只支持单个 * 通配符（用 Cut 拆分，热路径上不分配内存）
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	if !strings.Contains(suffix, "*") {
 		// 前缀 + * 或 * + 后缀
-		prefix, suffix := parts[0], parts[1]
 		return strings.HasPrefix(text, prefix) && strings.HasSuffix(text, suffix)
 	}
 
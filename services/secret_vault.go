@@ -0,0 +1,492 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 密钥库：API Key 以 AES-256-GCM 加密保存在 ~/.code-switch/secrets.vault，
+// 供应商配置中只保留 "vault:<id>" 引用。主密钥来源二选一：
+//   - keyfile：随机密钥保存在 ~/.code-switch/vault.key（0600），启动时自动解锁
+//   - passphrase：由用户口令经 PBKDF2-SHA256 派生，启动后处于锁定状态，需手动解锁
+//
+// 未启用密钥库时（vault 文件不存在）行为与以前一致，配置中保存明文
+const (
+	SecretVaultModeKeyFile    = "keyfile"
+	SecretVaultModePassphrase = "passphrase"
+
+	secretVaultFileName    = "secrets.vault"
+	secretVaultKeyFileName = "vault.key"
+	secretVaultVersion     = 1
+	secretVaultKDFIters    = 600000
+	secretVaultCheckID     = "__check__"
+	secretVaultCheckValue  = "code-switch-vault"
+
+	// secretRefPrefix 配置文件中密钥引用的前缀
+	secretRefPrefix = "vault:"
+)
+
+// errSecretVaultLocked 密钥库已启用但尚未解锁
+var errSecretVaultLocked = errors.New("密钥库已锁定，请先解锁")
+
+// SecretVaultStatus 密钥库状态
+type SecretVaultStatus struct {
+	Enabled     bool   `json:"enabled"`
+	Mode        string `json:"mode,omitempty"`
+	Locked      bool   `json:"locked"`
+	SecretCount int    `json:"secretCount"`
+	VaultPath   string `json:"vaultPath"`
+	KeyFilePath string `json:"keyFilePath,omitempty"` // 仅 keyfile 模式
+}
+
+// secretVaultFile vault 文件结构
+type secretVaultFile struct {
+	Version    int                     `json:"version"`
+	Mode       string                  `json:"mode"`
+	Salt       string                  `json:"salt,omitempty"` // passphrase 模式的 PBKDF2 盐（base64）
+	Iterations int                     `json:"iterations,omitempty"`
+	Check      sealedSecret            `json:"check"` // 用于校验主密钥是否正确
+	Secrets    map[string]sealedSecret `json:"secrets"`
+}
+
+// sealedSecret 单条加密数据，密文以 secret ID 作为附加数据，防止被挪用到其他引用
+type sealedSecret struct {
+	Nonce string `json:"nonce"`
+	Data  string `json:"data"`
+}
+
+// SecretVault 密钥库（按当前用户目录缓存，见 currentSecretVault）
+type SecretVault struct {
+	mu      sync.RWMutex
+	dir     string
+	file    *secretVaultFile  // nil 表示未启用
+	aead    cipher.AEAD       // nil 表示锁定
+	secrets map[string]string // 解锁后的明文缓存
+}
+
+var (
+	secretVaultMu     sync.Mutex
+	secretVaultCached *SecretVault
+)
+
+// currentSecretVault 返回当前用户目录对应的密钥库；首次加载时 keyfile 模式会自动解锁
+func currentSecretVault() *SecretVault {
+	dir := secretVaultDir()
+	secretVaultMu.Lock()
+	defer secretVaultMu.Unlock()
+	if secretVaultCached != nil && secretVaultCached.dir == dir {
+		return secretVaultCached
+	}
+	vault := &SecretVault{dir: dir}
+	if err := vault.load(); err != nil {
+		fmt.Printf("⚠️  加载密钥库失败: %v\n", err)
+	}
+	secretVaultCached = vault
+	return vault
+}
+
+func secretVaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".code-switch")
+}
+
+func (v *SecretVault) vaultPath() string   { return filepath.Join(v.dir, secretVaultFileName) }
+func (v *SecretVault) keyFilePath() string { return filepath.Join(v.dir, secretVaultKeyFileName) }
+
+// load 读取 vault 文件；keyfile 模式下同时读取密钥文件并解锁
+func (v *SecretVault) load() error {
+	data, err := os.ReadFile(v.vaultPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取密钥库失败: %w", err)
+	}
+	var file secretVaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析密钥库失败: %w", err)
+	}
+	if file.Secrets == nil {
+		file.Secrets = make(map[string]sealedSecret)
+	}
+	v.file = &file
+
+	if file.Mode != SecretVaultModeKeyFile {
+		return nil
+	}
+	encoded, err := os.ReadFile(v.keyFilePath())
+	if err != nil {
+		return fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+	return v.unlockWithKey(key)
+}
+
+// Status 返回密钥库状态
+func (v *SecretVault) Status() SecretVaultStatus {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	status := SecretVaultStatus{VaultPath: v.vaultPath()}
+	if v.file == nil {
+		return status
+	}
+	status.Enabled = true
+	status.Mode = v.file.Mode
+	status.Locked = v.aead == nil
+	status.SecretCount = len(v.file.Secrets)
+	if v.file.Mode == SecretVaultModeKeyFile {
+		status.KeyFilePath = v.keyFilePath()
+	}
+	return status
+}
+
+// Enabled 是否已启用密钥库
+func (v *SecretVault) Enabled() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.file != nil
+}
+
+// Locked 已启用且未解锁
+func (v *SecretVault) Locked() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.file != nil && v.aead == nil
+}
+
+// create 创建新的密钥库；passphrase 为空时使用密钥文件
+func (v *SecretVault) create(passphrase string) error {
+	v.mu.Lock()
+	if v.file != nil {
+		v.mu.Unlock()
+		return fmt.Errorf("密钥库已启用")
+	}
+	v.mu.Unlock()
+
+	file := &secretVaultFile{Version: secretVaultVersion, Secrets: make(map[string]sealedSecret)}
+	var key []byte
+	if passphrase == "" {
+		file.Mode = SecretVaultModeKeyFile
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("生成主密钥失败: %w", err)
+		}
+		if err := AtomicWriteBytes(v.keyFilePath(), []byte(base64.StdEncoding.EncodeToString(key))); err != nil {
+			return fmt.Errorf("写入密钥文件失败: %w", err)
+		}
+	} else {
+		file.Mode = SecretVaultModePassphrase
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("生成盐失败: %w", err)
+		}
+		file.Salt = base64.StdEncoding.EncodeToString(salt)
+		file.Iterations = secretVaultKDFIters
+		derived, err := deriveVaultKey(passphrase, salt, file.Iterations)
+		if err != nil {
+			return err
+		}
+		key = derived
+	}
+
+	aead, err := newVaultAEAD(key)
+	if err != nil {
+		return err
+	}
+	check, err := sealVaultValue(aead, secretVaultCheckID, secretVaultCheckValue)
+	if err != nil {
+		return err
+	}
+	file.Check = check
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.file = file
+	v.aead = aead
+	v.secrets = make(map[string]string)
+	return v.saveLocked()
+}
+
+// Unlock 使用口令解锁（keyfile 模式无需调用）
+func (v *SecretVault) Unlock(passphrase string) error {
+	v.mu.RLock()
+	file := v.file
+	unlocked := v.aead != nil
+	v.mu.RUnlock()
+	if file == nil {
+		return fmt.Errorf("密钥库未启用")
+	}
+	if unlocked {
+		return nil
+	}
+	if file.Mode != SecretVaultModePassphrase {
+		return fmt.Errorf("密钥库使用密钥文件，无法通过口令解锁")
+	}
+	salt, err := base64.StdEncoding.DecodeString(file.Salt)
+	if err != nil {
+		return fmt.Errorf("解析密钥库盐失败: %w", err)
+	}
+	key, err := deriveVaultKey(passphrase, salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+	return v.unlockWithKey(key)
+}
+
+// Lock 清除内存中的主密钥与明文（仅 passphrase 模式有意义）
+func (v *SecretVault) Lock() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.file == nil {
+		return fmt.Errorf("密钥库未启用")
+	}
+	if v.file.Mode != SecretVaultModePassphrase {
+		return fmt.Errorf("密钥文件模式启动时会自动解锁，不支持手动锁定")
+	}
+	v.aead = nil
+	v.secrets = nil
+	return nil
+}
+
+// detach 仅在内存中停用密钥库（之后的写入保存明文），磁盘文件保留；返回的函数用于写回失败时恢复
+func (v *SecretVault) detach() (restore func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	file, aead, secrets := v.file, v.aead, v.secrets
+	v.file, v.aead, v.secrets = nil, nil, nil
+	return func() {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.file, v.aead, v.secrets = file, aead, secrets
+	}
+}
+
+// remove 删除密钥库与密钥文件（调用方需先把明文写回配置）
+func (v *SecretVault) remove() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := os.Remove(v.vaultPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除密钥库失败: %w", err)
+	}
+	if err := os.Remove(v.keyFilePath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除密钥文件失败: %w", err)
+	}
+	v.file = nil
+	v.aead = nil
+	v.secrets = nil
+	return nil
+}
+
+func (v *SecretVault) unlockWithKey(key []byte) error {
+	aead, err := newVaultAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.file == nil {
+		return fmt.Errorf("密钥库未启用")
+	}
+	if check, err := openVaultValue(aead, secretVaultCheckID, v.file.Check); err != nil || check != secretVaultCheckValue {
+		return fmt.Errorf("主密钥不正确")
+	}
+	secrets := make(map[string]string, len(v.file.Secrets))
+	for id, sealed := range v.file.Secrets {
+		value, err := openVaultValue(aead, id, sealed)
+		if err != nil {
+			return fmt.Errorf("解密 %s 失败: %w", id, err)
+		}
+		secrets[id] = value
+	}
+	v.aead = aead
+	v.secrets = secrets
+	return nil
+}
+
+// resolve 将 "vault:<id>" 引用解析为明文；非引用原样返回
+func (v *SecretVault) resolve(value string) (string, error) {
+	id, ok := parseSecretRef(value)
+	if !ok {
+		return value, nil
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.file == nil || v.aead == nil {
+		return value, errSecretVaultLocked
+	}
+	secret, exists := v.secrets[id]
+	if !exists {
+		return value, fmt.Errorf("密钥库中不存在 %s", id)
+	}
+	return secret, nil
+}
+
+// sealAll 将一组明文写入密钥库并返回对应引用，同时清理 prefix 下不再使用的条目
+// values 中已经是引用的值保持不变；未启用密钥库时原样返回
+func (v *SecretVault) sealAll(prefix string, values map[string]string) (map[string]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.file == nil {
+		return values, nil
+	}
+
+	refs := make(map[string]string, len(values))
+	keep := make(map[string]bool, len(values))
+	changed := false
+	for id, value := range values {
+		if refID, ok := parseSecretRef(value); ok {
+			refs[id] = value
+			keep[refID] = true
+			continue
+		}
+		if v.aead == nil {
+			return nil, errSecretVaultLocked
+		}
+		if current, exists := v.secrets[id]; !exists || current != value {
+			sealed, err := sealVaultValue(v.aead, id, value)
+			if err != nil {
+				return nil, err
+			}
+			v.file.Secrets[id] = sealed
+			v.secrets[id] = value
+			changed = true
+		}
+		refs[id] = secretRefPrefix + id
+		keep[id] = true
+	}
+
+	// 已删除供应商的密钥（锁定时无法区分是否仍被引用，跳过清理）
+	if v.aead != nil {
+		for id := range v.file.Secrets {
+			if strings.HasPrefix(id, prefix) && !keep[id] {
+				delete(v.file.Secrets, id)
+				delete(v.secrets, id)
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return refs, nil
+	}
+	return refs, v.saveLocked()
+}
+
+func (v *SecretVault) saveLocked() error {
+	data, err := json.MarshalIndent(v.file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥库失败: %w", err)
+	}
+	if err := AtomicWriteBytes(v.vaultPath(), data); err != nil {
+		return fmt.Errorf("写入密钥库失败: %w", err)
+	}
+	return nil
+}
+
+// secretIDs 返回所有条目 ID（排序，便于测试与展示）
+func (v *SecretVault) secretIDs() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.file == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(v.file.Secrets))
+	for id := range v.file.Secrets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func parseSecretRef(value string) (string, bool) {
+	if !strings.HasPrefix(value, secretRefPrefix) {
+		return "", false
+	}
+	id := strings.TrimPrefix(value, secretRefPrefix)
+	return id, id != ""
+}
+
+// checkVaultKDFIterations 校验外部文件携带的迭代次数：只接受当前参数（0 表示沿用默认），
+// 避免构造的文件用超大迭代次数拖垮 CPU
+func checkVaultKDFIterations(iterations int) error {
+	if iterations != 0 && iterations != secretVaultKDFIters {
+		return fmt.Errorf("不支持的密钥派生迭代次数: %d", iterations)
+	}
+	return nil
+}
+
+func deriveVaultKey(passphrase string, salt []byte, iterations int) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("口令不能为空")
+	}
+	if iterations <= 0 {
+		iterations = secretVaultKDFIters
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("派生主密钥失败: %w", err)
+	}
+	return key, nil
+}
+
+func newVaultAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("初始化加密失败: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("初始化加密失败: %w", err)
+	}
+	return aead, nil
+}
+
+func sealVaultValue(aead cipher.AEAD, id, value string) (sealedSecret, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return sealedSecret{}, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	data := aead.Seal(nil, nonce, []byte(value), []byte(id))
+	return sealedSecret{
+		Nonce: base64.StdEncoding.EncodeToString(nonce),
+		Data:  base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+func openVaultValue(aead cipher.AEAD, id string, sealed sealedSecret) (string, error) {
+	nonce, err := base64.StdEncoding.DecodeString(sealed.Nonce)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed.Data)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return "", fmt.Errorf("nonce 长度无效")
+	}
+	plain, err := aead.Open(nil, nonce, data, []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
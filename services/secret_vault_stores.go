@@ -0,0 +1,321 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// secretDigestPrefix API Key 摘要的前缀
+const secretDigestPrefix = "sha256:"
+
+// secretStoreKind 规范化供应商存储类型（与 providerFilePath 的别名一致）
+func secretStoreKind(kind string) string {
+	switch lower := strings.ToLower(kind); lower {
+	case "claude-code", "claude_code":
+		return "claude"
+	default:
+		if strings.HasPrefix(lower, "custom:") {
+			return kind
+		}
+		return lower
+	}
+}
+
+func providerSecretID(kind string, providerID int64) string {
+	return fmt.Sprintf("%s/%d/apiKey", secretStoreKind(kind), providerID)
+}
+
+// openProviderSecrets 原地解析供应商中的密钥引用；密钥库锁定时保留引用
+func openProviderSecrets(providers []Provider) {
+	vault := currentSecretVault()
+	for i := range providers {
+		if _, ok := parseSecretRef(providers[i].APIKey); !ok {
+			continue
+		}
+		if value, err := vault.resolve(providers[i].APIKey); err == nil {
+			providers[i].APIKey = value
+		} else if err != errSecretVaultLocked {
+			log.Printf("[SecretVault] 解析 %s 的 API Key 失败: %v", providers[i].Name, err)
+		}
+	}
+}
+
+// secretDigest API Key 的摘要（同步基线与历史快照中代替明文保存）；已是摘要的值原样返回
+func secretDigest(value string) string {
+	if value == "" || strings.HasPrefix(value, secretDigestPrefix) {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return secretDigestPrefix + hex.EncodeToString(sum[:])
+}
+
+// sealProviderSecrets 返回写盘用的副本：API Key 存入密钥库并替换为引用（未启用时原样返回）
+func sealProviderSecrets(kind string, providers []Provider) ([]Provider, error) {
+	vault := currentSecretVault()
+	if !vault.Enabled() {
+		return providers, nil
+	}
+	values := make(map[string]string, len(providers))
+	for _, p := range providers {
+		if p.APIKey != "" {
+			values[providerSecretID(kind, p.ID)] = p.APIKey
+		}
+	}
+	refs, err := vault.sealAll(secretStoreKind(kind)+"/", values)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]Provider, len(providers))
+	copy(sealed, providers)
+	for i := range sealed {
+		if ref, ok := refs[providerSecretID(kind, sealed[i].ID)]; ok {
+			sealed[i].APIKey = ref
+		}
+	}
+	return sealed, nil
+}
+
+func geminiSecretID(providerID, field string) string {
+	return fmt.Sprintf("gemini/%s/%s", providerID, field)
+}
+
+// openGeminiSecrets 原地解析 Gemini 供应商的 API Key 与 env 中的 GEMINI_API_KEY
+func openGeminiSecrets(providers []GeminiProvider) {
+	vault := currentSecretVault()
+	resolve := func(name, value string) string {
+		if _, ok := parseSecretRef(value); !ok {
+			return value
+		}
+		resolved, err := vault.resolve(value)
+		if err != nil && err != errSecretVaultLocked {
+			log.Printf("[SecretVault] 解析 %s 的 API Key 失败: %v", name, err)
+		}
+		return resolved
+	}
+	for i := range providers {
+		providers[i].APIKey = resolve(providers[i].Name, providers[i].APIKey)
+		if value, ok := providers[i].EnvConfig[geminiAPIKeyKey]; ok {
+			providers[i].EnvConfig[geminiAPIKeyKey] = resolve(providers[i].Name, value)
+		}
+	}
+}
+
+// sealGeminiSecrets 返回写盘用的 Gemini 供应商副本（EnvConfig 会被复制，不影响内存中的明文）
+func sealGeminiSecrets(providers []GeminiProvider) ([]GeminiProvider, error) {
+	vault := currentSecretVault()
+	if !vault.Enabled() {
+		return providers, nil
+	}
+	values := make(map[string]string)
+	for _, p := range providers {
+		if p.APIKey != "" {
+			values[geminiSecretID(p.ID, "apiKey")] = p.APIKey
+		}
+		if value := p.EnvConfig[geminiAPIKeyKey]; value != "" {
+			values[geminiSecretID(p.ID, geminiAPIKeyKey)] = value
+		}
+	}
+	refs, err := vault.sealAll("gemini/", values)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]GeminiProvider, len(providers))
+	copy(sealed, providers)
+	for i := range sealed {
+		if ref, ok := refs[geminiSecretID(sealed[i].ID, "apiKey")]; ok {
+			sealed[i].APIKey = ref
+		}
+		if ref, ok := refs[geminiSecretID(sealed[i].ID, geminiAPIKeyKey)]; ok {
+			env := make(map[string]string, len(sealed[i].EnvConfig))
+			for k, v := range sealed[i].EnvConfig {
+				env[k] = v
+			}
+			env[geminiAPIKeyKey] = ref
+			sealed[i].EnvConfig = env
+		}
+	}
+	return sealed, nil
+}
+
+// secretVaultLocked 密钥库已启用但未解锁（此时配置中的 API Key 仍是引用，不能用于转发）
+func secretVaultLocked() bool {
+	return currentSecretVault().Locked()
+}
+
+// SecretVaultService 密钥库管理（启用/解锁/锁定/停用），启用与停用时迁移所有供应商配置
+type SecretVaultService struct {
+	providerService  *ProviderService
+	geminiService    *GeminiService
+	customCliService *CustomCliService
+
+	mu          sync.Mutex
+	unlockHooks []func()
+}
+
+func NewSecretVaultService(providerService *ProviderService, geminiService *GeminiService, customCliService *CustomCliService) *SecretVaultService {
+	return &SecretVaultService{
+		providerService:  providerService,
+		geminiService:    geminiService,
+		customCliService: customCliService,
+	}
+}
+
+// OnUnlock 注册解锁后的回调（如重新加载 Gemini 配置、启动中转服务）
+func (svs *SecretVaultService) OnUnlock(hook func()) {
+	svs.mu.Lock()
+	defer svs.mu.Unlock()
+	svs.unlockHooks = append(svs.unlockHooks, hook)
+}
+
+// GetStatus 获取密钥库状态
+func (svs *SecretVaultService) GetStatus() SecretVaultStatus {
+	return currentSecretVault().Status()
+}
+
+// Enable 启用密钥库并把现有配置中的明文 API Key 迁移进去；passphrase 为空时使用本地密钥文件
+func (svs *SecretVaultService) Enable(passphrase string) (SecretVaultStatus, error) {
+	svs.mu.Lock()
+	defer svs.mu.Unlock()
+
+	vault := currentSecretVault()
+	if vault.Enabled() {
+		return vault.Status(), fmt.Errorf("密钥库已启用")
+	}
+	stores, err := svs.loadAllProviders()
+	if err != nil {
+		return vault.Status(), err
+	}
+	if err := vault.create(passphrase); err != nil {
+		return vault.Status(), err
+	}
+	if err := svs.writeAllProviders(stores); err != nil {
+		return vault.Status(), fmt.Errorf("迁移 API Key 到密钥库失败: %w", err)
+	}
+	// 旧版本的历史快照可能含有明文 API Key
+	for _, kind := range svs.secretProviderStores() {
+		if err := scrubProviderHistory(kind); err != nil {
+			return vault.Status(), fmt.Errorf("清除 %s 历史快照中的 API Key 失败: %w", kind, err)
+		}
+	}
+	log.Printf("[SecretVault] 已启用密钥库（%s），共迁移 %d 个密钥", vault.Status().Mode, vault.Status().SecretCount)
+	return vault.Status(), nil
+}
+
+// Disable 停用密钥库：把 API Key 以明文写回配置文件并删除密钥库（需已解锁）
+func (svs *SecretVaultService) Disable() (SecretVaultStatus, error) {
+	svs.mu.Lock()
+	defer svs.mu.Unlock()
+
+	vault := currentSecretVault()
+	if !vault.Enabled() {
+		return vault.Status(), nil
+	}
+	if vault.Locked() {
+		return vault.Status(), errSecretVaultLocked
+	}
+	stores, err := svs.loadAllProviders()
+	if err != nil {
+		return vault.Status(), err
+	}
+	// 先写回全部明文，成功后才删除密钥库；中途失败时恢复密钥库，已写回的明文仍可正常读取
+	restore := vault.detach()
+	if err := svs.writeAllProviders(stores); err != nil {
+		restore()
+		return vault.Status(), fmt.Errorf("写回 API Key 失败: %w", err)
+	}
+	if err := vault.remove(); err != nil {
+		return vault.Status(), err
+	}
+	log.Printf("[SecretVault] 已停用密钥库，API Key 已写回配置文件")
+	return vault.Status(), nil
+}
+
+// Unlock 使用口令解锁，成功后执行解锁回调
+func (svs *SecretVaultService) Unlock(passphrase string) (SecretVaultStatus, error) {
+	vault := currentSecretVault()
+	wasLocked := vault.Locked()
+	if err := vault.Unlock(passphrase); err != nil {
+		return vault.Status(), err
+	}
+	if wasLocked {
+		svs.mu.Lock()
+		hooks := append([]func(){}, svs.unlockHooks...)
+		svs.mu.Unlock()
+		for _, hook := range hooks {
+			hook()
+		}
+	}
+	return vault.Status(), nil
+}
+
+// Lock 锁定密钥库（仅口令模式），锁定期间中转服务拒绝转发请求
+func (svs *SecretVaultService) Lock() (SecretVaultStatus, error) {
+	vault := currentSecretVault()
+	err := vault.Lock()
+	return vault.Status(), err
+}
+
+// secretProviderStores 需要迁移的 ProviderService 存储类型
+func (svs *SecretVaultService) secretProviderStores() []string {
+	kinds := []string{"claude", "codex"}
+	if svs.customCliService == nil {
+		return kinds
+	}
+	tools, err := svs.customCliService.ListTools()
+	if err != nil {
+		log.Printf("[SecretVault] 加载自定义 CLI 工具失败: %v", err)
+		return kinds
+	}
+	for _, tool := range tools {
+		kinds = append(kinds, "custom:"+tool.ID)
+	}
+	return kinds
+}
+
+// loadAllProviders 读取所有存储的供应商（API Key 已解析为明文）
+func (svs *SecretVaultService) loadAllProviders() (map[string][]Provider, error) {
+	stores := make(map[string][]Provider)
+	for _, kind := range svs.secretProviderStores() {
+		providers, err := svs.providerService.loadProvidersRaw(kind)
+		if err != nil {
+			return nil, fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+		}
+		if providers != nil {
+			stores[kind] = providers
+		}
+	}
+	return stores, nil
+}
+
+// writeAllProviders 按当前密钥库状态重写所有存储（启用时写引用，停用时写明文）
+func (svs *SecretVaultService) writeAllProviders(stores map[string][]Provider) error {
+	for kind, providers := range stores {
+		if err := svs.providerService.rewriteProviders(kind, providers); err != nil {
+			return fmt.Errorf("写入 %s 供应商失败: %w", kind, err)
+		}
+	}
+	if svs.geminiService != nil {
+		if err := svs.geminiService.rewriteProviders(); err != nil {
+			return fmt.Errorf("写入 Gemini 供应商失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// secretVaultGuard 密钥库锁定期间拒绝转发（状态页除外）
+func secretVaultGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if secretVaultLocked() && !strings.HasPrefix(c.Request.URL.Path, "/status") {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "secret vault is locked"})
+			return
+		}
+		c.Next()
+	}
+}
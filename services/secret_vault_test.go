@@ -0,0 +1,200 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resetSecretVaultCache 模拟应用重启：丢弃内存中的密钥库状态
+func resetSecretVaultCache() {
+	secretVaultMu.Lock()
+	secretVaultCached = nil
+	secretVaultMu.Unlock()
+}
+
+func readProviderFile(t *testing.T, kind string) string {
+	t.Helper()
+	path, err := providerFilePath(kind)
+	if err != nil {
+		t.Fatalf("providerFilePath: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestSecretVault_KeyFileMigrationAndDisable(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "relay", APIURL: "https://relay.example.com", APIKey: "sk-plain-claude", Enabled: true}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+	gs := NewGeminiService("127.0.0.1:18100")
+	if err := gs.AddProvider(GeminiProvider{ID: "g1", Name: "gemini", APIKey: "AIza-plain", EnvConfig: map[string]string{geminiAPIKeyKey: "AIza-plain"}}); err != nil {
+		t.Fatalf("add gemini provider: %v", err)
+	}
+
+	svs := NewSecretVaultService(ps, gs, nil)
+	status, err := svs.Enable("")
+	if err != nil {
+		t.Fatalf("enable vault: %v", err)
+	}
+	if status.Mode != SecretVaultModeKeyFile || status.Locked || status.SecretCount != 3 {
+		t.Fatalf("status = %+v", status)
+	}
+	if raw := readProviderFile(t, "claude"); strings.Contains(raw, "sk-plain-claude") || !strings.Contains(raw, secretRefPrefix) {
+		t.Fatalf("claude file still holds plaintext: %s", raw)
+	}
+	if raw, _ := os.ReadFile(getGeminiProvidersPath()); strings.Contains(string(raw), "AIza-plain") {
+		t.Fatalf("gemini file still holds plaintext: %s", raw)
+	}
+
+	// 重启后密钥文件模式自动解锁
+	resetSecretVaultCache()
+	providers, err := ps.LoadProviders("claude")
+	if err != nil || len(providers) != 1 || providers[0].APIKey != "sk-plain-claude" {
+		t.Fatalf("LoadProviders = %+v, %v", providers, err)
+	}
+	if err := gs.ReloadProviders(); err != nil || gs.GetProviders()[0].EnvConfig[geminiAPIKeyKey] != "AIza-plain" {
+		t.Fatalf("gemini reload = %+v, %v", gs.GetProviders(), err)
+	}
+
+	// 更新 Key 后旧密文被替换，删除供应商后条目被清理
+	providers[0].APIKey = "sk-rotated"
+	providers = append(providers, Provider{ID: 2, Name: "backup", APIURL: "https://b.example.com", APIKey: "sk-backup"})
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatalf("save rotated: %v", err)
+	}
+	if err := ps.SaveProviders("claude", providers[1:]); err != nil {
+		t.Fatalf("save after delete: %v", err)
+	}
+	ids := currentSecretVault().secretIDs()
+	if strings.Join(ids, ",") != "claude/2/apiKey,gemini/g1/GEMINI_API_KEY,gemini/g1/apiKey" {
+		t.Fatalf("vault ids = %v", ids)
+	}
+
+	if _, err := svs.Disable(); err != nil {
+		t.Fatalf("disable vault: %v", err)
+	}
+	if raw := readProviderFile(t, "claude"); !strings.Contains(raw, "sk-backup") {
+		t.Fatalf("claude file should hold plaintext after disable: %s", raw)
+	}
+	if _, err := os.Stat(currentSecretVault().vaultPath()); !os.IsNotExist(err) {
+		t.Fatalf("vault file should be removed, stat err = %v", err)
+	}
+}
+
+func TestSecretVault_DisableKeepsVaultWhenWriteBackFails(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "relay", APIURL: "https://relay.example.com", APIKey: "sk-plain-claude"}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+	gs := NewGeminiService("127.0.0.1:18100")
+	if err := gs.AddProvider(GeminiProvider{ID: "g1", Name: "gemini", APIKey: "AIza-plain"}); err != nil {
+		t.Fatalf("add gemini provider: %v", err)
+	}
+	svs := NewSecretVaultService(ps, gs, nil)
+	if _, err := svs.Enable(""); err != nil {
+		t.Fatalf("enable vault: %v", err)
+	}
+
+	// Gemini 配置路径被非空目录占据，写回必然失败
+	geminiPath := getGeminiProvidersPath()
+	if err := os.Remove(geminiPath); err != nil {
+		t.Fatalf("remove gemini file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(geminiPath, "blocker"), 0o755); err != nil {
+		t.Fatalf("block gemini path: %v", err)
+	}
+	if _, err := svs.Disable(); err == nil {
+		t.Fatal("disable should fail when a store cannot be written")
+	}
+	status := svs.GetStatus()
+	if !status.Enabled || status.Locked {
+		t.Fatalf("vault should stay enabled after failed disable: %+v", status)
+	}
+	if _, err := os.Stat(currentSecretVault().vaultPath()); err != nil {
+		t.Fatalf("vault file should be kept: %v", err)
+	}
+	resetSecretVaultCache()
+	if providers, err := ps.LoadProviders("claude"); err != nil || providers[0].APIKey != "sk-plain-claude" {
+		t.Fatalf("claude providers after failed disable = %+v, %v", providers, err)
+	}
+
+	if err := os.RemoveAll(geminiPath); err != nil {
+		t.Fatalf("unblock gemini path: %v", err)
+	}
+	if _, err := svs.Disable(); err != nil {
+		t.Fatalf("disable after unblocking: %v", err)
+	}
+	if raw, _ := os.ReadFile(geminiPath); !strings.Contains(string(raw), "AIza-plain") {
+		t.Fatalf("gemini file should hold plaintext after disable: %s", raw)
+	}
+}
+
+func TestSecretVault_PassphraseLockedState(t *testing.T) {
+	isolateHomeDir(t)
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("codex", []Provider{{ID: 7, Name: "codex-relay", APIURL: "https://c.example.com", APIKey: "sk-codex"}}); err != nil {
+		t.Fatalf("save providers: %v", err)
+	}
+	svs := NewSecretVaultService(ps, nil, nil)
+	if _, err := svs.Enable("correct horse"); err != nil {
+		t.Fatalf("enable vault: %v", err)
+	}
+
+	resetSecretVaultCache()
+	if !secretVaultLocked() {
+		t.Fatal("passphrase vault should start locked")
+	}
+	providers, _ := ps.LoadProviders("codex")
+	if len(providers) != 1 || !strings.HasPrefix(providers[0].APIKey, secretRefPrefix) {
+		t.Fatalf("locked LoadProviders should keep the reference: %+v", providers)
+	}
+	relay := NewProviderRelayService(ps, nil, nil, nil, "127.0.0.1:0")
+	if err := relay.Start(); err != errSecretVaultLocked {
+		t.Fatalf("relay start while locked = %v, want errSecretVaultLocked", err)
+	}
+	// 锁定时保存新的明文 Key 应被拒绝
+	if err := ps.SaveProviders("codex", []Provider{{ID: 7, Name: "codex-relay", APIURL: "https://c.example.com", APIKey: "sk-new"}}); err == nil {
+		t.Fatal("saving plaintext while locked should fail")
+	}
+
+	if _, err := svs.Unlock("wrong"); err == nil {
+		t.Fatal("wrong passphrase should fail")
+	}
+	hookCalled := false
+	svs.OnUnlock(func() { hookCalled = true })
+	if _, err := svs.Unlock("correct horse"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	providers, _ = ps.LoadProviders("codex")
+	if !hookCalled || providers[0].APIKey != "sk-codex" {
+		t.Fatalf("after unlock: hook=%v providers=%+v", hookCalled, providers)
+	}
+}
+
+func TestSecretVault_CiphertextBoundToID(t *testing.T) {
+	aead, err := newVaultAEAD(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("newVaultAEAD: %v", err)
+	}
+	sealed, err := sealVaultValue(aead, "claude/1/apiKey", "sk-secret")
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if value, err := openVaultValue(aead, "claude/1/apiKey", sealed); err != nil || value != "sk-secret" {
+		t.Fatalf("open = %q, %v", value, err)
+	}
+	if _, err := openVaultValue(aead, "claude/2/apiKey", sealed); err == nil {
+		t.Fatal("ciphertext moved to another id should not decrypt")
+	}
+}
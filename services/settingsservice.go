@@ -4,12 +4,20 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"sync"
 
 	"github.com/daodao97/xgo/xdb"
 )
 
 // SettingsService 管理全局配置
-type SettingsService struct{}
+type SettingsService struct {
+	scopeMu    sync.Mutex
+	scopeHooks []func(perModel bool) // 按模型拉黑开关切换后的回调
+
+	levelConfigMu    sync.Mutex
+	levelConfig      *BlacklistLevelConfig // 等级拉黑配置缓存，相关配置保存时失效
+	levelConfigEpoch uint64                // 每次失效递增，避免把失效前读到的旧配置写回缓存
+}
 
 // BlacklistSettings 黑名单配置（基础配置，向后兼容）
 type BlacklistSettings struct {
@@ -43,6 +51,23 @@ type BlacklistLevelConfig struct {
 	// 开关关闭时的行为
 	FallbackMode            string `json:"fallbackMode"`            // fixed=固定拉黑, none=不拉黑
 	FallbackDurationMinutes int    `json:"fallbackDurationMinutes"` // 固定拉黑时长（分钟）
+
+	// 熔断半开配置：拉黑到期后先进入半开状态，仅放行少量试探请求
+	HalfOpenDisabled         bool `json:"halfOpenDisabled"`         // 关闭半开（到期后直接全量恢复，旧行为）
+	HalfOpenMaxTrials        int  `json:"halfOpenMaxTrials"`        // 半开期间同时放行的试探请求数（0=默认 1）
+	HalfOpenSuccessThreshold int  `json:"halfOpenSuccessThreshold"` // 连续成功多少次后完全恢复（0=默认 2）
+	HalfOpenProbeDisabled    bool `json:"halfOpenProbeDisabled"`    // 关闭进入半开时的合成探测请求
+
+	// 滑动窗口拉黑：窗口内样本数达到下限后，错误率或慢请求率超过阈值即拉黑（与连续失败计数并行生效）
+	RateWindowEnabled  bool    `json:"rateWindowEnabled"`  // 是否启用滑动窗口拉黑
+	RateWindowSeconds  int     `json:"rateWindowSeconds"`  // 窗口长度（秒）
+	RateMinSamples     int     `json:"rateMinSamples"`     // 最小样本数（不足时不判定）
+	ErrorRateThreshold float64 `json:"errorRateThreshold"` // 错误率阈值（%，0=不检测）
+	SlowRateThreshold  float64 `json:"slowRateThreshold"`  // 慢请求率阈值（%，0=不检测）
+	SlowRequestMs      int     `json:"slowRequestMs"`      // 慢请求判定阈值（毫秒，按上游响应头到达耗时计算）
+
+	// 按模型拉黑：转发失败只拉黑 (platform, provider, 实际模型)，同一 provider 的其他模型不受影响
+	PerModelBlacklist bool `json:"perModelBlacklist"`
 }
 
 // DefaultBlacklistLevelConfig 返回默认的等级拉黑配置
@@ -63,6 +88,14 @@ func DefaultBlacklistLevelConfig() *BlacklistLevelConfig {
 		L5DurationMinutes:          1440, // 24小时
 		FallbackMode:               "fixed",
 		FallbackDurationMinutes:    30,
+		HalfOpenMaxTrials:          1,
+		HalfOpenSuccessThreshold:   2,
+		RateWindowEnabled:          false, // 默认关闭，向后兼容
+		RateWindowSeconds:          300,
+		RateMinSamples:             20,
+		ErrorRateThreshold:         50,
+		SlowRateThreshold:          0,
+		SlowRequestMs:              30000,
 	}
 }
 
@@ -167,6 +200,9 @@ func (ss *SettingsService) UpdateBlacklistSettings(threshold int, duration int)
 		return fmt.Errorf("拉黑时长只支持 5/15/30/60 分钟")
 	}
 
+	// 阈值会覆盖等级拉黑配置中的 FailureThreshold
+	defer ss.invalidateBlacklistLevelConfig()
+
 	// Saga 步骤 1：读取旧值（用于回滚）
 	db, err := xdb.DB("default")
 	if err != nil {
@@ -255,6 +291,7 @@ func (ss *SettingsService) SetLevelBlacklistEnabled(enabled bool) error {
 		ON CONFLICT(key) DO UPDATE SET value = excluded.value
 	`, enabledStr)
 
+	ss.invalidateBlacklistLevelConfig()
 	if err != nil {
 		return fmt.Errorf("设置等级拉黑开关失败: %w", err)
 	}
@@ -0,0 +1,651 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// SLA 报告周期
+const (
+	SLAPeriod24h   = "24h"
+	SLAPeriod7d    = "7d"
+	SLAPeriod30d   = "30d"
+	SLAPeriodMonth = "month" // 自然月，配合 SLAReportQuery.Month
+)
+
+// SLA 导出内容
+const (
+	SLAExportKindSummary   = "summary"   // 每个供应商一行汇总
+	SLAExportKindIncidents = "incidents" // 每次故障一行
+)
+
+const slaMonthLayout = "2006-01"
+
+// slaCheckCoverage 单次检测结果最多代表的时长（与调度的最大退避间隔一致），
+// 超出部分视为未覆盖：有真实流量时按流量成功率计，否则计为未知，不计入可用时间
+const slaCheckCoverage = time.Duration(defaultMaxBackoffSeconds) * time.Second
+
+// SLAReportQuery SLA 报告查询参数
+// 时间范围优先级：Period（24h/7d/30d/month）> Start/End（同 UsageQuery，默认最近 24 小时）
+type SLAReportQuery struct {
+	Platform string `json:"platform"`
+	Provider string `json:"provider"` // 为空时返回平台下所有供应商
+	Period   string `json:"period"`
+	Month    string `json:"month"` // YYYY-MM，Period=month 时使用，默认当月
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// SLAIncident 一次故障：连续失败的检测窗口
+type SLAIncident struct {
+	Platform        string     `json:"platform"`
+	ProviderName    string     `json:"providerName"`
+	StartedAt       time.Time  `json:"startedAt"`         // 第一次失败的检测时间
+	ResolvedAt      *time.Time `json:"resolvedAt"`        // 首次恢复的检测时间，未恢复时为空
+	DurationSeconds int64      `json:"durationSeconds"`   // 未恢复时计算到报告结束时间
+	FailedChecks    int        `json:"failedChecks"`      // 窗口内失败的检测次数
+	Status          string     `json:"status"`            // 第一次失败的状态（failed/validation_failed）
+	Cause           string     `json:"cause"`             // 第一条错误信息
+	Ongoing         bool       `json:"ongoing,omitempty"` // 报告结束时仍未恢复
+}
+
+// SLAReport 单个供应商在时间范围内的可用性报告
+type SLAReport struct {
+	Platform     string    `json:"platform"`
+	ProviderName string    `json:"providerName"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+
+	// 主动检测
+	TotalChecks int     `json:"totalChecks"`
+	UpChecks    int     `json:"upChecks"`    // operational + degraded
+	CheckUptime float64 `json:"checkUptime"` // 百分比，无检测时为 0
+
+	// 真实流量（来自小时汇总表，起止按整点对齐）
+	TotalRequests       int64   `json:"totalRequests"`
+	SuccessfulRequests  int64   `json:"successfulRequests"`
+	TrafficAvailability float64 `json:"trafficAvailability"` // 百分比，无流量时为 0
+
+	// 综合可用率：检测覆盖的时间按检测结果计，未覆盖但有流量的小时按流量成功率计，
+	// 两者都没有的时间计为未知，不参与计算
+	Availability   float64 `json:"availability"`
+	UnknownSeconds int64   `json:"unknownSeconds"` // 既无检测也无流量的时长
+
+	Incidents              []SLAIncident `json:"incidents"`
+	IncidentCount          int           `json:"incidentCount"`
+	DowntimeSeconds        int64         `json:"downtimeSeconds"`
+	MTTRSeconds            int64         `json:"mttrSeconds"` // 已恢复故障的平均恢复时长
+	LongestIncidentSeconds int64         `json:"longestIncidentSeconds"`
+}
+
+// SLAExportRequest SLA 报告导出参数
+type SLAExportRequest struct {
+	SLAReportQuery
+	Format string `json:"format"` // csv/jsonl
+	Kind   string `json:"kind"`   // summary/incidents
+}
+
+// SLAExportResult 导出结果
+type SLAExportResult struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Kind   string `json:"kind"`
+	Rows   int    `json:"rows"`
+}
+
+// slaCheckSample 报告计算使用的检测记录
+type slaCheckSample struct {
+	ProviderName string
+	Status       string
+	ErrorMessage string
+	CheckedAt    time.Time
+}
+
+// GetSLAReports 生成平台下供应商的 SLA 报告（按供应商名称排序）
+func (hcs *HealthCheckService) GetSLAReports(query SLAReportQuery) ([]SLAReport, error) {
+	platform := strings.TrimSpace(query.Platform)
+	if platform == "" {
+		return nil, fmt.Errorf("平台不能为空")
+	}
+	start, end, err := resolveSLARange(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	provider := strings.TrimSpace(query.Provider)
+
+	samples, err := querySLACheckSamples(platform, provider, start, end)
+	if err != nil {
+		return nil, err
+	}
+	traffic, err := querySLATraffic(platform, provider, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	if provider != "" {
+		names[provider] = true
+	} else {
+		if providers, err := hcs.loadPlatformProviders(platform); err == nil {
+			for _, p := range providers {
+				if p.AvailabilityMonitorEnabled {
+					names[p.Name] = true
+				}
+			}
+		}
+		for name := range samples {
+			names[name] = true
+		}
+		for name := range traffic {
+			names[name] = true
+		}
+	}
+
+	reports := make([]SLAReport, 0, len(names))
+	for name := range names {
+		report := buildSLAReport(samples[name], traffic[name], start, end)
+		report.Platform = platform
+		report.ProviderName = name
+		for i := range report.Incidents {
+			report.Incidents[i].Platform = platform
+			report.Incidents[i].ProviderName = name
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ProviderName < reports[j].ProviderName
+	})
+	return reports, nil
+}
+
+// ExportSLAReportToFile 导出 SLA 报告到指定路径（原子写入）
+func (hcs *HealthCheckService) ExportSLAReportToFile(req SLAExportRequest, path string) (SLAExportResult, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return SLAExportResult{}, fmt.Errorf("导出路径不能为空")
+	}
+	format, kind, err := normalizeSLAExportRequest(req)
+	if err != nil {
+		return SLAExportResult{}, err
+	}
+
+	reports, err := hcs.GetSLAReports(req.SLAReportQuery)
+	if err != nil {
+		return SLAExportResult{}, err
+	}
+
+	var header []string
+	items := make([]usageExportCSVRow, 0, len(reports))
+	switch kind {
+	case SLAExportKindIncidents:
+		header = slaIncidentExportHeader
+		for _, report := range reports {
+			for _, incident := range report.Incidents {
+				items = append(items, newSLAIncidentExportRow(incident))
+			}
+		}
+	default:
+		header = slaSummaryExportHeader
+		for _, report := range reports {
+			items = append(items, newSLASummaryExportRow(report))
+		}
+	}
+
+	data, rows, err := encodeUsageExport(format, header, items)
+	if err != nil {
+		return SLAExportResult{}, err
+	}
+	if err := AtomicWriteBytes(path, data); err != nil {
+		return SLAExportResult{}, err
+	}
+	return SLAExportResult{Path: path, Format: format, Kind: kind, Rows: rows}, nil
+}
+
+// ExportSLAReport 弹出系统保存对话框导出 SLA 报告（默认按月）
+// 用户取消时返回空 Path 且不报错
+func (hcs *HealthCheckService) ExportSLAReport(req SLAExportRequest) (SLAExportResult, error) {
+	format, kind, err := normalizeSLAExportRequest(req)
+	if err != nil {
+		return SLAExportResult{}, err
+	}
+	if strings.TrimSpace(req.Period) == "" && strings.TrimSpace(req.Start) == "" && strings.TrimSpace(req.End) == "" {
+		req.Period = SLAPeriodMonth
+	}
+
+	dialog := application.SaveFileDialog().
+		CanCreateDirectories(true).
+		SetFilename(defaultSLAExportFilename(req.SLAReportQuery, kind, format, time.Now()))
+	if format == UsageExportFormatCSV {
+		dialog.AddFilter("CSV (*.csv)", "*.csv")
+	} else {
+		dialog.AddFilter("JSON Lines (*.jsonl)", "*.jsonl")
+	}
+	path, err := dialog.PromptForSingleSelection()
+	if err != nil {
+		return SLAExportResult{}, fmt.Errorf("打开保存对话框失败: %w", err)
+	}
+	if strings.TrimSpace(path) == "" {
+		return SLAExportResult{Format: format, Kind: kind}, nil
+	}
+	if filepath.Ext(path) == "" {
+		path += "." + format
+	}
+
+	req.Format = format
+	req.Kind = kind
+	return hcs.ExportSLAReportToFile(req, path)
+}
+
+func normalizeSLAExportRequest(req SLAExportRequest) (string, string, error) {
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	switch format {
+	case "":
+		format = UsageExportFormatCSV
+	case UsageExportFormatCSV, UsageExportFormatJSONL:
+	default:
+		return "", "", fmt.Errorf("不支持的导出格式: %s", req.Format)
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	switch kind {
+	case "":
+		kind = SLAExportKindSummary
+	case SLAExportKindSummary, SLAExportKindIncidents:
+	default:
+		return "", "", fmt.Errorf("不支持的导出类型: %s", req.Kind)
+	}
+	return format, kind, nil
+}
+
+func defaultSLAExportFilename(query SLAReportQuery, kind, format string, now time.Time) string {
+	label := now.Format("20060102-150405")
+	if strings.ToLower(strings.TrimSpace(query.Period)) == SLAPeriodMonth {
+		label = now.Format(slaMonthLayout)
+		if month := strings.TrimSpace(query.Month); month != "" {
+			label = month
+		}
+	}
+	return fmt.Sprintf("code-switch-sla-%s-%s-%s.%s", strings.ReplaceAll(query.Platform, ":", "-"), kind, label, format)
+}
+
+// resolveSLARange 解析报告时间范围
+func resolveSLARange(query SLAReportQuery, now time.Time) (time.Time, time.Time, error) {
+	switch period := strings.ToLower(strings.TrimSpace(query.Period)); period {
+	case "":
+		return parseUsageRange(query.Start, query.End)
+	case SLAPeriod24h:
+		return now.Add(-24 * time.Hour), now, nil
+	case SLAPeriod7d:
+		return now.AddDate(0, 0, -7), now, nil
+	case SLAPeriod30d:
+		return now.AddDate(0, 0, -30), now, nil
+	case SLAPeriodMonth:
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		if month := strings.TrimSpace(query.Month); month != "" {
+			parsed, err := time.ParseInLocation(slaMonthLayout, month, time.Local)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("月份格式应为 YYYY-MM: %s", month)
+			}
+			monthStart = parsed
+		}
+		monthEnd := monthStart.AddDate(0, 1, 0)
+		if monthEnd.After(now) {
+			monthEnd = now
+		}
+		if !monthEnd.After(monthStart) {
+			return time.Time{}, time.Time{}, fmt.Errorf("月份 %s 尚未开始", monthStart.Format(slaMonthLayout))
+		}
+		return monthStart, monthEnd, nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("不支持的报告周期: %s", query.Period)
+	}
+}
+
+// querySLACheckSamples 按供应商分组读取范围内的检测记录（按时间升序）
+func querySLACheckSamples(platform, provider string, start, end time.Time) (map[string][]slaCheckSample, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	query := `
+		SELECT provider_name, status, error_message, checked_at
+		FROM health_check_history
+		WHERE platform = ? AND checked_at >= ? AND checked_at < ?
+	`
+	args := []interface{}{platform, start, end}
+	if provider != "" {
+		query += " AND provider_name = ?"
+		args = append(args, provider)
+	}
+	query += " ORDER BY checked_at ASC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		if isNoSuchTableErr(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询检测记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string][]slaCheckSample)
+	for rows.Next() {
+		var sample slaCheckSample
+		var errorMsg sql.NullString
+		if err := rows.Scan(&sample.ProviderName, &sample.Status, &errorMsg, &sample.CheckedAt); err != nil {
+			return nil, fmt.Errorf("解析检测记录失败: %w", err)
+		}
+		// 时间以驱动解析结果为准再过滤一次，避免存储时区差异
+		if sample.CheckedAt.Before(start) || !sample.CheckedAt.Before(end) {
+			continue
+		}
+		sample.ErrorMessage = errorMsg.String
+		result[sample.ProviderName] = append(result[sample.ProviderName], sample)
+	}
+	return result, rows.Err()
+}
+
+// slaTrafficCounts 一个小时内的请求数与成功数
+type slaTrafficCounts struct {
+	Total      int64
+	Successful int64
+}
+
+// querySLATraffic 从小时汇总表按供应商、小时（本地整点的 Unix 秒）统计范围内的请求数与成功数
+func querySLATraffic(platform, provider string, start, end time.Time) (map[string]map[int64]slaTrafficCounts, error) {
+	if _, err := xdb.DB("default"); err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+
+	// 起点向下取整到小时，包含起始小时的流量
+	rows, err := queryRequestLogRollups(start.Truncate(time.Hour), end, platform)
+	if err != nil {
+		return nil, fmt.Errorf("查询流量统计失败: %w", err)
+	}
+
+	result := make(map[string]map[int64]slaTrafficCounts)
+	for _, row := range rows {
+		if provider != "" && row.Provider != provider {
+			continue
+		}
+		hours := result[row.Provider]
+		if hours == nil {
+			hours = make(map[int64]slaTrafficCounts)
+			result[row.Provider] = hours
+		}
+		counts := hours[row.Hour.Unix()]
+		counts.Total += row.TotalRequests
+		counts.Successful += row.SuccessfulRequests
+		hours[row.Hour.Unix()] = counts
+	}
+	return result, nil
+}
+
+// buildSLAReport 根据升序检测记录与按小时的流量计算可用率、故障窗口与 MTTR
+// 故障从第一次失败开始，到下一次成功检测结束；报告结束时仍失败则计为进行中
+func buildSLAReport(samples []slaCheckSample, traffic map[int64]slaTrafficCounts, start, end time.Time) SLAReport {
+	report := SLAReport{Start: start, End: end, Incidents: []SLAIncident{}}
+	for _, counts := range traffic {
+		report.TotalRequests += counts.Total
+		report.SuccessfulRequests += counts.Successful
+	}
+	if report.TotalRequests > 0 {
+		report.TrafficAvailability = float64(report.SuccessfulRequests) * 100 / float64(report.TotalRequests)
+	}
+	report.Availability, report.UnknownSeconds = slaAvailability(samples, traffic, start, end)
+
+	var current *SLAIncident
+	closeIncident := func(resolvedAt *time.Time) {
+		if current == nil {
+			return
+		}
+		until := end
+		if resolvedAt != nil {
+			until = *resolvedAt
+		} else {
+			current.Ongoing = true
+		}
+		current.ResolvedAt = resolvedAt
+		current.DurationSeconds = int64(until.Sub(current.StartedAt).Seconds())
+		report.Incidents = append(report.Incidents, *current)
+		current = nil
+	}
+
+	for _, sample := range samples {
+		report.TotalChecks++
+		if sample.Status == HealthStatusOperational || sample.Status == HealthStatusDegraded {
+			report.UpChecks++
+			if current != nil {
+				resolvedAt := sample.CheckedAt
+				closeIncident(&resolvedAt)
+			}
+			continue
+		}
+		if current == nil {
+			current = &SLAIncident{StartedAt: sample.CheckedAt, Status: sample.Status}
+		}
+		current.FailedChecks++
+		if current.Cause == "" {
+			current.Cause = sample.ErrorMessage
+		}
+	}
+	closeIncident(nil)
+
+	if report.TotalChecks == 0 {
+		return report
+	}
+	report.CheckUptime = float64(report.UpChecks) * 100 / float64(report.TotalChecks)
+
+	var resolvedTotal int64
+	var resolvedCount int64
+	for _, incident := range report.Incidents {
+		report.DowntimeSeconds += incident.DurationSeconds
+		if incident.DurationSeconds > report.LongestIncidentSeconds {
+			report.LongestIncidentSeconds = incident.DurationSeconds
+		}
+		if !incident.Ongoing {
+			resolvedTotal += incident.DurationSeconds
+			resolvedCount++
+		}
+	}
+	report.IncidentCount = len(report.Incidents)
+	if resolvedCount > 0 {
+		report.MTTRSeconds = resolvedTotal / resolvedCount
+	}
+	return report
+}
+
+// slaAvailability 按小时合并检测与流量计算综合可用率，返回可用率（百分比）与未知时长（秒）
+// 每次检测代表到下一次检测为止（最多 slaCheckCoverage）的状态；小时内未被检测覆盖的时间
+// 有流量时按该小时的流量成功率拆分为可用 / 不可用，没有流量则计为未知
+func slaAvailability(samples []slaCheckSample, traffic map[int64]slaTrafficCounts, start, end time.Time) (float64, int64) {
+	type hourCoverage struct{ up, down time.Duration }
+	hours := make(map[int64]*hourCoverage)
+	addSpan := func(from, to time.Time, up bool) {
+		for from.Before(to) {
+			hourStart := from.Truncate(time.Hour)
+			next := hourStart.Add(time.Hour)
+			if next.After(to) {
+				next = to
+			}
+			coverage := hours[hourStart.Unix()]
+			if coverage == nil {
+				coverage = &hourCoverage{}
+				hours[hourStart.Unix()] = coverage
+			}
+			if up {
+				coverage.up += next.Sub(from)
+			} else {
+				coverage.down += next.Sub(from)
+			}
+			from = next
+		}
+	}
+	for i, sample := range samples {
+		until := sample.CheckedAt.Add(slaCheckCoverage)
+		if i+1 < len(samples) && samples[i+1].CheckedAt.Before(until) {
+			until = samples[i+1].CheckedAt
+		}
+		if until.After(end) {
+			until = end
+		}
+		addSpan(sample.CheckedAt, until, sample.Status == HealthStatusOperational || sample.Status == HealthStatusDegraded)
+	}
+
+	var upSeconds, downSeconds, unknownSeconds float64
+	for hourStart := start.Truncate(time.Hour); hourStart.Before(end); hourStart = hourStart.Add(time.Hour) {
+		from, to := hourStart, hourStart.Add(time.Hour)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		uncovered := to.Sub(from).Seconds()
+		if coverage := hours[hourStart.Unix()]; coverage != nil {
+			upSeconds += coverage.up.Seconds()
+			downSeconds += coverage.down.Seconds()
+			uncovered -= (coverage.up + coverage.down).Seconds()
+		}
+		if uncovered <= 0 {
+			continue
+		}
+		if counts := traffic[hourStart.Unix()]; counts.Total > 0 {
+			rate := float64(counts.Successful) / float64(counts.Total)
+			upSeconds += uncovered * rate
+			downSeconds += uncovered * (1 - rate)
+		} else {
+			unknownSeconds += uncovered
+		}
+	}
+
+	if known := upSeconds + downSeconds; known > 0 {
+		return upSeconds * 100 / known, int64(unknownSeconds)
+	}
+	return 0, int64(unknownSeconds)
+}
+
+// slaSummaryExportRow SLA 汇总导出行
+type slaSummaryExportRow struct {
+	Platform               string  `json:"platform"`
+	Provider               string  `json:"provider"`
+	Start                  string  `json:"start"`
+	End                    string  `json:"end"`
+	Availability           float64 `json:"availability"`
+	UnknownSeconds         int64   `json:"unknown_seconds"`
+	CheckUptime            float64 `json:"check_uptime"`
+	TotalChecks            int     `json:"total_checks"`
+	UpChecks               int     `json:"up_checks"`
+	TrafficAvailability    float64 `json:"traffic_availability"`
+	TotalRequests          int64   `json:"total_requests"`
+	SuccessfulRequests     int64   `json:"successful_requests"`
+	IncidentCount          int     `json:"incident_count"`
+	DowntimeSeconds        int64   `json:"downtime_seconds"`
+	MTTRSeconds            int64   `json:"mttr_seconds"`
+	LongestIncidentSeconds int64   `json:"longest_incident_seconds"`
+}
+
+var slaSummaryExportHeader = []string{
+	"platform", "provider", "start", "end", "availability", "unknown_seconds", "check_uptime", "total_checks", "up_checks",
+	"traffic_availability", "total_requests", "successful_requests",
+	"incident_count", "downtime_seconds", "mttr_seconds", "longest_incident_seconds",
+}
+
+func newSLASummaryExportRow(report SLAReport) slaSummaryExportRow {
+	return slaSummaryExportRow{
+		Platform:               report.Platform,
+		Provider:               report.ProviderName,
+		Start:                  report.Start.Format(time.RFC3339),
+		End:                    report.End.Format(time.RFC3339),
+		Availability:           report.Availability,
+		UnknownSeconds:         report.UnknownSeconds,
+		CheckUptime:            report.CheckUptime,
+		TotalChecks:            report.TotalChecks,
+		UpChecks:               report.UpChecks,
+		TrafficAvailability:    report.TrafficAvailability,
+		TotalRequests:          report.TotalRequests,
+		SuccessfulRequests:     report.SuccessfulRequests,
+		IncidentCount:          report.IncidentCount,
+		DowntimeSeconds:        report.DowntimeSeconds,
+		MTTRSeconds:            report.MTTRSeconds,
+		LongestIncidentSeconds: report.LongestIncidentSeconds,
+	}
+}
+
+func (r slaSummaryExportRow) csvRecord() []string {
+	return []string{
+		r.Platform,
+		r.Provider,
+		r.Start,
+		r.End,
+		formatExportFloat(r.Availability),
+		strconv.FormatInt(r.UnknownSeconds, 10),
+		formatExportFloat(r.CheckUptime),
+		strconv.Itoa(r.TotalChecks),
+		strconv.Itoa(r.UpChecks),
+		formatExportFloat(r.TrafficAvailability),
+		strconv.FormatInt(r.TotalRequests, 10),
+		strconv.FormatInt(r.SuccessfulRequests, 10),
+		strconv.Itoa(r.IncidentCount),
+		strconv.FormatInt(r.DowntimeSeconds, 10),
+		strconv.FormatInt(r.MTTRSeconds, 10),
+		strconv.FormatInt(r.LongestIncidentSeconds, 10),
+	}
+}
+
+// slaIncidentExportRow SLA 故障明细导出行
+type slaIncidentExportRow struct {
+	Platform        string `json:"platform"`
+	Provider        string `json:"provider"`
+	StartedAt       string `json:"started_at"`
+	ResolvedAt      string `json:"resolved_at"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	FailedChecks    int    `json:"failed_checks"`
+	Status          string `json:"status"`
+	Cause           string `json:"cause"`
+	Ongoing         bool   `json:"ongoing"`
+}
+
+var slaIncidentExportHeader = []string{
+	"platform", "provider", "started_at", "resolved_at", "duration_seconds", "failed_checks", "status", "cause", "ongoing",
+}
+
+func newSLAIncidentExportRow(incident SLAIncident) slaIncidentExportRow {
+	row := slaIncidentExportRow{
+		Platform:        incident.Platform,
+		Provider:        incident.ProviderName,
+		StartedAt:       incident.StartedAt.Format(time.RFC3339),
+		DurationSeconds: incident.DurationSeconds,
+		FailedChecks:    incident.FailedChecks,
+		Status:          incident.Status,
+		Cause:           incident.Cause,
+		Ongoing:         incident.Ongoing,
+	}
+	if incident.ResolvedAt != nil {
+		row.ResolvedAt = incident.ResolvedAt.Format(time.RFC3339)
+	}
+	return row
+}
+
+func (r slaIncidentExportRow) csvRecord() []string {
+	return []string{
+		r.Platform,
+		r.Provider,
+		r.StartedAt,
+		r.ResolvedAt,
+		strconv.FormatInt(r.DurationSeconds, 10),
+		strconv.Itoa(r.FailedChecks),
+		r.Status,
+		r.Cause,
+		strconv.FormatBool(r.Ongoing),
+	}
+}
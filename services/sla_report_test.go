@@ -0,0 +1,106 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBuildSLAReport_Incidents(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)
+	end := start.Add(10 * time.Hour)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	samples := []slaCheckSample{
+		{Status: HealthStatusOperational, CheckedAt: at(0)},
+		{Status: HealthStatusFailed, ErrorMessage: "HTTP 502", CheckedAt: at(60)},
+		{Status: HealthStatusFailed, ErrorMessage: "timeout", CheckedAt: at(61)},
+		{Status: HealthStatusDegraded, CheckedAt: at(90)},
+		{Status: HealthStatusValidationError, ErrorMessage: "校验未通过", CheckedAt: at(300)},
+		{Status: HealthStatusOperational, CheckedAt: at(330)},
+		{Status: HealthStatusFailed, ErrorMessage: "HTTP 503", CheckedAt: at(540)},
+	}
+
+	report := buildSLAReport(samples, nil, start, end)
+	if report.TotalChecks != 7 || report.UpChecks != 3 {
+		t.Fatalf("checks = %d/%d, want 3/7", report.UpChecks, report.TotalChecks)
+	}
+	if report.IncidentCount != 3 {
+		t.Fatalf("incidents = %+v, want 3", report.Incidents)
+	}
+
+	first := report.Incidents[0]
+	if first.DurationSeconds != 30*60 || first.FailedChecks != 2 || first.Cause != "HTTP 502" || first.Ongoing {
+		t.Fatalf("first incident = %+v", first)
+	}
+	last := report.Incidents[2]
+	if !last.Ongoing || last.ResolvedAt != nil || last.DurationSeconds != 60*60 {
+		t.Fatalf("ongoing incident = %+v", last)
+	}
+
+	if report.MTTRSeconds != 30*60 {
+		t.Fatalf("MTTR = %d, want %d", report.MTTRSeconds, 30*60)
+	}
+	if report.DowntimeSeconds != 120*60 || report.LongestIncidentSeconds != 60*60 {
+		t.Fatalf("downtime = %d, longest = %d", report.DowntimeSeconds, report.LongestIncidentSeconds)
+	}
+	// 每次检测最多代表 30 分钟：可用 90 分钟、故障 90 分钟，其余 420 分钟未知
+	if report.Availability != 50 || report.UnknownSeconds != 420*60 {
+		t.Fatalf("availability = %v, unknown = %d, want 50 and %d", report.Availability, report.UnknownSeconds, 420*60)
+	}
+
+	// 未被检测覆盖的第 3 个小时有流量（成功率 90%），按流量计入
+	traffic := map[int64]slaTrafficCounts{start.Add(2 * time.Hour).Unix(): {Total: 10, Successful: 9}}
+	report = buildSLAReport(samples, traffic, start, end)
+	if report.TotalRequests != 10 || report.TrafficAvailability != 90 {
+		t.Fatalf("traffic = %d/%v, want 10 requests at 90%%", report.TotalRequests, report.TrafficAvailability)
+	}
+	if math.Abs(report.Availability-60) > 1e-9 || report.UnknownSeconds != 360*60 {
+		t.Fatalf("availability = %v, unknown = %d, want 60 and %d", report.Availability, report.UnknownSeconds, 360*60)
+	}
+}
+
+func TestBuildSLAReport_NoChecks(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	report := buildSLAReport(nil, nil, start, time.Now())
+	if report.TotalChecks != 0 || report.Availability != 0 || report.UnknownSeconds < 3599 || report.Incidents == nil {
+		t.Fatalf("empty report = %+v", report)
+	}
+}
+
+func TestResolveSLARange(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+
+	start, end, err := resolveSLARange(SLAReportQuery{Period: SLAPeriod7d}, now)
+	if err != nil || !end.Equal(now) || !start.Equal(now.AddDate(0, 0, -7)) {
+		t.Fatalf("7d range = %v - %v, %v", start, end, err)
+	}
+
+	start, end, err = resolveSLARange(SLAReportQuery{Period: SLAPeriodMonth, Month: "2026-09"}, now)
+	if err != nil || start.Day() != 1 || start.Month() != time.September || end.Month() != time.October || end.Day() != 1 {
+		t.Fatalf("month range = %v - %v, %v", start, end, err)
+	}
+
+	// 当月截止到当前时间
+	start, end, err = resolveSLARange(SLAReportQuery{Period: SLAPeriodMonth}, now)
+	if err != nil || start.Month() != time.October || !end.Equal(now) {
+		t.Fatalf("current month range = %v - %v, %v", start, end, err)
+	}
+
+	if _, _, err := resolveSLARange(SLAReportQuery{Period: SLAPeriodMonth, Month: "2026-11"}, now); err == nil {
+		t.Fatal("future month should fail")
+	}
+	if _, _, err := resolveSLARange(SLAReportQuery{Period: "1y"}, now); err == nil {
+		t.Fatal("unknown period should fail")
+	}
+}
+
+func TestHealthHistoryCleanupCutoffKeepsSLAMonths(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	if got, want := healthHistoryCleanupCutoff(now, 0), time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Fatalf("default cutoff = %v, want %v", got, want)
+	}
+	if got, want := healthHistoryCleanupCutoff(now, 90), now.AddDate(0, 0, -90); !got.Equal(want) {
+		t.Fatalf("long retention cutoff = %v, want %v", got, want)
+	}
+}
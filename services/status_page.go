@@ -0,0 +1,326 @@
+package services
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 状态页：由中转服务提供的只读可用性视图（GET /status 与 /status.json）
+// - 默认关闭，通过 AppSettings.StatusPageEnabled 开启，关闭时返回 404
+// - 配置了 StatusPageToken 时需携带 ?token= 或 Authorization: Bearer；未配置令牌时只允许本机访问（中转服务监听所有网卡）
+// - 不输出 API Key / API URL，错误信息中的地址与密钥会被替换
+const (
+	statusPageTimelineLimit = 30 // 每个供应商最多展示的检测记录数
+	statusPageRefreshSecond = 60 // HTML 自动刷新间隔
+	statusPageRedacted      = "[redacted]"
+)
+
+var (
+	statusPageURLPattern    = regexp.MustCompile(`https?://[^\s"'<>]+`)
+	statusPageSecretPattern = regexp.MustCompile(`(?i)(bearer\s+)?\b(sk-[a-z0-9_\-]{8,}|AIza[0-9A-Za-z_\-]{20,})`)
+)
+
+// StatusPageSnapshot 状态页数据
+type StatusPageSnapshot struct {
+	GeneratedAt time.Time            `json:"generatedAt"`
+	Platforms   []StatusPagePlatform `json:"platforms"`
+}
+
+// StatusPagePlatform 单个平台的状态
+type StatusPagePlatform struct {
+	Platform         string               `json:"platform"`
+	LastUsedProvider string               `json:"lastUsedProvider,omitempty"`
+	LastUsedAt       *time.Time           `json:"lastUsedAt,omitempty"`
+	Providers        []StatusPageProvider `json:"providers"`
+}
+
+// StatusPageProvider 单个供应商的状态（不含任何连接信息）
+type StatusPageProvider struct {
+	Name              string            `json:"name"`
+	MonitorEnabled    bool              `json:"monitorEnabled"`
+	Status            string            `json:"status"` // 最新检测状态，无检测记录时为 unknown
+	LatencyMs         int               `json:"latencyMs"`
+	Message           string            `json:"message,omitempty"` // 最新检测的错误信息（已脱敏）
+	LastCheckedAt     *time.Time        `json:"lastCheckedAt,omitempty"`
+	Uptime            float64           `json:"uptime"`
+	AvgLatencyMs      int               `json:"avgLatencyMs"`
+	PassiveStatus     string            `json:"passiveStatus,omitempty"`
+	Blacklisted       bool              `json:"blacklisted"`
+	BlacklistedUntil  *time.Time        `json:"blacklistedUntil,omitempty"`
+	BlacklistedModels []string          `json:"blacklistedModels,omitempty"`
+	CircuitState      string            `json:"circuitState,omitempty"`
+	LastUsed          bool              `json:"lastUsed"`
+	Timeline          []StatusPageCheck `json:"timeline"` // 最近的检测记录（新在前）
+}
+
+// StatusPageCheck 时间线中的一次检测
+type StatusPageCheck struct {
+	Status    string    `json:"status"`
+	LatencyMs int       `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// SetStatusPageSources 注入状态页所需的数据源（未注入时状态页不可用）
+func (prs *ProviderRelayService) SetStatusPageSources(healthCheckService *HealthCheckService, appSettings *AppSettingsService) {
+	prs.statusHealth = healthCheckService
+	prs.statusSettings = appSettings
+}
+
+// statusPageHandler 处理状态页请求，asJSON 为 true 时返回 JSON
+func (prs *ProviderRelayService) statusPageHandler(asJSON bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if prs.statusHealth == nil || prs.statusSettings == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "status page is disabled"})
+			return
+		}
+		settings, err := prs.statusSettings.GetAppSettings()
+		if err != nil || !settings.StatusPageEnabled {
+			c.JSON(http.StatusNotFound, gin.H{"error": "status page is disabled"})
+			return
+		}
+		if strings.TrimSpace(settings.StatusPageToken) == "" && !isLoopbackRemoteAddr(c.Request.RemoteAddr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "status page token is required for remote access"})
+			return
+		}
+		if !statusPageAuthorized(c, settings.StatusPageToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid status page token"})
+			return
+		}
+
+		snapshot, err := prs.buildStatusSnapshot()
+		if err != nil {
+			log.Printf("[StatusPage] 生成状态页失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build status"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		if asJSON {
+			c.JSON(http.StatusOK, snapshot)
+			return
+		}
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := statusPageTemplate.Execute(c.Writer, snapshot); err != nil {
+			log.Printf("[StatusPage] 渲染状态页失败: %v", err)
+		}
+	}
+}
+
+func statusPageAuthorized(c *gin.Context, token string) bool {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return true
+	}
+	provided := c.Query("token")
+	if provided == "" {
+		auth := c.GetHeader("Authorization")
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+			provided = strings.TrimSpace(auth[7:])
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// isLoopbackRemoteAddr 请求是否来自本机（使用连接地址，不信任 X-Forwarded-For 等请求头）
+func isLoopbackRemoteAddr(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// buildStatusSnapshot 汇总可用性监控、黑名单与最后使用的供应商
+func (prs *ProviderRelayService) buildStatusSnapshot() (StatusPageSnapshot, error) {
+	timelines, err := prs.statusHealth.GetLatestResults()
+	if err != nil {
+		return StatusPageSnapshot{}, err
+	}
+
+	blacklist := make(map[string][]BlacklistStatus)
+	var secrets []string
+	for platform := range timelines {
+		if prs.blacklistService != nil {
+			if statuses, err := prs.blacklistService.GetBlacklistStatus(platform); err == nil {
+				blacklist[platform] = statuses
+			}
+		}
+		providers, err := prs.statusHealth.loadPlatformProviders(platform)
+		if err != nil {
+			continue
+		}
+		for _, p := range providers {
+			secrets = append(secrets, p.APIKey, p.APIURL)
+		}
+	}
+
+	return buildStatusPageSnapshot(timelines, blacklist, prs.GetAllLastUsedProviders(), secrets, time.Now()), nil
+}
+
+// buildStatusPageSnapshot 组装状态页数据；secrets 为需要从文本中抹去的密钥与地址
+func buildStatusPageSnapshot(timelines map[string][]ProviderTimeline, blacklist map[string][]BlacklistStatus, lastUsed map[string]*LastUsedProvider, secrets []string, now time.Time) StatusPageSnapshot {
+	snapshot := StatusPageSnapshot{GeneratedAt: now, Platforms: []StatusPagePlatform{}}
+
+	platforms := make([]string, 0, len(timelines))
+	for platform := range timelines {
+		platforms = append(platforms, platform)
+	}
+	sort.Slice(platforms, func(i, j int) bool {
+		return statusPlatformOrder(platforms[i]) < statusPlatformOrder(platforms[j]) ||
+			(statusPlatformOrder(platforms[i]) == statusPlatformOrder(platforms[j]) && platforms[i] < platforms[j])
+	})
+
+	for _, platform := range platforms {
+		entry := StatusPagePlatform{Platform: platform, Providers: []StatusPageProvider{}}
+		if used := lastUsed[platform]; used != nil && used.ProviderName != "" {
+			entry.LastUsedProvider = used.ProviderName
+			at := time.UnixMilli(used.UpdatedAt)
+			entry.LastUsedAt = &at
+		}
+
+		for _, timeline := range timelines[platform] {
+			provider := StatusPageProvider{
+				Name:           timeline.ProviderName,
+				MonitorEnabled: timeline.AvailabilityMonitorEnabled,
+				Status:         "unknown",
+				Uptime:         timeline.Uptime,
+				AvgLatencyMs:   timeline.AvgLatencyMs,
+				LastUsed:       entry.LastUsedProvider == timeline.ProviderName,
+				Timeline:       []StatusPageCheck{},
+			}
+			if latest := timeline.Latest; latest != nil {
+				checkedAt := latest.CheckedAt
+				provider.Status = latest.Status
+				provider.LatencyMs = latest.LatencyMs
+				provider.Message = redactStatusText(latest.ErrorMessage, secrets)
+				provider.LastCheckedAt = &checkedAt
+			}
+			if timeline.Passive != nil {
+				provider.PassiveStatus = timeline.Passive.Status
+			}
+			for i, item := range timeline.Items {
+				if i >= statusPageTimelineLimit {
+					break
+				}
+				provider.Timeline = append(provider.Timeline, StatusPageCheck{
+					Status:    item.Status,
+					LatencyMs: item.LatencyMs,
+					CheckedAt: item.CheckedAt,
+				})
+			}
+			for _, status := range blacklist[platform] {
+				if status.ProviderName != timeline.ProviderName || !status.IsBlacklisted {
+					continue
+				}
+				if status.Model != "" {
+					provider.BlacklistedModels = append(provider.BlacklistedModels, status.Model)
+					continue
+				}
+				provider.Blacklisted = true
+				provider.BlacklistedUntil = status.BlacklistedUntil
+				provider.CircuitState = status.CircuitState
+			}
+			entry.Providers = append(entry.Providers, provider)
+		}
+		snapshot.Platforms = append(snapshot.Platforms, entry)
+	}
+	return snapshot
+}
+
+// redactStatusText 抹去文本中的已知密钥/地址，以及形似 URL 和 API Key 的片段
+func redactStatusText(text string, secrets []string) string {
+	if text == "" {
+		return ""
+	}
+	text = statusPageURLPattern.ReplaceAllString(text, statusPageRedacted)
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if len(secret) < 6 {
+			continue
+		}
+		text = strings.ReplaceAll(text, secret, statusPageRedacted)
+		if host := strings.TrimPrefix(strings.TrimPrefix(secret, "https://"), "http://"); host != secret {
+			text = strings.ReplaceAll(text, strings.TrimSuffix(host, "/"), statusPageRedacted)
+		}
+	}
+	text = statusPageSecretPattern.ReplaceAllString(text, statusPageRedacted)
+	return text
+}
+
+func statusPlatformOrder(platform string) int {
+	switch platform {
+	case "claude":
+		return 0
+	case "codex":
+		return 1
+	case "gemini":
+		return 2
+	default:
+		return 3
+	}
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"refresh": func() int { return statusPageRefreshSecond },
+	"clock": func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Local().Format("01-02 15:04:05")
+	},
+	"stamp":   func(t time.Time) string { return t.Local().Format("01-02 15:04:05") },
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", v) },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{refresh}}">
+<title>Code Switch 状态</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",sans-serif;margin:24px;color:#1f2328;background:#f6f8fa}
+h1{font-size:20px}h2{font-size:16px;margin-top:28px}
+table{border-collapse:collapse;width:100%;background:#fff}
+th,td{border:1px solid #d0d7de;padding:6px 8px;font-size:13px;text-align:left;vertical-align:top}
+.operational{color:#1a7f37}.degraded{color:#9a6700}.failed,.validation_failed{color:#cf222e}.unknown{color:#6e7781}
+.bar{display:inline-block;width:6px;height:14px;margin-right:1px;background:#d0d7de}
+.bar.operational{background:#2da44e}.bar.degraded{background:#d4a72c}.bar.failed,.bar.validation_failed{background:#cf222e}
+.muted{color:#6e7781}
+</style>
+</head>
+<body>
+<h1>Code Switch 供应商状态</h1>
+<p class="muted">生成时间 {{stamp .GeneratedAt}}，每 {{refresh}} 秒自动刷新</p>
+{{range .Platforms}}
+<h2>{{.Platform}}{{if .LastUsedProvider}} <span class="muted">· 最近使用 {{.LastUsedProvider}}（{{clock .LastUsedAt}}）</span>{{end}}</h2>
+<table>
+<tr><th>供应商</th><th>状态</th><th>延迟</th><th>可用率</th><th>黑名单</th><th>最近检测</th><th>时间线（新→旧）</th></tr>
+{{range .Providers}}
+<tr>
+<td>{{.Name}}{{if .LastUsed}} ★{{end}}{{if not .MonitorEnabled}} <span class="muted">(未监控)</span>{{end}}</td>
+<td class="{{.Status}}">{{.Status}}{{if .PassiveStatus}} <span class="muted">/ 流量 {{.PassiveStatus}}</span>{{end}}{{if .Message}}<br><span class="muted">{{.Message}}</span>{{end}}</td>
+<td>{{.LatencyMs}}ms <span class="muted">(均 {{.AvgLatencyMs}}ms)</span></td>
+<td>{{percent .Uptime}}</td>
+<td>{{if .Blacklisted}}<span class="failed">已拉黑</span> 至 {{clock .BlacklistedUntil}}{{else}}-{{end}}{{range .BlacklistedModels}}<br><span class="muted">模型 {{.}}</span>{{end}}</td>
+<td>{{clock .LastCheckedAt}}</td>
+<td>{{range .Timeline}}<span class="bar {{.Status}}" title="{{stamp .CheckedAt}} {{.Status}} {{.LatencyMs}}ms"></span>{{end}}</td>
+</tr>
+{{else}}
+<tr><td colspan="7" class="muted">暂无供应商</td></tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildStatusPageSnapshot_RedactsSecrets(t *testing.T) {
+	now := time.Now()
+	until := now.Add(10 * time.Minute)
+	timelines := map[string][]ProviderTimeline{
+		"codex": {{ProviderName: "backup"}},
+		"claude": {{
+			ProviderName:               "relay-a",
+			AvailabilityMonitorEnabled: true,
+			AvailabilityConfig:         &AvailabilityConfig{TestEndpoint: "/v1/messages"},
+			Latest: &HealthCheckResult{
+				Status:       HealthStatusFailed,
+				Endpoint:     "https://relay-a.example.com/v1/messages",
+				ErrorMessage: "请求 https://relay-a.example.com/v1/messages 失败: invalid key sk-ant-secret-123456",
+				CheckedAt:    now,
+			},
+			Items: []HealthCheckResult{{Status: HealthStatusFailed, CheckedAt: now}, {Status: HealthStatusOperational, CheckedAt: now.Add(-time.Minute)}},
+		}},
+	}
+	blacklist := map[string][]BlacklistStatus{
+		"claude": {
+			{ProviderName: "relay-a", IsBlacklisted: true, BlacklistedUntil: &until, CircuitState: "open"},
+			{ProviderName: "relay-a", Model: "claude-opus", IsBlacklisted: true},
+		},
+	}
+	lastUsed := map[string]*LastUsedProvider{"claude": {Platform: "claude", ProviderName: "relay-a", UpdatedAt: now.UnixMilli()}}
+	secrets := []string{"sk-ant-secret-123456", "https://relay-a.example.com"}
+
+	snapshot := buildStatusPageSnapshot(timelines, blacklist, lastUsed, secrets, now)
+	if len(snapshot.Platforms) != 2 || snapshot.Platforms[0].Platform != "claude" {
+		t.Fatalf("platforms = %+v, want claude first", snapshot.Platforms)
+	}
+	provider := snapshot.Platforms[0].Providers[0]
+	if !provider.Blacklisted || provider.CircuitState != "open" || len(provider.BlacklistedModels) != 1 || !provider.LastUsed {
+		t.Fatalf("provider = %+v", provider)
+	}
+	if len(provider.Timeline) != 2 || provider.Status != HealthStatusFailed {
+		t.Fatalf("timeline = %+v, status = %s", provider.Timeline, provider.Status)
+	}
+	if snapshot.Platforms[1].Providers[0].Status != "unknown" {
+		t.Fatalf("provider without checks should be unknown: %+v", snapshot.Platforms[1].Providers[0])
+	}
+
+	data, _ := json.Marshal(snapshot)
+	for _, leaked := range []string{"relay-a.example.com", "sk-ant", "/v1/messages"} {
+		if strings.Contains(string(data), leaked) {
+			t.Fatalf("snapshot leaks %q: %s", leaked, data)
+		}
+	}
+}
+
+func TestStatusPageHandler_EnabledAndToken(t *testing.T) {
+	isolateHomeDir(t)
+	gin.SetMode(gin.TestMode)
+
+	appSettings := &AppSettingsService{path: filepath.Join(t.TempDir(), "app.json")}
+	prs := &ProviderRelayService{lastUsed: map[string]*LastUsedProvider{}}
+	prs.SetStatusPageSources(&HealthCheckService{}, appSettings)
+	router := gin.New()
+	prs.registerRoutes(router)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil)) // RemoteAddr 为 192.0.2.1
+		return rec.Code
+	}
+
+	if code := get("/status.json"); code != http.StatusNotFound {
+		t.Fatalf("disabled status page code = %d, want 404", code)
+	}
+
+	// 未配置令牌时只允许本机访问
+	if err := appSettings.saveLocked(AppSettings{StatusPageEnabled: true}); err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+	if code := get("/status.json"); code != http.StatusForbidden {
+		t.Fatalf("remote access without token code = %d, want 403", code)
+	}
+	if !isLoopbackRemoteAddr("127.0.0.1:5000") || !isLoopbackRemoteAddr("[::1]:5000") || isLoopbackRemoteAddr("192.168.1.2:5000") {
+		t.Fatalf("unexpected loopback detection")
+	}
+
+	if err := appSettings.saveLocked(AppSettings{StatusPageEnabled: true, StatusPageToken: "t0ken"}); err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+	if code := get("/status.json"); code != http.StatusUnauthorized {
+		t.Fatalf("missing token code = %d, want 401", code)
+	}
+	if code := get("/status.json?token=wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token code = %d, want 401", code)
+	}
+}
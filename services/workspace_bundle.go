@@ -0,0 +1,1267 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// 工作区导出/导入：把供应商、MCP、提示词、技能仓库、自定义 CLI 工具与各项设置打包为带清单的 zip，
+// 新机器导入前先预览冲突，再按条目选择合并/覆盖/跳过
+const (
+	workspaceBundleFormat  = "code-switch-workspace"
+	workspaceBundleVersion = 1
+	workspaceManifestEntry = "manifest.json"
+	workspaceDataEntry     = "workspace.json"
+	workspaceSealedEntry   = "workspace.enc" // 口令加密时代替 workspace.json
+	workspaceSealedID      = "workspace"     // AES-GCM 附加数据
+
+	workspaceBundleMaxEntrySize = 64 << 20 // 单个条目解压后的上限，防止构造的压缩包耗尽内存
+)
+
+// 导出分区
+const (
+	WorkspaceSectionProviders   = "providers"
+	WorkspaceSectionGemini      = "gemini"
+	WorkspaceSectionMCP         = "mcp"
+	WorkspaceSectionPrompts     = "prompts"
+	WorkspaceSectionSkillRepos  = "skillRepos"
+	WorkspaceSectionCustomTools = "customTools"
+	WorkspaceSectionSettings    = "settings"
+	WorkspaceSectionAppSettings = "appSettings"
+)
+
+// 冲突处理策略
+const (
+	WorkspaceStrategyMerge     = "merge"     // 导入内容中的非空字段覆盖本地，其余保留本地
+	WorkspaceStrategyOverwrite = "overwrite" // 以导入内容替换本地（导入内容未携带的密钥保留本地值）
+	WorkspaceStrategySkip      = "skip"      // 保留本地
+)
+
+// 预览状态
+const (
+	WorkspaceItemNew       = "new"
+	WorkspaceItemConflict  = "conflict"
+	WorkspaceItemIdentical = "identical"
+)
+
+// workspaceInternalSettings app_settings 中的本机状态标记，不随工作区导出
+var workspaceInternalSettings = map[string]bool{
+	requestLogPrunedBeforeKey:     true,
+	requestLogRollupBackfilledKey: true,
+}
+
+// WorkspaceManifest 导出包清单
+type WorkspaceManifest struct {
+	Format     string         `json:"format"`
+	Version    int            `json:"version"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	Redacted   bool           `json:"redacted"` // API Key 等密钥已移除
+	Encrypted  bool           `json:"encrypted"`
+	Salt       string         `json:"salt,omitempty"` // 口令加密的 PBKDF2 盐（base64）
+	Iterations int            `json:"iterations,omitempty"`
+	Counts     map[string]int `json:"counts"` // 各分区条目数
+}
+
+// workspaceData 导出内容（workspace.json）
+type workspaceData struct {
+	Providers   map[string][]Provider        `json:"providers"` // kind -> providers（custom:{toolId} 使用导出端的工具 ID）
+	Gemini      []GeminiProvider             `json:"gemini"`
+	MCPServers  []MCPServer                  `json:"mcpServers"`
+	Prompts     map[string]map[string]Prompt `json:"prompts"` // platform -> id -> prompt
+	SkillRepos  []skillRepoConfig            `json:"skillRepos"`
+	CustomTools []CustomCliTool              `json:"customTools"`
+	Settings    map[string]string            `json:"settings"` // app_settings 表（黑名单等）
+	AppSettings *AppSettings                 `json:"appSettings,omitempty"`
+}
+
+// WorkspaceExportOptions 导出选项
+type WorkspaceExportOptions struct {
+	RedactKeys bool   `json:"redactKeys"`
+	Passphrase string `json:"passphrase"` // 非空时使用口令加密导出内容
+}
+
+// WorkspaceExportResult 导出结果（Path 为空表示用户取消）
+type WorkspaceExportResult struct {
+	Path     string            `json:"path"`
+	Manifest WorkspaceManifest `json:"manifest"`
+}
+
+// WorkspaceImportItem 导入预览中的单个条目
+type WorkspaceImportItem struct {
+	Key     string   `json:"key"`
+	Section string   `json:"section"`
+	Group   string   `json:"group,omitempty"` // 供应商类型 / 提示词平台
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Changed []string `json:"changed,omitempty"` // 冲突时与本地不同的字段
+}
+
+// WorkspaceImportPreview 导入预览
+type WorkspaceImportPreview struct {
+	Manifest WorkspaceManifest     `json:"manifest"`
+	Items    []WorkspaceImportItem `json:"items"`
+}
+
+// WorkspaceImportRequest 导入请求
+type WorkspaceImportRequest struct {
+	Path            string            `json:"path"`
+	Passphrase      string            `json:"passphrase"`
+	DefaultStrategy string            `json:"defaultStrategy"` // 冲突条目的默认策略，默认 skip
+	Strategies      map[string]string `json:"strategies"`      // 按条目 key 指定策略
+}
+
+// WorkspaceImportResult 导入结果
+type WorkspaceImportResult struct {
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors"`
+}
+
+// WorkspaceService 工作区导出/导入
+type WorkspaceService struct {
+	providerService    *ProviderService
+	geminiService      *GeminiService
+	mcpService         *MCPService
+	promptService      *PromptService
+	skillService       *SkillService
+	customCliService   *CustomCliService
+	settingsService    *SettingsService
+	appSettingsService *AppSettingsService
+}
+
+func NewWorkspaceService(
+	providerService *ProviderService,
+	geminiService *GeminiService,
+	mcpService *MCPService,
+	promptService *PromptService,
+	skillService *SkillService,
+	customCliService *CustomCliService,
+	settingsService *SettingsService,
+	appSettingsService *AppSettingsService,
+) *WorkspaceService {
+	return &WorkspaceService{
+		providerService:    providerService,
+		geminiService:      geminiService,
+		mcpService:         mcpService,
+		promptService:      promptService,
+		skillService:       skillService,
+		customCliService:   customCliService,
+		settingsService:    settingsService,
+		appSettingsService: appSettingsService,
+	}
+}
+
+// ExportWorkspace 弹出保存对话框并导出工作区
+func (ws *WorkspaceService) ExportWorkspace(opts WorkspaceExportOptions) (WorkspaceExportResult, error) {
+	path, err := application.SaveFileDialog().
+		CanCreateDirectories(true).
+		SetFilename(fmt.Sprintf("code-switch-workspace-%s.zip", time.Now().Format("20060102-150405"))).
+		AddFilter("Workspace (*.zip)", "*.zip").
+		PromptForSingleSelection()
+	if err != nil {
+		return WorkspaceExportResult{}, fmt.Errorf("打开保存对话框失败: %w", err)
+	}
+	if strings.TrimSpace(path) == "" {
+		return WorkspaceExportResult{}, nil
+	}
+	if filepath.Ext(path) == "" {
+		path += ".zip"
+	}
+	return ws.ExportWorkspaceToFile(opts, path)
+}
+
+// ExportWorkspaceToFile 导出工作区到指定路径
+func (ws *WorkspaceService) ExportWorkspaceToFile(opts WorkspaceExportOptions, path string) (WorkspaceExportResult, error) {
+	data, err := ws.collectWorkspace(opts.RedactKeys)
+	if err != nil {
+		return WorkspaceExportResult{}, err
+	}
+	payload, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return WorkspaceExportResult{}, fmt.Errorf("序列化工作区失败: %w", err)
+	}
+
+	manifest := WorkspaceManifest{
+		Format:    workspaceBundleFormat,
+		Version:   workspaceBundleVersion,
+		CreatedAt: time.Now(),
+		Redacted:  opts.RedactKeys,
+		Counts:    data.counts(),
+	}
+	dataEntry := workspaceDataEntry
+	if opts.Passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return WorkspaceExportResult{}, fmt.Errorf("生成随机数失败: %w", err)
+		}
+		key, err := deriveVaultKey(opts.Passphrase, salt, secretVaultKDFIters)
+		if err != nil {
+			return WorkspaceExportResult{}, err
+		}
+		aead, err := newVaultAEAD(key)
+		if err != nil {
+			return WorkspaceExportResult{}, err
+		}
+		sealed, err := sealVaultValue(aead, workspaceSealedID, string(payload))
+		if err != nil {
+			return WorkspaceExportResult{}, err
+		}
+		if payload, err = json.Marshal(sealed); err != nil {
+			return WorkspaceExportResult{}, err
+		}
+		manifest.Encrypted = true
+		manifest.Salt = base64.StdEncoding.EncodeToString(salt)
+		manifest.Iterations = secretVaultKDFIters
+		dataEntry = workspaceSealedEntry
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return WorkspaceExportResult{}, err
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{{workspaceManifestEntry, manifestBytes}, {dataEntry, payload}} {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			return WorkspaceExportResult{}, fmt.Errorf("写入导出包失败: %w", err)
+		}
+		if _, err := w.Write(entry.data); err != nil {
+			return WorkspaceExportResult{}, fmt.Errorf("写入导出包失败: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return WorkspaceExportResult{}, fmt.Errorf("写入导出包失败: %w", err)
+	}
+	if err := AtomicWriteBytes(path, buf.Bytes()); err != nil {
+		return WorkspaceExportResult{}, fmt.Errorf("保存导出包失败: %w", err)
+	}
+	log.Printf("[Workspace] 已导出工作区到 %s（脱敏=%v，加密=%v）", path, manifest.Redacted, manifest.Encrypted)
+	return WorkspaceExportResult{Path: path, Manifest: manifest}, nil
+}
+
+// PreviewWorkspaceImport 读取导出包并列出各条目与本地配置的差异
+func (ws *WorkspaceService) PreviewWorkspaceImport(path, passphrase string) (*WorkspaceImportPreview, error) {
+	manifest, data, err := readWorkspaceBundle(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	items, err := ws.previewWorkspaceData(data)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkspaceImportPreview{Manifest: *manifest, Items: items}, nil
+}
+
+// ImportWorkspace 按条目策略导入工作区：新增条目默认导入，冲突条目默认跳过，内容相同的条目忽略
+func (ws *WorkspaceService) ImportWorkspace(req WorkspaceImportRequest) (*WorkspaceImportResult, error) {
+	if _, err := normalizeWorkspaceStrategy(req.DefaultStrategy); err != nil {
+		return nil, err
+	}
+	_, data, err := readWorkspaceBundle(req.Path, req.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ws.importWorkspaceData(data, req.DefaultStrategy, req.Strategies)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Workspace] 已从 %s 导入工作区：导入 %d 项，跳过 %d 项，失败 %d 项", req.Path, result.Imported, result.Skipped, len(result.Errors))
+	return result, nil
+}
+
+// previewWorkspaceData 列出导入内容中各条目与本地配置的差异（深度链接复用）
+func (ws *WorkspaceService) previewWorkspaceData(data *workspaceData) ([]WorkspaceImportItem, error) {
+	entries, err := ws.planWorkspaceImport(data)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]WorkspaceImportItem, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, entry.WorkspaceImportItem)
+	}
+	return items, nil
+}
+
+// importWorkspaceData 按条目策略导入已解析的工作区内容（深度链接复用）
+func (ws *WorkspaceService) importWorkspaceData(data *workspaceData, defaultStrategy string, requested map[string]string) (*WorkspaceImportResult, error) {
+	defaultStrategy, err := normalizeWorkspaceStrategy(defaultStrategy)
+	if err != nil {
+		return nil, err
+	}
+	strategies := make(map[string]string, len(requested))
+	for key, value := range requested {
+		if strategies[key], err = normalizeWorkspaceStrategy(value); err != nil {
+			return nil, err
+		}
+	}
+	entries, err := ws.planWorkspaceImport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WorkspaceImportResult{Errors: []string{}}
+	selected := make([]workspaceEntry, 0, len(entries))
+	for _, entry := range entries {
+		strategy, ok := strategies[entry.Key]
+		if !ok {
+			strategy = defaultStrategy
+			if entry.Status == WorkspaceItemNew {
+				strategy = WorkspaceStrategyOverwrite
+			}
+		}
+		if entry.Status == WorkspaceItemIdentical || strategy == WorkspaceStrategySkip {
+			result.Skipped++
+			continue
+		}
+		entry.strategy = strategy
+		selected = append(selected, entry)
+	}
+
+	ws.applyWorkspaceImport(data, selected, result)
+	return result, nil
+}
+
+func normalizeWorkspaceStrategy(strategy string) (string, error) {
+	switch strategy = strings.ToLower(strings.TrimSpace(strategy)); strategy {
+	case "":
+		return WorkspaceStrategySkip, nil
+	case WorkspaceStrategyMerge, WorkspaceStrategyOverwrite, WorkspaceStrategySkip:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("未知冲突策略: %s", strategy)
+	}
+}
+
+// collectWorkspace 收集各服务的当前配置；未注入的服务对应分区为空
+func (ws *WorkspaceService) collectWorkspace(redact bool) (*workspaceData, error) {
+	if !redact && secretVaultLocked() {
+		return nil, errSecretVaultLocked
+	}
+	data := &workspaceData{
+		Providers: map[string][]Provider{},
+		Prompts:   map[string]map[string]Prompt{},
+		Settings:  map[string]string{},
+	}
+
+	if ws.customCliService != nil {
+		tools, err := ws.customCliService.ListTools()
+		if err != nil {
+			return nil, fmt.Errorf("加载自定义 CLI 工具失败: %w", err)
+		}
+		data.CustomTools = tools
+	}
+	if ws.providerService != nil {
+		kinds := []string{"claude", "codex"}
+		for _, tool := range data.CustomTools {
+			kinds = append(kinds, "custom:"+tool.ID)
+		}
+		for _, kind := range kinds {
+			providers, err := ws.providerService.LoadProviders(kind)
+			if err != nil {
+				return nil, fmt.Errorf("加载 %s 供应商失败: %w", kind, err)
+			}
+			if len(providers) == 0 {
+				continue
+			}
+			if redact {
+				for i := range providers {
+					providers[i].APIKey = ""
+					providers[i].APIURL = redactWorkspaceURL(providers[i].APIURL)
+				}
+			}
+			data.Providers[kind] = providers
+		}
+	}
+	if ws.geminiService != nil {
+		for _, p := range ws.geminiService.GetProviders() {
+			if redact {
+				p.APIKey = ""
+				p.BaseURL = redactWorkspaceURL(p.BaseURL)
+				p.EnvConfig = redactWorkspaceEnv(p.EnvConfig)
+				p.SettingsConfig = redactWorkspaceSettingsConfig(p.SettingsConfig)
+			}
+			data.Gemini = append(data.Gemini, p)
+		}
+	}
+	if ws.mcpService != nil {
+		servers, err := ws.mcpService.ListServers()
+		if err != nil {
+			return nil, fmt.Errorf("加载 MCP 服务器失败: %w", err)
+		}
+		for i := range servers {
+			if redact {
+				servers[i].Env = redactWorkspaceEnv(servers[i].Env)
+				servers[i].URL = redactWorkspaceURL(servers[i].URL)
+				servers[i].Args = redactWorkspaceArgs(servers[i].Args)
+			}
+		}
+		data.MCPServers = servers
+	}
+	if ws.promptService != nil {
+		for _, platform := range []string{"claude", "codex", "gemini"} {
+			prompts, err := ws.promptService.GetPrompts(platform)
+			if err != nil {
+				return nil, fmt.Errorf("加载 %s 提示词失败: %w", platform, err)
+			}
+			if len(prompts) > 0 {
+				data.Prompts[platform] = prompts
+			}
+		}
+	}
+	if ws.skillService != nil {
+		repos, err := ws.skillService.ListRepos()
+		if err != nil {
+			return nil, fmt.Errorf("加载技能仓库失败: %w", err)
+		}
+		data.SkillRepos = repos
+	}
+	if ws.settingsService != nil {
+		settings, err := ws.settingsService.listSettings()
+		if err != nil {
+			return nil, err
+		}
+		if redact {
+			settings = redactWorkspaceSettings(settings)
+		}
+		data.Settings = settings
+	}
+	if ws.appSettingsService != nil {
+		settings, err := ws.appSettingsService.GetAppSettings()
+		if err != nil {
+			return nil, fmt.Errorf("加载应用设置失败: %w", err)
+		}
+		if redact {
+			settings.StatusPageToken = ""
+		}
+		data.AppSettings = &settings
+	}
+	return data, nil
+}
+
+func (data *workspaceData) counts() map[string]int {
+	providers := 0
+	for _, list := range data.Providers {
+		providers += len(list)
+	}
+	prompts := 0
+	for _, list := range data.Prompts {
+		prompts += len(list)
+	}
+	counts := map[string]int{
+		WorkspaceSectionProviders:   providers,
+		WorkspaceSectionGemini:      len(data.Gemini),
+		WorkspaceSectionMCP:         len(data.MCPServers),
+		WorkspaceSectionPrompts:     prompts,
+		WorkspaceSectionSkillRepos:  len(data.SkillRepos),
+		WorkspaceSectionCustomTools: len(data.CustomTools),
+		WorkspaceSectionSettings:    len(data.Settings),
+	}
+	if data.AppSettings != nil {
+		counts[WorkspaceSectionAppSettings] = 1
+	}
+	return counts
+}
+
+// isSensitiveEnvKey 判断环境变量是否可能存放密钥
+func isSensitiveEnvKey(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range []string{"KEY", "TOKEN", "SECRET", "PASSWORD"} {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactWorkspaceEnv 返回清空了密钥类变量的副本
+func redactWorkspaceEnv(env map[string]string) map[string]string {
+	if len(env) == 0 {
+		return env
+	}
+	redacted := make(map[string]string, len(env))
+	for key, value := range env {
+		if isSensitiveEnvKey(key) {
+			value = ""
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// redactWorkspaceURL 移除 URL 中的用户信息密码与密钥类查询参数；非 URL 原样返回
+func redactWorkspaceURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return raw
+	}
+	if _, hasPassword := parsed.User.Password(); hasPassword {
+		parsed.User = url.UserPassword(parsed.User.Username(), "")
+	}
+	if parsed.RawQuery != "" {
+		query := parsed.Query()
+		changed := false
+		for key := range query {
+			if isSensitiveEnvKey(key) {
+				query.Set(key, "")
+				changed = true
+			}
+		}
+		if changed {
+			parsed.RawQuery = query.Encode()
+		}
+	}
+	return parsed.String()
+}
+
+// redactWorkspaceArgs 清空命令行参数中的密钥：--api-key=xxx、--token xxx、KEY=xxx、Bearer xxx 以及 URL 中的密钥
+func redactWorkspaceArgs(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	redacted := make([]string, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, _, hasValue := strings.Cut(arg, "=")
+		flag := strings.HasPrefix(arg, "-")
+		switch {
+		case strings.Contains(arg, "://"):
+			redacted[i] = redactWorkspaceURL(arg)
+		case hasValue && isSensitiveEnvKey(name):
+			redacted[i] = name + "="
+		case flag && isSensitiveEnvKey(arg) && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-"):
+			// 密钥作为下一个参数传入
+			redacted[i] = arg
+			redacted[i+1] = ""
+			i++
+		case strings.HasPrefix(strings.ToLower(arg), "bearer "):
+			redacted[i] = arg[:len("bearer ")]
+		default:
+			redacted[i] = redactWorkspaceHeader(arg)
+		}
+	}
+	return redacted
+}
+
+// redactWorkspaceHeader 清空 "Authorization: xxx" 形式的请求头参数
+func redactWorkspaceHeader(arg string) string {
+	name, _, ok := strings.Cut(arg, ":")
+	if ok && !strings.Contains(name, "/") && (strings.EqualFold(strings.TrimSpace(name), "authorization") || isSensitiveEnvKey(name)) {
+		return name + ":"
+	}
+	return arg
+}
+
+// redactWorkspaceSettingsConfig 递归清空 settings.json 中密钥类字段（键名判断）与 URL 中的密钥
+func redactWorkspaceSettingsConfig(config map[string]any) map[string]any {
+	if len(config) == 0 {
+		return config
+	}
+	redacted, _ := redactWorkspaceConfigValue("", config).(map[string]any)
+	return redacted
+}
+
+func redactWorkspaceConfigValue(key string, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for childKey, child := range v {
+			redacted[childKey] = redactWorkspaceConfigValue(childKey, child)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, child := range v {
+			redacted[i] = redactWorkspaceConfigValue(key, child)
+		}
+		return redacted
+	case string:
+		if key != "" && isSensitiveEnvKey(key) {
+			return ""
+		}
+		return redactWorkspaceURL(v)
+	default:
+		return value
+	}
+}
+
+// redactWorkspaceSettings 脱敏 app_settings 原始键值（值可能是令牌或带密钥的 webhook 地址）
+func redactWorkspaceSettings(settings map[string]string) map[string]string {
+	redacted := make(map[string]string, len(settings))
+	for key, value := range settings {
+		if isSensitiveEnvKey(key) {
+			value = ""
+		}
+		redacted[key] = redactWorkspaceURL(value)
+	}
+	return redacted
+}
+
+// readWorkspaceBundle 读取并校验导出包，加密包需提供口令
+func readWorkspaceBundle(path, passphrase string) (*WorkspaceManifest, *workspaceData, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开导出包失败: %w", err)
+	}
+	defer reader.Close()
+
+	entries := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		entries[file.Name] = file
+	}
+	readEntry := func(name string) ([]byte, error) {
+		file, ok := entries[name]
+		if !ok {
+			return nil, fmt.Errorf("导出包缺少 %s", name)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, workspaceBundleMaxEntrySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", name, err)
+		}
+		if len(data) > workspaceBundleMaxEntrySize {
+			return nil, fmt.Errorf("导出包条目 %s 超过 %d MB", name, workspaceBundleMaxEntrySize>>20)
+		}
+		return data, nil
+	}
+
+	raw, err := readEntry(workspaceManifestEntry)
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest WorkspaceManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("解析清单失败: %w", err)
+	}
+	if manifest.Format != workspaceBundleFormat {
+		return nil, nil, fmt.Errorf("不是 Code Switch 工作区导出包")
+	}
+	if manifest.Version > workspaceBundleVersion {
+		return nil, nil, fmt.Errorf("导出包版本 %d 高于当前支持的版本 %d，请先升级应用", manifest.Version, workspaceBundleVersion)
+	}
+
+	var payload []byte
+	if manifest.Encrypted {
+		if passphrase == "" {
+			return nil, nil, fmt.Errorf("导出包已加密，请输入口令")
+		}
+		sealedRaw, err := readEntry(workspaceSealedEntry)
+		if err != nil {
+			return nil, nil, err
+		}
+		var sealed sealedSecret
+		if err := json.Unmarshal(sealedRaw, &sealed); err != nil {
+			return nil, nil, fmt.Errorf("解析加密内容失败: %w", err)
+		}
+		salt, err := base64.StdEncoding.DecodeString(manifest.Salt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("解析清单失败: %w", err)
+		}
+		if err := checkVaultKDFIterations(manifest.Iterations); err != nil {
+			return nil, nil, err
+		}
+		key, err := deriveVaultKey(passphrase, salt, manifest.Iterations)
+		if err != nil {
+			return nil, nil, err
+		}
+		aead, err := newVaultAEAD(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		plain, err := openVaultValue(aead, workspaceSealedID, sealed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("口令错误或导出包已损坏")
+		}
+		payload = []byte(plain)
+	} else if payload, err = readEntry(workspaceDataEntry); err != nil {
+		return nil, nil, err
+	}
+
+	var data workspaceData
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, nil, fmt.Errorf("解析工作区内容失败: %w", err)
+	}
+	return &manifest, &data, nil
+}
+
+// workspaceEntry 导入计划中的条目；incoming 已按本地配置对齐 ID 并补回未携带的密钥
+type workspaceEntry struct {
+	WorkspaceImportItem
+	found    bool
+	existing interface{}
+	incoming interface{}
+	strategy string
+}
+
+func newWorkspaceEntry(section, group, name string, found bool, existing, incoming interface{}) workspaceEntry {
+	key := section + "/" + name
+	if group != "" {
+		key = section + "/" + group + "/" + name
+	}
+	entry := workspaceEntry{
+		WorkspaceImportItem: WorkspaceImportItem{
+			Key:     key,
+			Section: section,
+			Group:   group,
+			Name:    name,
+			Status:  WorkspaceItemNew,
+		},
+		found:    found,
+		existing: existing,
+		incoming: incoming,
+	}
+	if found {
+		entry.Changed = changedConfigFields(existing, incoming)
+		entry.Status = WorkspaceItemConflict
+		if len(entry.Changed) == 0 {
+			entry.Status = WorkspaceItemIdentical
+		}
+	}
+	return entry
+}
+
+// planWorkspaceImport 将导出内容与本地配置逐项比对
+func (ws *WorkspaceService) planWorkspaceImport(data *workspaceData) ([]workspaceEntry, error) {
+	var entries []workspaceEntry
+
+	if ws.settingsService != nil && len(data.Settings) > 0 {
+		local, err := ws.settingsService.listSettings()
+		if err != nil {
+			return nil, err
+		}
+		incoming := make(map[string]string, len(local)+len(data.Settings))
+		for key, value := range local {
+			incoming[key] = value
+		}
+		for key, value := range data.Settings {
+			if !workspaceInternalSettings[key] {
+				incoming[key] = restoreRedactedString(local[key], value, func(v string) string {
+					return redactWorkspaceSettings(map[string]string{key: v})[key]
+				})
+			}
+		}
+		entries = append(entries, newWorkspaceEntry(WorkspaceSectionSettings, "", "settings", true, local, incoming))
+	}
+	if ws.appSettingsService != nil && data.AppSettings != nil {
+		local, err := ws.appSettingsService.GetAppSettings()
+		if err != nil {
+			return nil, fmt.Errorf("加载应用设置失败: %w", err)
+		}
+		incoming := *data.AppSettings
+		if incoming.StatusPageToken == "" {
+			incoming.StatusPageToken = local.StatusPageToken
+		}
+		entries = append(entries, newWorkspaceEntry(WorkspaceSectionAppSettings, "", "appSettings", true, local, incoming))
+	}
+
+	var localTools []CustomCliTool
+	if ws.customCliService != nil {
+		tools, err := ws.customCliService.ListTools()
+		if err != nil {
+			return nil, fmt.Errorf("加载自定义 CLI 工具失败: %w", err)
+		}
+		localTools = tools
+		for _, tool := range data.CustomTools {
+			local, found := findCustomTool(localTools, tool)
+			incoming := tool
+			if found {
+				incoming.ID = local.ID
+			}
+			entries = append(entries, newWorkspaceEntry(WorkspaceSectionCustomTools, "", tool.Name, found, local, incoming))
+		}
+	}
+
+	if ws.providerService != nil {
+		kinds := make([]string, 0, len(data.Providers))
+		for kind := range data.Providers {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			localKind := localProviderKind(kind, data.CustomTools, localTools)
+			var local []Provider
+			if localKind != "" {
+				providers, err := ws.providerService.LoadProviders(localKind)
+				if err != nil {
+					return nil, fmt.Errorf("加载 %s 供应商失败: %w", localKind, err)
+				}
+				local = providers
+			}
+			for _, p := range data.Providers[kind] {
+				existing, found := findProviderByName(local, p.Name)
+				incoming := p
+				incoming.UID = ""
+				if found {
+					incoming.ID, incoming.Name, incoming.UID = existing.ID, existing.Name, existing.UID
+					if incoming.APIKey == "" {
+						incoming.APIKey = existing.APIKey
+					}
+					incoming.APIURL = restoreRedactedString(existing.APIURL, incoming.APIURL, redactWorkspaceURL)
+				}
+				entries = append(entries, newWorkspaceEntry(WorkspaceSectionProviders, kind, p.Name, found, existing, incoming))
+			}
+		}
+	}
+
+	if ws.geminiService != nil {
+		local := ws.geminiService.GetProviders()
+		for _, p := range data.Gemini {
+			var existing GeminiProvider
+			found := false
+			for _, candidate := range local {
+				if strings.EqualFold(candidate.Name, p.Name) {
+					existing, found = candidate, true
+					break
+				}
+			}
+			incoming := p
+			incoming.UID = ""
+			if found {
+				incoming.ID, incoming.Name, incoming.UID = existing.ID, existing.Name, existing.UID
+				if incoming.APIKey == "" {
+					incoming.APIKey = existing.APIKey
+				}
+				incoming.EnvConfig = restoreWorkspaceEnv(existing.EnvConfig, incoming.EnvConfig)
+				incoming.BaseURL = restoreRedactedString(existing.BaseURL, incoming.BaseURL, redactWorkspaceURL)
+				if reflect.DeepEqual(configFieldMap(redactWorkspaceSettingsConfig(existing.SettingsConfig)), configFieldMap(incoming.SettingsConfig)) {
+					incoming.SettingsConfig = existing.SettingsConfig
+				}
+			}
+			entries = append(entries, newWorkspaceEntry(WorkspaceSectionGemini, "", p.Name, found, existing, incoming))
+		}
+	}
+
+	if ws.mcpService != nil && len(data.MCPServers) > 0 {
+		local, err := ws.mcpService.ListServers()
+		if err != nil {
+			return nil, fmt.Errorf("加载 MCP 服务器失败: %w", err)
+		}
+		for _, server := range data.MCPServers {
+			var existing MCPServer
+			found := false
+			for _, candidate := range local {
+				if normalizeName(candidate.Name) == normalizeName(server.Name) {
+					existing, found = candidate, true
+					break
+				}
+			}
+			incoming := server
+			if found {
+				incoming.Name = existing.Name
+				incoming.Env = restoreWorkspaceEnv(existing.Env, incoming.Env)
+				incoming.URL = restoreRedactedString(existing.URL, incoming.URL, redactWorkspaceURL)
+				if slices.Equal(redactWorkspaceArgs(existing.Args), incoming.Args) {
+					incoming.Args = existing.Args
+				}
+			}
+			entries = append(entries, newWorkspaceEntry(WorkspaceSectionMCP, "", server.Name, found, existing, incoming))
+		}
+	}
+
+	if ws.promptService != nil {
+		platforms := make([]string, 0, len(data.Prompts))
+		for platform := range data.Prompts {
+			platforms = append(platforms, platform)
+		}
+		sort.Strings(platforms)
+		for _, platform := range platforms {
+			local, err := ws.promptService.GetPrompts(platform)
+			if err != nil {
+				return nil, err
+			}
+			ids := make([]string, 0, len(data.Prompts[platform]))
+			for id := range data.Prompts[platform] {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				// 启用状态与时间戳属于本机状态，不参与比较；导入的提示词不会自动写入 CLI 配置文件
+				incoming := data.Prompts[platform][id]
+				incoming.ID = id
+				incoming.Enabled, incoming.CreatedAt, incoming.UpdatedAt = false, nil, nil
+				existing, found := local[id]
+				if found {
+					incoming.Enabled, incoming.CreatedAt, incoming.UpdatedAt = existing.Enabled, existing.CreatedAt, existing.UpdatedAt
+				}
+				entries = append(entries, newWorkspaceEntry(WorkspaceSectionPrompts, platform, id, found, existing, incoming))
+			}
+		}
+	}
+
+	if ws.skillService != nil && len(data.SkillRepos) > 0 {
+		local, err := ws.skillService.ListRepos()
+		if err != nil {
+			return nil, fmt.Errorf("加载技能仓库失败: %w", err)
+		}
+		for _, repo := range data.SkillRepos {
+			repo = normalizeRepoConfig(repo)
+			var existing skillRepoConfig
+			found := false
+			for _, candidate := range local {
+				if equalRepo(candidate, repo) {
+					existing, found = candidate, true
+					break
+				}
+			}
+			entries = append(entries, newWorkspaceEntry(WorkspaceSectionSkillRepos, "", repo.Owner+"/"+repo.Name, found, existing, repo))
+		}
+	}
+	return entries, nil
+}
+
+// applyWorkspaceImport 按分区写入选中的条目：自定义工具先于供应商，以便建立工具 ID 映射
+func (ws *WorkspaceService) applyWorkspaceImport(data *workspaceData, entries []workspaceEntry, result *WorkspaceImportResult) {
+	fail := func(entry workspaceEntry, err error) {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", entry.Key, err))
+	}
+	bySection := make(map[string][]workspaceEntry)
+	for _, entry := range entries {
+		bySection[entry.Section] = append(bySection[entry.Section], entry)
+	}
+
+	for _, entry := range bySection[WorkspaceSectionSettings] {
+		values := entry.incoming.(map[string]string)
+		if entry.strategy == WorkspaceStrategyMerge {
+			values = mergeWorkspaceValue(entry.existing.(map[string]string), values)
+		}
+		if err := ws.settingsService.applySettings(values); err != nil {
+			fail(entry, err)
+			continue
+		}
+		result.Imported++
+	}
+	for _, entry := range bySection[WorkspaceSectionAppSettings] {
+		settings := resolveWorkspaceValue(entry, entry.existing.(AppSettings), entry.incoming.(AppSettings))
+		if _, err := ws.appSettingsService.SaveAppSettings(settings); err != nil {
+			fail(entry, err)
+			continue
+		}
+		result.Imported++
+	}
+
+	// 导出端工具 ID -> 本地工具 ID
+	toolIDs := make(map[string]string)
+	if ws.customCliService != nil {
+		localTools, _ := ws.customCliService.ListTools()
+		for _, tool := range data.CustomTools {
+			if local, ok := findCustomTool(localTools, tool); ok {
+				toolIDs[tool.ID] = local.ID
+			}
+		}
+	}
+	for _, entry := range bySection[WorkspaceSectionCustomTools] {
+		incoming := entry.incoming.(CustomCliTool)
+		if !entry.found {
+			bundleID := incoming.ID
+			created, err := ws.customCliService.createTool(incoming, bundleID)
+			if err != nil {
+				fail(entry, err)
+				continue
+			}
+			toolIDs[bundleID] = created.ID
+			result.Imported++
+			continue
+		}
+		existing := entry.existing.(CustomCliTool)
+		if err := ws.customCliService.UpdateTool(existing.ID, resolveWorkspaceValue(entry, existing, incoming)); err != nil {
+			fail(entry, err)
+			continue
+		}
+		result.Imported++
+	}
+
+	providerGroups := make(map[string][]workspaceEntry)
+	for _, entry := range bySection[WorkspaceSectionProviders] {
+		providerGroups[entry.Group] = append(providerGroups[entry.Group], entry)
+	}
+	for kind, group := range providerGroups {
+		localKind := kind
+		if strings.HasPrefix(kind, "custom:") {
+			toolID, ok := toolIDs[strings.TrimPrefix(kind, "custom:")]
+			if !ok {
+				for _, entry := range group {
+					fail(entry, fmt.Errorf("所属自定义 CLI 工具未导入"))
+				}
+				continue
+			}
+			localKind = "custom:" + toolID
+		}
+		providers, err := ws.providerService.LoadProviders(localKind)
+		if err != nil {
+			for _, entry := range group {
+				fail(entry, err)
+			}
+			continue
+		}
+		for _, entry := range group {
+			incoming := entry.incoming.(Provider)
+			if !entry.found {
+				incoming.ID = nextProviderID(providers)
+				providers = append(providers, incoming)
+				continue
+			}
+			existing := entry.existing.(Provider)
+			for i := range providers {
+				if providers[i].ID == existing.ID {
+					providers[i] = resolveWorkspaceValue(entry, existing, incoming)
+				}
+			}
+		}
+		if err := ws.providerService.SaveProviders(localKind, providers); err != nil {
+			for _, entry := range group {
+				fail(entry, err)
+			}
+			continue
+		}
+		result.Imported += len(group)
+	}
+
+	for _, entry := range bySection[WorkspaceSectionGemini] {
+		incoming := entry.incoming.(GeminiProvider)
+		var err error
+		if entry.found {
+			err = ws.geminiService.UpdateProvider(resolveWorkspaceValue(entry, entry.existing.(GeminiProvider), incoming))
+		} else {
+			for _, local := range ws.geminiService.GetProviders() {
+				if local.ID == incoming.ID {
+					incoming.ID = fmt.Sprintf("%s-%d", incoming.ID, time.Now().UnixNano())
+					break
+				}
+			}
+			err = ws.geminiService.AddProvider(incoming)
+		}
+		if err != nil {
+			fail(entry, err)
+			continue
+		}
+		result.Imported++
+	}
+
+	if mcpEntries := bySection[WorkspaceSectionMCP]; len(mcpEntries) > 0 {
+		servers, err := ws.mcpService.ListServers()
+		if err == nil {
+			for _, entry := range mcpEntries {
+				incoming := entry.incoming.(MCPServer)
+				if !entry.found {
+					servers = append(servers, incoming)
+					continue
+				}
+				for i := range servers {
+					if servers[i].Name == entry.existing.(MCPServer).Name {
+						servers[i] = resolveWorkspaceValue(entry, servers[i], incoming)
+					}
+				}
+			}
+			err = ws.mcpService.SaveServers(servers)
+		}
+		for _, entry := range mcpEntries {
+			if err != nil {
+				fail(entry, err)
+			} else {
+				result.Imported++
+			}
+		}
+	}
+
+	for _, entry := range bySection[WorkspaceSectionPrompts] {
+		prompt := entry.incoming.(Prompt)
+		if entry.found {
+			prompt = resolveWorkspaceValue(entry, entry.existing.(Prompt), prompt)
+		}
+		if err := ws.promptService.UpsertPrompt(entry.Group, prompt.ID, prompt); err != nil {
+			fail(entry, err)
+			continue
+		}
+		result.Imported++
+	}
+
+	for _, entry := range bySection[WorkspaceSectionSkillRepos] {
+		repo := entry.incoming.(skillRepoConfig)
+		if entry.found {
+			repo = resolveWorkspaceValue(entry, entry.existing.(skillRepoConfig), repo)
+		}
+		if _, err := ws.skillService.AddRepo(repo); err != nil {
+			fail(entry, err)
+			continue
+		}
+		result.Imported++
+	}
+}
+
+// resolveWorkspaceValue 按条目策略得到最终写入的值
+func resolveWorkspaceValue[T any](entry workspaceEntry, existing, incoming T) T {
+	if entry.strategy == WorkspaceStrategyMerge {
+		return mergeWorkspaceValue(existing, incoming)
+	}
+	return incoming
+}
+
+// mergeWorkspaceValue 以 JSON 字段为单位合并：incoming 中的非空字段覆盖 existing
+func mergeWorkspaceValue[T any](existing, incoming T) T {
+	fields := configFieldMap(existing)
+	for key, value := range configFieldMap(incoming) {
+		if !isEmptyWorkspaceValue(value) {
+			fields[key] = value
+		}
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return incoming
+	}
+	var merged T
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		return incoming
+	}
+	return merged
+}
+
+// isEmptyWorkspaceValue 判断导入字段是否视为“未提供”
+// 零值布尔/数字字段若带 omitempty 不会出现在 JSON 中；出现时就是显式的值（如 enabled=false），需要覆盖本地
+func isEmptyWorkspaceValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// restoreWorkspaceEnv 脱敏导出的环境变量为空时使用本地值
+func restoreWorkspaceEnv(local, incoming map[string]string) map[string]string {
+	if len(incoming) == 0 {
+		return incoming
+	}
+	restored := make(map[string]string, len(incoming))
+	for key, value := range incoming {
+		if value == "" && local[key] != "" {
+			value = local[key]
+		}
+		restored[key] = value
+	}
+	return restored
+}
+
+// restoreRedactedString 导入值正是本地值脱敏后的结果时沿用本地值
+func restoreRedactedString(local, incoming string, redact func(string) string) string {
+	if local != "" && incoming != local && redact(local) == incoming {
+		return local
+	}
+	return incoming
+}
+
+// localProviderKind 返回导出端存储类型对应的本地类型；自定义工具按名称匹配，本地不存在时返回空
+func localProviderKind(kind string, bundleTools, localTools []CustomCliTool) string {
+	bundleID, isCustom := strings.CutPrefix(kind, "custom:")
+	if !isCustom {
+		return kind
+	}
+	for _, tool := range bundleTools {
+		if tool.ID != bundleID {
+			continue
+		}
+		if local, ok := findCustomTool(localTools, tool); ok {
+			return "custom:" + local.ID
+		}
+	}
+	return ""
+}
+
+// findCustomTool 查找对应的本地工具：优先按工具 ID（导入或同步创建的工具沿用原 ID），其次按名称
+func findCustomTool(tools []CustomCliTool, target CustomCliTool) (CustomCliTool, bool) {
+	for _, tool := range tools {
+		if target.ID != "" && tool.ID == target.ID {
+			return tool, true
+		}
+	}
+	return findCustomToolByName(tools, target.Name)
+}
+
+func findCustomToolByName(tools []CustomCliTool, name string) (CustomCliTool, bool) {
+	for _, tool := range tools {
+		if strings.EqualFold(strings.TrimSpace(tool.Name), strings.TrimSpace(name)) {
+			return tool, true
+		}
+	}
+	return CustomCliTool{}, false
+}
+
+func findProviderByName(providers []Provider, name string) (Provider, bool) {
+	for _, p := range providers {
+		if strings.EqualFold(strings.TrimSpace(p.Name), strings.TrimSpace(name)) {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
+
+// listSettings 读取 app_settings 中的用户配置（不含本机状态标记）
+func (ss *SettingsService) listSettings() (map[string]string, error) {
+	db, err := xdb.DB("default")
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	rows, err := db.Query(`SELECT key, COALESCE(value, '') FROM app_settings`)
+	if err != nil {
+		return nil, fmt.Errorf("读取设置失败: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("读取设置失败: %w", err)
+		}
+		if !workspaceInternalSettings[key] {
+			settings[key] = value
+		}
+	}
+	return settings, rows.Err()
+}
+
+// applySettings 批量写入 app_settings（跳过本机状态标记）
+func (ss *SettingsService) applySettings(settings map[string]string) error {
+	defer ss.invalidateBlacklistLevelConfig()
+	for key, value := range settings {
+		if workspaceInternalSettings[key] {
+			continue
+		}
+		err := GlobalDBQueue.Exec(`
+			INSERT INTO app_settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value
+		`, key, value)
+		if err != nil {
+			return fmt.Errorf("设置 %s 失败: %w", key, err)
+		}
+	}
+	return nil
+}